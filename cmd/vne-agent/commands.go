@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const defaultHistoryDir = "runs"
+
+// command is one vne-agent subcommand. run gets the arguments after the
+// command name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "Run the diagnostics and write a report", runCommand},
+		{"serve", "Start the web UI", serveCommand},
+		{"history", "List, show or remove saved runs", historyCommand},
+		{"diff", "Compare two saved runs", diffCommand},
+		{"export", "Write a saved run as HTML, JSON or an evidence bundle", exportCommand},
+		{"replay", "Re-evaluate the findings rules against a saved run", replayCommand},
+		{"reflector", "Serve the far end of the load and voice quality tests", reflectorCommand},
+		{"config", "Show the merged configuration", func(args []string) int {
+			return runConfigCommand(args, os.Stdout, os.Stderr)
+		}},
+	}
+}
+
+// dispatch picks the subcommand named by args[0]. Anything else, including
+// no arguments at all, goes to the pre-subcommand flag interface.
+func dispatch(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && !isHelpArg(args[0]) {
+		return legacyCommand(args)
+	}
+	if isHelpArg(args[0]) || args[0] == "help" {
+		usage(os.Stdout)
+		return 0
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "vne-agent: unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return 2
+}
+
+func isHelpArg(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: vne-agent <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s  %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "vne-agent <command> -h" for a command's flags.`)
+	fmt.Fprintln(w, `Flags without a command (e.g. "vne-agent --target 8.8.8.8") keep working as before.`)
+}
+
+// newFlagSet returns a flag set whose usage prints the synopsis and summary
+// before the flags.
+func newFlagSet(name, synopsis, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: vne-agent %s\n\n%s\n\nFlags:\n", synopsis, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses fs from args, allowing flags after positional arguments,
+// and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runCommand(args []string) int {
+	fs := newFlagSet("run", "run [flags]",
+		"Runs the diagnostics, writes the HTML report and saves the results to the run history.\n"+
+			"Settings come from flags, then environment, then the config file profile, then defaults.")
+	var cli cliFlags
+	var rf runFlags
+	cli.register(fs)
+	rf.register(fs, false)
+	if rest := parseArgs(fs, normalizeSNMPArgs(args)); len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "run: unexpected argument %q\n", rest[0])
+		return 2
+	}
+	return runReport(fs, &cli, rf, false)
+}
+
+func serveCommand(args []string) int {
+	fs := newFlagSet("serve", "serve [flags]",
+		"Starts the web UI. Runs started from the browser use the merged config for probe settings.")
+	var cli cliFlags
+	cli.register(fs)
+	addr := fs.String("addr", "127.0.0.1:8080", "Address for the web UI to listen on")
+	if rest := parseArgs(fs, normalizeSNMPArgs(args)); len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "serve: unexpected argument %q\n", rest[0])
+		return 2
+	}
+	return serveUI(fs, &cli, *addr)
+}
+
+// legacyCommand accepts the flags vne-agent took before it had subcommands:
+// --web starts the web UI and anything else runs the diagnostics, prompting
+// unless --target, --out or --skip-python was given.
+func legacyCommand(args []string) int {
+	fs := flag.NewFlagSet("vne-agent", flag.ExitOnError)
+	fs.Usage = func() {
+		usage(fs.Output())
+		fmt.Fprintln(fs.Output(), "\nFlags without a command:")
+		fs.PrintDefaults()
+	}
+	var cli cliFlags
+	var rf runFlags
+	cli.register(fs)
+	rf.register(fs, true)
+	web := fs.Bool("web", false, "Run embedded web UI on 127.0.0.1:8080 (same as \"vne-agent serve\")")
+	fs.Parse(normalizeSNMPArgs(args))
+	if *web {
+		return serveUI(fs, &cli, "127.0.0.1:8080")
+	}
+	return runReport(fs, &cli, rf, true)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runConfigCommand handles "vne-agent config ...". It returns the process
+// exit code.
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(stderr, "usage: vne-agent config show [--config path] [--profile name] [--show-secrets] [run flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var cli cliFlags
+	cli.register(fs)
+	showSecrets := fs.Bool("show-secrets", false, "Print passwords, secrets and SNMP communities instead of masking them")
+	if err := fs.Parse(normalizeSNMPArgs(args[1:])); err != nil {
+		return 2
+	}
+
+	loaded, flagErr, err := cli.load(fs)
+	if err != nil {
+		fmt.Fprintln(stderr, "config:", err)
+		return 1
+	}
+	if flagErr != nil {
+		fmt.Fprintln(stderr, "config:", flagErr)
+		return 1
+	}
+	if _, err := loaded.RuleSet(); err != nil {
+		fmt.Fprintln(stderr, "config: rules:", err)
+		return 1
+	}
+
+	cfg := loaded.Config
+	if !*showSecrets {
+		cfg = cfg.Redacted()
+	}
+	out, err := cfg.YAML()
+	if err != nil {
+		fmt.Fprintln(stderr, "config:", err)
+		return 1
+	}
+
+	source := loaded.Path
+	if source == "" {
+		source = "none (built-in defaults)"
+	}
+	fmt.Fprintf(stdout, "# config file: %s\n", source)
+	if loaded.Profile != "" {
+		fmt.Fprintf(stdout, "# profile: %s\n", loaded.Profile)
+	}
+	if len(loaded.Profiles) > 0 {
+		fmt.Fprintf(stdout, "# profiles defined: %s\n", strings.Join(loaded.Profiles, ", "))
+	}
+	if _, err := stdout.Write(out); err != nil {
+		fmt.Fprintln(stderr, "config:", err)
+		return 1
+	}
+	return 0
+}
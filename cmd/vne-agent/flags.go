@@ -0,0 +1,331 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cneate93/vne/internal/config"
+)
+
+// cliFlags holds the command-line flags. Settings that also live in the
+// config file only override it when given explicitly; see apply.
+type cliFlags struct {
+	configPath    string
+	profile       string
+	target        string
+	targets       string
+	target6       string
+	out           string
+	skipPython    bool
+	python        string
+	autoPacks     bool
+	scan          bool
+	scanTimeout   time.Duration
+	scanMaxHosts  int
+	scanCIDRLimit int
+	fortiHost     string
+	fortiUser     string
+	fortiPass     string
+	ciscoHost     string
+	ciscoUser     string
+	ciscoPass     string
+	ciscoSecret   string
+	ciscoPort     int
+	verbose       bool
+	bundle        bool
+	json          string
+	count         int
+	timeout       time.Duration
+	dnsNames      string
+	resolvers     string
+	apps          string
+	loadEndpoint  string
+	loadDuration  time.Duration
+	loadStreams   int
+	voiceEndpoint string
+	voiceDuration time.Duration
+	voiceRate     int
+	voiceSize     int
+	lldpWindow    time.Duration
+	dhcpWindow    time.Duration
+	probes        string
+	skipProbes    string
+	pathCycles    int
+	rules         string
+	workers       int
+	snmp          string
+}
+
+func (f *cliFlags) register(fs *flag.FlagSet) {
+	def := config.Default()
+	fs.StringVar(&f.configPath, "config", "", "Config file (default ./vne.yaml, then vne/config.yaml in the user config directory)")
+	fs.StringVar(&f.profile, "profile", "", "Named profile from the config file to apply, e.g. \"branch-office\"")
+	fs.StringVar(&f.target, "target", "", "Target for WAN checks (default 1.1.1.1)")
+	fs.StringVar(&f.targets, "targets", "", "Comma-separated named WAN targets, e.g. \"saas=app.example.com,vpn=vpn.example.net,anycast=1.1.1.1\"")
+	fs.StringVar(&f.target6, "target6", "", "IPv6 target for the IPv6 checks when the WAN target has no IPv6 address (default 2606:4700:4700::1111)")
+	fs.StringVar(&f.out, "out", "", "Output HTML report path (default vne-report.html)")
+	fs.BoolVar(&f.skipPython, "skip-python", false, "Skip optional Python packs (FortiGate, Cisco IOS)")
+	fs.StringVar(&f.python, "python", "", "Path to python executable for optional packs")
+	fs.BoolVar(&f.autoPacks, "auto-packs", false, "Automatically run vendor-specific packs when detected")
+	fs.BoolVar(&f.scan, "scan", false, "Enable layer-2 discovery: an ARP sweep, or a ping sweep without raw socket access, then mDNS, SSDP, LLMNR and NetBIOS queries to identify the hosts (experimental)")
+	fs.DurationVar(&f.scanTimeout, "scan-timeout", def.Scan.Timeout, "Timeout per host for layer-2 discovery (default 2s)")
+	fs.IntVar(&f.scanMaxHosts, "scan-max-hosts", def.Scan.MaxHosts, "Maximum number of layer-2 hosts to probe (default 256)")
+	fs.IntVar(&f.scanCIDRLimit, "scan-cidr-limit", def.Scan.CIDRLimit, "Smallest CIDR mask to sweep (default 24)")
+	fs.StringVar(&f.fortiHost, "forti-host", "", "FortiGate host/IP for optional Python pack")
+	fs.StringVar(&f.fortiUser, "forti-user", "", "FortiGate username for optional Python pack")
+	fs.StringVar(&f.fortiPass, "forti-pass", "", "FortiGate password for optional Python pack")
+	fs.StringVar(&f.ciscoHost, "cisco-host", "", "Cisco IOS host/IP for optional Python pack")
+	fs.StringVar(&f.ciscoUser, "cisco-user", "", "Cisco IOS username for optional Python pack")
+	fs.StringVar(&f.ciscoPass, "cisco-pass", "", "Cisco IOS password for optional Python pack")
+	fs.StringVar(&f.ciscoSecret, "cisco-secret", "", "Cisco IOS enable secret for optional Python pack")
+	fs.IntVar(&f.ciscoPort, "cisco-port", def.Packs.Cisco.Port, "Cisco IOS SSH port (default 22)")
+	fs.BoolVar(&f.verbose, "verbose", false, "Enable verbose logging to vne.log")
+	fs.BoolVar(&f.bundle, "bundle", false, "Write zipped evidence bundle (vne-evidence-YYYYMMDD-HHMM.zip)")
+	fs.StringVar(&f.json, "json", "", "Write report data as indented JSON to the given path")
+	fs.IntVar(&f.count, "count", def.Count, "Number of ping attempts for each host (default 20)")
+	fs.DurationVar(&f.timeout, "timeout", def.Timeout, "Timeout for network probes (default 10s)")
+	fs.StringVar(&f.dnsNames, "dns-names", "", "Comma-separated names resolved by the DNS probe (default cloudflare.com)")
+	fs.StringVar(&f.resolvers, "resolvers", "", "Comma-separated resolvers queried one by one besides the system nameservers, e.g. \"9.9.9.9,tls://dns.quad9.net,https://dns.google/dns-query\" (default Cloudflare over UDP, TLS and HTTPS)")
+	fs.StringVar(&f.apps, "apps", "", "Comma-separated URLs or host:port pairs timed by the apps probe, e.g. \"https://app.example.com/health,db.example.com:5432\"")
+	fs.StringVar(&f.loadEndpoint, "load-endpoint", "", "Reflector for the latency-under-load test, e.g. \"http://reflector.example.net:8790\" or \"reflector.example.net:8790\" for raw TCP; see \"vne-agent reflector\"")
+	fs.DurationVar(&f.loadDuration, "load-duration", def.Load.Duration, "How long the latency-under-load test loads each direction (default 8s)")
+	fs.IntVar(&f.loadStreams, "load-streams", def.Load.Streams, "Parallel connections used to load the link (default 4)")
+	fs.StringVar(&f.voiceEndpoint, "voice-endpoint", "", "Reflector host:port for the voice/video quality stream (default the --load-endpoint reflector)")
+	fs.DurationVar(&f.voiceDuration, "voice-duration", def.Voice.Duration, "How long the voice/video quality stream runs (default 10s)")
+	fs.IntVar(&f.voiceRate, "voice-rate", def.Voice.Rate, "Packets a second in the voice/video quality stream (default 50)")
+	fs.IntVar(&f.voiceSize, "voice-size", def.Voice.Size, "UDP payload bytes per packet in the voice/video quality stream (default 172)")
+	fs.DurationVar(&f.lldpWindow, "lldp-window", def.LLDP.Window, "Longest time to listen for the switch's LLDP/CDP announcements on the wired interface (default 1m0s)")
+	fs.DurationVar(&f.dhcpWindow, "dhcp-window", def.DHCP.Window, "How long to collect DHCP offers after the DHCPDISCOVER (default 3s)")
+	fs.StringVar(&f.probes, "probes", "", "Comma-separated probes to run (default all), e.g. \"netinfo,gateway,wan\"")
+	fs.StringVar(&f.skipProbes, "skip-probes", "", "Comma-separated probes to skip, e.g. \"traceroute,path\"")
+	fs.IntVar(&f.pathCycles, "path-cycles", def.PathCycles, "Probe cycles for per-hop path analysis; 0 disables it (default 10)")
+	fs.StringVar(&f.rules, "rules", "", "YAML or JSON rule file merged over the built-in findings rules")
+	fs.IntVar(&f.workers, "workers", def.Workers, "Maximum number of probes run at the same time; 1 runs them one by one (default 4)")
+	fs.StringVar(&f.snmp, "snmp", "", "SNMP interface query parameters, e.g. \"host=1.2.3.4 community=public if=Gig0/1\"")
+}
+
+// runFlags are the run command's flags that only affect this invocation.
+type runFlags struct {
+	interactive bool
+	serve       bool
+	open        bool
+	noHistory   bool
+	historyDir  string
+}
+
+// register adds the run flags to fs. The legacy flag set only knows --serve
+// and --open; it never saves to history and decides on prompting itself.
+func (f *runFlags) register(fs *flag.FlagSet, legacy bool) {
+	fs.BoolVar(&f.serve, "serve", false, "Serve the generated report over HTTP on :8080")
+	fs.BoolVar(&f.open, "open", false, "Open the generated report after creation")
+	if legacy {
+		f.noHistory = true
+		return
+	}
+	fs.BoolVar(&f.interactive, "interactive", false, "Prompt for a problem description, the WAN target and vendor pack credentials")
+	fs.BoolVar(&f.interactive, "i", false, "Shorthand for --interactive")
+	fs.BoolVar(&f.noHistory, "no-history", false, "Do not save the results to the run history")
+	fs.StringVar(&f.historyDir, "history-dir", defaultHistoryDir, "Directory holding saved runs")
+}
+
+// load reads the config file and profile named by the flags (or by
+// VNE_CONFIG and VNE_PROFILE) and applies the explicitly set flags on top,
+// giving flag > env > profile > file > defaults. A bad --snmp or --targets
+// value is reported in flagErr and the flag ignored.
+func (f *cliFlags) load(fs *flag.FlagSet) (loaded config.Loaded, flagErr error, err error) {
+	path := f.configPath
+	if !isFlagSet(fs, "config") {
+		path = os.Getenv("VNE_CONFIG")
+	}
+	profile := f.profile
+	if !isFlagSet(fs, "profile") {
+		profile = os.Getenv("VNE_PROFILE")
+	}
+	loaded, err = config.Load(path, profile)
+	if err != nil {
+		return loaded, nil, err
+	}
+	flagErr = f.apply(fs, &loaded.Config)
+	return loaded, flagErr, nil
+}
+
+// apply copies the flags given on the command line into cfg.
+func (f *cliFlags) apply(fs *flag.FlagSet, cfg *config.Config) error {
+	var flagErr error
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "target":
+			if t := strings.TrimSpace(f.target); t != "" {
+				cfg.Target = t
+				cfg.Targets = nil
+			}
+		case "targets":
+			targets, err := config.ParseTargets(f.targets)
+			if err != nil {
+				flagErr = fmt.Errorf("--targets: %w", err)
+				return
+			}
+			cfg.Targets = targets
+		case "target6":
+			cfg.Target6 = strings.TrimSpace(f.target6)
+		case "out":
+			if o := strings.TrimSpace(f.out); o != "" {
+				cfg.Output.HTML = o
+			}
+		case "json":
+			cfg.Output.JSON = strings.TrimSpace(f.json)
+		case "bundle":
+			cfg.Output.Bundle = f.bundle
+		case "verbose":
+			cfg.Output.Verbose = f.verbose
+		case "skip-python":
+			cfg.Packs.SkipPython = f.skipPython
+		case "auto-packs":
+			cfg.Packs.Auto = f.autoPacks
+		case "python":
+			cfg.Packs.Python = strings.TrimSpace(f.python)
+		case "scan":
+			cfg.Scan.Enabled = f.scan
+		case "scan-timeout":
+			cfg.Scan.Timeout = f.scanTimeout
+		case "scan-max-hosts":
+			cfg.Scan.MaxHosts = f.scanMaxHosts
+		case "scan-cidr-limit":
+			cfg.Scan.CIDRLimit = f.scanCIDRLimit
+		case "forti-host":
+			cfg.Packs.FortiGate.Host = strings.TrimSpace(f.fortiHost)
+		case "forti-user":
+			cfg.Packs.FortiGate.User = strings.TrimSpace(f.fortiUser)
+		case "forti-pass":
+			cfg.Packs.FortiGate.Pass = strings.TrimSpace(f.fortiPass)
+		case "cisco-host":
+			cfg.Packs.Cisco.Host = strings.TrimSpace(f.ciscoHost)
+		case "cisco-user":
+			cfg.Packs.Cisco.User = strings.TrimSpace(f.ciscoUser)
+		case "cisco-pass":
+			cfg.Packs.Cisco.Pass = strings.TrimSpace(f.ciscoPass)
+		case "cisco-secret":
+			cfg.Packs.Cisco.Secret = strings.TrimSpace(f.ciscoSecret)
+		case "cisco-port":
+			if f.ciscoPort > 0 {
+				cfg.Packs.Cisco.Port = f.ciscoPort
+			}
+		case "count":
+			cfg.Count = f.count
+		case "timeout":
+			cfg.Timeout = f.timeout
+		case "dns-names":
+			cfg.DNSNames = config.SplitList(f.dnsNames)
+		case "resolvers":
+			cfg.Resolvers = config.SplitList(f.resolvers)
+		case "apps":
+			cfg.Apps = config.SplitList(f.apps)
+		case "load-endpoint":
+			cfg.Load.Endpoint = strings.TrimSpace(f.loadEndpoint)
+		case "load-duration":
+			cfg.Load.Duration = f.loadDuration
+		case "load-streams":
+			cfg.Load.Streams = f.loadStreams
+		case "voice-endpoint":
+			cfg.Voice.Endpoint = strings.TrimSpace(f.voiceEndpoint)
+		case "voice-duration":
+			cfg.Voice.Duration = f.voiceDuration
+		case "voice-rate":
+			cfg.Voice.Rate = f.voiceRate
+		case "voice-size":
+			cfg.Voice.Size = f.voiceSize
+		case "lldp-window":
+			cfg.LLDP.Window = f.lldpWindow
+		case "dhcp-window":
+			cfg.DHCP.Window = f.dhcpWindow
+		case "probes":
+			cfg.Probes = config.SplitList(f.probes)
+		case "skip-probes":
+			cfg.SkipProbes = config.SplitList(f.skipProbes)
+		case "path-cycles":
+			cfg.PathCycles = f.pathCycles
+		case "rules":
+			cfg.RulesFile = strings.TrimSpace(f.rules)
+		case "workers":
+			cfg.Workers = f.workers
+		case "snmp":
+			dev, err := parseSNMPFlag(f.snmp)
+			if err != nil {
+				flagErr = fmt.Errorf("--snmp: %w", err)
+				return
+			}
+			cfg.SNMP = nil
+			if dev != nil {
+				cfg.SNMP = []config.SNMPDevice{*dev}
+			}
+		}
+	})
+	return flagErr
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// normalizeSNMPArgs joins the space-separated key=value pairs following
+// --snmp into a single argument so the flag package sees one value.
+func normalizeSNMPArgs(args []string) []string {
+	var normalized []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--snmp" {
+			j := i + 1
+			var tokens []string
+			for j < len(args) && !strings.HasPrefix(args[j], "-") {
+				tokens = append(tokens, args[j])
+				j++
+			}
+			if len(tokens) > 0 {
+				normalized = append(normalized, "--snmp="+strings.Join(tokens, " "))
+				i = j - 1
+				continue
+			}
+		}
+		normalized = append(normalized, args[i])
+	}
+	return normalized
+}
+
+func parseSNMPFlag(raw string) (*config.SNMPDevice, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	fields := strings.Fields(raw)
+	dev := &config.SNMPDevice{}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected key=value pair, got %q", field)
+		}
+		key := strings.ToLower(parts[0])
+		val := parts[1]
+		switch key {
+		case "host":
+			dev.Host = val
+		case "community":
+			dev.Community = val
+		case "if", "iface", "interface":
+			dev.Iface = val
+		default:
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	// Without host or if, the switch's LLDP/CDP announcement fills them in.
+	if dev.Community == "" {
+		return nil, fmt.Errorf("community parameter is required")
+	}
+	return dev, nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cneate93/vne/internal/history"
+	"github.com/cneate93/vne/internal/report"
+	"github.com/cneate93/vne/internal/snmp"
+)
+
+func historyCommand(args []string) int {
+	const synopsis = "history list | show <id> | rm <id>..."
+	if len(args) == 0 || isHelpArg(args[0]) {
+		fmt.Fprintf(os.Stderr, "Usage: vne-agent %s\n", synopsis)
+		return 2
+	}
+	sub := args[0]
+	fs := newFlagSet("history "+sub, synopsis, "Lists, shows or removes runs saved by \"run\" and the web UI.")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding saved runs")
+	asJSON := fs.Bool("json", false, "Print the saved results as JSON (show only)")
+	rest := parseArgs(fs, args[1:])
+	store := history.NewStore(*dir, 0)
+
+	switch sub {
+	case "list", "ls":
+		entries, err := store.List()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "history:", err)
+			return 1
+		}
+		if len(entries) == 0 {
+			fmt.Println("No saved runs in", *dir)
+			return 0
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tWHEN\tTARGET\tCLASSIFICATION")
+		for _, e := range entries {
+			class := e.Classification
+			if e.Partial {
+				class += " (partial)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.ID, e.When.Local().Format("2006-01-02 15:04:05"), e.Target, class)
+		}
+		tw.Flush()
+		return 0
+	case "show":
+		if len(rest) != 1 {
+			fmt.Fprintln(os.Stderr, "usage: vne-agent history show [--json] <id>")
+			return 2
+		}
+		res, err := loadRun(store, rest[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "history:", err)
+			return 1
+		}
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(res); err != nil {
+				fmt.Fprintln(os.Stderr, "history:", err)
+				return 1
+			}
+			return 0
+		}
+		printSummary(os.Stdout, rest[0], *res)
+		return 0
+	case "rm", "remove":
+		if len(rest) == 0 {
+			fmt.Fprintln(os.Stderr, "usage: vne-agent history rm <id>...")
+			return 2
+		}
+		status := 0
+		for _, id := range rest {
+			if err := store.Delete(id); err != nil {
+				fmt.Fprintf(os.Stderr, "history: %s: %v\n", id, runError(err))
+				status = 1
+				continue
+			}
+			fmt.Println("Removed", id)
+		}
+		return status
+	}
+	fmt.Fprintf(os.Stderr, "history: unknown subcommand %q\nUsage: vne-agent %s\n", sub, synopsis)
+	return 2
+}
+
+func diffCommand(args []string) int {
+	fs := newFlagSet("diff", "diff [flags] <id> <id>",
+		"Compares the key measurements and findings of two saved runs (or result JSON files).")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding saved runs")
+	rest := parseArgs(fs, args)
+	if len(rest) != 2 {
+		fs.Usage()
+		return 2
+	}
+	store := history.NewStore(*dir, 0)
+	a, err := loadRun(store, rest[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "diff:", err)
+		return 1
+	}
+	b, err := loadRun(store, rest[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "diff:", err)
+		return 1
+	}
+	printDiff(os.Stdout, rest[0], *a, rest[1], *b)
+	return 0
+}
+
+func exportCommand(args []string) int {
+	fs := newFlagSet("export", "export [flags] <id>",
+		"Writes a saved run (or result JSON file) as an HTML report, JSON or an evidence bundle.\n"+
+			"Without output flags an HTML report named vne-report-<id>.html is written.")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding saved runs")
+	htmlOut := fs.String("html", "", "Write the HTML report to this path")
+	jsonOut := fs.String("json", "", "Write the results as indented JSON to this path")
+	bundleOut := fs.String("bundle", "", "Write a zipped evidence bundle to this path")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		fs.Usage()
+		return 2
+	}
+	ref := rest[0]
+	res, err := loadRun(history.NewStore(*dir, 0), ref)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+	if *htmlOut == "" && *jsonOut == "" && *bundleOut == "" {
+		*htmlOut = fmt.Sprintf("vne-report-%s.html", res.When.Format("20060102-150405"))
+	}
+	if *htmlOut != "" {
+		if err := report.RenderHTML(*res, "assets/report_template.html", *htmlOut); err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return 1
+		}
+		fmt.Println("→ HTML report written to:", *htmlOut)
+	}
+	if *jsonOut != "" {
+		if err := writeJSONResults(*jsonOut, *res); err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return 1
+		}
+		fmt.Println("→ JSON results written to:", *jsonOut)
+	}
+	if *bundleOut != "" {
+		if err := report.WriteBundle(*bundleOut, *res, rawEvidence(*res)); err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return 1
+		}
+		fmt.Println("→ Evidence bundle written to:", *bundleOut)
+	}
+	return 0
+}
+
+func replayCommand(args []string) int {
+	fs := newFlagSet("replay", "replay [flags] <id>",
+		"Evaluates the current findings rules against a saved run (or result JSON file) without\n"+
+			"probing again, which is handy when tuning rules or thresholds.")
+	var cli cliFlags
+	fs.StringVar(&cli.configPath, "config", "", "Config file whose rules and profile are used")
+	fs.StringVar(&cli.profile, "profile", "", "Named profile from the config file to apply")
+	fs.StringVar(&cli.rules, "rules", "", "YAML or JSON rule file merged over the built-in findings rules")
+	dir := fs.String("history-dir", defaultHistoryDir, "Directory holding saved runs")
+	htmlOut := fs.String("out", "", "Write an HTML report of the replayed results to this path")
+	jsonOut := fs.String("json", "", "Write the replayed results as indented JSON to this path")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		fs.Usage()
+		return 2
+	}
+	loaded, _, err := cli.load(fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		return 1
+	}
+	ruleSet, err := loaded.RuleSet()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		return 1
+	}
+	ref := rest[0]
+	orig, err := loadRun(history.NewStore(*dir, 0), ref)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay:", err)
+		return 1
+	}
+	// Findings without a rule come from the vendor packs and SNMP, or, in
+	// runs saved before the rules engine, from the hard-coded checks the
+	// rules replaced. Rebuild them from their sources so the latter are not
+	// reported next to the rules that now raise them.
+	base := *orig
+	base.Findings = unruledFindings(base)
+	res, err := ruleSet.Apply(base)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "replay: rule evaluation:", err)
+	}
+
+	printSummary(os.Stdout, ref+" (replayed)", res)
+	if res.Classification != orig.Classification {
+		fmt.Printf("\nClassification changed: %s → %s\n", orig.Classification, res.Classification)
+	}
+	printFindingChanges(os.Stdout, "Findings no longer raised", orig.Findings, res.Findings)
+	printFindingChanges(os.Stdout, "New findings", res.Findings, orig.Findings)
+
+	if *htmlOut != "" {
+		if err := report.RenderHTML(res, "assets/report_template.html", *htmlOut); err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			return 1
+		}
+		fmt.Println("→ HTML report written to:", *htmlOut)
+	}
+	if *jsonOut != "" {
+		if err := writeJSONResults(*jsonOut, res); err != nil {
+			fmt.Fprintln(os.Stderr, "replay:", err)
+			return 1
+		}
+		fmt.Println("→ JSON results written to:", *jsonOut)
+	}
+	return 0
+}
+
+// unruledFindings returns the findings a run adds besides the rules' own,
+// in the order runDiagnostics adds them.
+func unruledFindings(res report.Results) []report.Finding {
+	findings := append([]report.Finding(nil), res.VendorSummaries...)
+	healths := res.IfaceHealths
+	if len(healths) == 0 && res.IfaceHealth != nil {
+		healths = []*snmp.InterfaceHealth{res.IfaceHealth}
+	}
+	findings = append(findings, snmpFindings(healths)...)
+	if res.CiscoIOS != nil {
+		findings = append(findings, res.CiscoIOS.Findings...)
+	}
+	return findings
+}
+
+// loadRun loads a run by history ID, or from a results JSON file when ref
+// names one.
+func loadRun(store *history.Store, ref string) (*report.Results, error) {
+	if strings.HasSuffix(ref, ".json") || strings.ContainsAny(ref, `/\`) {
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return nil, err
+		}
+		var res report.Results
+		if err := json.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("%s: %w", ref, err)
+		}
+		return &res, nil
+	}
+	res, err := store.Load(ref)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ref, runError(err))
+	}
+	return res, nil
+}
+
+func runError(err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New("no such saved run")
+	}
+	return err
+}
+
+// rawEvidence is the raw probe output included in an evidence bundle.
+func rawEvidence(res report.Results) map[string][]byte {
+	return map[string][]byte{
+		"gateway-ping.txt": []byte(res.GwPing.Raw),
+		"wan-ping.txt":     []byte(res.WanPing.Raw),
+		"traceroute.txt":   []byte(res.Trace.Raw),
+	}
+}
+
+func printSummary(w io.Writer, name string, res report.Results) {
+	partial := ""
+	if res.Partial {
+		partial = " [partial]"
+	}
+	fmt.Fprintf(w, "Run %s, %s%s\n", name, res.When.Local().Format("2006-01-02 15:04:05"), partial)
+	if res.UserNote != "" {
+		fmt.Fprintf(w, "Note: %s\n", res.UserNote)
+	}
+	fmt.Fprintf(w, "Classification: %s\n", res.Classification)
+	for _, r := range res.Reasons {
+		fmt.Fprintf(w, "  - %s\n", r)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, m := range metrics {
+		fmt.Fprintf(tw, "%s\t%s\n", m.name, m.value(res))
+	}
+	tw.Flush()
+	if len(res.Findings) > 0 {
+		fmt.Fprintln(w, "\nFindings:")
+		for _, f := range res.Findings {
+			fmt.Fprintf(w, "  %s\n", formatFinding(f))
+		}
+	}
+}
+
+func printDiff(w io.Writer, nameA string, a report.Results, nameB string, b report.Results) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "\t%s\t%s\t\n", nameA, nameB)
+	fmt.Fprintf(tw, "When\t%s\t%s\t\n", a.When.Local().Format("2006-01-02 15:04"), b.When.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(tw, "Classification\t%s\t%s\t%s\n", a.Classification, b.Classification, changed(a.Classification != b.Classification))
+	for _, m := range metrics {
+		va, vb := m.value(a), m.value(b)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.name, va, vb, changed(va != vb))
+	}
+	tw.Flush()
+	printFindingChanges(w, "Findings only in "+nameA, a.Findings, b.Findings)
+	printFindingChanges(w, "Findings only in "+nameB, b.Findings, a.Findings)
+}
+
+func changed(c bool) string {
+	if c {
+		return "*"
+	}
+	return ""
+}
+
+// printFindingChanges lists the findings in from that are missing in other.
+func printFindingChanges(w io.Writer, title string, from, other []report.Finding) {
+	seen := make(map[string]bool, len(other))
+	for _, f := range other {
+		seen[formatFinding(f)] = true
+	}
+	var lines []string
+	for _, f := range from {
+		if line := formatFinding(f); !seen[line] {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, line := range lines {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+func formatFinding(f report.Finding) string {
+	line := fmt.Sprintf("[%s] %s", f.Severity, f.Message)
+	if f.Rule != "" {
+		line += " (" + f.Rule + ")"
+	}
+	return line
+}
+
+// metric is one measurement shown by history show and compared by diff.
+type metric struct {
+	name  string
+	value func(report.Results) string
+}
+
+var metrics = []metric{
+	{"Target", func(r report.Results) string { return r.TargetHost }},
+	{"Gateway", func(r report.Results) string {
+		if !r.HasGateway {
+			return "(none)"
+		}
+		return r.GatewayUsed
+	}},
+	{"Gateway loss", func(r report.Results) string { return fmt.Sprintf("%.1f%%", r.GwPing.Loss*100) }},
+	{"Gateway avg", func(r report.Results) string { return fmt.Sprintf("%.1f ms", r.GwPing.AvgMs) }},
+	{"Gateway jitter", func(r report.Results) string { return fmt.Sprintf("%.1f ms", r.GwPing.JitterMs) }},
+	{"WAN loss", func(r report.Results) string { return fmt.Sprintf("%.1f%%", r.WanPing.Loss*100) }},
+	{"WAN avg", func(r report.Results) string { return fmt.Sprintf("%.1f ms", r.WanPing.AvgMs) }},
+	{"WAN jitter", func(r report.Results) string { return fmt.Sprintf("%.1f ms", r.WanPing.JitterMs) }},
+	{"DNS (system)", func(r report.Results) string { return fmt.Sprintf("%.0f ms", r.DNSLocal.AvgMs) }},
+	{"DNS (1.1.1.1)", func(r report.Results) string { return fmt.Sprintf("%.0f ms", r.DNSCF.AvgMs) }},
+	{"Path MTU", func(r report.Results) string {
+		if r.MTU.PathMTU == 0 {
+			return "(unknown)"
+		}
+		return fmt.Sprintf("%d", r.MTU.PathMTU)
+	}},
+	{"Findings", func(r report.Results) string { return fmt.Sprintf("%d", len(r.Findings)) }},
+}
@@ -11,21 +11,28 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/cneate93/vne/internal/config"
+	"github.com/cneate93/vne/internal/engine"
+	"github.com/cneate93/vne/internal/history"
 	"github.com/cneate93/vne/internal/logx"
 	"github.com/cneate93/vne/internal/progress"
 	"github.com/cneate93/vne/internal/report"
+	"github.com/cneate93/vne/internal/rules"
 	"github.com/cneate93/vne/internal/webui"
 )
 
 type RunContext struct {
-	UserNotes          string
-	TargetHost         string // default internet target
+	UserNotes  string
+	TargetHost string // default internet target
+	// Targets are named WAN targets; when set they replace TargetHost.
+	Targets            []engine.Target
 	UsePythonFortigate bool
 	UsePythonCisco     bool
 	FortiHost          string
@@ -65,196 +72,102 @@ func yesno(s string) bool {
 	}
 }
 
-type snmpQuery struct {
-	Host      string
-	Community string
-	Iface     string
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
 }
 
-func normalizeSNMPArgs() {
-	args := os.Args[1:]
-	var normalized []string
-	for i := 0; i < len(args); i++ {
-		if args[i] == "--snmp" {
-			j := i + 1
-			var tokens []string
-			for j < len(args) && !strings.HasPrefix(args[j], "-") {
-				tokens = append(tokens, args[j])
-				j++
-			}
-			if len(tokens) > 0 {
-				normalized = append(normalized, "--snmp="+strings.Join(tokens, " "))
-				i = j - 1
-				continue
-			}
-		}
-		normalized = append(normalized, args[i])
+// setup loads the merged config for a command, enables verbose logging when
+// asked and compiles the rules. The returned cleanup closes the log.
+func setup(fs *flag.FlagSet, cli *cliFlags) (loaded config.Loaded, ruleSet *rules.Set, flagErr error, cleanup func()) {
+	cleanup = func() {}
+	loaded, flagErr, err := cli.load(fs)
+	if err != nil {
+		fmt.Println("Unable to load config:", err)
+		log.Fatal(err)
 	}
-	os.Args = append([]string{os.Args[0]}, normalized...)
-}
-
-func parseSNMPFlag(raw string) (*snmpQuery, error) {
-	if strings.TrimSpace(raw) == "" {
-		return nil, nil
+	if err := logx.Configure(loaded.Output.Verbose); err != nil {
+		fmt.Println("Unable to enable verbose logging:", err)
+	} else if loaded.Output.Verbose {
+		cleanup = func() { logx.Close() }
 	}
-	fields := strings.Fields(raw)
-	cfg := &snmpQuery{}
-	for _, field := range fields {
-		parts := strings.SplitN(field, "=", 2)
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("expected key=value pair, got %q", field)
-		}
-		key := strings.ToLower(parts[0])
-		val := parts[1]
-		switch key {
-		case "host":
-			cfg.Host = val
-		case "community":
-			cfg.Community = val
-		case "if", "iface", "interface":
-			cfg.Iface = val
-		default:
-			return nil, fmt.Errorf("unknown parameter %q", key)
-		}
+	if loaded.Path != "" {
+		log.Printf("Loaded config from %s (profile %q)", loaded.Path, loaded.Profile)
 	}
-	if cfg.Host == "" || cfg.Community == "" || cfg.Iface == "" {
-		return nil, fmt.Errorf("host, community, and if parameters are required")
+	ruleSet, err = loaded.RuleSet()
+	if err != nil {
+		fmt.Println("Unable to load rules:", err)
+		log.Fatal(err)
 	}
-	return cfg, nil
+	return loaded, ruleSet, flagErr, cleanup
 }
 
-func main() {
-	normalizeSNMPArgs()
-	targetFlag := flag.String("target", "", "Target for WAN checks (default 1.1.1.1)")
-	outFlag := flag.String("out", "", "Output HTML report path (default vne-report.html)")
-	skipPythonFlag := flag.Bool("skip-python", false, "Skip optional Python packs (FortiGate, Cisco IOS)")
-	serveFlag := flag.Bool("serve", false, "Serve the generated report over HTTP on :8080")
-	webFlag := flag.Bool("web", false, "Run embedded web UI on 127.0.0.1:8080")
-	openFlag := flag.Bool("open", false, "Open the generated report after creation")
-	pythonFlag := flag.String("python", "", "Path to python executable for optional packs")
-	autoPacksFlag := flag.Bool("auto-packs", false, "Automatically run vendor-specific packs when detected")
-	scanFlag := flag.Bool("scan", false, "Enable layer-2 discovery ping sweep (experimental)")
-	scanTimeoutFlag := flag.Duration("scan-timeout", 2*time.Second, "Timeout per host for layer-2 discovery (default 2s)")
-	scanMaxHostsFlag := flag.Int("scan-max-hosts", 256, "Maximum number of layer-2 hosts to probe (default 256)")
-	scanCIDRLimitFlag := flag.Int("scan-cidr-limit", 24, "Smallest CIDR mask to sweep (default 24)")
-	fortiHostFlag := flag.String("forti-host", "", "FortiGate host/IP for optional Python pack")
-	fortiUserFlag := flag.String("forti-user", "", "FortiGate username for optional Python pack")
-	fortiPassFlag := flag.String("forti-pass", "", "FortiGate password for optional Python pack")
-	ciscoHostFlag := flag.String("cisco-host", "", "Cisco IOS host/IP for optional Python pack")
-	ciscoUserFlag := flag.String("cisco-user", "", "Cisco IOS username for optional Python pack")
-	ciscoPassFlag := flag.String("cisco-pass", "", "Cisco IOS password for optional Python pack")
-	ciscoSecretFlag := flag.String("cisco-secret", "", "Cisco IOS enable secret for optional Python pack")
-	ciscoPortFlag := flag.Int("cisco-port", 22, "Cisco IOS SSH port (default 22)")
-	verboseFlag := flag.Bool("verbose", false, "Enable verbose logging to vne.log")
-	bundleFlag := flag.Bool("bundle", false, "Write zipped evidence bundle (vne-evidence-YYYYMMDD-HHMM.zip)")
-	jsonFlag := flag.String("json", "", "Write report data as indented JSON to the given path")
-	countFlag := flag.Int("count", 20, "Number of ping attempts for each host (default 20)")
-	timeoutFlag := flag.Duration("timeout", 10*time.Second, "Timeout for network probes (default 10s)")
-	snmpFlag := flag.String("snmp", "", "SNMP interface query parameters, e.g. \"host=1.2.3.4 community=public if=Gig0/1\"")
-	flag.Parse()
-
-	if err := logx.Configure(*verboseFlag); err != nil {
-		fmt.Println("Unable to enable verbose logging:", err)
-	} else if *verboseFlag {
-		defer logx.Close()
-	}
+// runReport runs the diagnostics once and writes the report and the other
+// requested outputs.
+func runReport(fs *flag.FlagSet, cli *cliFlags, rf runFlags, legacy bool) int {
+	loaded, ruleSet, flagErr, cleanup := setup(fs, cli)
+	defer cleanup()
+	cfg := loaded.Config
 
-	flagsSet := map[string]bool{}
-	flag.CommandLine.Visit(func(f *flag.Flag) {
-		flagsSet[f.Name] = true
-	})
-	nonInteractive := flagsSet["target"] || flagsSet["out"] || flagsSet["skip-python"]
-	autoPacksRequested := *autoPacksFlag
-
-	if *webFlag {
-		srv, err := webui.NewServer(func(_ context.Context, req webui.RunRequest, reporter progress.Reporter) (report.Results, error) {
-			runCtx := RunContext{
-				TargetHost: "1.1.1.1",
-				CiscoPort:  22,
-			}
-			if trimmed := strings.TrimSpace(req.Target); trimmed != "" {
-				runCtx.TargetHost = trimmed
-			}
-			opts := RunOptions{
-				Count:         *countFlag,
-				Timeout:       *timeoutFlag,
-				Scan:          req.Scan,
-				ScanTimeout:   *scanTimeoutFlag,
-				ScanMaxHosts:  *scanMaxHostsFlag,
-				ScanCIDRLimit: *scanCIDRLimitFlag,
-				SkipPython:    true,
-				AutoPacks:     true,
-				SNMPCfg:       nil,
-				Printer:       newProgressPrinter(reporter),
-				Progress:      reporter,
-			}
-			return runDiagnostics(runCtx, opts)
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-		addr := "127.0.0.1:8080"
-		fmt.Printf("Starting web UI at http://%s\n", addr)
-		log.Println("Starting web UI server on", addr)
-		if err := http.ListenAndServe(addr, srv); err != nil {
-			log.Fatal(err)
-		}
-		return
+	interactive := rf.interactive
+	if legacy {
+		// Before subcommands, prompting was skipped as soon as any of these
+		// was given.
+		interactive = !isFlagSet(fs, "target") && !isFlagSet(fs, "out") && !isFlagSet(fs, "skip-python")
 	}
 
-	snmpCfg, err := parseSNMPFlag(*snmpFlag)
-	if err != nil {
-		fmt.Println("→ Unable to parse --snmp parameters:", err)
-		log.Println("SNMP flag parse error:", err)
+	if flagErr != nil {
+		fmt.Println("→ Ignoring invalid flag:", flagErr)
+		log.Println("Flag parse error:", flagErr)
 	}
 
 	fmt.Println("== Virtual Network Engineer (MVP) ==")
 
 	ctx := RunContext{
-		TargetHost: "1.1.1.1",
-		CiscoPort:  22,
-	}
-
-	ctx.FortiHost = stringFlagOrEnv(*fortiHostFlag, flagsSet["forti-host"], "FORTI_HOST", "FORTIGATE_HOST")
-	ctx.FortiUser = stringFlagOrEnv(*fortiUserFlag, flagsSet["forti-user"], "FORTI_USER", "FORTIGATE_USER")
-	ctx.FortiPass = stringFlagOrEnv(*fortiPassFlag, flagsSet["forti-pass"], "FORTI_PASS", "FORTI_PASSWORD", "FORTIGATE_PASS", "FORTIGATE_PASSWORD")
-	ctx.CiscoHost = stringFlagOrEnv(*ciscoHostFlag, flagsSet["cisco-host"], "CISCO_HOST")
-	ctx.CiscoUser = stringFlagOrEnv(*ciscoUserFlag, flagsSet["cisco-user"], "CISCO_USER")
-	ctx.CiscoPass = stringFlagOrEnv(*ciscoPassFlag, flagsSet["cisco-pass"], "CISCO_PASS", "CISCO_PASSWORD")
-	ctx.CiscoSecret = stringFlagOrEnv(*ciscoSecretFlag, flagsSet["cisco-secret"], "CISCO_SECRET")
-	ctx.CiscoPort = intFlagOrEnv(ctx.CiscoPort, *ciscoPortFlag, flagsSet["cisco-port"], "CISCO_PORT")
-
-	if *targetFlag != "" {
-		ctx.TargetHost = *targetFlag
-	}
-	if *pythonFlag != "" {
-		ctx.PythonPath = *pythonFlag
-	}
-
-	if nonInteractive {
-		ctx.UserNotes = ""
-	} else {
+		TargetHost:  cfg.Target,
+		Targets:     engineTargets(cfg.Targets),
+		FortiHost:   cfg.Packs.FortiGate.Host,
+		FortiUser:   cfg.Packs.FortiGate.User,
+		FortiPass:   cfg.Packs.FortiGate.Pass,
+		PythonPath:  cfg.Packs.Python,
+		CiscoHost:   cfg.Packs.Cisco.Host,
+		CiscoUser:   cfg.Packs.Cisco.User,
+		CiscoPass:   cfg.Packs.Cisco.Pass,
+		CiscoSecret: cfg.Packs.Cisco.Secret,
+		CiscoPort:   cfg.Packs.Cisco.Port,
+	}
+	if ctx.CiscoPort <= 0 {
+		ctx.CiscoPort = 22
+	}
+
+	if interactive {
 		ctx.UserNotes = prompt("Optional: describe the problem (e.g., 'Zoom choppy, started yesterday'):\n> ")
 
 		th := prompt("Target for WAN checks (default 1.1.1.1): ")
 		if th != "" {
 			ctx.TargetHost = th
+			ctx.Targets = nil
 		}
 	}
 
-	log.Printf("Using target host: %s", ctx.TargetHost)
-	if snmpCfg != nil {
-		log.Printf("SNMP query configured for host %s interface %s", snmpCfg.Host, snmpCfg.Iface)
+	if len(ctx.Targets) > 0 {
+		for _, t := range ctx.Targets {
+			log.Printf("Using target %s: %s", t.Name, t.Host)
+		}
+	} else {
+		log.Printf("Using target host: %s", ctx.TargetHost)
+	}
+	for _, dev := range cfg.SNMP {
+		log.Printf("SNMP query configured for host %s interface %s", dev.Host, dev.Iface)
 	}
 
-	if *skipPythonFlag {
-		if nonInteractive {
-			log.Println("Skipping optional Python packs (requested via --skip-python).")
-		} else {
+	if cfg.Packs.SkipPython {
+		if interactive {
 			fmt.Println("→ Skipping optional Python packs (requested via --skip-python).")
+		} else {
+			log.Println("Skipping optional Python packs (requested via --skip-python).")
 		}
-	} else if !autoPacksRequested {
-		if nonInteractive {
+	} else if !cfg.Packs.Auto {
+		if !interactive {
 			log.Println("Skipping optional Python packs in non-interactive mode; use interactive mode to supply credentials if needed.")
 		} else {
 			if yesno("Do you want to run the FortiGate Python pack (optional)?") {
@@ -292,25 +205,28 @@ func main() {
 		}
 	}
 
-	outPath := "vne-report.html"
-	if *outFlag != "" {
-		outPath = *outFlag
+	outPath := cfg.Output.HTML
+	if outPath == "" {
+		outPath = "vne-report.html"
 	}
 
-	res, err := runDiagnostics(ctx, RunOptions{
-		Count:         *countFlag,
-		Timeout:       *timeoutFlag,
-		Scan:          *scanFlag,
-		ScanTimeout:   *scanTimeoutFlag,
-		ScanMaxHosts:  *scanMaxHostsFlag,
-		ScanCIDRLimit: *scanCIDRLimitFlag,
-		SkipPython:    *skipPythonFlag,
-		AutoPacks:     autoPacksRequested,
-		SNMPCfg:       snmpCfg,
-		Printer:       stdPrinter{},
-	})
+	// Ctrl-C stops the probes in flight; whatever they gathered is still
+	// written to the report.
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := runOptions(cfg, ruleSet)
+	opts.Printer = stdPrinter{}
+	if !rf.noHistory {
+		opts.HistoryDir = rf.historyDir
+	}
+	res, err := runDiagnostics(sigCtx, ctx, opts)
+	stop()
 	if err != nil {
-		log.Fatal(err)
+		if sigCtx.Err() == nil {
+			log.Fatal(err)
+		}
+		fmt.Println("\n→ Run cancelled; writing partial results.")
+		log.Println("Run cancelled; writing partial results")
 	}
 
 	log.Println("Rendering HTML report to", outPath)
@@ -320,8 +236,8 @@ func main() {
 	fmt.Println("\n✅ Done. Report written to:", outPath)
 	log.Println("Report generation complete")
 
-	if *jsonFlag != "" {
-		jsonPath := *jsonFlag
+	if cfg.Output.JSON != "" {
+		jsonPath := cfg.Output.JSON
 		if err := writeJSONResults(jsonPath, res); err != nil {
 			log.Fatalf("failed to write JSON results: %v", err)
 		}
@@ -329,22 +245,28 @@ func main() {
 		log.Println("JSON results written to", jsonPath)
 	}
 
-	if *bundleFlag {
+	if cfg.Output.Bundle {
 		bundleName := fmt.Sprintf("vne-evidence-%s.zip", res.When.Format("20060102-1504"))
-		rawFiles := map[string][]byte{
-			"gateway-ping.txt": []byte(res.GwPing.Raw),
-			"wan-ping.txt":     []byte(res.WanPing.Raw),
-			"traceroute.txt":   []byte(res.Trace.Raw),
-		}
-		if err := report.WriteBundle(bundleName, res, rawFiles); err != nil {
+		if err := report.WriteBundle(bundleName, res, rawEvidence(res)); err != nil {
 			log.Fatalf("failed to write bundle: %v", err)
 		}
 		fmt.Println("→ Evidence bundle written to:", bundleName)
 		log.Println("Evidence bundle written to", bundleName)
 	}
 
+	if !rf.noHistory {
+		store := history.NewStore(rf.historyDir, 0)
+		if id, err := store.Save(res); err != nil {
+			fmt.Println("→ Unable to save run to history:", err)
+			log.Println("history save error:", err)
+		} else {
+			fmt.Println("→ Saved to history as:", id)
+			log.Println("Run saved to history as", id)
+		}
+	}
+
 	servedURL := ""
-	if *serveFlag {
+	if rf.serve {
 		servedURL = buildServedURL(outPath)
 		fmt.Printf("Serving report at %s\n", servedURL)
 		log.Println("Serving report at", servedURL)
@@ -353,7 +275,7 @@ func main() {
 			serverErr <- http.ListenAndServe(":8080", http.FileServer(http.Dir(".")))
 		}()
 
-		if *openFlag {
+		if rf.open {
 			fmt.Println("→ Opening report in browser…")
 			go func(url string) {
 				time.Sleep(200 * time.Millisecond)
@@ -365,10 +287,56 @@ func main() {
 		}
 
 		log.Fatal(<-serverErr)
-	} else if *openFlag {
+	} else if rf.open {
 		fmt.Println("→ --open requires --serve; ignoring.")
 		log.Println("--open requested without --serve; ignoring")
 	}
+	return 0
+}
+
+// serveUI starts the web UI on addr and blocks.
+func serveUI(fs *flag.FlagSet, cli *cliFlags, addr string) int {
+	loaded, ruleSet, _, cleanup := setup(fs, cli)
+	defer cleanup()
+	cfg := loaded.Config
+
+	srv, err := webui.NewServer(func(ctx context.Context, req webui.RunRequest, reporter progress.Reporter) (report.Results, error) {
+		runCtx := RunContext{
+			TargetHost: cfg.Target,
+			Targets:    engineTargets(cfg.Targets),
+			CiscoPort:  22,
+		}
+		if trimmed := strings.TrimSpace(req.Target); trimmed != "" {
+			runCtx.TargetHost = trimmed
+			runCtx.Targets = nil
+		}
+		opts := runOptions(cfg, ruleSet)
+		opts.Scan = req.Scan
+		opts.SkipPython = true
+		opts.AutoPacks = true
+		opts.SNMP = nil
+		opts.HistoryDir = defaultHistoryDir
+		opts.Printer = newProgressPrinter(reporter)
+		opts.Progress = reporter
+		return runDiagnostics(ctx, runCtx, opts)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Starting web UI at http://%s\n", addr)
+	log.Println("Starting web UI server on", addr)
+	if err := http.ListenAndServe(addr, srv); err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
+
+func engineTargets(targets []config.Target) []engine.Target {
+	var out []engine.Target
+	for _, t := range targets {
+		out = append(out, engine.Target{Name: t.Name, Host: t.Host})
+	}
+	return out
 }
 
 func isWindows() bool {
@@ -431,45 +399,3 @@ func writeJSONResults(jsonPath string, res report.Results) error {
 
 	return nil
 }
-
-func stringFlagOrEnv(flagVal string, flagSet bool, envKeys ...string) string {
-	val := strings.TrimSpace(flagVal)
-	if flagSet {
-		return val
-	}
-	if val != "" {
-		return val
-	}
-	for _, key := range envKeys {
-		if key == "" {
-			continue
-		}
-		if envVal := strings.TrimSpace(os.Getenv(key)); envVal != "" {
-			return envVal
-		}
-	}
-	return ""
-}
-
-func intFlagOrEnv(defaultVal, flagVal int, flagSet bool, envKeys ...string) int {
-	if flagSet {
-		if flagVal > 0 {
-			return flagVal
-		}
-		return defaultVal
-	}
-	for _, key := range envKeys {
-		if key == "" {
-			continue
-		}
-		if envVal := strings.TrimSpace(os.Getenv(key)); envVal != "" {
-			if parsed, err := strconv.Atoi(envVal); err == nil && parsed > 0 {
-				return parsed
-			}
-		}
-	}
-	if flagVal > 0 {
-		return flagVal
-	}
-	return defaultVal
-}
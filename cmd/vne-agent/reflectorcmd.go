@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/cneate93/vne/internal/reflector"
+)
+
+func reflectorCommand(args []string) int {
+	fs := newFlagSet("reflector", "reflector [flags]",
+		"Runs the server side of the latency-under-load and voice quality tests until\n"+
+			"interrupted. Point --load-endpoint at http://<host>:<port> for the HTTP mode or\n"+
+			"<host>:<port> for raw TCP; the voice stream uses UDP on the same port.")
+	addr := fs.String("addr", ":"+reflector.DefaultPort, "Address for the reflector to listen on")
+	if rest := parseArgs(fs, args); len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "reflector: unexpected argument %q\n", rest[0])
+		return 2
+	}
+	srv, err := reflector.Listen(*addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reflector:", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	fmt.Println("→ Reflector listening on", srv.Addr())
+	if err := srv.Serve(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "reflector:", err)
+		return 1
+	}
+	return 0
+}
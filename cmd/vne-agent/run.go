@@ -9,10 +9,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cneate93/vne/internal/config"
 	"github.com/cneate93/vne/internal/engine"
+	"github.com/cneate93/vne/internal/history"
 	"github.com/cneate93/vne/internal/packs"
+	"github.com/cneate93/vne/internal/probes"
 	"github.com/cneate93/vne/internal/progress"
 	"github.com/cneate93/vne/internal/report"
+	"github.com/cneate93/vne/internal/rules"
 	"github.com/cneate93/vne/internal/snmp"
 	"github.com/cneate93/vne/internal/sshx"
 )
@@ -84,18 +88,91 @@ func (p *progressPrinter) forward(msg string) {
 type RunOptions struct {
 	Count         int
 	Timeout       time.Duration
+	DNSNames      []string
+	Resolvers     []string
+	Apps          []string
+	LoadEndpoint  string
+	LoadDuration  time.Duration
+	LoadStreams   int
+	VoiceEndpoint string
+	VoiceDuration time.Duration
+	VoiceRate     int
+	VoiceSize     int
+	LLDPWindow    time.Duration
+	DHCPWindow    time.Duration
+	Target6       string
 	Scan          bool
 	ScanTimeout   time.Duration
 	ScanMaxHosts  int
 	ScanCIDRLimit int
+	PathCycles    int
+	Probes        []string
+	SkipProbes    []string
+	Workers       int
+	Rules         *rules.Set
+	HistoryDir    string
 	SkipPython    bool
 	AutoPacks     bool
-	SNMPCfg       *snmpQuery
+	SNMP          []config.SNMPDevice
 	Printer       RunPrinter
 	Progress      progress.Reporter
 }
 
-func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
+// runOptions maps the merged config onto the options for one run.
+func runOptions(cfg config.Config, ruleSet *rules.Set) RunOptions {
+	return RunOptions{
+		Count:         cfg.Count,
+		Timeout:       cfg.Timeout,
+		DNSNames:      cfg.DNSNames,
+		Resolvers:     cfg.Resolvers,
+		Apps:          cfg.Apps,
+		LoadEndpoint:  cfg.Load.Endpoint,
+		LoadDuration:  cfg.Load.Duration,
+		LoadStreams:   cfg.Load.Streams,
+		VoiceEndpoint: cfg.Voice.Endpoint,
+		VoiceDuration: cfg.Voice.Duration,
+		VoiceRate:     cfg.Voice.Rate,
+		VoiceSize:     cfg.Voice.Size,
+		LLDPWindow:    cfg.LLDP.Window,
+		DHCPWindow:    cfg.DHCP.Window,
+		Target6:       cfg.Target6,
+		Scan:          cfg.Scan.Enabled,
+		ScanTimeout:   cfg.Scan.Timeout,
+		ScanMaxHosts:  cfg.Scan.MaxHosts,
+		ScanCIDRLimit: cfg.Scan.CIDRLimit,
+		PathCycles:    cfg.PathCycles,
+		Probes:        cfg.Probes,
+		SkipProbes:    cfg.SkipProbes,
+		Workers:       cfg.Workers,
+		Rules:         ruleSet,
+		SkipPython:    cfg.Packs.SkipPython,
+		AutoPacks:     cfg.Packs.Auto,
+		SNMP:          cfg.SNMP,
+	}
+}
+
+// knownHosts looks up the hosts discovered by the newest saved run in dir
+// that used the same default gateway, so a run on another network that
+// reuses the addresses is not compared.
+func knownHosts(dir string) func(probes.NetInfo) (string, []probes.L2Host) {
+	if dir == "" {
+		return nil
+	}
+	return func(ni probes.NetInfo) (string, []probes.L2Host) {
+		if ni.DefaultGateway == "" {
+			return "", nil
+		}
+		id, res, err := history.NewStore(dir, 0).Latest(func(res *report.Results) bool {
+			return res.NetInfo.DefaultGateway == ni.DefaultGateway && len(res.Discovered) > 0
+		})
+		if err != nil {
+			return "", nil
+		}
+		return id, res.Discovered
+	}
+}
+
+func runDiagnostics(ctx context.Context, rc RunContext, opts RunOptions) (report.Results, error) {
 	printer := opts.Printer
 	if printer == nil {
 		printer = nopPrinter{}
@@ -113,6 +190,10 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		}
 	}
 
+	pathCycles := opts.PathCycles
+	if pathCycles == 0 {
+		pathCycles = -1
+	}
 	params := engine.Params{
 		Count:         opts.Count,
 		Timeout:       opts.Timeout,
@@ -120,12 +201,37 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		ScanTimeout:   opts.ScanTimeout,
 		ScanMaxHosts:  opts.ScanMaxHosts,
 		ScanCIDRLimit: opts.ScanCIDRLimit,
-		TargetHost:    ctx.TargetHost,
+		TargetHost:    rc.TargetHost,
+		Targets:       rc.Targets,
+		Target6:       opts.Target6,
+		DNSNames:      opts.DNSNames,
+		Resolvers:     opts.Resolvers,
+		Apps:          opts.Apps,
+		LoadEndpoint:  opts.LoadEndpoint,
+		LoadDuration:  opts.LoadDuration,
+		LoadStreams:   opts.LoadStreams,
+		VoiceEndpoint: opts.VoiceEndpoint,
+		VoiceDuration: opts.VoiceDuration,
+		VoiceRate:     opts.VoiceRate,
+		VoiceSize:     opts.VoiceSize,
+		LLDPWindow:    opts.LLDPWindow,
+		DHCPWindow:    opts.DHCPWindow,
+		PathCycles:    pathCycles,
+		Enable:        opts.Probes,
+		Disable:       opts.SkipProbes,
+		Workers:       opts.Workers,
+		Rules:         opts.Rules,
+		KnownHosts:    knownHosts(opts.HistoryDir),
 		Reporter:      reporter,
 		Printer:       printer,
 	}
-	baseRes, err := engine.Run(context.Background(), params)
+	baseRes, err := engine.Run(ctx, params)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Hand back what the probes gathered before the run was stopped.
+			baseRes.UserNote = rc.UserNotes
+			return baseRes, err
+		}
 		return report.Results{}, err
 	}
 
@@ -145,8 +251,8 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		for _, key := range selected {
 			switch key {
 			case "fortigate":
-				if ctx.FortiHost != "" && ctx.FortiUser != "" && ctx.FortiPass != "" {
-					ctx.UsePythonFortigate = true
+				if rc.FortiHost != "" && rc.FortiUser != "" && rc.FortiPass != "" {
+					rc.UsePythonFortigate = true
 				} else {
 					vendorSummaries = append(vendorSummaries, report.Finding{
 						Severity: "info",
@@ -155,8 +261,8 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 					log.Println("Detected Fortinet device(s) but missing FortiGate credentials; skipping auto pack run.")
 				}
 			case "cisco_ios":
-				if ctx.CiscoHost != "" && ctx.CiscoUser != "" && ctx.CiscoPass != "" {
-					ctx.UsePythonCisco = true
+				if rc.CiscoHost != "" && rc.CiscoUser != "" && rc.CiscoPass != "" {
+					rc.UsePythonCisco = true
 				} else {
 					vendorSummaries = append(vendorSummaries, report.Finding{
 						Severity: "info",
@@ -166,8 +272,8 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 				}
 			}
 		}
-		if (ctx.UsePythonFortigate || ctx.UsePythonCisco) && ctx.PythonPath == "" {
-			ctx.PythonPath = defaultPythonPath()
+		if (rc.UsePythonFortigate || rc.UsePythonCisco) && rc.PythonPath == "" {
+			rc.PythonPath = defaultPythonPath()
 		}
 	} else if reporter != nil && !opts.SkipPython {
 		phase("python-packs")
@@ -175,21 +281,21 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 
 	var fortiRaw map[string]any
 	var ciscoRaw *report.CiscoPackResults
-	if !opts.SkipPython && ctx.UsePythonFortigate {
+	if !opts.SkipPython && rc.UsePythonFortigate {
 		println("→ Running FortiGate Python pack…")
 		log.Println("Running FortiGate Python pack")
 		packDir := filepath.Join("packs", "python", "fortigate")
 		payload := map[string]any{
-			"host":     ctx.FortiHost,
-			"username": ctx.FortiUser,
-			"password": ctx.FortiPass,
+			"host":     rc.FortiHost,
+			"username": rc.FortiUser,
+			"password": rc.FortiPass,
 			"commands": map[string]string{
 				"interfaces": "get hardware nic",
 				"routes":     "get router info routing-table all",
 			},
 		}
 		parserPath := filepath.Join(packDir, "parser.py")
-		out, err := sshx.RunPythonPack(ctx.PythonPath, parserPath, payload)
+		out, err := sshx.RunPythonPack(ctx, rc.PythonPath, parserPath, payload)
 		if err != nil {
 			log.Println("Forti pack error:", err)
 			vendorSummaries = append(vendorSummaries, report.Finding{
@@ -205,23 +311,23 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		}
 	}
 
-	if !opts.SkipPython && ctx.UsePythonCisco {
+	if !opts.SkipPython && rc.UsePythonCisco {
 		println("→ Running Cisco IOS Python pack…")
 		log.Println("Running Cisco IOS Python pack")
 		packDir := filepath.Join("packs", "python", "cisco_ios")
 		payload := map[string]any{
-			"host":     ctx.CiscoHost,
-			"username": ctx.CiscoUser,
-			"password": ctx.CiscoPass,
+			"host":     rc.CiscoHost,
+			"username": rc.CiscoUser,
+			"password": rc.CiscoPass,
 		}
-		if ctx.CiscoSecret != "" {
-			payload["secret"] = ctx.CiscoSecret
+		if rc.CiscoSecret != "" {
+			payload["secret"] = rc.CiscoSecret
 		}
-		if ctx.CiscoPort != 0 && ctx.CiscoPort != 22 {
-			payload["port"] = ctx.CiscoPort
+		if rc.CiscoPort != 0 && rc.CiscoPort != 22 {
+			payload["port"] = rc.CiscoPort
 		}
 		parserPath := filepath.Join(packDir, "parser.py")
-		out, err := sshx.RunPythonPack(ctx.PythonPath, parserPath, payload)
+		out, err := sshx.RunPythonPack(ctx, rc.PythonPath, parserPath, payload)
 		if err != nil {
 			log.Println("Cisco IOS pack error:", err)
 			vendorSummaries = append(vendorSummaries, report.Finding{
@@ -247,59 +353,64 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		}
 	}
 
-	var ifaceHealth *snmp.InterfaceHealth
-	if opts.SNMPCfg != nil {
+	var ifaceHealths []*snmp.InterfaceHealth
+	if len(opts.SNMP) > 0 {
 		phase("snmp")
 		println("\n→ Fetching SNMP interface health…")
-		log.Printf("Fetching SNMP interface health from %s (%s)", opts.SNMPCfg.Host, opts.SNMPCfg.Iface)
-		snmpCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		ifaceHealth, err = snmp.GetInterfaceHealth(snmpCtx, opts.SNMPCfg.Host, opts.SNMPCfg.Community, opts.SNMPCfg.Iface)
+	}
+	for _, dev := range opts.SNMP {
+		if ctx.Err() != nil {
+			break
+		}
+		if dev.Host == "" || dev.Iface == "" {
+			sw := baseRes.LLDP.Switch()
+			if sw == nil {
+				println("  Skipping SNMP query: no host given and no LLDP/CDP neighbour announced a management address.")
+				log.Println("SNMP: no host and no LLDP/CDP management address")
+				continue
+			}
+			if dev.Host == "" {
+				dev.Host = sw.MgmtAddr()
+			}
+			if dev.Iface == "" {
+				dev.Iface = sw.PortName()
+			}
+			printf("  Using %s port %s from its %s announcement.\n", dev.Host, dev.Iface, strings.ToUpper(sw.Protocol))
+		}
+		log.Printf("Fetching SNMP interface health from %s (%s)", dev.Host, dev.Iface)
+		snmpCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		ifaceHealth, err := snmp.GetInterfaceHealth(snmpCtx, dev.Host, dev.Community, dev.Iface)
+		cancel()
 		if err != nil {
-			println("  Unable to fetch interface health:", err)
+			printf("  Unable to fetch interface health from %s: %v\n", dev.Host, err)
 			log.Println("SNMP interface health error:", err)
-		} else {
-			printf("  Interface %s status: %s\n", ifaceHealth.Name, ifaceHealth.OperStatus)
-			printf("  Speed: %d bps\n", ifaceHealth.SpeedBps)
-			printf("  InErrors=%d OutErrors=%d InDiscards=%d OutDiscards=%d\n",
-				ifaceHealth.InErrors, ifaceHealth.OutErrors, ifaceHealth.InDiscards, ifaceHealth.OutDiscards)
+			continue
 		}
+		printf("  %s interface %s status: %s\n", dev.Host, ifaceHealth.Name, ifaceHealth.OperStatus)
+		printf("  Speed: %d bps\n", ifaceHealth.SpeedBps)
+		printf("  InErrors=%d OutErrors=%d InDiscards=%d OutDiscards=%d\n",
+			ifaceHealth.InErrors, ifaceHealth.OutErrors, ifaceHealth.InDiscards, ifaceHealth.OutDiscards)
+		ifaceHealths = append(ifaceHealths, ifaceHealth)
 	}
 
 	phase("finalizing")
 	findings := append([]report.Finding{}, baseRes.Findings...)
 	findings = append(findings, vendorSummaries...)
-	if ifaceHealth != nil {
-		if ifaceHealth.OperStatus != "" && strings.ToLower(ifaceHealth.OperStatus) != "up" {
-			findings = append(findings, report.Finding{
-				Severity: "high",
-				Message:  fmt.Sprintf("Interface %s reports operational status %s via SNMP.", ifaceHealth.Name, ifaceHealth.OperStatus),
-			})
-		}
-		if ifaceHealth.InErrors > 0 || ifaceHealth.OutErrors > 0 {
-			findings = append(findings, report.Finding{
-				Severity: "medium",
-				Message:  fmt.Sprintf("Interface %s shows %d input and %d output errors via SNMP.", ifaceHealth.Name, ifaceHealth.InErrors, ifaceHealth.OutErrors),
-			})
-		}
-		if ifaceHealth.InDiscards > 0 || ifaceHealth.OutDiscards > 0 {
-			findings = append(findings, report.Finding{
-				Severity: "medium",
-				Message:  fmt.Sprintf("Interface %s shows %d input and %d output discards via SNMP.", ifaceHealth.Name, ifaceHealth.InDiscards, ifaceHealth.OutDiscards),
-			})
-		}
-	}
+	findings = append(findings, snmpFindings(ifaceHealths)...)
 	if ciscoRaw != nil {
 		findings = append(findings, ciscoRaw.Findings...)
 		vendorFindings = append(vendorFindings, ciscoRaw.Findings...)
 	}
 
 	baseRes.When = time.Now()
-	baseRes.UserNote = ctx.UserNotes
+	baseRes.UserNote = rc.UserNotes
 	baseRes.Findings = findings
 	baseRes.FortiRaw = fortiRaw
 	baseRes.CiscoIOS = ciscoRaw
-	baseRes.IfaceHealth = ifaceHealth
+	baseRes.IfaceHealths = ifaceHealths
+	if len(ifaceHealths) > 0 {
+		baseRes.IfaceHealth = ifaceHealths[0]
+	}
 	baseRes.GwLossPct = fmt.Sprintf("%.0f%%", baseRes.GwPing.Loss*100)
 	baseRes.WanLossPct = fmt.Sprintf("%.0f%%", baseRes.WanPing.Loss*100)
 	if len(vendorSummaries) > 0 {
@@ -309,5 +420,32 @@ func runDiagnostics(ctx RunContext, opts RunOptions) (report.Results, error) {
 		baseRes.VendorFindings = append([]report.Finding(nil), vendorFindings...)
 	}
 
-	return baseRes, nil
+	return baseRes, ctx.Err()
+}
+
+// snmpFindings reports interfaces that SNMP shows down or with errors or
+// discards.
+func snmpFindings(ifaceHealths []*snmp.InterfaceHealth) []report.Finding {
+	var findings []report.Finding
+	for _, ifaceHealth := range ifaceHealths {
+		if ifaceHealth.OperStatus != "" && strings.ToLower(ifaceHealth.OperStatus) != "up" {
+			findings = append(findings, report.Finding{
+				Severity: "high",
+				Message:  fmt.Sprintf("Interface %s on %s reports operational status %s via SNMP.", ifaceHealth.Name, ifaceHealth.Host, ifaceHealth.OperStatus),
+			})
+		}
+		if ifaceHealth.InErrors > 0 || ifaceHealth.OutErrors > 0 {
+			findings = append(findings, report.Finding{
+				Severity: "medium",
+				Message:  fmt.Sprintf("Interface %s on %s shows %d input and %d output errors via SNMP.", ifaceHealth.Name, ifaceHealth.Host, ifaceHealth.InErrors, ifaceHealth.OutErrors),
+			})
+		}
+		if ifaceHealth.InDiscards > 0 || ifaceHealth.OutDiscards > 0 {
+			findings = append(findings, report.Finding{
+				Severity: "medium",
+				Message:  fmt.Sprintf("Interface %s on %s shows %d input and %d output discards via SNMP.", ifaceHealth.Name, ifaceHealth.Host, ifaceHealth.InDiscards, ifaceHealth.OutDiscards),
+			})
+		}
+	}
+	return findings
 }
@@ -3,3 +3,9 @@ module github.com/cneate93/vne
 go 1.22
 
 require github.com/gosnmp/gosnmp v1.37.0
+
+require (
+	golang.org/x/net v0.25.0
+	golang.org/x/sys v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,387 @@
+// Package config loads vne-agent settings from a YAML config file with
+// optional named profiles. Values are layered: built-in defaults, then the
+// top level of the file, then the selected profile, then environment
+// variables. Command-line flags are applied on top by the caller.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cneate93/vne/internal/rules"
+)
+
+// Config is the merged set of run settings.
+type Config struct {
+	// Target is the host used for the WAN checks.
+	Target string `yaml:"target"`
+	// Targets, when set, replaces Target with several named WAN targets;
+	// the first is the primary one.
+	Targets []Target `yaml:"targets,omitempty"`
+	// Target6 is the IPv6 WAN target used when the primary target has no
+	// IPv6 address.
+	Target6 string `yaml:"target6,omitempty"`
+	// DNSNames are the names resolved by the DNS probe.
+	DNSNames []string `yaml:"dns_names"`
+	// Resolvers are queried one by one by the resolvers probe besides the
+	// system nameservers: addresses for UDP, tcp:// and tls:// addresses,
+	// or https:// DNS-over-HTTPS URLs.
+	Resolvers []string `yaml:"resolvers,omitempty"`
+	// Apps are the URLs and host:port pairs checked by the apps probe.
+	Apps       []string      `yaml:"apps,omitempty"`
+	Count      int           `yaml:"count"`
+	Timeout    time.Duration `yaml:"timeout"`
+	PathCycles int           `yaml:"path_cycles"`
+	Workers    int           `yaml:"workers"`
+	Probes     []string      `yaml:"probes,omitempty"`
+	SkipProbes []string      `yaml:"skip_probes,omitempty"`
+	Scan       Scan          `yaml:"scan"`
+	Load       LoadTest      `yaml:"load"`
+	Voice      VoiceTest     `yaml:"voice"`
+	LLDP       LLDP          `yaml:"lldp"`
+	DHCP       DHCP          `yaml:"dhcp"`
+	SNMP       []SNMPDevice  `yaml:"snmp,omitempty"`
+	Packs      Packs         `yaml:"packs"`
+	Output     Output        `yaml:"output"`
+	// RulesFile is a rule file merged over the built-in rules.
+	RulesFile string `yaml:"rules_file,omitempty"`
+	// Rules are merged after RulesFile. A profile's rules are added to the
+	// file's, replacing those with the same id, so a profile can adjust a
+	// threshold by redefining a single rule.
+	Rules []rules.Rule `yaml:"rules,omitempty"`
+}
+
+// Target is a named WAN destination.
+type Target struct {
+	Name string `yaml:"name,omitempty"`
+	Host string `yaml:"host"`
+}
+
+// ParseTargets parses a comma-separated list of WAN targets, each either
+// "name=host" or a bare host.
+func ParseTargets(raw string) ([]Target, error) {
+	var out []Target
+	for _, item := range SplitList(raw) {
+		t := Target{Host: item}
+		if name, host, ok := strings.Cut(item, "="); ok {
+			t = Target{Name: strings.TrimSpace(name), Host: strings.TrimSpace(host)}
+		}
+		if t.Host == "" {
+			return nil, fmt.Errorf("target %q has no host", item)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// Scan holds the layer-2 discovery settings.
+type Scan struct {
+	Enabled   bool          `yaml:"enabled"`
+	Timeout   time.Duration `yaml:"timeout"`
+	MaxHosts  int           `yaml:"max_hosts"`
+	CIDRLimit int           `yaml:"cidr_limit"`
+}
+
+// LoadTest holds the latency-under-load settings. Endpoint is a reflector
+// started with "vne-agent reflector": an http:// URL, or host:port for its
+// raw TCP mode. The test is skipped while it is empty.
+type LoadTest struct {
+	Endpoint string        `yaml:"endpoint,omitempty"`
+	Duration time.Duration `yaml:"duration"`
+	Streams  int           `yaml:"streams"`
+}
+
+// VoiceTest holds the voice/video quality settings. Endpoint is a reflector
+// started with "vne-agent reflector", as host:port; while it is empty the
+// load test's reflector is used. Rate is packets a second and Size their
+// UDP payload in bytes.
+type VoiceTest struct {
+	Endpoint string        `yaml:"endpoint,omitempty"`
+	Duration time.Duration `yaml:"duration"`
+	Rate     int           `yaml:"rate"`
+	Size     int           `yaml:"size"`
+}
+
+// LLDP holds the LLDP/CDP capture settings. Window is the longest the wired
+// interface is listened on; switches announce themselves every 30 to 60
+// seconds.
+type LLDP struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// DHCP holds the DHCP discovery settings. Window is how long offers are
+// collected after the DISCOVER.
+type DHCP struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// SNMPDevice is one interface to query over SNMP. An empty Host or Iface is
+// taken from the switch's LLDP or CDP announcement: its management address
+// and the port the host is plugged into.
+type SNMPDevice struct {
+	Host      string `yaml:"host"`
+	Community string `yaml:"community"`
+	Iface     string `yaml:"iface"`
+}
+
+// Packs holds the optional vendor pack settings.
+type Packs struct {
+	Auto       bool      `yaml:"auto"`
+	SkipPython bool      `yaml:"skip_python"`
+	Python     string    `yaml:"python,omitempty"`
+	FortiGate  FortiGate `yaml:"fortigate"`
+	Cisco      Cisco     `yaml:"cisco"`
+}
+
+// FortiGate holds the FortiGate pack connection settings.
+type FortiGate struct {
+	Host string `yaml:"host,omitempty"`
+	User string `yaml:"user,omitempty"`
+	Pass string `yaml:"pass,omitempty"`
+}
+
+// Cisco holds the Cisco IOS pack connection settings.
+type Cisco struct {
+	Host   string `yaml:"host,omitempty"`
+	User   string `yaml:"user,omitempty"`
+	Pass   string `yaml:"pass,omitempty"`
+	Secret string `yaml:"secret,omitempty"`
+	Port   int    `yaml:"port"`
+}
+
+// Output holds where reports are written.
+type Output struct {
+	HTML    string `yaml:"html"`
+	JSON    string `yaml:"json,omitempty"`
+	Bundle  bool   `yaml:"bundle"`
+	Verbose bool   `yaml:"verbose"`
+}
+
+// Default returns the settings used when nothing else is configured.
+func Default() Config {
+	return Config{
+		Target:     "1.1.1.1",
+		DNSNames:   []string{"cloudflare.com"},
+		Count:      20,
+		Timeout:    10 * time.Second,
+		PathCycles: 10,
+		Workers:    4,
+		Scan: Scan{
+			Timeout:   2 * time.Second,
+			MaxHosts:  256,
+			CIDRLimit: 24,
+		},
+		Load:   LoadTest{Duration: 8 * time.Second, Streams: 4},
+		Voice:  VoiceTest{Duration: 10 * time.Second, Rate: 50, Size: 172},
+		LLDP:   LLDP{Window: time.Minute},
+		DHCP:   DHCP{Window: 3 * time.Second},
+		Packs:  Packs{Cisco: Cisco{Port: 22}},
+		Output: Output{HTML: "vne-report.html"},
+	}
+}
+
+// Loaded is a merged config and where it came from.
+type Loaded struct {
+	Config
+	// Path is the config file that was read; empty when none was found.
+	Path string
+	// Profile is the applied profile, if any.
+	Profile string
+	// Profiles lists the profiles defined in the file.
+	Profiles []string
+}
+
+// SearchPaths lists where a config file is looked for when none is given:
+// vne.yaml in the working directory, then vne/config.yaml under the user
+// config directory ($XDG_CONFIG_HOME or ~/.config on Linux).
+func SearchPaths() []string {
+	paths := []string{"vne.yaml", "vne.yml"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths,
+			filepath.Join(dir, "vne", "config.yaml"),
+			filepath.Join(dir, "vne", "config.yml"),
+		)
+	}
+	return paths
+}
+
+// Load merges the defaults, the config file and the named profile, then
+// applies environment overrides. An explicit path must exist; otherwise the
+// first file found in SearchPaths is used, and having none is not an error
+// unless a profile was asked for.
+func Load(path, profile string) (Loaded, error) {
+	loaded := Loaded{Config: Default()}
+	profile = strings.TrimSpace(profile)
+
+	path = strings.TrimSpace(path)
+	if path == "" {
+		for _, candidate := range SearchPaths() {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return loaded, err
+		}
+		profiles, err := loaded.decodeFile(data)
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded.Path = path
+		for name := range profiles {
+			loaded.Profiles = append(loaded.Profiles, name)
+		}
+		sort.Strings(loaded.Profiles)
+		if profile != "" {
+			node, ok := profiles[profile]
+			if !ok {
+				return loaded, fmt.Errorf("%s: unknown profile %q (defined: %s)", path, profile, listOrNone(loaded.Profiles))
+			}
+			if err := loaded.decodeProfile(&node); err != nil {
+				return loaded, fmt.Errorf("%s: profile %q: %w", path, profile, err)
+			}
+			loaded.Profile = profile
+		}
+	} else if profile != "" {
+		return loaded, fmt.Errorf("profile %q requested but no config file found (looked for %s)", profile, strings.Join(SearchPaths(), ", "))
+	}
+
+	if err := loaded.ApplyEnv(os.LookupEnv); err != nil {
+		return loaded, err
+	}
+	return loaded, nil
+}
+
+// decodeFile overlays the top level of a config file onto c and returns the
+// undecoded profiles. Keys missing from the file keep their current values.
+func (c *Config) decodeFile(data []byte) (map[string]yaml.Node, error) {
+	doc := struct {
+		Config   `yaml:",inline"`
+		Profiles map[string]yaml.Node `yaml:"profiles"`
+	}{Config: *c}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	*c = doc.Config
+	return doc.Profiles, nil
+}
+
+// decodeProfile overlays one profile onto c. The node is re-encoded so the
+// decoder can reject unknown keys, which Node.Decode does not. Decoding
+// replaces lists, so the profile's rules are merged into the file's
+// afterwards.
+func (c *Config) decodeProfile(node *yaml.Node) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	fileRules := c.Rules
+	c.Rules = nil
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	c.Rules = mergeRules(fileRules, c.Rules)
+	return nil
+}
+
+// mergeRules returns base with each rule of over replacing the one with the
+// same id, or appended when there is none.
+func mergeRules(base, over []rules.Rule) []rules.Rule {
+	merged := append([]rules.Rule(nil), base...)
+	for _, r := range over {
+		idx := -1
+		for i := range merged {
+			if strings.TrimSpace(merged[i].ID) == strings.TrimSpace(r.ID) {
+				idx = i
+				break
+			}
+		}
+		if idx >= 0 {
+			merged[idx] = r
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// RuleSet returns the built-in rules with RulesFile and then Rules merged on
+// top.
+func (c Config) RuleSet() (*rules.Set, error) {
+	set, err := rules.LoadWithDefaults(c.RulesFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Rules) == 0 {
+		return set, nil
+	}
+	inline, err := rules.NewSet(c.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("config rules: %w", err)
+	}
+	return set.Merge(inline), nil
+}
+
+// Redacted returns a copy of c with passwords, secrets and SNMP communities
+// masked, for display.
+func (c Config) Redacted() Config {
+	mask := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return "********"
+	}
+	c.Packs.FortiGate.Pass = mask(c.Packs.FortiGate.Pass)
+	c.Packs.Cisco.Pass = mask(c.Packs.Cisco.Pass)
+	c.Packs.Cisco.Secret = mask(c.Packs.Cisco.Secret)
+	if len(c.SNMP) > 0 {
+		devices := make([]SNMPDevice, len(c.SNMP))
+		for i, d := range c.SNMP {
+			d.Community = mask(d.Community)
+			devices[i] = d
+		}
+		c.SNMP = devices
+	}
+	return c
+}
+
+// YAML renders c in config file form.
+func (c Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfileRulesMergeWithFileRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vne.yaml")
+	data := `
+rules:
+  - id: slow-gateway
+    when: gw_ping.avg_ms > 20
+    severity: medium
+    message: slow
+  - id: lossy-wan
+    when: wan_ping.loss > 0.1
+    severity: high
+    message: lossy
+profiles:
+  office:
+    rules:
+      - id: slow-gateway
+        when: gw_ping.avg_ms > 5
+        severity: medium
+        message: slow
+      - id: extra
+        when: "true"
+        severity: info
+        message: extra
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.Config.Rules
+	want := []struct{ id, when string }{
+		{"slow-gateway", "gw_ping.avg_ms > 5"},
+		{"lossy-wan", "wan_ping.loss > 0.1"},
+		{"extra", "true"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rules = %+v, want %d", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].ID != w.id || got[i].When != w.when {
+			t.Errorf("rule %d = %s %q, want %s %q", i, got[i].ID, got[i].When, w.id, w.when)
+		}
+	}
+	if _, err := loaded.Config.RuleSet(); err != nil {
+		t.Errorf("RuleSet: %v", err)
+	}
+
+	loaded, err = Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(loaded.Config.Rules); n != 2 {
+		t.Errorf("without a profile: %d rules, want 2", n)
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envVar binds environment variables to one setting. The first variable
+// that is set and non-empty wins.
+type envVar struct {
+	keys []string
+	set  func(c *Config, val string) error
+}
+
+var envVars = []envVar{
+	{[]string{"VNE_TARGET"}, func(c *Config, v string) error { c.Target, c.Targets = v, nil; return nil }},
+	{[]string{"VNE_TARGETS"}, func(c *Config, v string) error {
+		targets, err := ParseTargets(v)
+		c.Targets = targets
+		return err
+	}},
+	{[]string{"VNE_TARGET6"}, func(c *Config, v string) error { c.Target6 = v; return nil }},
+	{[]string{"VNE_DNS_NAMES"}, func(c *Config, v string) error { c.DNSNames = SplitList(v); return nil }},
+	{[]string{"VNE_RESOLVERS"}, func(c *Config, v string) error { c.Resolvers = SplitList(v); return nil }},
+	{[]string{"VNE_APPS"}, func(c *Config, v string) error { c.Apps = SplitList(v); return nil }},
+	{[]string{"VNE_LOAD_ENDPOINT"}, func(c *Config, v string) error { c.Load.Endpoint = v; return nil }},
+	{[]string{"VNE_LOAD_DURATION"}, durationVar(func(c *Config) *time.Duration { return &c.Load.Duration })},
+	{[]string{"VNE_LOAD_STREAMS"}, intVar(func(c *Config) *int { return &c.Load.Streams })},
+	{[]string{"VNE_VOICE_ENDPOINT"}, func(c *Config, v string) error { c.Voice.Endpoint = v; return nil }},
+	{[]string{"VNE_VOICE_DURATION"}, durationVar(func(c *Config) *time.Duration { return &c.Voice.Duration })},
+	{[]string{"VNE_VOICE_RATE"}, intVar(func(c *Config) *int { return &c.Voice.Rate })},
+	{[]string{"VNE_VOICE_SIZE"}, intVar(func(c *Config) *int { return &c.Voice.Size })},
+	{[]string{"VNE_LLDP_WINDOW"}, durationVar(func(c *Config) *time.Duration { return &c.LLDP.Window })},
+	{[]string{"VNE_DHCP_WINDOW"}, durationVar(func(c *Config) *time.Duration { return &c.DHCP.Window })},
+	{[]string{"VNE_COUNT"}, intVar(func(c *Config) *int { return &c.Count })},
+	{[]string{"VNE_TIMEOUT"}, durationVar(func(c *Config) *time.Duration { return &c.Timeout })},
+	{[]string{"VNE_PATH_CYCLES"}, intVar(func(c *Config) *int { return &c.PathCycles })},
+	{[]string{"VNE_WORKERS"}, intVar(func(c *Config) *int { return &c.Workers })},
+	{[]string{"VNE_PROBES"}, func(c *Config, v string) error { c.Probes = SplitList(v); return nil }},
+	{[]string{"VNE_SKIP_PROBES"}, func(c *Config, v string) error { c.SkipProbes = SplitList(v); return nil }},
+	{[]string{"VNE_RULES"}, func(c *Config, v string) error { c.RulesFile = v; return nil }},
+	{[]string{"VNE_PYTHON"}, func(c *Config, v string) error { c.Packs.Python = v; return nil }},
+	{[]string{"FORTI_HOST", "FORTIGATE_HOST"}, func(c *Config, v string) error { c.Packs.FortiGate.Host = v; return nil }},
+	{[]string{"FORTI_USER", "FORTIGATE_USER"}, func(c *Config, v string) error { c.Packs.FortiGate.User = v; return nil }},
+	{[]string{"FORTI_PASS", "FORTI_PASSWORD", "FORTIGATE_PASS", "FORTIGATE_PASSWORD"}, func(c *Config, v string) error { c.Packs.FortiGate.Pass = v; return nil }},
+	{[]string{"CISCO_HOST"}, func(c *Config, v string) error { c.Packs.Cisco.Host = v; return nil }},
+	{[]string{"CISCO_USER"}, func(c *Config, v string) error { c.Packs.Cisco.User = v; return nil }},
+	{[]string{"CISCO_PASS", "CISCO_PASSWORD"}, func(c *Config, v string) error { c.Packs.Cisco.Pass = v; return nil }},
+	{[]string{"CISCO_SECRET"}, func(c *Config, v string) error { c.Packs.Cisco.Secret = v; return nil }},
+	{[]string{"CISCO_PORT"}, intVar(func(c *Config) *int { return &c.Packs.Cisco.Port })},
+}
+
+// ApplyEnv overrides settings from environment variables, looked up with
+// lookup (normally os.LookupEnv).
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, ev := range envVars {
+		for _, key := range ev.keys {
+			val, ok := lookup(key)
+			val = strings.TrimSpace(val)
+			if !ok || val == "" {
+				continue
+			}
+			if err := ev.set(c, val); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func intVar(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func durationVar(field func(c *Config) *time.Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// SplitList splits a comma-separated value, dropping empty entries.
+func SplitList(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
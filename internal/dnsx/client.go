@@ -0,0 +1,432 @@
+package dnsx
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cneate93/vne/internal/httpx"
+)
+
+// Record is one answer record.
+type Record struct {
+	Name string
+	// Type is the record type's mnemonic, e.g. "AAAA".
+	Type string
+	TTL  uint32
+	// Value is the record data in zone-file form, e.g. "10 mx.example.com."
+	// for an MX record.
+	Value string
+}
+
+// Response is the outcome of one query.
+type Response struct {
+	// Rcode is the response code's mnemonic, e.g. "NOERROR" or "NXDOMAIN".
+	Rcode string
+	// Truncated is set when the UDP answer had the TC bit set. The query is
+	// then repeated over TCP and Answers come from the TCP response.
+	Truncated bool
+	Answers   []Record
+	// From is the address the answer came from.
+	From string
+	// RTT runs from sending the query to parsing the answer. For TCP, TLS
+	// and HTTPS it includes the connection setup, since every query uses a
+	// fresh connection.
+	RTT time.Duration
+}
+
+// Client sends single queries. The zero value is ready to use.
+type Client struct {
+	// Timeout bounds each query, including a TCP retry after truncation;
+	// zero selects 5 seconds.
+	Timeout time.Duration
+	// TLSConfig is used for TLS and HTTPS servers; nil verifies them against
+	// the system roots.
+	TLSConfig *tls.Config
+	// AnySource accepts UDP answers from any address rather than only from
+	// the server queried, so From shows who really answered. Transparent DNS
+	// interception answers in the server's name or from its own address.
+	AnySource bool
+}
+
+// maxMessage is the largest DNS message over TCP, TLS and HTTPS.
+const maxMessage = 65535
+
+// ednsSize is the UDP payload size advertised with EDNS(0), the value
+// agreed on for DNS flag day 2020 to avoid IP fragmentation.
+const ednsSize = 1232
+
+// udpRetry is how long to wait for a UDP answer before resending.
+const udpRetry = time.Second
+
+var typeNames = map[dnsmessage.Type]string{
+	dnsmessage.TypeA:     "A",
+	dnsmessage.TypeNS:    "NS",
+	dnsmessage.TypeCNAME: "CNAME",
+	dnsmessage.TypeSOA:   "SOA",
+	dnsmessage.TypePTR:   "PTR",
+	dnsmessage.TypeMX:    "MX",
+	dnsmessage.TypeTXT:   "TXT",
+	dnsmessage.TypeAAAA:  "AAAA",
+	dnsmessage.TypeSRV:   "SRV",
+}
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+func typeName(t dnsmessage.Type) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+func rcodeName(rc dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rc]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rc)
+}
+
+// Query asks s for the records of type qtype ("A", "AAAA", "CNAME", "MX",
+// ...) at name. An error means no usable answer arrived; a negative answer
+// such as NXDOMAIN or SERVFAIL is a Response with that Rcode.
+func (c *Client) Query(ctx context.Context, s Server, name, qtype string) (*Response, error) {
+	var t dnsmessage.Type
+	for k, v := range typeNames {
+		if strings.EqualFold(v, qtype) {
+			t = k
+		}
+	}
+	if t == 0 {
+		return nil, fmt.Errorf("unsupported record type %q", qtype)
+	}
+	return c.exchange(ctx, s, name, t, dnsmessage.ClassINET)
+}
+
+// ServerID asks s who it is with a CHAOS-class TXT query for id.server
+// (RFC 4892). Anycast resolvers answer with the instance that served the
+// query, e.g. an airport code; the TXT text is the only answer's Value.
+func (c *Client) ServerID(ctx context.Context, s Server) (*Response, error) {
+	return c.exchange(ctx, s, "id.server.", dnsmessage.TypeTXT, dnsmessage.ClassCHAOS)
+}
+
+func (c *Client) exchange(ctx context.Context, s Server, name string, t dnsmessage.Type, class dnsmessage.Class) (*Response, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, err
+	}
+	q := dnsmessage.Question{Name: qname, Type: t, Class: class}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// RFC 8484 asks DoH clients to use ID 0 so responses cache well.
+	var id uint16
+	if s.Transport != "https" {
+		id = uint16(rand.Uint32())
+	}
+	msg, err := newQuery(q, id)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	var raw []byte
+	from := s.Addr
+	switch s.Transport {
+	case "udp", "":
+		raw, from, err = exchangeUDP(ctx, s.Addr, msg[2:], id, c.AnySource)
+	case "tcp":
+		raw, err = exchangeStream(ctx, s.Addr, msg, nil)
+	case "tls":
+		raw, err = exchangeStream(ctx, s.Addr, msg, c.tlsConfig(s.Addr))
+	case "https":
+		raw, err = c.exchangeHTTPS(ctx, s.Addr, msg[2:])
+	default:
+		return nil, fmt.Errorf("unknown transport %q", s.Transport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp, err := parseResponse(raw, id, q)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Truncated && (s.Transport == "udp" || s.Transport == "") {
+		raw, err = exchangeStream(ctx, s.Addr, msg, nil)
+		if err != nil {
+			return nil, fmt.Errorf("answer truncated over UDP, TCP retry failed: %w", err)
+		}
+		full, err := parseResponse(raw, id, q)
+		if err != nil {
+			return nil, fmt.Errorf("answer truncated over UDP, TCP retry failed: %w", err)
+		}
+		full.Truncated = true
+		resp = full
+	}
+	resp.From = from
+	resp.RTT = time.Since(start)
+	return resp, nil
+}
+
+// newQuery builds a recursive query for q with an EDNS(0) record, behind a
+// two-byte length prefix for the stream transports.
+func newQuery(q dnsmessage.Question, id uint16) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 2, 514), dnsmessage.Header{ID: id, RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsSize, dnsmessage.RCodeSuccess, false); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(msg, uint16(len(msg)-2))
+	return msg, nil
+}
+
+var errMismatch = errors.New("response does not match the query")
+
+// parseResponse decodes an answer to q. A truncated answer may end in the
+// middle of a record; whatever parsed is kept.
+func parseResponse(raw []byte, id uint16, q dnsmessage.Question) (*Response, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bad response: %w", err)
+	}
+	if !h.Response || h.ID != id {
+		return nil, errMismatch
+	}
+	qs, err := p.AllQuestions()
+	if err != nil && !h.Truncated {
+		return nil, fmt.Errorf("bad response: %w", err)
+	}
+	if len(qs) > 0 && (qs[0].Type != q.Type || !strings.EqualFold(qs[0].Name.String(), q.Name.String())) {
+		return nil, errMismatch
+	}
+	resp := &Response{Rcode: rcodeName(h.RCode), Truncated: h.Truncated}
+	for {
+		ans, err := p.Answer()
+		if err != nil {
+			if errors.Is(err, dnsmessage.ErrSectionDone) || h.Truncated {
+				break
+			}
+			return nil, fmt.Errorf("bad response: %w", err)
+		}
+		resp.Answers = append(resp.Answers, Record{
+			Name:  ans.Header.Name.String(),
+			Type:  typeName(ans.Header.Type),
+			TTL:   ans.Header.TTL,
+			Value: recordValue(ans.Body),
+		})
+	}
+	return resp, nil
+}
+
+// recordValue formats the data of one record.
+func recordValue(body dnsmessage.ResourceBody) string {
+	switch body := body.(type) {
+	case *dnsmessage.AResource:
+		return netip.AddrFrom4(body.A).String()
+	case *dnsmessage.AAAAResource:
+		return netip.AddrFrom16(body.AAAA).String()
+	case *dnsmessage.CNAMEResource:
+		return body.CNAME.String()
+	case *dnsmessage.NSResource:
+		return body.NS.String()
+	case *dnsmessage.PTRResource:
+		return body.PTR.String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", body.Pref, body.MX)
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", body.Priority, body.Weight, body.Port, body.Target)
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d", body.NS, body.MBox, body.Serial)
+	case *dnsmessage.TXTResource:
+		return strings.Join(body.TXT, "")
+	}
+	return ""
+}
+
+// exchangeUDP sends msg and waits for the answer with a matching ID,
+// resending every udpRetry until ctx expires. It returns the answer and the
+// address it came from, which is addr unless anySource is set.
+func exchangeUDP(ctx context.Context, addr string, msg []byte, id uint16, anySource bool) ([]byte, string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	var pc net.PacketConn
+	if anySource {
+		// A connected socket drops datagrams from other addresses, so read
+		// from an unconnected one on a fresh port instead.
+		if pc, err = net.ListenPacket("udp", ""); err != nil {
+			return nil, "", err
+		}
+		defer pc.Close()
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+		if pc != nil {
+			pc.SetDeadline(time.Now())
+		}
+	})
+	defer stop()
+
+	buf := make([]byte, maxMessage)
+	for ctx.Err() == nil {
+		var err error
+		if pc != nil {
+			_, err = pc.WriteTo(msg, conn.RemoteAddr())
+			pc.SetReadDeadline(time.Now().Add(udpRetry))
+		} else {
+			_, err = conn.Write(msg)
+			conn.SetReadDeadline(time.Now().Add(udpRetry))
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		for {
+			var n int
+			from := addr
+			if pc != nil {
+				var src net.Addr
+				n, src, err = pc.ReadFrom(buf)
+				if src != nil {
+					from = src.String()
+				}
+			} else {
+				n, err = conn.Read(buf)
+			}
+			if err != nil {
+				var nerr net.Error
+				if errors.As(err, &nerr) && nerr.Timeout() {
+					break
+				}
+				return nil, "", err
+			}
+			// Drop stray and spoofed datagrams with the wrong ID.
+			if n >= 2 && binary.BigEndian.Uint16(buf) == id {
+				return buf[:n], from, nil
+			}
+		}
+	}
+	return nil, "", ctx.Err()
+}
+
+// exchangeStream sends the length-prefixed msg over TCP, or over TLS when
+// tlsConfig is set, and reads one length-prefixed answer.
+func exchangeStream(ctx context.Context, addr string, msg []byte, tlsConfig *tls.Config) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		d := tls.Dialer{Config: tlsConfig}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// exchangeHTTPS POSTs msg to a DNS-over-HTTPS URL.
+func (c *Client) exchangeHTTPS(ctx context.Context, url string, msg []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", "vne-agent")
+	// The transport adds its ALPN protocols to the config, so each query
+	// gets its own copy.
+	var tlsConfig *tls.Config
+	if c.TLSConfig != nil {
+		tlsConfig = c.TLSConfig.Clone()
+	}
+	transport := httpx.OneShotTransport(tlsConfig)
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMessage))
+}
+
+// tlsConfig returns the TLS settings for a DNS-over-TLS server, checking
+// its certificate against the host part of addr.
+func (c *Client) tlsConfig(addr string) *tls.Config {
+	cfg := &tls.Config{}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		host, _, _ := net.SplitHostPort(addr)
+		cfg.ServerName = host
+	}
+	return cfg
+}
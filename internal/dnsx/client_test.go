@@ -0,0 +1,186 @@
+package dnsx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cneate93/vne/internal/dnsx/dnstest"
+)
+
+func TestQueryRcodes(t *testing.T) {
+	tests := []struct {
+		rcode dnsmessage.RCode
+		want  string
+	}{
+		{dnsmessage.RCodeSuccess, "NOERROR"},
+		{dnsmessage.RCodeNameError, "NXDOMAIN"},
+		{dnsmessage.RCodeServerFailure, "SERVFAIL"},
+		{dnsmessage.RCodeRefused, "REFUSED"},
+		{dnsmessage.RCode(9), "RCODE9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+				if tt.rcode != dnsmessage.RCodeSuccess {
+					return dnstest.Reply(req, tt.rcode)
+				}
+				return dnstest.Reply(req, tt.rcode, dnstest.A(req.Questions[0], 300, "192.0.2.1"))
+			})
+			defer srv.Close()
+			for _, transport := range []string{"udp", "tcp"} {
+				c := &Client{Timeout: time.Second}
+				resp, err := c.Query(context.Background(), Server{Transport: transport, Addr: srv.Addr}, "example.com", "A")
+				if err != nil {
+					t.Fatalf("%s: %v", transport, err)
+				}
+				if resp.Rcode != tt.want {
+					t.Errorf("%s: rcode %s, want %s", transport, resp.Rcode, tt.want)
+				}
+				if tt.rcode == dnsmessage.RCodeSuccess {
+					want := Record{Name: "example.com.", Type: "A", TTL: 300, Value: "192.0.2.1"}
+					if len(resp.Answers) != 1 || resp.Answers[0] != want {
+						t.Errorf("%s: answers %+v, want %+v", transport, resp.Answers, want)
+					}
+				}
+				if resp.From != srv.Addr {
+					t.Errorf("%s: from %s, want %s", transport, resp.From, srv.Addr)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryTruncatedRetriesOverTCP(t *testing.T) {
+	srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		if !tcp {
+			resp := dnstest.Reply(req, dnsmessage.RCodeSuccess)
+			resp.Header.Truncated = true
+			return resp
+		}
+		q := req.Questions[0]
+		return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.A(q, 60, "192.0.2.1"), dnstest.A(q, 60, "192.0.2.2"))
+	})
+	defer srv.Close()
+	c := &Client{Timeout: time.Second}
+	resp, err := c.Query(context.Background(), Server{Transport: "udp", Addr: srv.Addr}, "example.com", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Truncated || len(resp.Answers) != 2 {
+		t.Errorf("truncated %v with %d answers, want the TCP retry's 2 answers", resp.Truncated, len(resp.Answers))
+	}
+}
+
+func TestQueryRejectsMismatchedResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		mangle func(*dnsmessage.Message)
+	}{
+		{"id", func(m *dnsmessage.Message) { m.Header.ID++ }},
+		{"question", func(m *dnsmessage.Message) {
+			m.Questions = []dnsmessage.Question{{Name: dnsmessage.MustNewName("other.example."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}}
+		}},
+		{"type", func(m *dnsmessage.Message) {
+			m.Questions = []dnsmessage.Question{{Name: m.Questions[0].Name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET}}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+				resp := dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.A(req.Questions[0], 60, "192.0.2.66"))
+				tt.mangle(resp)
+				return resp
+			})
+			defer srv.Close()
+			for _, transport := range []string{"udp", "tcp"} {
+				c := &Client{Timeout: 300 * time.Millisecond}
+				resp, err := c.Query(context.Background(), Server{Transport: transport, Addr: srv.Addr}, "example.com", "A")
+				if err == nil {
+					t.Errorf("%s: accepted %+v", transport, resp)
+				}
+			}
+		})
+	}
+	// A TCP answer is the only one on its connection, so a wrong ID is
+	// reported as a mismatch rather than waited out.
+	srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		resp := dnstest.Reply(req, dnsmessage.RCodeSuccess)
+		resp.Header.ID++
+		return resp
+	})
+	defer srv.Close()
+	c := &Client{Timeout: time.Second}
+	if _, err := c.Query(context.Background(), Server{Transport: "tcp", Addr: srv.Addr}, "example.com", "A"); !errors.Is(err, errMismatch) {
+		t.Errorf("tcp error %v, want %v", err, errMismatch)
+	}
+}
+
+func TestQueryAnySource(t *testing.T) {
+	srv := dnstest.NewServerFrom(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.A(req.Questions[0], 60, "192.0.2.1"))
+	}, "127.0.0.2")
+	defer srv.Close()
+	s := Server{Transport: "udp", Addr: srv.Addr}
+
+	c := &Client{Timeout: 300 * time.Millisecond}
+	if resp, err := c.Query(context.Background(), s, "example.com", "A"); err == nil {
+		t.Errorf("accepted an answer from %s without AnySource", resp.From)
+	}
+	c.AnySource = true
+	resp, err := c.Query(context.Background(), s, "example.com", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.From != srv.From() {
+		t.Errorf("from %s, want %s", resp.From, srv.From())
+	}
+}
+
+func TestServerID(t *testing.T) {
+	srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		q := req.Questions[0]
+		if q.Class != dnsmessage.ClassCHAOS || q.Name.String() != "id.server." {
+			return dnstest.Reply(req, dnsmessage.RCodeRefused)
+		}
+		return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.TXT(q, "AMS"))
+	})
+	defer srv.Close()
+	c := &Client{Timeout: time.Second}
+	resp, err := c.ServerID(context.Background(), Server{Transport: "udp", Addr: srv.Addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Answers) != 1 || resp.Answers[0].Value != "AMS" {
+		t.Errorf("answers %+v, want the TXT AMS", resp.Answers)
+	}
+}
+
+func TestQueryHTTPS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req dnsmessage.Message
+		if r.Header.Get("Content-Type") != "application/dns-message" || req.Unpack(body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		resp, _ := dnstest.Reply(&req, dnsmessage.RCodeSuccess, dnstest.A(req.Questions[0], 60, "192.0.2.1")).Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(resp)
+	}))
+	defer srv.Close()
+	c := &Client{Timeout: time.Second, TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig}
+	resp, err := c.Query(context.Background(), Server{Transport: "https", Addr: srv.URL + "/dns-query"}, "example.com", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != "NOERROR" || len(resp.Answers) != 1 {
+		t.Errorf("rcode %s answers %+v, want one A record", resp.Rcode, resp.Answers)
+	}
+}
@@ -0,0 +1,200 @@
+// Package dnstest runs in-process DNS servers for tests. A server answers
+// over UDP and TCP on the same loopback port with whatever its Handler
+// returns, which lets tests script truncation, wrong IDs, negative answers
+// and spoofed sources.
+package dnstest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Handler answers one query; tcp tells which transport it arrived over. A
+// nil response drops the query.
+type Handler func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message
+
+// Server is a DNS server listening on 127.0.0.1.
+type Server struct {
+	// Addr is the host:port of both the UDP and the TCP listener.
+	Addr string
+
+	handler Handler
+	udp     *net.UDPConn
+	tcp     *net.TCPListener
+	// from, when set, sends the UDP answers instead of udp, as a
+	// transparent DNS proxy answering from its own address would.
+	from *net.UDPConn
+	wg   sync.WaitGroup
+}
+
+// NewServer starts a server answering with h. It panics if it cannot
+// listen, like httptest.NewServer.
+func NewServer(h Handler) *Server {
+	s, err := start(h, "")
+	if err != nil {
+		panic("dnstest: " + err.Error())
+	}
+	return s
+}
+
+// NewServerFrom starts a server whose UDP answers come from fromHost, another
+// loopback address such as 127.0.0.2, rather than from Addr.
+func NewServerFrom(h Handler, fromHost string) *Server {
+	s, err := start(h, fromHost)
+	if err != nil {
+		panic("dnstest: " + err.Error())
+	}
+	return s
+}
+
+func start(h Handler, fromHost string) (*Server, error) {
+	s := &Server{handler: h}
+	// Take a free UDP port and try for the same TCP port; another test may
+	// hold it, so retry with a new one a few times.
+	var err error
+	for i := 0; i < 10; i++ {
+		s.udp, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			return nil, err
+		}
+		s.tcp, err = net.ListenTCP("tcp", net.TCPAddrFromAddrPort(s.udp.LocalAddr().(*net.UDPAddr).AddrPort()))
+		if err == nil {
+			break
+		}
+		s.udp.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if fromHost != "" {
+		if s.from, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(fromHost)}); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	s.Addr = s.udp.LocalAddr().String()
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, nil
+}
+
+// From returns the address UDP answers are sent from.
+func (s *Server) From() string {
+	if s.from != nil {
+		return s.from.LocalAddr().String()
+	}
+	return s.Addr
+}
+
+// Close stops the server and waits for it to finish.
+func (s *Server) Close() {
+	s.udp.Close()
+	s.tcp.Close()
+	if s.from != nil {
+		s.from.Close()
+	}
+	s.wg.Wait()
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	out := s.udp
+	if s.from != nil {
+		out = s.from
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, src, err := s.udp.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n], false); resp != nil {
+			out.WriteToUDP(resp, src)
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			for {
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, msg); err != nil {
+					return
+				}
+				resp := s.answer(msg, true)
+				if resp == nil {
+					return
+				}
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+			}
+		}()
+	}
+}
+
+func (s *Server) answer(raw []byte, tcp bool) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(raw); err != nil {
+		return nil
+	}
+	resp := s.handler(&req, tcp)
+	if resp == nil {
+		return nil
+	}
+	b, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Reply returns the response to req with rcode and answers, echoing its ID
+// and question.
+func Reply(req *dnsmessage.Message, rcode dnsmessage.RCode, answers ...dnsmessage.Resource) *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 req.Header.ID,
+			Response:           true,
+			RecursionDesired:   req.Header.RecursionDesired,
+			RecursionAvailable: true,
+			RCode:              rcode,
+		},
+		Questions: req.Questions,
+		Answers:   answers,
+	}
+}
+
+// A returns an A record for the question q.
+func A(q dnsmessage.Question, ttl uint32, addr string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.AResource{A: netip.MustParseAddr(addr).As4()},
+	}
+}
+
+// TXT returns a TXT record for the question q in q's class, e.g. CHAOS for
+// id.server.
+func TXT(q dnsmessage.Question, text string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: q.Class},
+		Body:   &dnsmessage.TXTResource{TXT: []string{text}},
+	}
+}
@@ -0,0 +1,92 @@
+// Package dnsx sends DNS queries to one chosen resolver over UDP, TCP,
+// DNS-over-TLS (RFC 7858) or DNS-over-HTTPS (RFC 8484) and reports the raw
+// outcome: response code, truncation, answers and TTLs. Unlike net.Resolver
+// it does not fold NXDOMAIN and SERVFAIL into one error or hide which server
+// answered.
+package dnsx
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Server is a resolver and the transport used to reach it.
+type Server struct {
+	// Transport is "udp", "tcp", "tls" or "https".
+	Transport string
+	// Addr is host:port, or the URL of a DNS-over-HTTPS server.
+	Addr string
+}
+
+// ParseServer parses a resolver spec: a bare address such as "1.1.1.1" or
+// "[::1]:5353" for UDP, "tcp://", "tls://" or "udp://" followed by an
+// address, or an https:// URL for DNS-over-HTTPS. Ports default to 53, or
+// 853 for TLS.
+func ParseServer(spec string) (Server, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Server{}, fmt.Errorf("empty resolver")
+	}
+	scheme, rest, ok := strings.Cut(spec, "://")
+	if !ok {
+		scheme, rest = "udp", spec
+	}
+	switch scheme = strings.ToLower(scheme); scheme {
+	case "https":
+		u, err := url.Parse(spec)
+		if err != nil {
+			return Server{}, fmt.Errorf("resolver %q: %w", spec, err)
+		}
+		if u.Host == "" {
+			return Server{}, fmt.Errorf("resolver %q has no host", spec)
+		}
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return Server{Transport: "https", Addr: u.String()}, nil
+	case "udp", "tcp", "tls":
+		port := "53"
+		if scheme == "tls" {
+			port = "853"
+		}
+		rest = strings.TrimSuffix(rest, "/")
+		host, p, err := net.SplitHostPort(rest)
+		if err != nil {
+			// A bare host, or an IPv6 address without brackets or port.
+			host, p = strings.Trim(rest, "[]"), port
+		}
+		if host == "" {
+			return Server{}, fmt.Errorf("resolver %q has no host", spec)
+		}
+		return Server{Transport: scheme, Addr: net.JoinHostPort(host, p)}, nil
+	}
+	return Server{}, fmt.Errorf("resolver %q: unknown transport %q", spec, scheme)
+}
+
+// String formats s as a spec ParseServer accepts, leaving out the UDP
+// scheme and default ports.
+func (s Server) String() string {
+	if s.Transport == "https" {
+		return s.Addr
+	}
+	host, port, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return s.Transport + "://" + s.Addr
+	}
+	addr := s.Addr
+	if (s.Transport == "tls" && port == "853") || (s.Transport != "tls" && port == "53") {
+		if s.Transport == "udp" {
+			return host
+		}
+		addr = host
+		if strings.Contains(host, ":") {
+			addr = "[" + host + "]"
+		}
+	}
+	if s.Transport == "udp" {
+		return addr
+	}
+	return s.Transport + "://" + addr
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type appsProbe struct{}
+
+func (appsProbe) Name() string       { return "apps" }
+func (appsProbe) Title() string      { return "Application reachability" }
+func (appsProbe) Requires() []string { return nil }
+
+// Run times the DNS, connect, TLS and first-byte stages of every configured
+// application at the same time.
+func (appsProbe) Run(ctx context.Context, bag *Bag) error {
+	apps := bag.Params.Apps
+	if len(apps) == 0 {
+		return nil
+	}
+	bag.Say("→ Checking application reachability…")
+	log.Println("Checking application reachability")
+
+	results := make([]probes.AppResult, len(apps))
+	var wg sync.WaitGroup
+	for i, app := range apps {
+		wg.Add(1)
+		go func(i int, app string) {
+			defer wg.Done()
+			results[i] = probes.AppCheck(ctx, app, bag.Params.Timeout)
+		}(i, app)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		if r.Error != "" {
+			bag.Println(fmt.Sprintf("  %s: %s", r.Target, r.Error))
+			log.Printf("app check %s: %s", r.Target, r.Error)
+			continue
+		}
+		if r.Kind == "tcp" {
+			bag.Println(fmt.Sprintf("  %s: connected in %.0f ms", r.Target, r.ConnectMs))
+			continue
+		}
+		bag.Println(fmt.Sprintf("  %s: HTTP %d in %.0f ms (dns %.0f, connect %.0f, tls %.0f, ttfb %.0f)",
+			r.Target, r.Status, r.TotalMs, r.DNSMs, r.ConnectMs, r.TLSMs, r.TTFBMs))
+	}
+	bag.Update(func(res *report.Results) {
+		res.Apps = results
+	})
+	return ctx.Err()
+}
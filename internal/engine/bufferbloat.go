@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type bufferbloatProbe struct{}
+
+func (bufferbloatProbe) Name() string       { return "bufferbloat" }
+func (bufferbloatProbe) Title() string      { return "Latency under load" }
+func (bufferbloatProbe) Requires() []string { return nil }
+
+// Exclusive keeps the load off every other measurement.
+func (bufferbloatProbe) Exclusive() bool { return true }
+
+func (bufferbloatProbe) Run(ctx context.Context, bag *Bag) error {
+	params := bag.Params
+	if params.LoadEndpoint == "" {
+		bag.Say("→ Skipping latency under load (set --load-endpoint to a reflector).")
+		log.Println("Skipping latency under load (no reflector)")
+		return nil
+	}
+	bag.Say("→ Measuring latency under load against " + params.LoadEndpoint + "…")
+	log.Println("Measuring latency under load against", params.LoadEndpoint)
+	res := probes.Bufferbloat(ctx, params.LoadEndpoint, params.LoadDuration, params.LoadStreams)
+	if res.Error != "" {
+		bag.Println("  Latency under load:", res.Error)
+		log.Println("latency under load:", res.Error)
+	} else {
+		bag.Println(fmt.Sprintf("  Idle %.1f ms; download %.1f Mbit/s +%.1f ms; upload %.1f Mbit/s +%.1f ms; grade %s",
+			res.Idle.AvgMs, res.Download.Mbps, res.Download.IncreaseMs, res.Upload.Mbps, res.Upload.IncreaseMs, res.Grade))
+	}
+	bag.Update(func(r *report.Results) { r.Bufferbloat = &res })
+	return ctx.Err()
+}
@@ -0,0 +1,24 @@
+package engine
+
+// The built-in probes, registered in the order they run when nothing else
+// constrains them.
+func init() {
+	Register(netinfoProbe{})
+	Register(wirelessProbe{})
+	Register(l2ScanProbe{})
+	Register(lldpProbe{})
+	Register(dhcpProbe{})
+	Register(gatewayProbe{})
+	Register(dnsProbe{})
+	Register(resolversProbe{})
+	Register(dnsTamperProbe{})
+	Register(wanProbe{})
+	Register(traceProbe{})
+	Register(pathProbe{})
+	Register(mtuProbe{})
+	Register(ipv6Probe{})
+	Register(appsProbe{})
+	Register(voiceProbe{})
+	Register(bufferbloatProbe{})
+	Register(nicCountersProbe{})
+}
@@ -0,0 +1,147 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type dhcpProbe struct{}
+
+func (dhcpProbe) Name() string  { return "dhcp" }
+func (dhcpProbe) Title() string { return "DHCP servers" }
+
+// Requires the layer-2 scan so the servers' MAC addresses and vendors can be
+// filled in when it ran.
+func (dhcpProbe) Requires() []string { return []string{"netinfo", "l2-scan"} }
+
+// Run broadcasts a DHCPDISCOVER on the LAN interface and records every
+// offer, flagging those whose router or DNS servers differ from the ones the
+// host uses. No lease is requested.
+func (dhcpProbe) Run(ctx context.Context, bag *Bag) error {
+	res := bag.Results()
+	iface := lanIface(res.NetInfo)
+	if iface == "" {
+		bag.Say("→ Skipping DHCP discovery (no LAN interface).")
+		log.Println("Skipping DHCP discovery (no LAN interface)")
+		return nil
+	}
+	bag.Say(fmt.Sprintf("→ Looking for DHCP servers on %s (DISCOVER only, no lease taken)…", iface))
+	log.Println("Sending DHCPDISCOVER on", iface)
+	dhcp, err := probes.DHCPDiscover(ctx, iface, bag.Params.DHCPWindow)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, os.ErrPermission) {
+			err = fmt.Errorf("%w (needs root)", err)
+		}
+		bag.Println("  Skipping DHCP discovery:", err)
+		log.Println("DHCP discovery:", err)
+		return nil
+	}
+	markDHCPMismatches(dhcp, res.NetInfo)
+	for i := range dhcp.Offers {
+		o := &dhcp.Offers[i]
+		for _, h := range res.Discovered {
+			if h.IP == o.From {
+				o.ServerMAC, o.ServerVendor = h.MAC, h.Vendor
+				break
+			}
+		}
+	}
+	if len(dhcp.Offers) == 0 {
+		bag.Println(fmt.Sprintf("  No DHCP offers received on %s within %s.", iface, bag.Params.DHCPWindow))
+	}
+	for _, o := range dhcp.Offers {
+		bag.Println("  " + describeOffer(o))
+	}
+	if len(dhcp.Servers) > 1 {
+		bag.Println(fmt.Sprintf("  %d DHCP servers answered: %s.", len(dhcp.Servers), strings.Join(dhcp.Servers, ", ")))
+	}
+	bag.Update(func(r *report.Results) { r.DHCP = dhcp })
+	return nil
+}
+
+// markDHCPMismatches flags the offers none of whose routers is a default
+// gateway of the host and none of whose DNS servers is one the host
+// queries. Either check is skipped when the host has nothing to compare
+// with, e.g. only a local stub resolver.
+func markDHCPMismatches(res *probes.DHCPResult, ni probes.NetInfo) {
+	gateways := ipv4Only(ni.Gateways)
+	var dns []string
+	for _, s := range ipv4Only(ni.DNSServers) {
+		if !net.ParseIP(s).IsLoopback() {
+			dns = append(dns, s)
+		}
+	}
+	for i := range res.Offers {
+		o := &res.Offers[i]
+		o.GatewayMismatch = len(gateways) > 0 && !overlaps(o.Routers, gateways)
+		o.DNSMismatch = len(dns) > 0 && !overlaps(o.DNS, dns)
+	}
+}
+
+func ipv4Only(addrs []string) []string {
+	var out []string
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip != nil && ip.To4() != nil {
+			out = append(out, ip.String())
+		}
+	}
+	return out
+}
+
+func overlaps(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeOffer summarises an offer on one line, e.g. "10.0.0.1 offered
+// 10.0.0.57/255.255.255.0, router 10.0.0.1, DNS 10.0.0.1, lease 24h0m0s".
+func describeOffer(o probes.DHCPOffer) string {
+	head := o.ServerID
+	if o.ServerVendor != "" {
+		head += " (" + o.ServerVendor + ")"
+	}
+	if o.From != o.ServerID {
+		head += " via " + o.From
+	}
+	addr := o.OfferedIP
+	if o.SubnetMask != "" {
+		addr += "/" + o.SubnetMask
+	}
+	parts := []string{head + " offered " + addr}
+	if len(o.Routers) > 0 {
+		router := "router " + strings.Join(o.Routers, ", ")
+		if o.GatewayMismatch {
+			router += " (not the current gateway)"
+		}
+		parts = append(parts, router)
+	}
+	if len(o.DNS) > 0 {
+		dns := "DNS " + strings.Join(o.DNS, ", ")
+		if o.DNSMismatch {
+			dns += " (not the current DNS)"
+		}
+		parts = append(parts, dns)
+	}
+	if o.LeaseSec > 0 {
+		parts = append(parts, "lease "+(time.Duration(o.LeaseSec)*time.Second).String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/cneate93/vne/internal/probes"
+)
+
+func TestMarkDHCPMismatches(t *testing.T) {
+	legit := probes.DHCPOffer{ServerID: "10.0.0.1", Routers: []string{"10.0.0.1"}, DNS: []string{"10.0.0.1", "10.0.0.2"}}
+	rogue := probes.DHCPOffer{ServerID: "192.168.99.1", Routers: []string{"192.168.99.1"}, DNS: []string{"192.168.99.1"}}
+	bare := probes.DHCPOffer{ServerID: "10.0.0.9"}
+
+	tests := []struct {
+		name string
+		ni   probes.NetInfo
+		// want holds the gateway and DNS flags of legit, rogue and bare.
+		want [3][2]bool
+	}{
+		{
+			name: "both checked",
+			ni:   probes.NetInfo{Gateways: []string{"10.0.0.1"}, DNSServers: []string{"10.0.0.2"}},
+			want: [3][2]bool{{false, false}, {true, true}, {true, true}},
+		},
+		{
+			name: "stub resolver",
+			ni:   probes.NetInfo{Gateways: []string{"10.0.0.1"}, DNSServers: []string{"127.0.0.53"}},
+			want: [3][2]bool{{false, false}, {true, false}, {true, false}},
+		},
+		{
+			name: "no gateway",
+			ni:   probes.NetInfo{DNSServers: []string{"10.0.0.1"}},
+			want: [3][2]bool{{false, false}, {false, true}, {false, true}},
+		},
+		{
+			name: "IPv6 only",
+			ni:   probes.NetInfo{Gateways: []string{"fe80::1%eth0"}, DNSServers: []string{"2001:db8::53", "::1"}},
+			want: [3][2]bool{{false, false}, {false, false}, {false, false}},
+		},
+		{
+			name: "IPv4 among IPv6",
+			ni:   probes.NetInfo{Gateways: []string{"fe80::1%eth0", "192.168.99.1"}, DNSServers: []string{"2001:db8::53", "192.168.99.1"}},
+			want: [3][2]bool{{true, true}, {false, false}, {true, true}},
+		},
+	}
+	for _, tt := range tests {
+		res := &probes.DHCPResult{Offers: []probes.DHCPOffer{legit, rogue, bare}}
+		markDHCPMismatches(res, tt.ni)
+		for i, o := range res.Offers {
+			if got := [2]bool{o.GatewayMismatch, o.DNSMismatch}; got != tt.want[i] {
+				t.Errorf("%s: offer from %s: gateway, DNS mismatch = %v, want %v", tt.name, o.ServerID, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestDescribeOffer(t *testing.T) {
+	o := probes.DHCPOffer{
+		ServerID: "10.0.0.1", From: "10.0.5.1", ServerVendor: "Cisco",
+		OfferedIP: "10.0.0.57", SubnetMask: "255.255.255.0",
+		Routers: []string{"10.0.0.1"}, DNS: []string{"8.8.8.8"}, DNSMismatch: true,
+		LeaseSec: 86400,
+	}
+	want := "10.0.0.1 (Cisco) via 10.0.5.1 offered 10.0.0.57/255.255.255.0, router 10.0.0.1, DNS 8.8.8.8 (not the current DNS), lease 24h0m0s"
+	if got := describeOffer(o); got != want {
+		t.Errorf("describeOffer:\n got %q\nwant %q", got, want)
+	}
+}
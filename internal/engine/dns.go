@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type dnsProbe struct{}
+
+func (dnsProbe) Name() string       { return "dns" }
+func (dnsProbe) Title() string      { return "DNS lookups" }
+func (dnsProbe) Requires() []string { return []string{"netinfo"} }
+
+func (dnsProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Testing DNS lookups…")
+	log.Println("Testing DNS lookups")
+	params := bag.Params
+	servers := bag.Results().NetInfo.DNSServers
+	local, _ := probes.DNSLookupTimed(ctx, params.DNSNames, servers, params.Timeout)
+	cf, _ := probes.DNSLookupTimed(ctx, params.DNSNames, []string{"1.1.1.1"}, params.Timeout)
+	bag.Update(func(res *report.Results) {
+		res.DNSLocal = local
+		res.DNSCF = cf
+	})
+	return ctx.Err()
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/dnsx"
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+// The tamper checks compare plain DNS to Cloudflare with DNS-over-HTTPS to
+// the same service. The DoH URL uses the IP address so reaching it does not
+// depend on the DNS being checked.
+var (
+	tamperPlain     = dnsx.Server{Transport: "udp", Addr: "1.1.1.1:53"}
+	tamperReference = dnsx.Server{Transport: "https", Addr: "https://1.1.1.1/dns-query"}
+)
+
+type dnsTamperProbe struct{}
+
+func (dnsTamperProbe) Name() string       { return "dns-tamper" }
+func (dnsTamperProbe) Title() string      { return "DNS tampering" }
+func (dnsTamperProbe) Requires() []string { return []string{"netinfo"} }
+
+func (dnsTamperProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Checking for DNS tampering…")
+	log.Println("Checking for DNS tampering")
+
+	var system []dnsx.Server
+	for _, ns := range bag.Results().NetInfo.DNSServers {
+		if s, err := dnsx.ParseServer(ns); err == nil {
+			system = append(system, s)
+		}
+	}
+	res := probes.DNSTamperCheck(ctx, system, tamperPlain, tamperReference, bag.Params.DNSNames, bag.Params.Timeout)
+
+	if !res.ReferenceOK {
+		bag.Println(fmt.Sprintf("  %s did not answer; answers were not compared", res.Reference))
+	}
+	for _, r := range res.NXRedirects {
+		bag.Println(fmt.Sprintf("  %s answered nonexistent %s with %v", r.Server, r.Name, r.Answers))
+	}
+	for _, r := range res.Rewrites {
+		bag.Println(fmt.Sprintf("  %s answered %s with %v: %s", r.Server, r.Name, r.Answers, r.Reason))
+	}
+	for _, i := range res.Interceptions {
+		bag.Println("  " + i.Detail)
+		log.Printf("DNS interception: %s", i.Detail)
+	}
+	if len(res.NXRedirects)+len(res.Rewrites)+len(res.Interceptions) == 0 {
+		bag.Println("  no signs of DNS tampering")
+	}
+	bag.Update(func(r *report.Results) {
+		r.DNSTamper = &res
+	})
+	return ctx.Err()
+}
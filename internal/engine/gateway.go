@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type gatewayProbe struct{}
+
+func (gatewayProbe) Name() string       { return "gateway" }
+func (gatewayProbe) Title() string      { return "Gateway checks" }
+func (gatewayProbe) Requires() []string { return []string{"netinfo"} }
+
+func (gatewayProbe) Run(ctx context.Context, bag *Bag) error {
+	gw := bag.Results().GatewayUsed
+	if gw == "" {
+		bag.Say("→ No default gateway detected; skipping gateway ping.")
+		log.Println("No default gateway detected; skipping gateway ping")
+		return nil
+	}
+	bag.Say(fmt.Sprintf("→ Pinging default gateway: %s", gw))
+	ping, err := probes.PingHost(ctx, gw, bag.Params.Count, bag.Params.Timeout)
+	if err != nil && ctx.Err() == nil {
+		bag.Println("  Gateway ping error:", err)
+		log.Println("Gateway ping error:", err)
+	}
+	bag.Update(func(res *report.Results) {
+		res.GwPing = ping
+	})
+	return ctx.Err()
+}
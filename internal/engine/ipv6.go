@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type ipv6Probe struct{}
+
+func (ipv6Probe) Name() string       { return "ipv6" }
+func (ipv6Probe) Title() string      { return "IPv6 checks" }
+func (ipv6Probe) Requires() []string { return []string{"netinfo"} }
+
+// Run pings the IPv6 default gateway and, when the host has a global IPv6
+// address, pings, traces and measures the path MTU to the IPv6 target.
+func (ipv6Probe) Run(ctx context.Context, bag *Bag) error {
+	info := bag.Results().NetInfo
+	addrs := info.GlobalIPv6()
+	gw := info.DefaultGateway6
+	bag.Update(func(res *report.Results) {
+		res.IPv6.Addrs = addrs
+		res.IPv6.Gateway = gw
+	})
+	if gw == "" {
+		bag.Say("→ No IPv6 default route; skipping IPv6 checks.")
+		log.Println("No IPv6 default route; skipping IPv6 checks")
+		return nil
+	}
+
+	params := bag.Params
+	bag.Say(fmt.Sprintf("→ Pinging IPv6 default gateway: %s", gw))
+	gwPing, err := probes.PingHost6(ctx, gw, params.Count, params.Timeout)
+	if err != nil && ctx.Err() == nil {
+		bag.Println("  IPv6 gateway ping error:", err)
+		log.Println("IPv6 gateway ping error:", err)
+		markUnreachable(&gwPing)
+	}
+	bag.Update(func(res *report.Results) {
+		res.IPv6.GwPing = gwPing
+	})
+	if len(addrs) == 0 {
+		bag.Say("→ No global IPv6 address; skipping IPv6 WAN checks.")
+		log.Println("No global IPv6 address; skipping IPv6 WAN checks")
+		return ctx.Err()
+	}
+
+	target := ipv6Target(ctx, params)
+	bag.Say(fmt.Sprintf("→ Checking the IPv6 path to %s…", target))
+	log.Println("Checking IPv6 path to", target)
+	bag.Update(func(res *report.Results) {
+		res.IPv6.Target = target
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		ping, err := probes.PingHost6(ctx, target, params.Count, params.Timeout)
+		if err != nil && ctx.Err() == nil {
+			bag.Println("  IPv6 WAN ping error:", err)
+			log.Println("IPv6 WAN ping error:", err)
+			markUnreachable(&ping)
+		}
+		bag.Update(func(res *report.Results) { res.IPv6.Ping = ping })
+	}()
+	go func() {
+		defer wg.Done()
+		trace, _ := probes.Trace6(ctx, target, 20, params.Timeout)
+		bag.Update(func(res *report.Results) { res.IPv6.Trace = trace })
+	}()
+	go func() {
+		defer wg.Done()
+		mtu, _ := probes.MTUCheck6(ctx, target)
+		bag.Update(func(res *report.Results) { res.IPv6.MTU = mtu })
+	}()
+	wg.Wait()
+	return ctx.Err()
+}
+
+// markUnreachable records total loss for a ping that failed before any echo
+// request went out, e.g. with "network unreachable", so rules see the broken
+// path instead of a clean zero.
+func markUnreachable(ping *probes.PingResult) {
+	if len(ping.Samples) == 0 && ping.AvgMs == 0 {
+		ping.Loss = 1
+	}
+}
+
+// ipv6Target returns the primary WAN target when it has an IPv6 address and
+// Params.Target6 otherwise.
+func ipv6Target(ctx context.Context, params Params) string {
+	host := params.TargetHost
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return host
+		}
+		return params.Target6
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, params.Timeout)
+	defer cancel()
+	if ips, err := net.DefaultResolver.LookupIP(lookupCtx, "ip6", host); err == nil && len(ips) > 0 {
+		return host
+	}
+	return params.Target6
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type l2ScanProbe struct{}
+
+func (l2ScanProbe) Name() string       { return "l2-scan" }
+func (l2ScanProbe) Title() string      { return "Layer-2 scan" }
+func (l2ScanProbe) Requires() []string { return []string{"netinfo"} }
+
+// Exclusive keeps the ARP or ping sweep from overlapping latency measurements.
+func (l2ScanProbe) Exclusive() bool { return true }
+
+func (l2ScanProbe) Run(ctx context.Context, bag *Bag) error {
+	params := bag.Params
+	if !params.Scan {
+		bag.Say("→ Skipping local layer-2 discovery (enable with --scan).")
+		log.Println("Skipping layer-2 discovery (flag not set)")
+		return nil
+	}
+	bag.Say("→ Discovering local layer-2 neighbors (ARP)…")
+	log.Println("Running layer-2 discovery")
+	ni := bag.Results().NetInfo
+	hosts, err := probes.L2Scan(ctx, params.ScanTimeout, params.ScanMaxHosts, params.ScanCIDRLimit, ni.Gateways)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bag.Println("  Unable to complete L2 discovery:", err)
+		log.Println("L2 discovery error:", err)
+	} else if len(hosts) == 0 {
+		bag.Println("  No L2 hosts discovered (ARP cache empty).")
+	}
+	bag.Say("→ Discovering IPv6 neighbors (NDP)…")
+	log.Println("Running IPv6 neighbor discovery")
+	neighbors, err := probes.NDPScan(ctx, params.ScanTimeout)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bag.Println("  Unable to complete IPv6 neighbor discovery:", err)
+		log.Println("NDP discovery error:", err)
+	}
+	hosts = append(hosts, neighbors...)
+	if len(hosts) > 0 {
+		bag.Say("→ Identifying discovered hosts (mDNS, SSDP, LLMNR, NetBIOS)…")
+		log.Println("Identifying discovered hosts")
+		probes.IdentifyHosts(ctx, hosts, params.ScanTimeout)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		identified := 0
+		for _, h := range hosts {
+			if h.Hostname != "" || h.Model != "" || h.Kind != "" {
+				identified++
+			}
+		}
+		bag.Println(fmt.Sprintf("  Identified %d of %d hosts.", identified, len(hosts)))
+	}
+	for _, h := range hosts {
+		if h.Gateway && len(h.ConflictMACs) > 0 {
+			bag.Println(fmt.Sprintf("  Gateway %s answered from %s and %s.", h.IP, h.MAC, strings.Join(h.ConflictMACs, ", ")))
+		}
+	}
+	var changes []probes.L2Change
+	if params.KnownHosts != nil && len(hosts) > 0 {
+		run, known := params.KnownHosts(ni)
+		changes = probes.CompareL2Hosts(known, hosts)
+		for i := range changes {
+			changes[i].Run = run
+			bag.Println(fmt.Sprintf("  %s changed from %s to %s since run %s.", changes[i].IP, changes[i].BeforeMAC, changes[i].AfterMAC, run))
+		}
+	}
+	bag.Update(func(res *report.Results) {
+		res.Discovered = hosts
+		res.L2Changes = changes
+	})
+	return nil
+}
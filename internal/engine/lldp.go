@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type lldpProbe struct{}
+
+func (lldpProbe) Name() string  { return "lldp" }
+func (lldpProbe) Title() string { return "LLDP/CDP neighbours" }
+
+// Requires the wireless probe so the capture is not attempted on Wi-Fi,
+// where access points do not forward LLDP.
+func (lldpProbe) Requires() []string { return []string{"netinfo", "wireless"} }
+
+// Run listens for the switch's LLDP and CDP announcements on the wired
+// interface. It only listens, so it runs alongside the other probes, and as
+// the listen can take a minute its findings are printed after theirs.
+func (lldpProbe) Run(ctx context.Context, bag *Bag) error {
+	iface := wiredIface(bag.Results())
+	if iface == "" {
+		bag.Say("→ Skipping LLDP/CDP capture (no wired interface).")
+		log.Println("Skipping LLDP/CDP capture (no wired interface)")
+		return nil
+	}
+	window := bag.Params.LLDPWindow
+	bag.Say(fmt.Sprintf("→ Listening for LLDP/CDP announcements on %s (up to %s)…", iface, window))
+	log.Println("Listening for LLDP/CDP announcements on", iface)
+	bag.Background()
+	res, err := probes.CaptureNeighbors(ctx, iface, window)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, os.ErrPermission) {
+			err = fmt.Errorf("%w (needs root or CAP_NET_RAW)", err)
+		}
+		bag.Println("  Skipping LLDP/CDP capture:", err)
+		log.Println("LLDP/CDP capture:", err)
+		return nil
+	}
+	if len(res.Neighbors) == 0 {
+		bag.Println(fmt.Sprintf("  No LLDP or CDP announcements heard on %s.", iface))
+	}
+	for _, n := range res.Neighbors {
+		bag.Println("  " + describeNeighbor(n))
+	}
+	bag.Update(func(r *report.Results) { r.LLDP = res })
+	return nil
+}
+
+// wiredIface returns the interface to listen on: the LAN interface, leaving
+// out Wi-Fi.
+func wiredIface(res report.Results) string {
+	var skip []string
+	if res.Wireless != nil {
+		skip = append(skip, res.Wireless.Iface)
+	}
+	return lanIface(res.NetInfo, skip...)
+}
+
+// lanIface returns the interface of the default route unless it is a
+// tunnel or listed in skip, else the first other interface that is up with a
+// link, a MAC address and an IPv4 address.
+func lanIface(ni probes.NetInfo, skip ...string) string {
+	skipped := map[string]bool{"lo": true}
+	for _, name := range append(skip, ni.VPNAdapterNames()...) {
+		skipped[name] = true
+	}
+	if iface := defaultRouteIface(ni); iface != "" && !skipped[iface] {
+		return iface
+	}
+	for _, i := range ni.Interfaces {
+		if skipped[i.Name] || !i.Up || i.NoCarrier() || i.Mac == "" {
+			continue
+		}
+		for _, cidr := range i.IPs {
+			if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() != nil {
+				return i.Name
+			}
+		}
+	}
+	return ""
+}
+
+// describeNeighbor summarises a neighbour on one line, e.g.
+// "LLDP: sw1 port Gi1/0/12, VLAN 10, mgmt 10.0.0.2".
+func describeNeighbor(n probes.LLDPNeighbor) string {
+	parts := []string{fmt.Sprintf("%s: %s", strings.ToUpper(n.Protocol), n.Name())}
+	if port := n.PortName(); port != "" {
+		parts[0] += " port " + port
+	}
+	if n.VLAN > 0 {
+		parts = append(parts, fmt.Sprintf("VLAN %d", n.VLAN))
+	}
+	if n.VoiceVLAN > 0 {
+		parts = append(parts, fmt.Sprintf("voice VLAN %d", n.VoiceVLAN))
+	}
+	if addr := n.MgmtAddr(); addr != "" {
+		parts = append(parts, "mgmt "+addr)
+	}
+	if n.PoE != nil {
+		parts = append(parts, "PoE "+n.PoE.Summary())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type mtuProbe struct{}
+
+func (mtuProbe) Name() string       { return "mtu" }
+func (mtuProbe) Title() string      { return "MTU probe" }
+func (mtuProbe) Requires() []string { return nil }
+
+func (mtuProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ MTU / Path MTU probe…")
+	log.Println("Running MTU / Path MTU probe")
+	forEachTarget(ctx, bag.Params.Targets, func(ctx context.Context, i int, t Target) {
+		mtu, _ := probes.MTUCheck(ctx, t.Host)
+		updateTarget(bag, i, func(tr *report.TargetResult) {
+			tr.MTU = mtu
+		})
+	})
+	return ctx.Err()
+}
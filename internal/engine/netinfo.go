@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type netinfoProbe struct{}
+
+func (netinfoProbe) Name() string       { return "netinfo" }
+func (netinfoProbe) Title() string      { return "Network info" }
+func (netinfoProbe) Requires() []string { return nil }
+
+func (netinfoProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("\n→ Collecting local network info…")
+	log.Println("Collecting local network info")
+	info, err := probes.GetBasics()
+	if err != nil {
+		bag.Println("  Unable to gather netinfo:", err)
+		log.Println("netinfo error:", err)
+	}
+	gw := info.DefaultGateway
+	if gw == "" && len(info.Gateways) > 0 {
+		gw = info.Gateways[0]
+	}
+	bag.Update(func(res *report.Results) {
+		res.NetInfo = info
+		res.GatewayUsed = gw
+		res.HasGateway = gw != ""
+	})
+	return nil
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type nicCountersProbe struct{}
+
+func (nicCountersProbe) Name() string  { return "nic-counters" }
+func (nicCountersProbe) Title() string { return "Local interface counters" }
+
+// Requires netinfo, which takes the first sample.
+func (nicCountersProbe) Requires() []string { return []string{"netinfo"} }
+
+// RunLast puts the second sample after every other probe in the run, so the
+// counters cover all the traffic the run sent.
+func (nicCountersProbe) RunLast() bool { return true }
+
+// Run samples the local interface counters again and records how much they
+// grew since the netinfo probe read them.
+func (nicCountersProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Checking local interface error counters…")
+	log.Println("Sampling local interface counters")
+	now, err := probes.InterfaceStats()
+	if err != nil {
+		bag.Println("  Skipping interface counters:", err)
+		log.Println("interface counters:", err)
+		return nil
+	}
+
+	counters := nicCounterDeltas(bag.Results().NetInfo.Interfaces, now)
+	for _, c := range counters {
+		if c.Errors > 0 || c.Drops > 0 || c.Delta.Collisions > 0 {
+			bag.Println(fmt.Sprintf("  %s: +%d errors, +%d drops, +%d collisions during the run", c.Name, c.Errors, c.Drops, c.Delta.Collisions))
+		}
+	}
+	if len(counters) == 0 {
+		bag.Println("  No interface counters to compare.")
+		return nil
+	}
+	bag.Update(func(res *report.Results) {
+		res.NICCounters = counters
+	})
+	return nil
+}
+
+// nicCounterDeltas compares the counters netinfo read for each interface
+// that is up with now, leaving out loopback and interfaces either sample
+// missed.
+func nicCounterDeltas(ifaces []probes.IF, now map[string]probes.IFStats) []report.NICCounter {
+	var counters []report.NICCounter
+	for _, iface := range ifaces {
+		after, ok := now[iface.Name]
+		if !ok || iface.Stats == nil || !iface.Up || iface.Name == "lo" {
+			continue
+		}
+		delta := after.Sub(*iface.Stats)
+		counters = append(counters, report.NICCounter{
+			Name:   iface.Name,
+			Delta:  delta,
+			Errors: delta.RxErrors + delta.TxErrors,
+			Drops:  delta.RxDropped + delta.TxDropped,
+		})
+	}
+	return counters
+}
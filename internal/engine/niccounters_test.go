@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+func TestNICCounterDeltas(t *testing.T) {
+	before := &probes.IFStats{RxErrors: 10, TxErrors: 1, RxDropped: 100, TxDropped: 5, RxCRCErrors: 8, Collisions: 2}
+	ifaces := []probes.IF{
+		{Name: "lo", Up: true, Stats: &probes.IFStats{}},
+		{Name: "eth0", Up: true, Stats: before},
+		{Name: "eth1", Up: false, Stats: &probes.IFStats{}},
+		{Name: "wlan0", Up: true},
+		{Name: "eth2", Up: true, Stats: &probes.IFStats{RxDropped: 50}},
+		{Name: "gone", Up: true, Stats: &probes.IFStats{}},
+	}
+	now := map[string]probes.IFStats{
+		"lo":    {RxErrors: 3},
+		"eth0":  {RxErrors: 13, TxErrors: 1, RxDropped: 104, TxDropped: 6, RxCRCErrors: 11, Collisions: 2},
+		"eth1":  {RxErrors: 1},
+		"wlan0": {RxErrors: 1},
+		// The driver was reloaded and its counters started again.
+		"eth2": {RxDropped: 7},
+	}
+	want := []report.NICCounter{
+		{
+			Name:   "eth0",
+			Delta:  probes.IFStats{RxErrors: 3, RxDropped: 4, TxDropped: 1, RxCRCErrors: 3},
+			Errors: 3, Drops: 5,
+		},
+		{Name: "eth2"},
+	}
+	if got := nicCounterDeltas(ifaces, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+	if got := nicCounterDeltas(ifaces, nil); got != nil {
+		t.Errorf("with no second sample: %+v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type pathProbe struct{}
+
+func (pathProbe) Name() string       { return "path" }
+func (pathProbe) Title() string      { return "Path analysis" }
+func (pathProbe) Requires() []string { return nil }
+
+func (pathProbe) Run(ctx context.Context, bag *Bag) error {
+	params := bag.Params
+	if params.PathCycles < 0 {
+		bag.Say("→ Skipping per-hop path analysis.")
+		log.Println("Skipping per-hop path analysis (disabled)")
+		return nil
+	}
+	bag.Say(fmt.Sprintf("→ Per-hop path analysis (%d cycles)…", params.PathCycles))
+	log.Println("Running per-hop path analysis")
+	forEachTarget(ctx, params.Targets, func(ctx context.Context, i int, t Target) {
+		path, err := probes.PathAnalysis(ctx, t.Host, params.PathCycles, 20, time.Second, params.Timeout)
+		if err != nil && ctx.Err() == nil {
+			bag.Println("  Path analysis error:", t.Name+":", err)
+			log.Println("Path analysis error:", t.Host, err)
+		}
+		updateTarget(bag, i, func(tr *report.TargetResult) {
+			tr.Path = path
+		})
+	})
+	return ctx.Err()
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/cneate93/vne/internal/probes"
 	"github.com/cneate93/vne/internal/progress"
 	"github.com/cneate93/vne/internal/report"
+	"github.com/cneate93/vne/internal/rules"
 )
 
 type Printer interface {
@@ -24,10 +25,64 @@ type Params struct {
 	ScanTimeout   time.Duration
 	ScanMaxHosts  int
 	ScanCIDRLimit int
-	TargetHost    string
-	DNSTarget     string
-	Reporter      progress.Reporter
-	Printer       Printer
+	// KnownHosts returns the hosts discovered by an earlier run on the
+	// network described by ni, and an ID for that run; the l2-scan probe
+	// reports the addresses whose MAC address changed since. Nil skips the
+	// comparison.
+	KnownHosts func(ni probes.NetInfo) (run string, hosts []probes.L2Host)
+	// Targets are the WAN destinations; the first is the primary target.
+	// Empty selects a single target at TargetHost.
+	Targets    []Target
+	TargetHost string
+	// Target6 is the destination of the IPv6 WAN checks when the primary
+	// target has no IPv6 address; empty selects Cloudflare's resolver.
+	Target6 string
+	// DNSNames are resolved by the DNS probe; empty selects cloudflare.com.
+	DNSNames []string
+	// Resolvers are queried by the resolvers probe besides the system
+	// nameservers, as dnsx.ParseServer specs; nil selects Cloudflare over
+	// UDP, TLS and HTTPS.
+	Resolvers []string
+	// Apps are the URLs and host:port pairs timed by the apps probe; empty
+	// skips it.
+	Apps []string
+	// LoadEndpoint is the reflector the bufferbloat probe loads the link
+	// against; empty skips it. LoadDuration is the time spent loading each
+	// direction and LoadStreams the number of parallel connections; zero
+	// selects the probe's defaults.
+	LoadEndpoint string
+	LoadDuration time.Duration
+	LoadStreams  int
+	// VoiceEndpoint is the reflector the voice probe streams to; empty
+	// falls back to LoadEndpoint's host and skips the probe when both are
+	// empty. VoiceDuration, VoiceRate (packets a second) and VoiceSize
+	// (bytes) shape the stream; zero selects the probe's defaults.
+	VoiceEndpoint string
+	VoiceDuration time.Duration
+	VoiceRate     int
+	VoiceSize     int
+	// LLDPWindow is the longest the lldp probe listens for announcements;
+	// zero selects a minute.
+	LLDPWindow time.Duration
+	// DHCPWindow is how long the dhcp probe collects offers; zero selects
+	// 3 s.
+	DHCPWindow time.Duration
+	// PathCycles is the number of per-hop probe cycles; zero selects the
+	// default and a negative value disables the path analysis.
+	PathCycles int
+	// Enable restricts the run to the named probes and the probes they
+	// require. Empty means every registered probe.
+	Enable []string
+	// Disable removes the named probes from the run.
+	Disable []string
+	// Workers caps how many independent probes run at the same time; zero
+	// selects the default and 1 runs the probes one after another.
+	Workers int
+	// Rules derives findings and the classification from the results; nil
+	// selects the embedded default rules.
+	Rules    *rules.Set
+	Reporter progress.Reporter
+	Printer  Printer
 }
 
 type noopPrinter struct{}
@@ -35,312 +90,115 @@ type noopPrinter struct{}
 func (noopPrinter) Println(...interface{})        {}
 func (noopPrinter) Printf(string, ...interface{}) {}
 
-func Run(ctx context.Context, params Params) (report.Results, error) {
-	reporter := params.Reporter
-	printer := params.Printer
-	if printer == nil {
-		printer = noopPrinter{}
-	}
-
-	count := params.Count
-	if count <= 0 {
-		count = 4
+// withDefaults returns a copy of p with unset fields replaced by defaults.
+func (p Params) withDefaults() Params {
+	if p.Count <= 0 {
+		p.Count = 4
 	}
-	timeout := params.Timeout
-	if timeout <= 0 {
-		timeout = 10 * time.Second
+	if p.Timeout <= 0 {
+		p.Timeout = 10 * time.Second
 	}
-	scanTimeout := params.ScanTimeout
-	if scanTimeout <= 0 {
-		scanTimeout = 30 * time.Second
+	if p.ScanTimeout <= 0 {
+		p.ScanTimeout = 30 * time.Second
 	}
-	maxHosts := params.ScanMaxHosts
-	if maxHosts <= 0 {
-		maxHosts = 256
+	if p.ScanMaxHosts <= 0 {
+		p.ScanMaxHosts = 256
 	}
-	cidrLimit := params.ScanCIDRLimit
-	if cidrLimit <= 0 {
-		cidrLimit = 24
+	if p.ScanCIDRLimit <= 0 {
+		p.ScanCIDRLimit = 24
 	}
-	target := strings.TrimSpace(params.TargetHost)
-	if target == "" {
-		target = "1.1.1.1"
+	if p.LLDPWindow <= 0 {
+		p.LLDPWindow = time.Minute
 	}
-	dnsTarget := strings.TrimSpace(params.DNSTarget)
-	if dnsTarget == "" {
-		dnsTarget = "cloudflare.com"
+	if p.DHCPWindow <= 0 {
+		p.DHCPWindow = 3 * time.Second
 	}
-
-	phase := func(name string) {
-		if reporter != nil {
-			reporter.Phase(name)
+	var targets []Target
+	for _, t := range p.Targets {
+		t.Host = strings.TrimSpace(t.Host)
+		if t.Host == "" {
+			continue
 		}
-	}
-	step := func(msg string) {
-		if reporter != nil {
-			reporter.Step(msg)
+		if t.Name = strings.TrimSpace(t.Name); t.Name == "" {
+			t.Name = t.Host
 		}
+		targets = append(targets, t)
 	}
-	checkCtx := func() error {
-		if ctx == nil {
-			return nil
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			return nil
+	if len(targets) == 0 {
+		host := strings.TrimSpace(p.TargetHost)
+		if host == "" {
+			host = "1.1.1.1"
 		}
+		targets = []Target{{Name: host, Host: host}}
 	}
-
-	var (
-		netInfo  probes.NetInfo
-		l2Hosts  []probes.L2Host
-		gwPing   probes.PingResult
-		wanPing  probes.PingResult
-		dnsLocal probes.DNSResult
-		dnsCF    probes.DNSResult
-		traceOut probes.TraceResult
-		mtu      probes.MTUResult
-	)
-
-	phase("netinfo")
-	step("\n→ Collecting local network info…")
-	log.Println("Collecting local network info")
-	printer.Println("\n→ Collecting local network info…")
-	if err := checkCtx(); err != nil {
-		return report.Results{}, err
-	}
-	if info, err := probes.GetBasics(); err == nil {
-		netInfo = info
-	} else {
-		printer.Println("  Unable to gather netinfo:", err)
-		log.Println("netinfo error:", err)
+	p.Targets = targets
+	p.TargetHost = targets[0].Host
+	if p.Target6 = strings.TrimSpace(p.Target6); p.Target6 == "" {
+		p.Target6 = "2606:4700:4700::1111"
 	}
-
-	gw := netInfo.DefaultGateway
-	if gw == "" && len(netInfo.Gateways) > 0 {
-		gw = netInfo.Gateways[0]
-	}
-
-	phase("l2-scan")
-	if params.Scan {
-		step("→ Discovering local layer-2 neighbors (ping sweep)…")
-		printer.Println("→ Discovering local layer-2 neighbors (ping sweep)…")
-		log.Println("Running layer-2 discovery")
-		if err := checkCtx(); err != nil {
-			return report.Results{}, err
-		}
-		if hosts, err := probes.L2Scan(ctx, scanTimeout, maxHosts, cidrLimit); err == nil {
-			l2Hosts = hosts
-			if len(l2Hosts) == 0 {
-				printer.Println("  No L2 hosts discovered (ARP cache empty).")
-			}
-		} else {
-			printer.Println("  Unable to complete L2 discovery:", err)
-			log.Println("L2 discovery error:", err)
+	var names []string
+	for _, name := range p.DNSNames {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
 		}
-	} else {
-		step("→ Skipping local layer-2 discovery (enable with --scan).")
-		printer.Println("→ Skipping local layer-2 discovery (enable with --scan).")
-		log.Println("Skipping layer-2 discovery (flag not set)")
 	}
-
-	phase("gateway")
-	if err := checkCtx(); err != nil {
-		return report.Results{}, err
+	if len(names) == 0 {
+		names = []string{"cloudflare.com"}
 	}
-	if gw != "" {
-		msg := fmt.Sprintf("→ Pinging default gateway: %s", gw)
-		step(msg)
-		printer.Println(msg)
-		var err error
-		gwPing, err = probes.PingHost(gw, count, timeout)
-		if err != nil {
-			printer.Println("  Gateway ping error:", err)
-			log.Println("Gateway ping error:", err)
-		}
-	} else {
-		step("→ No default gateway detected; skipping gateway ping.")
-		printer.Println("→ No default gateway detected; skipping gateway ping.")
-		log.Println("No default gateway detected; skipping gateway ping")
+	p.DNSNames = names
+	if p.Resolvers == nil {
+		p.Resolvers = []string{"1.1.1.1", "tls://1.1.1.1", "https://cloudflare-dns.com/dns-query"}
 	}
-
-	phase("dns")
-	step("→ Testing DNS lookups…")
-	printer.Println("→ Testing DNS lookups…")
-	log.Println("Testing DNS lookups")
-	if err := checkCtx(); err != nil {
-		return report.Results{}, err
+	if p.PathCycles == 0 {
+		p.PathCycles = 10
 	}
-	dnsLocal, _ = probes.DNSLookupTimed(dnsTarget, netInfo.DNSServers, timeout)
-	dnsCF, _ = probes.DNSLookupTimed(dnsTarget, []string{"1.1.1.1"}, timeout)
+	return p
+}
 
-	phase("wan")
-	msg := fmt.Sprintf("→ Pinging internet target: %s", target)
-	step(msg)
-	printer.Println(msg)
-	log.Println("Pinging internet target", target)
-	if err := checkCtx(); err != nil {
-		return report.Results{}, err
+// Run executes the selected probes as a dependency graph, running independent
+// probes concurrently, then evaluates the rules against their combined
+// results to derive findings and the overall classification. If ctx is
+// cancelled mid-run, Run stops the probes in flight and returns the results
+// gathered so far with ctx's error.
+func Run(ctx context.Context, params Params) (report.Results, error) {
+	if ctx == nil {
+		ctx = context.Background()
 	}
-	var err error
-	wanPing, err = probes.PingHost(target, count, timeout)
+	params = params.withDefaults()
+	selected, err := selectProbes(params.Enable, params.Disable)
 	if err != nil {
-		printer.Println("  WAN ping error:", err)
-		log.Println("WAN ping error:", err)
-	}
-
-	phase("traceroute")
-	step("→ Traceroute (this may take ~10–20 seconds)…")
-	printer.Println("→ Traceroute (this may take ~10–20 seconds)…")
-	log.Println("Running traceroute")
-	if err := checkCtx(); err != nil {
 		return report.Results{}, err
 	}
-	traceOut, _ = probes.Trace(target, 20, timeout)
-
-	phase("mtu")
-	step("→ MTU / Path MTU probe…")
-	printer.Println("→ MTU / Path MTU probe…")
-	log.Println("Running MTU / Path MTU probe")
-	if err := checkCtx(); err != nil {
+	ordered, err := orderProbes(selected)
+	if err != nil {
 		return report.Results{}, err
 	}
-	mtu, _ = probes.MTUCheck(target)
 
-	findings := make([]report.Finding, 0)
-	if gw != "" && gwPing.Loss > 0.3 {
-		findings = append(findings, report.Finding{
-			Severity: "high",
-			Message:  fmt.Sprintf("High loss to default gateway (%.0f%%). Suspect local wiring/switch port; check cable/port; look for error counters.", gwPing.Loss*100),
-		})
-	}
-	if dnsLocal.AvgMs > 100 && dnsCF.AvgMs > 0 && dnsCF.AvgMs < 50 {
-		findings = append(findings, report.Finding{
-			Severity: "medium",
-			Message:  fmt.Sprintf("Local DNS slow (~%.0f ms). Consider using a public resolver (1.1.1.1) or fixing router DNS forwarder.", dnsLocal.AvgMs),
-		})
+	shared := &sharedResults{}
+	shared.res.TargetHost = params.TargetHost
+	for _, t := range params.Targets {
+		shared.res.Targets = append(shared.res.Targets, report.TargetResult{Name: t.Name, Host: t.Host})
 	}
-	if wanPing.Loss > 0.05 {
-		findings = append(findings, report.Finding{
-			Severity: "medium",
-			Message:  fmt.Sprintf("Packet loss to internet target (~%.0f%%). Likely ISP/modem or upstream congestion.", wanPing.Loss*100),
-		})
-	}
-	if mtu.PathMTU > 0 && mtu.PathMTU < 1500 {
-		findings = append(findings, report.Finding{
-			Severity: "info",
-			Message:  fmt.Sprintf("Path MTU appears to be %d. If VPN/tunnel is in path, lower MTU or enable TCP MSS clamping.", mtu.PathMTU),
-		})
-	}
-	vpnAdapters := netInfo.VPNAdapterNames()
-	if len(vpnAdapters) > 0 && (mtu.PathMTU == 0 || mtu.PathMTU < 1500) {
-		mtuPhrase := "Path MTU probe was inconclusive"
-		if mtu.PathMTU > 0 {
-			mtuPhrase = fmt.Sprintf("Path MTU reported as %d", mtu.PathMTU)
+	ruleSet := params.Rules
+	if ruleSet == nil {
+		ruleSet, err = rules.Default()
+		if err != nil {
+			return report.Results{}, err
 		}
-		findings = append(findings, report.Finding{
-			Severity: "info",
-			Message:  fmt.Sprintf("%s with active VPN/tunnel adapter (%s). Recommend setting tunnel MTU to 1420–1412 and enabling a TCP MSS clamp to avoid fragmentation.", mtuPhrase, strings.Join(vpnAdapters, ", ")),
-		})
-	}
-
-	classification, reasons := classify(netInfo, gwPing, wanPing, dnsLocal, mtu)
-
-	res := report.Results{
-		When:           time.Now(),
-		NetInfo:        netInfo,
-		Discovered:     l2Hosts,
-		GwPing:         gwPing,
-		WanPing:        wanPing,
-		DNSLocal:       dnsLocal,
-		DNSCF:          dnsCF,
-		Trace:          traceOut,
-		MTU:            mtu,
-		Findings:       findings,
-		GwLossPct:      fmt.Sprintf("%.0f%%", gwPing.Loss*100),
-		WanLossPct:     fmt.Sprintf("%.0f%%", wanPing.Loss*100),
-		TargetHost:     target,
-		HasGateway:     gw != "",
-		GatewayUsed:    gw,
-		GwJitterMs:     gwPing.JitterMs,
-		WanJitterMs:    wanPing.JitterMs,
-		Classification: classification,
-		Reasons:        reasons,
 	}
 
-	return res, nil
-}
+	runErr := runGraph(ctx, ordered, shared, params, params.Workers)
 
-type classificationIssue struct {
-	label    string
-	reason   string
-	severity int
-}
-
-func classify(netInfo probes.NetInfo, gwPing, wanPing probes.PingResult, dnsLocal probes.DNSResult, mtu probes.MTUResult) (string, []string) {
-	const (
-		gwLossThreshold    = 0.1
-		gwJitterThreshold  = 20
-		wanLossThreshold   = 0.05
-		wanJitterThreshold = 30
-		dnsSlowThreshold   = 150
-		dnsCleanLossThresh = 0.02
-		mtuMinHealthy      = 1500
-	)
-
-	hasGateway := netInfo.DefaultGateway != "" || len(netInfo.Gateways) > 0
-	gatewayBad := hasGateway && (gwPing.Loss >= gwLossThreshold || gwPing.JitterMs >= gwJitterThreshold)
-	wanBad := wanPing.Loss >= wanLossThreshold || wanPing.JitterMs >= wanJitterThreshold
-
-	issues := make([]classificationIssue, 0)
-	if gatewayBad {
-		issues = append(issues, classificationIssue{
-			label:    "LAN problem likely",
-			reason:   fmt.Sprintf("Gateway ping unstable (loss %.1f%%, jitter %.1f ms)", gwPing.Loss*100, gwPing.JitterMs),
-			severity: 3,
-		})
-	}
-	if !gatewayBad && wanBad {
-		issues = append(issues, classificationIssue{
-			label:    "WAN/ISP issue likely",
-			reason:   fmt.Sprintf("WAN target showing impairment (loss %.1f%%, jitter %.1f ms)", wanPing.Loss*100, wanPing.JitterMs),
-			severity: 2,
-		})
-	}
-	if !gatewayBad && !wanBad && dnsLocal.AvgMs >= dnsSlowThreshold && gwPing.Loss < dnsCleanLossThresh && wanPing.Loss < dnsCleanLossThresh {
-		issues = append(issues, classificationIssue{
-			label:    "DNS slow",
-			reason:   fmt.Sprintf("System DNS lookups averaging %.0f ms", dnsLocal.AvgMs),
-			severity: 1,
-		})
-	}
-	vpnAdapters := netInfo.VPNAdapterNames()
-	if mtu.PathMTU > 0 && mtu.PathMTU < mtuMinHealthy && len(vpnAdapters) > 0 {
-		issues = append(issues, classificationIssue{
-			label:    "MTU/MSS issue",
-			reason:   fmt.Sprintf("Path MTU %d bytes with VPN/tunnel adapter(s) %s", mtu.PathMTU, strings.Join(vpnAdapters, ", ")),
-			severity: 2,
-		})
-	}
-
-	reasons := make([]string, len(issues))
-	for i, issue := range issues {
-		reasons[i] = issue.reason
-	}
-
-	classification := "Healthy"
-	if len(issues) > 0 {
-		classification = issues[0].label
-		highest := issues[0].severity
-		for _, issue := range issues[1:] {
-			if issue.severity > highest {
-				classification = issue.label
-				highest = issue.severity
-			}
-		}
+	res, err := ruleSet.Apply(shared.res)
+	if err != nil {
+		log.Println("rule evaluation:", err)
 	}
 
-	return classification, reasons
+	res.When = time.Now()
+	res.Partial = runErr != nil
+	res.GwLossPct = fmt.Sprintf("%.0f%%", res.GwPing.Loss*100)
+	res.WanLossPct = fmt.Sprintf("%.0f%%", res.WanPing.Loss*100)
+	res.GwJitterMs = res.GwPing.JitterMs
+	res.WanJitterMs = res.WanPing.JitterMs
+	return res, runErr
 }
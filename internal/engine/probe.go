@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cneate93/vne/internal/report"
+)
+
+// Probe is a single diagnostic check run by the engine. Probes declare the
+// probes whose output they read so the engine can order them, and record their
+// own output in the shared Bag.
+type Probe interface {
+	// Name is the stable identifier used for progress phases and for
+	// enabling or disabling the probe.
+	Name() string
+	// Title is the human-readable label shown in progress displays.
+	Title() string
+	// Requires lists the names of probes that must run first.
+	Requires() []string
+	// Run performs the check and stores its results in the bag. Errors are
+	// reported but do not stop the run unless the context is done.
+	Run(ctx context.Context, bag *Bag) error
+}
+
+// Bag is the view of the shared results handed to a probe. Probes may run
+// concurrently, so results are only read and written through Results and
+// Update, and progress output goes through Say and Println so the engine can
+// keep it in probe order.
+type Bag struct {
+	// Params holds the run parameters with defaults applied.
+	Params Params
+
+	shared *sharedResults
+	out    *probeOutput
+}
+
+type sharedResults struct {
+	mu  sync.Mutex
+	res report.Results
+}
+
+// Update applies fn to the results under the shared lock.
+func (b *Bag) Update(fn func(*report.Results)) {
+	b.shared.mu.Lock()
+	defer b.shared.mu.Unlock()
+	fn(&b.shared.res)
+}
+
+// Results returns a copy of the results recorded so far.
+func (b *Bag) Results() report.Results {
+	b.shared.mu.Lock()
+	defer b.shared.mu.Unlock()
+	return b.shared.res
+}
+
+// Say reports a progress message to both the live progress stream and the
+// console printer.
+func (b *Bag) Say(msg string) {
+	b.out.step(msg)
+}
+
+// Println writes to the console printer only.
+func (b *Bag) Println(args ...interface{}) {
+	b.out.println(args...)
+}
+
+// Background releases the probe's place in the output order: whatever it
+// prints from now on comes after every other probe's output. Probes that
+// spend most of their time waiting, like a capture, call it once they have
+// said what they are waiting for so they do not hold back the probes after
+// them.
+func (b *Bag) Background() {
+	b.out.seq.background(b.out.idx)
+}
+
+func (b *Bag) phase(name string) {
+	b.out.phase(name)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Probe
+)
+
+// Register adds a probe to the engine. Probes run in registration order
+// unless their requirements force a later position. Registering a name twice
+// panics.
+func Register(p Probe) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == p.Name() {
+			panic(fmt.Sprintf("engine: probe %q registered twice", p.Name()))
+		}
+	}
+	registry = append(registry, p)
+}
+
+// Probes returns every registered probe in execution order.
+func Probes() []Probe {
+	registryMu.RLock()
+	all := append([]Probe(nil), registry...)
+	registryMu.RUnlock()
+	ordered, err := orderProbes(all)
+	if err != nil {
+		return all
+	}
+	return ordered
+}
+
+// selectProbes resolves the enable/disable lists against the registry. An
+// empty enable list selects every probe; otherwise the named probes and their
+// requirements are selected. Disabled probes are removed last.
+func selectProbes(enable, disable []string) ([]Probe, error) {
+	all := Probes()
+	byName := make(map[string]Probe, len(all))
+	for _, p := range all {
+		byName[p.Name()] = p
+	}
+	for _, name := range append(append([]string(nil), enable...), disable...) {
+		if _, ok := byName[name]; !ok {
+			return nil, fmt.Errorf("unknown probe %q (available: %s)", name, strings.Join(probeNames(all), ", "))
+		}
+	}
+
+	selected := map[string]bool{}
+	if len(enable) == 0 {
+		for _, p := range all {
+			selected[p.Name()] = true
+		}
+	} else {
+		var add func(name string)
+		add = func(name string) {
+			if selected[name] {
+				return
+			}
+			selected[name] = true
+			if p, ok := byName[name]; ok {
+				for _, dep := range p.Requires() {
+					add(dep)
+				}
+			}
+		}
+		for _, name := range enable {
+			add(name)
+		}
+	}
+	for _, name := range disable {
+		delete(selected, name)
+	}
+
+	var out []Probe
+	for _, p := range all {
+		if selected[p.Name()] {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// orderProbes sorts probes so each runs after its requirements, and probes
+// that run last after all the others, keeping the given order wherever that
+// allows. Requirements that are not in
+// the list are ignored so a disabled probe does not block its dependents.
+func orderProbes(probes []Probe) ([]Probe, error) {
+	index := make(map[string]int, len(probes))
+	for i, p := range probes {
+		index[p.Name()] = i
+	}
+	done := make([]bool, len(probes))
+	ordered := make([]Probe, 0, len(probes))
+	for len(ordered) < len(probes) {
+		progressed := false
+		for i, p := range probes {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, dep := range after(p, probes) {
+				if j, ok := index[dep]; ok && !done[j] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			done[i] = true
+			ordered = append(ordered, p)
+			progressed = true
+			break
+		}
+		if !progressed {
+			var pending []string
+			for i, p := range probes {
+				if !done[i] {
+					pending = append(pending, p.Name())
+				}
+			}
+			sort.Strings(pending)
+			return nil, fmt.Errorf("probe dependency cycle among %s", strings.Join(pending, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+func probeNames(probes []Probe) []string {
+	names := make([]string, len(probes))
+	for i, p := range probes {
+		names[i] = p.Name()
+	}
+	return names
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+// withRegistry swaps the registered probes for list until the test ends.
+func withRegistry(t *testing.T, list ...Probe) {
+	t.Helper()
+	registryMu.Lock()
+	saved := registry
+	registry = list
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	})
+}
+
+func dep(name string, requires ...string) *fakeProbe {
+	return &fakeProbe{name: name, requires: requires}
+}
+
+func last(name string, requires ...string) *fakeProbe {
+	return &fakeProbe{name: name, requires: requires, last: true}
+}
+
+func TestSelectProbes(t *testing.T) {
+	// Registered out of dependency order: trace needs wan, which comes
+	// after it.
+	withRegistry(t,
+		dep("netinfo"),
+		dep("gateway", "netinfo"),
+		dep("trace", "wan"),
+		dep("wan", "netinfo"),
+		last("counters", "netinfo"),
+		dep("dns"),
+		dep("report", "gateway", "trace"),
+	)
+	tests := []struct {
+		name            string
+		enable, disable []string
+		want            []string
+		wantErr         string
+	}{
+		{
+			name: "everything in dependency order",
+			want: []string{"netinfo", "gateway", "wan", "trace", "dns", "report", "counters"},
+		},
+		{
+			name:   "requirements pulled in",
+			enable: []string{"trace"},
+			want:   []string{"netinfo", "wan", "trace"},
+		},
+		{
+			name:   "transitive requirements",
+			enable: []string{"report"},
+			want:   []string{"netinfo", "gateway", "wan", "trace", "report"},
+		},
+		{
+			name:   "several named",
+			enable: []string{"dns", "gateway"},
+			want:   []string{"netinfo", "gateway", "dns"},
+		},
+		{
+			name:    "skip a leaf",
+			disable: []string{"dns"},
+			want:    []string{"netinfo", "gateway", "wan", "trace", "report", "counters"},
+		},
+		{
+			// A skipped requirement is dropped, not re-added, and its
+			// dependents still run.
+			name:    "skip a requirement",
+			enable:  []string{"trace"},
+			disable: []string{"wan"},
+			want:    []string{"netinfo", "trace"},
+		},
+		{
+			name:    "skip everything needed",
+			disable: []string{"netinfo", "wan"},
+			want:    []string{"gateway", "trace", "dns", "report", "counters"},
+		},
+		{
+			// Running last only orders; it pulls in nothing but its
+			// requirements.
+			name:   "run last",
+			enable: []string{"counters", "dns"},
+			want:   []string{"netinfo", "dns", "counters"},
+		},
+		{
+			name:    "unknown enabled",
+			enable:  []string{"trace", "bogus"},
+			wantErr: `unknown probe "bogus" (available: netinfo, gateway, wan, trace, dns, report, counters)`,
+		},
+		{
+			name:    "unknown disabled",
+			disable: []string{"nope"},
+			wantErr: `unknown probe "nope" (available: netinfo, gateway, wan, trace, dns, report, counters)`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectProbes(tt.enable, tt.disable)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := probeNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("selected %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderProbes(t *testing.T) {
+	tests := []struct {
+		name    string
+		probes  []Probe
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "already ordered",
+			probes: []Probe{dep("a"), dep("b", "a"), dep("c", "b")},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "reversed",
+			probes: []Probe{dep("c", "b"), dep("b", "a"), dep("a")},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			// Independent probes keep their place; only c moves behind d.
+			name:   "stable",
+			probes: []Probe{dep("a"), dep("c", "d"), dep("b"), dep("d")},
+			want:   []string{"a", "b", "d", "c"},
+		},
+		{
+			name:   "missing requirement ignored",
+			probes: []Probe{dep("b", "gone"), dep("a")},
+			want:   []string{"b", "a"},
+		},
+		{
+			name:   "run last",
+			probes: []Probe{dep("a"), last("z"), dep("b", "a"), last("y", "z"), dep("c")},
+			want:   []string{"a", "b", "c", "z", "y"},
+		},
+		{
+			name:    "requiring a probe that runs last",
+			probes:  []Probe{last("z"), dep("a", "z")},
+			wantErr: "probe dependency cycle among a, z",
+		},
+		{
+			name:    "cycle",
+			probes:  []Probe{dep("a"), dep("c", "b"), dep("b", "c"), dep("d", "b")},
+			wantErr: "probe dependency cycle among b, c, d",
+		},
+		{
+			name:    "self",
+			probes:  []Probe{dep("a", "a")},
+			wantErr: "probe dependency cycle among a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderProbes(tt.probes)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := probeNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("order %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+// A cycle in the registry leaves Probes in registration order rather than
+// failing every run.
+func TestProbesWithCycle(t *testing.T) {
+	withRegistry(t, dep("a", "b"), dep("b", "a"))
+	if names := probeNames(Probes()); !slices.Equal(names, []string{"a", "b"}) {
+		t.Errorf("Probes() = %q", names)
+	}
+}
+
+func TestBuiltinProbesOrder(t *testing.T) {
+	all := Probes()
+	seen := map[string]bool{}
+	for _, p := range all {
+		for _, req := range p.Requires() {
+			if !seen[req] {
+				t.Errorf("%s runs before its requirement %s", p.Name(), req)
+			}
+		}
+		seen[p.Name()] = true
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	withRegistry(t, dep("a"))
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	Register(dep("a"))
+}
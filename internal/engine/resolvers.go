@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/dnsx"
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type resolversProbe struct{}
+
+func (resolversProbe) Name() string       { return "resolvers" }
+func (resolversProbe) Title() string      { return "Per-resolver DNS" }
+func (resolversProbe) Requires() []string { return []string{"netinfo"} }
+
+// Run queries each system nameserver over UDP and TCP, and each configured
+// resolver over its own transport, one server at a time so a failing one
+// shows up on its own.
+func (resolversProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Querying each DNS resolver…")
+	log.Println("Querying each DNS resolver")
+
+	var servers []dnsx.Server
+	seen := map[dnsx.Server]bool{}
+	add := func(s dnsx.Server) {
+		if !seen[s] {
+			seen[s] = true
+			servers = append(servers, s)
+		}
+	}
+	for _, ns := range bag.Results().NetInfo.DNSServers {
+		s, err := dnsx.ParseServer(ns)
+		if err != nil {
+			continue
+		}
+		add(s)
+		add(dnsx.Server{Transport: "tcp", Addr: s.Addr})
+	}
+	system := len(servers)
+	for _, spec := range bag.Params.Resolvers {
+		s, err := dnsx.ParseServer(spec)
+		if err != nil {
+			bag.Println(fmt.Sprintf("  skipping resolver: %v", err))
+			log.Printf("skipping resolver: %v", err)
+			continue
+		}
+		add(s)
+	}
+	if len(servers) == 0 {
+		return nil
+	}
+
+	results, mismatches := probes.CheckResolvers(ctx, servers, bag.Params.DNSNames, bag.Params.Timeout)
+	for i := range results {
+		r := &results[i]
+		r.System = i < system
+		answered := len(r.Queries) - r.Failed
+		line := fmt.Sprintf("  %s: %d/%d answered", r.Server, answered, len(r.Queries))
+		if answered > 0 {
+			line += fmt.Sprintf(", avg %.0f ms", r.AvgMs)
+		}
+		if n := r.NXDomain + r.ServFail + r.Refused; n > 0 {
+			line += fmt.Sprintf(" (%d NXDOMAIN, %d SERVFAIL, %d REFUSED)", r.NXDomain, r.ServFail, r.Refused)
+		}
+		bag.Println(line)
+	}
+	for _, m := range mismatches {
+		bag.Println(fmt.Sprintf("  resolvers disagree on %s %s: %s", m.Name, m.Type, m.Detail))
+		log.Printf("resolvers disagree on %s %s: %s", m.Name, m.Type, m.Detail)
+	}
+	bag.Update(func(res *report.Results) {
+		res.Resolvers = results
+		res.DNSMismatches = mismatches
+	})
+	return ctx.Err()
+}
@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+)
+
+const defaultWorkers = 4
+
+// Exclusive is implemented by probes that must not overlap with any other
+// probe, typically because they generate enough traffic to skew latency
+// measurements taken at the same time.
+type Exclusive interface {
+	Exclusive() bool
+}
+
+func isExclusive(p Probe) bool {
+	ex, ok := p.(Exclusive)
+	return ok && ex.Exclusive()
+}
+
+// RunLast is implemented by probes that must run after every other probe in
+// the run, such as one that measures what the run as a whole did. Unlike a
+// requirement it does not add the other probes to the run.
+type RunLast interface {
+	RunLast() bool
+}
+
+func runsLast(p Probe) bool {
+	rl, ok := p.(RunLast)
+	return ok && rl.RunLast()
+}
+
+// after returns the names of the probes p waits for: its requirements and,
+// for a probe that runs last, every other probe in probes that does not.
+func after(p Probe, probes []Probe) []string {
+	deps := p.Requires()
+	if !runsLast(p) {
+		return deps
+	}
+	deps = append([]string(nil), deps...)
+	for _, q := range probes {
+		if !runsLast(q) {
+			deps = append(deps, q.Name())
+		}
+	}
+	return deps
+}
+
+// runGraph runs the probes with up to workers at a time. A probe starts once
+// every probe it requires (and that is part of this run) has finished, and a
+// probe that runs last once every other one has. The
+// probes must already be in dependency order; that order is also the order in
+// which their progress output is released.
+func runGraph(ctx context.Context, ordered []Probe, shared *sharedResults, params Params, workers int) error {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	n := len(ordered)
+	index := make(map[string]int, n)
+	for i, p := range ordered {
+		index[p.Name()] = i
+	}
+	waiting := make([]int, n)
+	dependents := make([][]int, n)
+	for i, p := range ordered {
+		for _, dep := range after(p, ordered) {
+			if j, ok := index[dep]; ok {
+				waiting[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	seq := newSequencer(n, params)
+	type outcome struct {
+		idx int
+		err error
+	}
+	finished := make(chan outcome)
+	started := make([]bool, n)
+	running, done := 0, 0
+	exclusiveRunning := false
+
+	start := func(i int) {
+		started[i] = true
+		running++
+		if isExclusive(ordered[i]) {
+			exclusiveRunning = true
+		}
+		go func() {
+			bag := &Bag{Params: params, shared: shared, out: seq.sink(i)}
+			bag.phase(ordered[i].Name())
+			err := ctx.Err()
+			if err == nil {
+				err = ordered[i].Run(ctx, bag)
+			}
+			finished <- outcome{idx: i, err: err}
+		}()
+	}
+
+	// schedule starts ready probes in order until the worker budget is used
+	// up. An exclusive probe only starts when nothing else is running and
+	// blocks everything behind it until it finishes.
+	schedule := func() {
+		for i := 0; i < n && running < workers && !exclusiveRunning; i++ {
+			if started[i] || waiting[i] > 0 {
+				continue
+			}
+			if isExclusive(ordered[i]) {
+				if running == 0 {
+					start(i)
+				}
+				return
+			}
+			start(i)
+		}
+	}
+
+	var firstErr error
+	schedule()
+	for done < n {
+		if running == 0 {
+			// Nothing can make progress; the order guarantees this only
+			// happens when the context stopped scheduling.
+			break
+		}
+		out := <-finished
+		running--
+		done++
+		if isExclusive(ordered[out.idx]) {
+			exclusiveRunning = false
+		}
+		if out.err != nil {
+			if ctx.Err() != nil {
+				if firstErr == nil {
+					firstErr = ctx.Err()
+				}
+			} else {
+				name := ordered[out.idx].Name()
+				seq.sink(out.idx).println(fmt.Sprintf("  %s probe error: %v", name, out.err))
+				log.Printf("%s probe error: %v", name, out.err)
+			}
+		}
+		seq.finish(out.idx)
+		for _, d := range dependents[out.idx] {
+			waiting[d]--
+		}
+		if ctx.Err() == nil {
+			schedule()
+		}
+	}
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// sequencer releases progress output in probe order even though probes run
+// concurrently: output from the earliest unfinished probe passes straight
+// through, while later probes buffer theirs until every probe before them has
+// finished. A probe that moves to the back with background releases its
+// place and its remaining output comes after everyone else's.
+type sequencer struct {
+	mu      sync.Mutex
+	params  Params
+	printer Printer
+	// order lists the slots in release order and current is the position
+	// in it whose output passes through.
+	order    []int
+	current  int
+	slots    []sequencerSlot
+	children []*probeOutput
+}
+
+type sequencerSlot struct {
+	events []func()
+	done   bool
+}
+
+func newSequencer(n int, params Params) *sequencer {
+	printer := params.Printer
+	if printer == nil {
+		printer = noopPrinter{}
+	}
+	s := &sequencer{params: params, printer: printer, slots: make([]sequencerSlot, n)}
+	s.order = make([]int, n)
+	s.children = make([]*probeOutput, n)
+	for i := range s.children {
+		s.order[i] = i
+		s.children[i] = &probeOutput{seq: s, idx: i}
+	}
+	return s
+}
+
+func (s *sequencer) sink(i int) *probeOutput {
+	return s.children[i]
+}
+
+func (s *sequencer) emit(i int, event func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current < len(s.order) && i == s.order[s.current] {
+		event()
+		return
+	}
+	s.slots[i].events = append(s.slots[i].events, event)
+}
+
+func (s *sequencer) finish(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slots[i].done = true
+	s.advance()
+}
+
+// background moves slot i behind every other unreleased slot. Output it
+// has already released stays where it is.
+func (s *sequencer) background(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := slices.Index(s.order[s.current:], i)
+	if k < 0 {
+		return
+	}
+	k += s.current
+	s.order = append(append(s.order[:k], s.order[k+1:]...), i)
+	if k == s.current {
+		s.release()
+		s.advance()
+	}
+}
+
+// advance moves past finished slots, releasing the buffered output of each
+// slot it reaches.
+func (s *sequencer) advance() {
+	for s.current < len(s.order) && s.slots[s.order[s.current]].done {
+		s.current++
+		s.release()
+	}
+}
+
+func (s *sequencer) release() {
+	if s.current == len(s.order) {
+		return
+	}
+	slot := &s.slots[s.order[s.current]]
+	for _, event := range slot.events {
+		event()
+	}
+	slot.events = nil
+}
+
+// probeOutput is the per-probe progress sink handed out by a sequencer.
+type probeOutput struct {
+	seq *sequencer
+	idx int
+}
+
+func (o *probeOutput) phase(name string) {
+	reporter := o.seq.params.Reporter
+	if reporter == nil {
+		return
+	}
+	o.seq.emit(o.idx, func() { reporter.Phase(name) })
+}
+
+func (o *probeOutput) step(msg string) {
+	reporter := o.seq.params.Reporter
+	printer := o.seq.printer
+	o.seq.emit(o.idx, func() {
+		if reporter != nil {
+			reporter.Step(msg)
+		}
+		printer.Println(msg)
+	})
+}
+
+func (o *probeOutput) println(args ...interface{}) {
+	printer := o.seq.printer
+	o.seq.emit(o.idx, func() { printer.Println(args...) })
+}
@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProbe is a probe whose behaviour a test scripts through run.
+type fakeProbe struct {
+	name      string
+	requires  []string
+	exclusive bool
+	last      bool
+	run       func(ctx context.Context, bag *Bag) error
+}
+
+func (p *fakeProbe) Name() string       { return p.name }
+func (p *fakeProbe) Title() string      { return p.name }
+func (p *fakeProbe) Requires() []string { return p.requires }
+func (p *fakeProbe) Exclusive() bool    { return p.exclusive }
+func (p *fakeProbe) RunLast() bool      { return p.last }
+
+func (p *fakeProbe) Run(ctx context.Context, bag *Bag) error {
+	if p.run == nil {
+		return nil
+	}
+	return p.run(ctx, bag)
+}
+
+// recorder is a Printer and progress.Reporter that keeps what it is given.
+type recorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *recorder) add(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, s)
+}
+
+func (r *recorder) Println(args ...interface{})               { r.add(fmt.Sprint(args...)) }
+func (r *recorder) Printf(format string, args ...interface{}) { r.add(fmt.Sprintf(format, args...)) }
+func (r *recorder) Phase(name string)                         { r.add("phase " + name) }
+func (r *recorder) Step(msg string)                           { r.add("step " + msg) }
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.lines...)
+}
+
+func runFakes(ctx context.Context, probes []*fakeProbe, workers int, params Params) error {
+	ordered := make([]Probe, len(probes))
+	for i, p := range probes {
+		ordered[i] = p
+	}
+	return runGraph(ctx, ordered, &sharedResults{}, params, workers)
+}
+
+func TestRunGraphDependencies(t *testing.T) {
+	rec := &recorder{}
+	sleepy := func(name string, d time.Duration) *fakeProbe {
+		return &fakeProbe{name: name, run: func(context.Context, *Bag) error {
+			rec.add("start " + name)
+			time.Sleep(d)
+			rec.add("end " + name)
+			return nil
+		}}
+	}
+	a := sleepy("a", 30*time.Millisecond)
+	b := sleepy("b", 10*time.Millisecond)
+	b.requires = []string{"a"}
+	c := sleepy("c", 0)
+	c.requires = []string{"a", "b", "not-selected"}
+	d := sleepy("d", 0)
+	if err := runFakes(context.Background(), []*fakeProbe{a, b, c, d}, 4, Params{}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := rec.get()
+	pos := func(e string) int {
+		i := slices.Index(events, e)
+		if i < 0 {
+			t.Fatalf("no %q in %q", e, events)
+		}
+		return i
+	}
+	for _, p := range []*fakeProbe{b, c} {
+		for _, dep := range p.requires {
+			if dep == "not-selected" {
+				continue
+			}
+			if pos("end "+dep) > pos("start "+p.name) {
+				t.Errorf("%s started before %s finished: %q", p.name, dep, events)
+			}
+		}
+	}
+	// d needs nothing, so it does not wait for a.
+	if pos("start d") > pos("end a") {
+		t.Errorf("d waited for a: %q", events)
+	}
+}
+
+// A probe that runs last waits for every other probe, required or not.
+func TestRunGraphRunLast(t *testing.T) {
+	rec := &recorder{}
+	probe := func(name string, d time.Duration) *fakeProbe {
+		return &fakeProbe{name: name, run: func(context.Context, *Bag) error {
+			rec.add("start " + name)
+			time.Sleep(d)
+			rec.add("end " + name)
+			return nil
+		}}
+	}
+	first, slow, fast := probe("first", 0), probe("slow", 30*time.Millisecond), probe("fast", 0)
+	last := probe("last", 0)
+	last.requires, last.last = []string{"first"}, true
+	if err := runFakes(context.Background(), []*fakeProbe{first, last, slow, fast}, 4, Params{}); err != nil {
+		t.Fatal(err)
+	}
+	events := rec.get()
+	if i := slices.Index(events, "start last"); i != len(events)-2 {
+		t.Errorf("last started before the others finished: %q", events)
+	}
+}
+
+func TestRunGraphWorkers(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		var running, peak atomic.Int32
+		var list []*fakeProbe
+		for i := 0; i < 8; i++ {
+			list = append(list, &fakeProbe{name: fmt.Sprint("p", i), run: func(context.Context, *Bag) error {
+				n := running.Add(1)
+				for {
+					old := peak.Load()
+					if n <= old || peak.CompareAndSwap(old, n) {
+						break
+					}
+				}
+				time.Sleep(20 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			}})
+		}
+		if err := runFakes(context.Background(), list, workers, Params{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := peak.Load(); got != int32(workers) {
+			t.Errorf("workers %d: %d probes ran at once", workers, got)
+		}
+	}
+}
+
+func TestRunGraphExclusive(t *testing.T) {
+	var running atomic.Int32
+	var exclusiveRunning atomic.Bool
+	var overlaps atomic.Int32
+	probe := func(name string, exclusive bool) *fakeProbe {
+		return &fakeProbe{name: name, exclusive: exclusive, run: func(context.Context, *Bag) error {
+			running.Add(1)
+			defer running.Add(-1)
+			if exclusive {
+				exclusiveRunning.Store(true)
+				defer exclusiveRunning.Store(false)
+			}
+			for i := 0; i < 4; i++ {
+				if (exclusive && running.Load() != 1) || (!exclusive && exclusiveRunning.Load()) {
+					overlaps.Add(1)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			return nil
+		}}
+	}
+	list := []*fakeProbe{
+		probe("a", false), probe("b", false), probe("load", true),
+		probe("c", false), probe("d", false), probe("voice", true), probe("e", false),
+	}
+	if err := runFakes(context.Background(), list, 4, Params{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("an exclusive probe overlapped others %d times", n)
+	}
+}
+
+func TestRunGraphCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var ran []string
+	var mu sync.Mutex
+	probe := func(name string, requires ...string) *fakeProbe {
+		return &fakeProbe{name: name, requires: requires, run: func(ctx context.Context, bag *Bag) error {
+			mu.Lock()
+			ran = append(ran, name)
+			mu.Unlock()
+			if name == "a" {
+				cancel()
+				return ctx.Err()
+			}
+			return nil
+		}}
+	}
+	// With one worker, c waits behind a even though it needs nothing.
+	list := []*fakeProbe{probe("a"), probe("b", "a"), probe("c")}
+	err := runFakes(ctx, list, 1, Params{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if !slices.Equal(ran, []string{"a"}) {
+		t.Errorf("ran %q after the cancel, want only a", ran)
+	}
+}
+
+// Probes finish in reverse order, but their progress comes out in probe
+// order, each probe's phase and output together.
+func TestRunGraphOutputOrder(t *testing.T) {
+	rec := &recorder{}
+	done2, done1 := make(chan struct{}), make(chan struct{})
+	list := []*fakeProbe{
+		{name: "p0", run: func(_ context.Context, bag *Bag) error {
+			<-done1
+			bag.Say("p0 says")
+			bag.Println("p0 prints")
+			return nil
+		}},
+		{name: "p1", run: func(_ context.Context, bag *Bag) error {
+			<-done2
+			bag.Println("p1 prints")
+			defer close(done1)
+			return errors.New("boom")
+		}},
+		{name: "p2", run: func(_ context.Context, bag *Bag) error {
+			bag.Say("p2 says")
+			close(done2)
+			return nil
+		}},
+	}
+	if err := runFakes(context.Background(), list, 3, Params{Printer: rec, Reporter: rec}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"phase p0", "step p0 says", "p0 says", "p0 prints",
+		"phase p1", "p1 prints", "  p1 probe error: boom",
+		"phase p2", "step p2 says", "p2 says",
+	}
+	if got := rec.get(); !slices.Equal(got, want) {
+		t.Errorf("output:\n got %q\nwant %q", got, want)
+	}
+}
+
+// The first unfinished probe's output is not held back.
+func TestSequencerPassesCurrentThrough(t *testing.T) {
+	rec := &recorder{}
+	seq := newSequencer(2, Params{Printer: rec})
+	seq.sink(1).println("later")
+	seq.sink(0).println("now")
+	if got := rec.get(); !slices.Equal(got, []string{"now"}) {
+		t.Fatalf("before finish: %q", got)
+	}
+	seq.finish(0)
+	seq.sink(1).println("live")
+	if got := rec.get(); !slices.Equal(got, []string{"now", "later", "live"}) {
+		t.Errorf("after finish: %q", got)
+	}
+}
+
+// A probe that goes into the background stops holding back the probes after
+// it; what it prints afterwards comes last.
+func TestRunGraphBackground(t *testing.T) {
+	rec := &recorder{}
+	heard := make(chan struct{})
+	list := []*fakeProbe{
+		{name: "listen", run: func(_ context.Context, bag *Bag) error {
+			bag.Say("listening")
+			bag.Background()
+			<-heard
+			bag.Println("heard a switch")
+			return nil
+		}},
+		{name: "p1", run: func(_ context.Context, bag *Bag) error {
+			bag.Println("p1 prints")
+			return nil
+		}},
+		{name: "p2", requires: []string{"p1"}, run: func(_ context.Context, bag *Bag) error {
+			bag.Println("p2 prints")
+			// Both are out before the listen ends.
+			for !slices.Contains(rec.get(), "p2 prints") {
+				time.Sleep(time.Millisecond)
+			}
+			close(heard)
+			return nil
+		}},
+	}
+	if err := runFakes(context.Background(), list, 3, Params{Printer: rec, Reporter: rec}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"phase listen", "step listening", "listening",
+		"phase p1", "p1 prints",
+		"phase p2", "p2 prints",
+		"heard a switch",
+	}
+	if got := rec.get(); !slices.Equal(got, want) {
+		t.Errorf("output:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestSequencerBackground(t *testing.T) {
+	rec := &recorder{}
+	seq := newSequencer(4, Params{Printer: rec})
+	seq.sink(2).println("2 early")
+	seq.sink(1).println("1 before")
+	// Slot 1 is not current yet, so its buffered output moves with it.
+	seq.background(1)
+	seq.sink(1).println("1 after")
+	seq.sink(0).println("0")
+	seq.finish(0)
+	seq.finish(2)
+	// Slot 3 is current, so it prints straight away; moving it back
+	// releases slot 1's output.
+	seq.sink(3).println("3")
+	seq.background(3)
+	seq.sink(3).println("3 held")
+	seq.finish(1)
+	seq.sink(3).println("3 live")
+	// Once last, going into the background changes nothing.
+	seq.background(3)
+	seq.finish(3)
+	seq.background(3)
+	want := []string{"0", "2 early", "3", "1 before", "1 after", "3 held", "3 live"}
+	if got := rec.get(); !slices.Equal(got, want) {
+		t.Errorf("output %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cneate93/vne/internal/report"
+)
+
+// Target is a named WAN destination checked by the wan, traceroute, path and
+// mtu probes.
+type Target struct {
+	// Name labels the target in results and rules, e.g. "vpn" or "saas";
+	// empty selects the host.
+	Name string
+	Host string
+}
+
+// forEachTarget calls fn for every target at the same time and waits for all
+// of them. Each call gets the target's index in Params.Targets.
+func forEachTarget(ctx context.Context, targets []Target, fn func(ctx context.Context, i int, t Target)) {
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t Target) {
+			defer wg.Done()
+			fn(ctx, i, t)
+		}(i, t)
+	}
+	wg.Wait()
+}
+
+// updateTarget applies fn to the results of target i and mirrors the primary
+// target into the top-level WAN fields.
+func updateTarget(bag *Bag, i int, fn func(*report.TargetResult)) {
+	bag.Update(func(res *report.Results) {
+		if i >= len(res.Targets) {
+			return
+		}
+		t := &res.Targets[i]
+		fn(t)
+		if i == 0 {
+			res.WanPing = t.Ping
+			res.Trace = t.Trace
+			res.Path = t.Path
+			res.MTU = t.MTU
+		}
+	})
+}
+
+func targetLabel(t Target) string {
+	if t.Name == t.Host {
+		return t.Host
+	}
+	return t.Name + " (" + t.Host + ")"
+}
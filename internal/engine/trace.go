@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"context"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type traceProbe struct{}
+
+func (traceProbe) Name() string       { return "traceroute" }
+func (traceProbe) Title() string      { return "Traceroute" }
+func (traceProbe) Requires() []string { return nil }
+
+func (traceProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Traceroute (this may take ~10–20 seconds)…")
+	log.Println("Running traceroute")
+	forEachTarget(ctx, bag.Params.Targets, func(ctx context.Context, i int, t Target) {
+		trace, _ := probes.Trace(ctx, t.Host, 20, bag.Params.Timeout)
+		updateTarget(bag, i, func(tr *report.TargetResult) {
+			tr.Trace = trace
+		})
+	})
+	return ctx.Err()
+}
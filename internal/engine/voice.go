@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type voiceProbe struct{}
+
+func (voiceProbe) Name() string       { return "voice" }
+func (voiceProbe) Title() string      { return "Voice/video quality" }
+func (voiceProbe) Requires() []string { return nil }
+
+// Exclusive keeps other probes' traffic out of the jitter and loss.
+func (voiceProbe) Exclusive() bool { return true }
+
+func (voiceProbe) Run(ctx context.Context, bag *Bag) error {
+	params := bag.Params
+	endpoint := params.VoiceEndpoint
+	if endpoint == "" {
+		endpoint = params.LoadEndpoint
+	}
+	if endpoint == "" {
+		bag.Say("→ Skipping voice/video quality (set --voice-endpoint to a reflector).")
+		log.Println("Skipping voice/video quality (no reflector)")
+		return nil
+	}
+	bag.Say("→ Streaming voice-sized UDP packets to " + endpoint + "…")
+	log.Println("Measuring voice/video quality against", endpoint)
+	res := probes.VoiceQuality(ctx, endpoint, params.VoiceDuration, params.VoiceRate, params.VoiceSize)
+	if res.Error != "" {
+		bag.Println("  Voice/video quality:", res.Error)
+		log.Println("voice/video quality:", res.Error)
+	} else {
+		bag.Println(fmt.Sprintf("  Loss %.1f%%; jitter %.1f ms; RTT %.1f ms; MOS %.2f (R %.0f, %s)",
+			res.Loss*100, res.JitterMs, res.AvgMs, res.MOS, res.RFactor, res.Quality))
+	}
+	bag.Update(func(r *report.Results) { r.Voice = &res })
+	return ctx.Err()
+}
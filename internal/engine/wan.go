@@ -0,0 +1,32 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type wanProbe struct{}
+
+func (wanProbe) Name() string       { return "wan" }
+func (wanProbe) Title() string      { return "WAN ping" }
+func (wanProbe) Requires() []string { return nil }
+
+func (wanProbe) Run(ctx context.Context, bag *Bag) error {
+	forEachTarget(ctx, bag.Params.Targets, func(ctx context.Context, i int, t Target) {
+		bag.Say(fmt.Sprintf("→ Pinging internet target: %s", targetLabel(t)))
+		log.Println("Pinging internet target", t.Host)
+		ping, err := probes.PingHost(ctx, t.Host, bag.Params.Count, bag.Params.Timeout)
+		if err != nil && ctx.Err() == nil {
+			bag.Println("  WAN ping error:", t.Name+":", err)
+			log.Println("WAN ping error:", t.Host, err)
+		}
+		updateTarget(bag, i, func(tr *report.TargetResult) {
+			tr.Ping = ping
+		})
+	})
+	return ctx.Err()
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+type wirelessProbe struct{}
+
+func (wirelessProbe) Name() string       { return "wireless" }
+func (wirelessProbe) Title() string      { return "Wi-Fi link" }
+func (wirelessProbe) Requires() []string { return []string{"netinfo"} }
+
+// Run reads the Wi-Fi link quality of the interface carrying the default
+// route, or of the first connected wireless interface.
+func (wirelessProbe) Run(ctx context.Context, bag *Bag) error {
+	bag.Say("→ Checking Wi-Fi link quality…")
+	log.Println("Checking Wi-Fi link quality")
+	info, err := probes.Wireless(defaultRouteIface(bag.Results().NetInfo))
+	if err != nil {
+		bag.Println("  Skipping Wi-Fi checks:", err)
+		log.Println("wireless:", err)
+		return nil
+	}
+	if info == nil {
+		bag.Println("  No wireless interface found.")
+		return nil
+	}
+	bag.Println(fmt.Sprintf("  %s: SSID %q, channel %d (%s), signal %d dBm, tx bitrate %.1f Mbit/s",
+		info.Iface, info.SSID, info.Channel, info.Band, info.SignalDBm, info.TxBitrateMbps))
+	bag.Update(func(res *report.Results) {
+		res.Wireless = info
+	})
+	return ctx.Err()
+}
+
+// defaultRouteIface returns the interface of the lowest-metric IPv4 default
+// route in the main table, or "" when the routes are unknown.
+func defaultRouteIface(info probes.NetInfo) string {
+	iface, metric := "", 0
+	for _, r := range info.Routes {
+		if r.Destination != "0.0.0.0/0" || r.TableName() != "main" || r.Iface == "" {
+			continue
+		}
+		if iface == "" || r.Metric < metric {
+			iface, metric = r.Iface, r.Metric
+		}
+	}
+	return iface
+}
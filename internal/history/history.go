@@ -28,6 +28,7 @@ type Entry struct {
 	When           time.Time `json:"when"`
 	Target         string    `json:"target,omitempty"`
 	Classification string    `json:"classification,omitempty"`
+	Partial        bool      `json:"partial,omitempty"`
 }
 
 func NewStore(dir string, max int) *Store {
@@ -150,6 +151,41 @@ func (s *Store) Load(id string) (*report.Results, error) {
 	return &res, nil
 }
 
+// Latest returns the newest stored run for which match reports true, and
+// its ID. It returns os.ErrNotExist when no run matches.
+func (s *Store) Latest(match func(*report.Results) bool) (string, *report.Results, error) {
+	if s == nil {
+		return "", nil, errors.New("nil history store")
+	}
+	names, err := s.sortedRunFiles()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, name := range names {
+		id := strings.TrimSuffix(name, ".json")
+		res, err := s.Load(id)
+		if err != nil {
+			continue
+		}
+		if match == nil || match(res) {
+			return id, res, nil
+		}
+	}
+	return "", nil, os.ErrNotExist
+}
+
+// Delete removes a stored run.
+func (s *Store) Delete(id string) error {
+	if s == nil {
+		return errors.New("nil history store")
+	}
+	cleanID, err := sanitizeID(id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.pathFor(cleanID))
+}
+
 func (s *Store) prune() error {
 	names, err := s.sortedRunFiles()
 	if err != nil {
@@ -201,6 +237,7 @@ func (s *Store) readMeta(id string) (Entry, error) {
 		When           time.Time `json:"when"`
 		Target         string    `json:"target_host"`
 		Classification string    `json:"classification"`
+		Partial        bool      `json:"partial"`
 	}
 	if err := json.Unmarshal(data, &meta); err != nil {
 		return Entry{}, err
@@ -210,6 +247,7 @@ func (s *Store) readMeta(id string) (Entry, error) {
 		When:           meta.When,
 		Target:         strings.TrimSpace(meta.Target),
 		Classification: strings.TrimSpace(meta.Classification),
+		Partial:        meta.Partial,
 	}, nil
 }
 
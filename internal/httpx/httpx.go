@@ -0,0 +1,20 @@
+// Package httpx builds the HTTP transports the checks share.
+package httpx
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// OneShotTransport returns a transport for a single measured request: it
+// honours the proxy environment, opens a fresh connection rather than
+// reusing one, and still negotiates HTTP/2 when tlsConfig is set, which
+// turns it off unless asked for.
+func OneShotTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   tlsConfig,
+		DisableKeepAlives: true,
+		ForceAttemptHTTP2: true,
+	}
+}
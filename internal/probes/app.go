@@ -0,0 +1,210 @@
+package probes
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cneate93/vne/internal/httpx"
+)
+
+// AppResult times one application check. URLs go through every stage of an
+// HTTP request; host:port targets stop after the TCP connect. Stage times are
+// zero for stages that did not happen, e.g. DNS for an IP address.
+type AppResult struct {
+	Target string `json:"target"`
+	// Kind is "http" or "tcp".
+	Kind string `json:"kind"`
+	// Addr is the address connected to.
+	Addr      string  `json:"addr,omitempty"`
+	DNSMs     float64 `json:"dns_ms"`
+	ConnectMs float64 `json:"connect_ms"`
+	TLSMs     float64 `json:"tls_ms"`
+	// TTFBMs is the time from sending the request to the first response
+	// byte, i.e. the server's think time plus one round trip.
+	TTFBMs float64 `json:"ttfb_ms"`
+	// TotalMs runs from the start of the check to the end of the body.
+	TotalMs    float64 `json:"total_ms"`
+	Status     int     `json:"status,omitempty"`
+	Proto      string  `json:"proto,omitempty"`
+	TLSVersion string  `json:"tls_version,omitempty"`
+	ALPN       string  `json:"alpn,omitempty"`
+	CertIssuer string  `json:"cert_issuer,omitempty"`
+	// CertExpiry is the leaf certificate's NotAfter and CertDaysLeft the
+	// days until then, negative once expired.
+	CertExpiry   *time.Time `json:"cert_expiry,omitempty"`
+	CertDaysLeft float64    `json:"cert_days_left"`
+	Bytes        int64      `json:"bytes,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// maxAppBody caps how much of a response body is read for the transfer time.
+const maxAppBody = 10 << 20
+
+// AppCheck checks one application target: an http:// or https:// URL, a
+// host:port pair for a plain TCP connect, or a bare host, which is fetched
+// over HTTPS. Redirects are not followed so the timings cover one exchange.
+func AppCheck(ctx context.Context, target string, timeout time.Duration) AppResult {
+	return appCheck(ctx, target, timeout, nil)
+}
+
+func appCheck(ctx context.Context, target string, timeout time.Duration, tlsConfig *tls.Config) AppResult {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	target = strings.TrimSpace(target)
+	if !strings.Contains(target, "://") {
+		if _, _, err := net.SplitHostPort(target); err == nil {
+			return tcpCheck(ctx, target)
+		}
+		return httpCheck(ctx, target, "https://"+target, tlsConfig)
+	}
+	return httpCheck(ctx, target, target, tlsConfig)
+}
+
+func tcpCheck(ctx context.Context, target string) AppResult {
+	res := AppResult{Target: target, Kind: "tcp"}
+	start := time.Now()
+	host, port, _ := net.SplitHostPort(target)
+	addrs := []string{host}
+	if net.ParseIP(host) == nil {
+		resolved, err := net.DefaultResolver.LookupHost(ctx, host)
+		res.DNSMs = msSince(start)
+		if err != nil {
+			res.Error = err.Error()
+			res.TotalMs = msSince(start)
+			return res
+		}
+		addrs = resolved
+	}
+
+	connectStart := time.Now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+	res.ConnectMs = msSince(connectStart)
+	res.TotalMs = msSince(start)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Addr = conn.RemoteAddr().String()
+	conn.Close()
+	return res
+}
+
+func httpCheck(ctx context.Context, target, url string, tlsConfig *tls.Config) AppResult {
+	res := AppResult{Target: target, Kind: "http"}
+	// The transport calls the hooks from its dial, write and read
+	// goroutines, and with Happy Eyeballs dials IPv4 and IPv6 at once, so
+	// the hooks share a lock and connect times are kept per address for the
+	// connection used to pick its own.
+	var (
+		mu                               sync.Mutex
+		dnsStart, tlsStart, wroteRequest time.Time
+		connectStart                     = map[string]time.Time{}
+		connectMs                        = map[string]float64{}
+	)
+	locked := func(f func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		f()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { locked(func() { dnsStart = time.Now() }) },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			locked(func() {
+				if !dnsStart.IsZero() {
+					res.DNSMs = msSince(dnsStart)
+				}
+			})
+		},
+		ConnectStart: func(_, addr string) { locked(func() { connectStart[addr] = time.Now() }) },
+		ConnectDone: func(_, addr string, err error) {
+			locked(func() {
+				if started, ok := connectStart[addr]; ok && err == nil {
+					connectMs[addr] = msSince(started)
+				}
+			})
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			addr := info.Conn.RemoteAddr().String()
+			locked(func() { res.Addr, res.ConnectMs = addr, connectMs[addr] })
+		},
+		TLSHandshakeStart: func() { locked(func() { tlsStart = time.Now() }) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			locked(func() {
+				if err == nil && !tlsStart.IsZero() {
+					res.TLSMs = msSince(tlsStart)
+				}
+			})
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { locked(func() { wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() {
+			locked(func() {
+				if !wroteRequest.IsZero() {
+					res.TTFBMs = msSince(wroteRequest)
+				}
+			})
+		},
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", "vne-agent")
+	transport := httpx.OneShotTransport(tlsConfig)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Error = err.Error()
+		res.TotalMs = msSince(start)
+		return res
+	}
+	defer resp.Body.Close()
+	res.Bytes, err = io.Copy(io.Discard, io.LimitReader(resp.Body, maxAppBody))
+	res.TotalMs = msSince(start)
+	if err != nil {
+		res.Error = fmt.Sprintf("read body: %v", err)
+	}
+	res.Status = resp.StatusCode
+	res.Proto = resp.Proto
+	if state := resp.TLS; state != nil {
+		res.TLSVersion = tls.VersionName(state.Version)
+		res.ALPN = state.NegotiatedProtocol
+		if len(state.PeerCertificates) > 0 {
+			leaf := state.PeerCertificates[0]
+			res.CertIssuer = leaf.Issuer.CommonName
+			if res.CertIssuer == "" {
+				res.CertIssuer = leaf.Issuer.String()
+			}
+			expiry := leaf.NotAfter
+			res.CertExpiry = &expiry
+			res.CertDaysLeft = time.Until(expiry).Hours() / 24
+		}
+	}
+	return res
+}
+
+func msSince(t time.Time) float64 {
+	return float64(time.Since(t)) / float64(time.Millisecond)
+}
@@ -0,0 +1,109 @@
+package probes
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAppTestServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *tls.Config) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(h)
+	srv.EnableHTTP2 = true
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+}
+
+func TestAppCheckHTTPS(t *testing.T) {
+	srv, tlsConfig := newAppTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		w.Write([]byte("hello"))
+	})
+	res := appCheck(context.Background(), srv.URL, 5*time.Second, tlsConfig)
+	if res.Error != "" {
+		t.Fatalf("error: %s", res.Error)
+	}
+	if res.Kind != "http" || res.Status != http.StatusOK || res.Bytes != 5 {
+		t.Errorf("kind %q status %d bytes %d, want http 200 5", res.Kind, res.Status, res.Bytes)
+	}
+	if res.Proto != "HTTP/2.0" || res.ALPN != "h2" {
+		t.Errorf("proto %q ALPN %q, want HTTP/2.0 over h2", res.Proto, res.ALPN)
+	}
+	if res.TLSVersion != "TLS 1.3" {
+		t.Errorf("TLS version %q, want TLS 1.3", res.TLSVersion)
+	}
+	if want := srv.Listener.Addr().String(); res.Addr != want {
+		t.Errorf("addr %q, want %q", res.Addr, want)
+	}
+	if res.DNSMs != 0 {
+		t.Errorf("DNS %v ms for an IP address, want 0", res.DNSMs)
+	}
+	if res.ConnectMs <= 0 || res.TLSMs <= 0 {
+		t.Errorf("connect %v ms, TLS %v ms, want both > 0", res.ConnectMs, res.TLSMs)
+	}
+	if res.TTFBMs < 30 || res.TotalMs < res.TTFBMs+res.ConnectMs+res.TLSMs {
+		t.Errorf("TTFB %v ms, total %v ms: want TTFB >= 30 and total covering every stage", res.TTFBMs, res.TotalMs)
+	}
+	cert := srv.Certificate()
+	if !strings.Contains(res.CertIssuer, "Acme Co") {
+		t.Errorf("cert issuer %q, want the test certificate's", res.CertIssuer)
+	}
+	if res.CertExpiry == nil || !res.CertExpiry.Equal(cert.NotAfter) {
+		t.Errorf("cert expiry %v, want %v", res.CertExpiry, cert.NotAfter)
+	}
+	if want := time.Until(cert.NotAfter).Hours() / 24; math.Abs(res.CertDaysLeft-want) > 0.01 {
+		t.Errorf("cert days left %v, want about %v", res.CertDaysLeft, want)
+	}
+}
+
+func TestAppCheckServerError(t *testing.T) {
+	srv, tlsConfig := newAppTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	})
+	res := appCheck(context.Background(), srv.URL, 5*time.Second, tlsConfig)
+	if res.Error != "" {
+		t.Fatalf("error: %s", res.Error)
+	}
+	if res.Status != http.StatusServiceUnavailable {
+		t.Errorf("status %d, want 503", res.Status)
+	}
+}
+
+func TestAppCheckNoRedirects(t *testing.T) {
+	srv, tlsConfig := newAppTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	})
+	res := appCheck(context.Background(), srv.URL, 5*time.Second, tlsConfig)
+	if res.Status != http.StatusFound {
+		t.Errorf("status %d, want the redirect itself (302)", res.Status)
+	}
+}
+
+func TestAppCheckUntrustedCert(t *testing.T) {
+	srv, _ := newAppTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	res := appCheck(context.Background(), srv.URL, 5*time.Second, nil)
+	if res.Error == "" || res.Status != 0 {
+		t.Errorf("status %d error %q, want a certificate error", res.Status, res.Error)
+	}
+}
+
+func TestAppCheckTCP(t *testing.T) {
+	srv, _ := newAppTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	addr := srv.Listener.Addr().String()
+	res := AppCheck(context.Background(), addr, 5*time.Second)
+	if res.Error != "" {
+		t.Fatalf("error: %s", res.Error)
+	}
+	if res.Kind != "tcp" || res.Addr != addr || res.Status != 0 {
+		t.Errorf("kind %q addr %q status %d, want a tcp connect to %s", res.Kind, res.Addr, res.Status, addr)
+	}
+}
@@ -0,0 +1,250 @@
+package probes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// arpRounds is how often an address that has not answered is asked
+	// again, and arpPace the gap between two requests so a large subnet
+	// does not flood the segment.
+	arpRounds = 2
+	arpPace   = 2 * time.Millisecond
+	// arpPoll bounds each blocking read so cancellation is noticed.
+	arpPoll = 50 * time.Millisecond
+
+	arpPacketLen = 28
+	arpRequest   = 1
+	arpReply     = 2
+)
+
+var ethBroadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// arpScan sends ARP requests for every target address over an AF_PACKET
+// socket and listens for the replies and for any other ARP traffic on the
+// segment. It needs root or CAP_NET_RAW; the error tells L2Scan to fall
+// back to the ping sweep.
+func arpScan(ctx context.Context, targets []*scanTarget, timeout time.Duration) ([]L2Host, error) {
+	var hosts []L2Host
+	scanned := false
+	for _, t := range targets {
+		if len(t.HWAddr) != 6 {
+			continue
+		}
+		found, err := arpScanTarget(ctx, t, timeout)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, err
+		}
+		scanned = true
+		hosts = append(hosts, found...)
+	}
+	if !scanned {
+		return nil, errors.New("no Ethernet interface to send ARP requests on")
+	}
+	return hosts, nil
+}
+
+// arpScanTarget scans one subnet. Requests go out arpPace apart; after
+// each round the addresses that have not answered are asked again, and the
+// socket is read until timeout after the last request.
+func arpScanTarget(ctx context.Context, t *scanTarget, timeout time.Duration) ([]L2Host, error) {
+	proto := htons(syscall.ETH_P_ARP)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, int(proto))
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: t.Index}); err != nil {
+		return nil, err
+	}
+	tv := syscall.NsecToTimeval(arpPoll.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		return nil, err
+	}
+
+	scan := newARPScan(t)
+	dst := &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: t.Index, Halen: 6}
+	copy(dst.Addr[:], ethBroadcast)
+	sendErr := make(chan error, 1)
+	go func() {
+		defer close(sendErr)
+		for round := 0; round < arpRounds; round++ {
+			for _, host := range t.Hosts {
+				ip := net.ParseIP(host).To4()
+				if ip == nil || scan.answered(host) {
+					continue
+				}
+				frame := arpFrame(t.HWAddr, t.LocalIP, ip)
+				scan.sent(host)
+				if err := syscall.Sendto(fd, frame, 0, dst); err != nil {
+					sendErr <- err
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(arpPace):
+				}
+			}
+			// Give the first round's replies time to arrive before asking
+			// again.
+			if round+1 < arpRounds {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(timeout / 2):
+				}
+			}
+		}
+	}()
+
+	buf := make([]byte, 1514)
+	var sendDone time.Time
+	for ctx.Err() == nil {
+		if sendDone.IsZero() {
+			select {
+			case err := <-sendErr:
+				if err != nil {
+					return nil, err
+				}
+				sendDone = time.Now()
+			default:
+			}
+		} else if time.Since(sendDone) >= timeout {
+			break
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return nil, err
+		}
+		scan.frame(buf[:n], time.Now())
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return scan.hosts(), nil
+}
+
+// arpScanState collects what one subnet's scan has seen.
+type arpScanState struct {
+	t      *scanTarget
+	mu     sync.Mutex
+	sentAt map[string]time.Time
+	byIP   map[string]*L2Host
+	order  []string
+}
+
+func newARPScan(t *scanTarget) *arpScanState {
+	return &arpScanState{t: t, sentAt: map[string]time.Time{}, byIP: map[string]*L2Host{}}
+}
+
+func (s *arpScanState) sent(ip string) {
+	s.mu.Lock()
+	s.sentAt[ip] = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *arpScanState) answered(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.byIP[ip]
+	return h != nil && h.Source == "arp"
+}
+
+// frame records the sender of an ARP packet. A reply to this host's
+// request counts as an answer and gets a response time; any other ARP
+// packet from the subnet is recorded as passive. A sender claiming this
+// host's own address with another MAC is recorded as a conflict with it.
+func (s *arpScanState) frame(b []byte, at time.Time) {
+	if len(b) < ethHeaderLen+arpPacketLen || binary.BigEndian.Uint16(b[12:14]) != syscall.ETH_P_ARP {
+		return
+	}
+	p := b[ethHeaderLen:]
+	if binary.BigEndian.Uint16(p[0:2]) != 1 || binary.BigEndian.Uint16(p[2:4]) != syscall.ETH_P_IP || p[4] != 6 || p[5] != 4 {
+		return
+	}
+	op := binary.BigEndian.Uint16(p[6:8])
+	sha, spa := net.HardwareAddr(p[8:14]), net.IP(p[14:18])
+	tha, tpa := net.HardwareAddr(p[18:24]), net.IP(p[24:28])
+	// Address probes (RFC 5227) come from 0.0.0.0.
+	if spa.IsUnspecified() || !s.t.covers(spa) {
+		return
+	}
+	mac := normalizeMAC(sha.String())
+	if mac == "" {
+		return
+	}
+	own := normalizeMAC(s.t.HWAddr.String())
+	if spa.Equal(s.t.LocalIP) && mac == own {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ip := spa.String()
+	h := s.byIP[ip]
+	if h == nil {
+		h = &L2Host{IfName: s.t.IfName, IP: ip, MAC: mac, Source: "arp-passive"}
+		if info, ok := VendorFromMAC(mac); ok {
+			h.Vendor = info.Name
+		}
+		if spa.Equal(s.t.LocalIP) {
+			h.ConflictMACs = []string{own}
+		}
+		s.byIP[ip] = h
+		s.order = append(s.order, ip)
+	} else if mac != h.MAC && !containsString(h.ConflictMACs, mac) {
+		h.ConflictMACs = append(h.ConflictMACs, mac)
+	}
+	if spa.Equal(tpa) {
+		h.Gratuitous = true
+	}
+	if op == arpReply && tpa.Equal(s.t.LocalIP) && bytes.Equal(tha, s.t.HWAddr) && mac == h.MAC && h.Source != "arp" {
+		h.Source = "arp"
+		if sent, ok := s.sentAt[ip]; ok {
+			h.RTTMs = float64(at.Sub(sent)) / float64(time.Millisecond)
+		}
+	}
+}
+
+func (s *arpScanState) hosts() []L2Host {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]L2Host, 0, len(s.order))
+	for _, ip := range s.order {
+		out = append(out, *s.byIP[ip])
+	}
+	return out
+}
+
+// arpFrame builds a broadcast ARP request for ip.
+func arpFrame(srcMAC net.HardwareAddr, srcIP, ip net.IP) []byte {
+	b := make([]byte, ethHeaderLen+arpPacketLen)
+	copy(b[0:6], ethBroadcast)
+	copy(b[6:12], srcMAC)
+	binary.BigEndian.PutUint16(b[12:14], syscall.ETH_P_ARP)
+	p := b[ethHeaderLen:]
+	binary.BigEndian.PutUint16(p[0:2], 1)
+	binary.BigEndian.PutUint16(p[2:4], syscall.ETH_P_IP)
+	p[4], p[5] = 6, 4
+	binary.BigEndian.PutUint16(p[6:8], arpRequest)
+	copy(p[8:14], srcMAC)
+	copy(p[14:18], srcIP.To4())
+	copy(p[24:28], ip.To4())
+	return b
+}
+
+func htons(v uint16) uint16 { return v<<8 | v>>8 }
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package probes
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+)
+
+// arpScan needs a Linux packet socket; elsewhere L2Scan falls back to the
+// ping sweep.
+func arpScan(ctx context.Context, targets []*scanTarget, timeout time.Duration) ([]L2Host, error) {
+	return nil, errors.New("ARP scanning is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,367 @@
+package probes
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cneate93/vne/internal/reflector"
+)
+
+// BufferbloatResult is a latency-under-load test against a reflector: the
+// latency at idle, then while downloads and while uploads fill the link.
+// Latency that grows under load means an oversized queue, usually in the
+// router or modem, which makes calls choppy while anything else transfers.
+type BufferbloatResult struct {
+	// Endpoint is the reflector, an http:// URL or a host:port for its raw
+	// TCP mode. Mode is "http" or "tcp".
+	Endpoint string      `json:"endpoint"`
+	Mode     string      `json:"mode"`
+	Streams  int         `json:"streams"`
+	Idle     LoadLatency `json:"idle"`
+	Download LoadPhase   `json:"download"`
+	Upload   LoadPhase   `json:"upload"`
+	// IncreaseMs is the larger increase of the two directions and Grade
+	// rates it from A+ (under 5 ms) to F (400 ms or more).
+	IncreaseMs float64 `json:"increase_ms"`
+	Grade      string  `json:"grade,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// LoadLatency sums up the latency samples of one phase. Over HTTP a sample
+// is a request on a kept-alive connection apart from the load; in TCP mode
+// it is a TCP handshake. Lost samples got no answer within loadSampleTimeout.
+type LoadLatency struct {
+	Samples int     `json:"samples"`
+	Lost    int     `json:"lost"`
+	AvgMs   float64 `json:"avg_ms"`
+	P95Ms   float64 `json:"p95_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
+
+// LoadPhase is one direction under load.
+type LoadPhase struct {
+	// Mbps counts the bytes moved after the warm-up, when send buffers are
+	// full and the rate is the link's.
+	Mbps    float64     `json:"mbps"`
+	Bytes   int64       `json:"bytes"`
+	Latency LoadLatency `json:"latency"`
+	// IncreaseMs is the average latency under load less the idle average.
+	IncreaseMs float64 `json:"increase_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+const (
+	loadIdle          = 2 * time.Second
+	loadSampleEvery   = 100 * time.Millisecond
+	loadSampleTimeout = 2 * time.Second
+	// loadWarmup is left out of the loaded latency while TCP ramps up and
+	// the queue fills.
+	loadWarmup = time.Second
+	loadChunk  = 64 << 10
+)
+
+// loadPinger takes one latency sample.
+type loadPinger func(ctx context.Context) (time.Duration, error)
+
+// loadStream moves data in one direction until ctx is done, adding the
+// bytes moved to n.
+type loadStream func(ctx context.Context, n *atomic.Int64) error
+
+// loadTest is how one kind of endpoint is pinged and loaded.
+type loadTest struct {
+	ping             loadPinger
+	download, upload loadStream
+	close            func()
+}
+
+// Bufferbloat measures latency at idle, then saturates the download and the
+// upload in turn with streams parallel connections for duration each while
+// sampling latency every 100 ms. endpoint is an http:// or https:// URL of
+// a reflector, or host:port (optionally tcp://) for its raw TCP mode; a
+// bare host uses the reflector's default port.
+func Bufferbloat(ctx context.Context, endpoint string, duration time.Duration, streams int) BufferbloatResult {
+	if duration <= 0 {
+		duration = 8 * time.Second
+	}
+	if streams <= 0 {
+		streams = 4
+	}
+	res := BufferbloatResult{Endpoint: strings.TrimSpace(endpoint), Streams: streams}
+
+	chunk := make([]byte, loadChunk)
+	rand.Read(chunk)
+	var t loadTest
+	if strings.HasPrefix(res.Endpoint, "http://") || strings.HasPrefix(res.Endpoint, "https://") {
+		res.Mode = "http"
+		t = httpLoad(strings.TrimSuffix(res.Endpoint, "/"), duration, chunk)
+	} else {
+		res.Mode = "tcp"
+		addr := strings.TrimPrefix(res.Endpoint, "tcp://")
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), reflector.DefaultPort)
+		}
+		t = tcpLoad(addr, chunk)
+	}
+	defer t.close()
+
+	// The first sample sets up the connection; only then is latency idle.
+	if _, err := t.ping(ctx); err != nil {
+		res.Error = fmt.Sprintf("reflector unreachable: %v", err)
+		return res
+	}
+	res.Idle = sampleLatency(ctx, t.ping, loadIdle, 0)
+	if res.Idle.Samples == 0 {
+		res.Error = "no latency samples at idle"
+		return res
+	}
+	res.Download = loadPhase(ctx, t.ping, t.download, streams, duration, res.Idle)
+	res.Upload = loadPhase(ctx, t.ping, t.upload, streams, duration, res.Idle)
+	res.IncreaseMs = max(res.Download.IncreaseMs, res.Upload.IncreaseMs)
+	if res.Download.Latency.Samples > 0 || res.Upload.Latency.Samples > 0 {
+		res.Grade = bloatGrade(res.IncreaseMs)
+	}
+	return res
+}
+
+// loadPhase runs streams copies of stream for d while sampling latency.
+func loadPhase(ctx context.Context, ping loadPinger, stream loadStream, streams int, d time.Duration, idle LoadLatency) LoadPhase {
+	var phase LoadPhase
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	var n atomic.Int64
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failures []string
+	var warmBytes int64
+	var warmAt time.Time
+	warm := time.AfterFunc(loadWarmup, func() {
+		mu.Lock()
+		warmBytes, warmAt = n.Load(), time.Now()
+		mu.Unlock()
+	})
+	defer warm.Stop()
+	for i := 0; i < streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stream(ctx, &n); err != nil && ctx.Err() == nil {
+				mu.Lock()
+				failures = append(failures, err.Error())
+				mu.Unlock()
+			}
+		}()
+	}
+	phase.Latency = sampleLatency(ctx, ping, d, loadWarmup)
+	cancel()
+	wg.Wait()
+
+	phase.Bytes = n.Load()
+	mu.Lock()
+	if !warmAt.IsZero() {
+		if secs := time.Since(warmAt).Seconds(); secs > 0 {
+			phase.Mbps = float64(phase.Bytes-warmBytes) * 8 / secs / 1e6
+		}
+	}
+	mu.Unlock()
+	if len(failures) == streams {
+		phase.Error = failures[0]
+	}
+	if phase.Latency.Samples > 0 {
+		phase.IncreaseMs = max(0, phase.Latency.AvgMs-idle.AvgMs)
+	}
+	return phase
+}
+
+// sampleLatency pings every loadSampleEvery for d, ignoring the samples
+// taken in the first skip.
+func sampleLatency(ctx context.Context, ping loadPinger, d, skip time.Duration) LoadLatency {
+	var res LoadLatency
+	var rtts []float64
+	start := time.Now()
+	for time.Since(start) < d && ctx.Err() == nil {
+		next := time.Now().Add(loadSampleEvery)
+		sctx, cancel := context.WithTimeout(ctx, loadSampleTimeout)
+		rtt, err := ping(sctx)
+		cancel()
+		if time.Since(start) >= skip {
+			switch {
+			case err == nil:
+				ms := float64(rtt) / float64(time.Millisecond)
+				rtts = append(rtts, ms)
+				res.MaxMs = max(res.MaxMs, ms)
+			case ctx.Err() == nil:
+				res.Lost++
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(next)):
+		}
+	}
+	res.Samples = len(rtts)
+	res.AvgMs = average(rtts)
+	res.P95Ms = percentile95(rtts)
+	return res
+}
+
+// bloatGrade rates the latency increase under load.
+func bloatGrade(increaseMs float64) string {
+	switch {
+	case increaseMs < 5:
+		return "A+"
+	case increaseMs < 30:
+		return "A"
+	case increaseMs < 60:
+		return "B"
+	case increaseMs < 200:
+		return "C"
+	case increaseMs < 400:
+		return "D"
+	}
+	return "F"
+}
+
+// httpLoad uses the reflector's HTTP endpoints. Latency samples reuse one
+// kept-alive connection so they time a round trip rather than a handshake.
+func httpLoad(base string, d time.Duration, chunk []byte) loadTest {
+	pingTransport := &http.Transport{Proxy: http.ProxyFromEnvironment, MaxConnsPerHost: 1}
+	pingClient := &http.Client{Transport: pingTransport}
+	loadClient := &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, DisableKeepAlives: true, DisableCompression: true}}
+
+	ping := func(ctx context.Context) (time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/ping", nil)
+		if err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		resp, err := pingClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return 0, fmt.Errorf("ping: HTTP %d", resp.StatusCode)
+		}
+		return time.Since(start), nil
+	}
+	download := func(ctx context.Context, n *atomic.Int64) error {
+		url := fmt.Sprintf("%s/download?seconds=%g", base, (d + time.Second).Seconds())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := loadClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("download: HTTP %d", resp.StatusCode)
+		}
+		_, err = io.Copy(countWriter{n}, resp.Body)
+		return err
+	}
+	upload := func(ctx context.Context, n *atomic.Int64) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/upload", &loadReader{ctx: ctx, chunk: chunk, n: n})
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err := loadClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return loadTest{ping: ping, download: download, upload: upload, close: pingTransport.CloseIdleConnections}
+}
+
+// tcpLoad uses the reflector's raw TCP mode; a latency sample is the time
+// to complete a TCP handshake.
+func tcpLoad(addr string, chunk []byte) loadTest {
+	var d net.Dialer
+	ping := func(ctx context.Context) (time.Duration, error) {
+		start := time.Now()
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		conn.Close()
+		return rtt, nil
+	}
+	open := func(ctx context.Context, cmd string) (net.Conn, func() bool, error) {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		if _, err := io.WriteString(conn, cmd+"\n"); err != nil {
+			stop()
+			conn.Close()
+			return nil, nil, err
+		}
+		return conn, stop, nil
+	}
+	download := func(ctx context.Context, n *atomic.Int64) error {
+		conn, stop, err := open(ctx, reflector.CmdDownload)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		defer conn.Close()
+		_, err = io.Copy(countWriter{n}, conn)
+		return err
+	}
+	upload := func(ctx context.Context, n *atomic.Int64) error {
+		conn, stop, err := open(ctx, reflector.CmdUpload)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		defer conn.Close()
+		for {
+			w, err := conn.Write(chunk)
+			n.Add(int64(w))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return loadTest{ping: ping, download: download, upload: upload, close: func() {}}
+}
+
+// countWriter discards what it is given and counts it.
+type countWriter struct{ n *atomic.Int64 }
+
+func (w countWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// loadReader is an upload body that repeats chunk until ctx is done.
+type loadReader struct {
+	ctx   context.Context
+	chunk []byte
+	n     *atomic.Int64
+}
+
+func (r *loadReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, io.EOF
+	}
+	c := copy(p, r.chunk)
+	r.n.Add(int64(c))
+	return c, nil
+}
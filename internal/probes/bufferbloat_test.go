@@ -0,0 +1,90 @@
+package probes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cneate93/vne/internal/reflector"
+)
+
+func TestBloatGrade(t *testing.T) {
+	tests := []struct {
+		ms   float64
+		want string
+	}{
+		{0, "A+"},
+		{4.9, "A+"},
+		{5, "A"},
+		{29.9, "A"},
+		{30, "B"},
+		{59.9, "B"},
+		{60, "C"},
+		{199.9, "C"},
+		{200, "D"},
+		{399.9, "D"},
+		{400, "F"},
+		{5000, "F"},
+	}
+	for _, tt := range tests {
+		if got := bloatGrade(tt.ms); got != tt.want {
+			t.Errorf("bloatGrade(%v) = %q, want %q", tt.ms, got, tt.want)
+		}
+	}
+}
+
+func TestBufferbloatLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs for several seconds")
+	}
+	s, err := reflector.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	// Cleanup rather than defer: the parallel subtests outlive this function.
+	t.Cleanup(cancel)
+	go s.Serve(ctx)
+	addr := s.Addr().String()
+
+	for _, tt := range []struct{ endpoint, mode string }{
+		{"http://" + addr, "http"},
+		{"tcp://" + addr, "tcp"},
+	} {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			t.Parallel()
+			// The phases must outlast loadWarmup to take loaded samples.
+			res := Bufferbloat(ctx, tt.endpoint, loadWarmup+500*time.Millisecond, 2)
+			if res.Error != "" {
+				t.Fatalf("error: %s", res.Error)
+			}
+			if res.Mode != tt.mode {
+				t.Errorf("mode = %q, want %q", res.Mode, tt.mode)
+			}
+			if res.Idle.Samples == 0 {
+				t.Error("no idle samples")
+			}
+			for name, p := range map[string]LoadPhase{"download": res.Download, "upload": res.Upload} {
+				if p.Error != "" {
+					t.Errorf("%s: %s", name, p.Error)
+				}
+				if p.Bytes == 0 || p.Mbps <= 0 {
+					t.Errorf("%s moved %d bytes at %v Mbps", name, p.Bytes, p.Mbps)
+				}
+				if p.Latency.Samples == 0 {
+					t.Errorf("%s: no latency samples under load", name)
+				}
+			}
+			if res.Grade == "" {
+				t.Error("no grade")
+			}
+		})
+	}
+}
+
+func TestBufferbloatUnreachable(t *testing.T) {
+	res := Bufferbloat(context.Background(), "tcp://127.0.0.1:9", time.Second, 1)
+	if res.Error == "" || res.Grade != "" {
+		t.Errorf("got error %q, grade %q; want an error and no grade", res.Error, res.Grade)
+	}
+}
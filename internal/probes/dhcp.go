@@ -0,0 +1,416 @@
+package probes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDHCPWindow = 3 * time.Second
+	dhcpServerPort    = 67
+	dhcpClientPort    = 68
+
+	// dhcpHeaderLen is the fixed BOOTP header (RFC 2131, section 2) and
+	// dhcpMinLen the smallest message older BOOTP relays accept.
+	dhcpHeaderLen = 236
+	dhcpMinLen    = 300
+	dhcpBroadcast = 0x8000
+
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+
+	// Option codes (RFC 2132 and later).
+	dhcpOptPad          = 0
+	dhcpOptSubnetMask   = 1
+	dhcpOptRouter       = 3
+	dhcpOptDNS          = 6
+	dhcpOptDomainName   = 15
+	dhcpOptLeaseTime    = 51
+	dhcpOptMessageType  = 53
+	dhcpOptServerID     = 54
+	dhcpOptParams       = 55
+	dhcpOptMaxSize      = 57
+	dhcpOptDomainSearch = 119
+	dhcpOptStaticRoutes = 121
+	dhcpOptEnd          = 255
+)
+
+var dhcpMagic = []byte{0x63, 0x82, 0x53, 0x63}
+
+// dhcpRequested are the options the DISCOVER asks for.
+var dhcpRequested = []byte{1, 3, 6, 15, 26, 28, 42, 44, 51, 54, 58, 59, 66, 67, 119, 121, 150, 252}
+
+// dhcpOptionKinds names the options recorded from offers and says how their
+// value is shown.
+var dhcpOptionKinds = map[byte]struct{ name, kind string }{
+	1:   {"subnet-mask", "ip"},
+	3:   {"router", "ips"},
+	6:   {"dns", "ips"},
+	12:  {"hostname", "string"},
+	15:  {"domain-name", "string"},
+	26:  {"mtu", "uint16"},
+	28:  {"broadcast", "ip"},
+	42:  {"ntp-servers", "ips"},
+	44:  {"netbios-name-servers", "ips"},
+	51:  {"lease-time", "seconds"},
+	54:  {"server-id", "ip"},
+	58:  {"renewal-time", "seconds"},
+	59:  {"rebinding-time", "seconds"},
+	66:  {"tftp-server", "string"},
+	67:  {"bootfile", "string"},
+	119: {"domain-search", "names"},
+	121: {"classless-routes", "routes"},
+	150: {"tftp-servers", "ips"},
+	252: {"wpad", "string"},
+}
+
+// DHCPResult holds the offers made to a DHCPDISCOVER sent on one interface.
+type DHCPResult struct {
+	Iface string `json:"iface"`
+	// MAC is the client hardware address the DISCOVER carried.
+	MAC       string      `json:"mac"`
+	WindowSec float64     `json:"window_s"`
+	Offers    []DHCPOffer `json:"offers,omitempty"`
+	// Servers lists the distinct servers that made offers.
+	Servers []string `json:"servers,omitempty"`
+}
+
+// DHCPOffer is one DHCPOFFER.
+type DHCPOffer struct {
+	// ServerID is the server identifier option, or the reply's source
+	// when it is missing. From is the source address, a relay agent's when
+	// the server is on another subnet; Relay is the relay's address in the
+	// message.
+	ServerID string `json:"server_id"`
+	From     string `json:"from"`
+	Relay    string `json:"relay,omitempty"`
+	// ServerMAC and ServerVendor identify From when the layer-2 scan found
+	// it.
+	ServerMAC    string   `json:"server_mac,omitempty"`
+	ServerVendor string   `json:"server_vendor,omitempty"`
+	OfferedIP    string   `json:"offered_ip"`
+	SubnetMask   string   `json:"subnet_mask,omitempty"`
+	Routers      []string `json:"routers,omitempty"`
+	DNS          []string `json:"dns,omitempty"`
+	DomainName   string   `json:"domain_name,omitempty"`
+	LeaseSec     int      `json:"lease_s,omitempty"`
+	RTTMs        float64  `json:"rtt_ms"`
+	// Options are all options in the offer, in order, except the message
+	// type.
+	Options []DHCPOption `json:"options,omitempty"`
+	// GatewayMismatch and DNSMismatch are set when none of the offered
+	// routers or DNS servers is one the host uses.
+	GatewayMismatch bool `json:"gateway_mismatch"`
+	DNSMismatch     bool `json:"dns_mismatch"`
+}
+
+// DHCPOption is a DHCP option with its value in readable form; options
+// without a known format are shown in hex.
+type DHCPOption struct {
+	Code  int    `json:"code"`
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// DHCPDiscover broadcasts a DHCPDISCOVER on iface with the interface's MAC
+// address and collects the offers made within window (3 s when zero). It
+// never sends a DHCPREQUEST, so no lease is taken, although a server may
+// hold the offered address back for a short while. Listening on the DHCP
+// client port needs root, and is only supported on Linux.
+func DHCPDiscover(ctx context.Context, iface string, window time.Duration) (*DHCPResult, error) {
+	if window <= 0 {
+		window = defaultDHCPWindow
+	}
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("%s has no Ethernet address", iface)
+	}
+	conn, err := listenDHCP(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	offers, err := ExchangeDHCP(ctx, conn, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpServerPort}, ifi.HardwareAddr, window)
+	if err != nil {
+		return nil, err
+	}
+	res := &DHCPResult{
+		Iface:     iface,
+		MAC:       normalizeMAC(ifi.HardwareAddr.String()),
+		WindowSec: window.Seconds(),
+		Offers:    offers,
+	}
+	for _, o := range offers {
+		if !containsString(res.Servers, o.ServerID) {
+			res.Servers = append(res.Servers, o.ServerID)
+		}
+	}
+	return res, nil
+}
+
+// ExchangeDHCP sends a DHCPDISCOVER for mac to dst over conn, again halfway
+// through window since DHCP runs over UDP without retries of its own, and
+// returns the offers received until window ends, the first of each server
+// and address. DHCPDiscover broadcasts it on an interface; a test harness
+// can point it at a fake server on loopback instead.
+func ExchangeDHCP(ctx context.Context, conn *net.UDPConn, dst *net.UDPAddr, mac net.HardwareAddr, window time.Duration) ([]DHCPOffer, error) {
+	xid := rand.Uint32()
+	discover := dhcpDiscoverMessage(xid, mac)
+	start := time.Now()
+	if _, err := conn.WriteToUDP(discover, dst); err != nil {
+		return nil, err
+	}
+	resent := false
+	tick := func() {
+		if !resent && time.Since(start) >= window/2 {
+			resent = true
+			_, _ = conn.WriteToUDP(discover, dst)
+		}
+	}
+	var offers []DHCPOffer
+	seen := map[string]bool{}
+	readUDPReplies(ctx, conn, start.Add(window), tick, func(src net.IP, b []byte) {
+		o, ok := parseDHCPOffer(b, xid, mac)
+		if !ok {
+			return
+		}
+		o.From = src.String()
+		if o.ServerID == "" {
+			o.ServerID = o.From
+		}
+		if key := o.ServerID + "|" + o.OfferedIP; !seen[key] {
+			seen[key] = true
+			o.RTTMs = float64(time.Since(start)) / float64(time.Millisecond)
+			offers = append(offers, o)
+		}
+	})
+	if err := ctx.Err(); err != nil {
+		return offers, err
+	}
+	return offers, nil
+}
+
+// dhcpDiscoverMessage builds a DHCPDISCOVER asking for the replies to be
+// broadcast, since the client has no address yet as far as the server
+// knows.
+func dhcpDiscoverMessage(xid uint32, mac net.HardwareAddr) []byte {
+	b := make([]byte, dhcpHeaderLen, dhcpMinLen)
+	b[0], b[1], b[2] = 1, 1, 6 // BOOTREQUEST over Ethernet
+	binary.BigEndian.PutUint32(b[4:8], xid)
+	binary.BigEndian.PutUint16(b[10:12], dhcpBroadcast)
+	copy(b[28:44], mac)
+	b = append(b, dhcpMagic...)
+	b = append(b, dhcpOptMessageType, 1, dhcpDiscover)
+	b = append(b, dhcpOptMaxSize, 2, 0x05, 0xdc)
+	b = append(b, dhcpOptParams, byte(len(dhcpRequested)))
+	b = append(b, dhcpRequested...)
+	b = append(b, dhcpOptEnd)
+	for len(b) < dhcpMinLen {
+		b = append(b, dhcpOptPad)
+	}
+	return b
+}
+
+// parseDHCPOffer decodes a DHCPOFFER answering the DISCOVER with xid for
+// mac.
+func parseDHCPOffer(b []byte, xid uint32, mac net.HardwareAddr) (DHCPOffer, bool) {
+	if len(b) < dhcpHeaderLen+len(dhcpMagic) || b[0] != 2 || binary.BigEndian.Uint32(b[4:8]) != xid ||
+		!bytes.Equal(b[28:28+len(mac)], mac) || !bytes.Equal(b[dhcpHeaderLen:dhcpHeaderLen+4], dhcpMagic) {
+		return DHCPOffer{}, false
+	}
+	o := DHCPOffer{OfferedIP: net.IP(b[16:20]).String()}
+	if giaddr := net.IP(b[24:28]); !giaddr.IsUnspecified() {
+		o.Relay = giaddr.String()
+	}
+	var msgType byte
+	opts, err := dhcpOptions(b[dhcpHeaderLen+4:])
+	if err != nil {
+		return DHCPOffer{}, false
+	}
+	for _, opt := range opts {
+		v := opt.value
+		switch opt.code {
+		case dhcpOptMessageType:
+			if len(v) == 1 {
+				msgType = v[0]
+			}
+			continue
+		case dhcpOptServerID:
+			if len(v) == 4 {
+				o.ServerID = net.IP(v).String()
+			}
+		case dhcpOptSubnetMask:
+			if len(v) == 4 {
+				o.SubnetMask = net.IP(v).String()
+			}
+		case dhcpOptRouter:
+			o.Routers = dhcpIPs(v)
+		case dhcpOptDNS:
+			o.DNS = dhcpIPs(v)
+		case dhcpOptDomainName:
+			o.DomainName = optionString(v)
+		case dhcpOptLeaseTime:
+			if len(v) == 4 {
+				o.LeaseSec = int(binary.BigEndian.Uint32(v))
+			}
+		}
+		o.Options = append(o.Options, dhcpOptionValue(opt.code, v))
+	}
+	if msgType != dhcpOffer {
+		return DHCPOffer{}, false
+	}
+	return o, true
+}
+
+type dhcpOpt struct {
+	code  byte
+	value []byte
+}
+
+// dhcpOptions splits the options field. Options repeated in the message are
+// joined (RFC 3396).
+func dhcpOptions(p []byte) ([]dhcpOpt, error) {
+	var out []dhcpOpt
+	index := map[byte]int{}
+	for len(p) > 0 {
+		code := p[0]
+		if code == dhcpOptEnd {
+			break
+		}
+		if code == dhcpOptPad {
+			p = p[1:]
+			continue
+		}
+		if len(p) < 2 || len(p) < 2+int(p[1]) {
+			return nil, errors.New("truncated DHCP option")
+		}
+		v := p[2 : 2+int(p[1])]
+		p = p[2+int(p[1]):]
+		if i, ok := index[code]; ok {
+			out[i].value = append(out[i].value, v...)
+			continue
+		}
+		index[code] = len(out)
+		out = append(out, dhcpOpt{code: code, value: append([]byte(nil), v...)})
+	}
+	return out, nil
+}
+
+// dhcpOptionValue formats an option for the report.
+func dhcpOptionValue(code byte, v []byte) DHCPOption {
+	opt := DHCPOption{Code: int(code)}
+	kind, ok := dhcpOptionKinds[code]
+	if !ok {
+		opt.Value = hex.EncodeToString(v)
+		return opt
+	}
+	opt.Name = kind.name
+	switch kind.kind {
+	case "ip", "ips":
+		opt.Value = strings.Join(dhcpIPs(v), ", ")
+	case "string":
+		opt.Value = optionString(v)
+	case "uint16":
+		if len(v) == 2 {
+			opt.Value = strconv.Itoa(int(binary.BigEndian.Uint16(v)))
+		}
+	case "seconds":
+		if len(v) == 4 {
+			opt.Value = (time.Duration(binary.BigEndian.Uint32(v)) * time.Second).String()
+		}
+	case "names":
+		opt.Value = strings.Join(dhcpDomainNames(v), ", ")
+	case "routes":
+		opt.Value = strings.Join(dhcpStaticRoutes(v), ", ")
+	}
+	if opt.Value == "" && len(v) > 0 {
+		opt.Value = hex.EncodeToString(v)
+	}
+	return opt
+}
+
+// dhcpIPs splits an option value into IPv4 addresses.
+func dhcpIPs(v []byte) []string {
+	var out []string
+	for ; len(v) >= 4; v = v[4:] {
+		out = append(out, net.IP(v[:4]).String())
+	}
+	return out
+}
+
+// dhcpDomainNames decodes the domain search option (RFC 3397): DNS names
+// whose compression pointers are offsets into the option.
+func dhcpDomainNames(v []byte) []string {
+	var out []string
+	for off := 0; off < len(v); {
+		var (
+			labels []string
+			next   = -1
+			pos    = off
+		)
+		for hops := 0; pos < len(v) && hops < len(v); hops++ {
+			n := int(v[pos])
+			if n == 0 {
+				pos++
+				break
+			}
+			if n&0xc0 == 0xc0 {
+				if pos+1 >= len(v) {
+					return out
+				}
+				if next < 0 {
+					next = pos + 2
+				}
+				pos = int(binary.BigEndian.Uint16(v[pos:]) & 0x3fff)
+				continue
+			}
+			if pos+1+n > len(v) {
+				return out
+			}
+			labels = append(labels, string(v[pos+1:pos+1+n]))
+			pos += 1 + n
+		}
+		if next < 0 {
+			next = pos
+		}
+		if len(labels) > 0 {
+			out = append(out, strings.Join(labels, "."))
+		}
+		if next <= off {
+			break
+		}
+		off = next
+	}
+	return out
+}
+
+// dhcpStaticRoutes decodes the classless static route option (RFC 3442):
+// each route is the prefix length, the significant octets of the
+// destination and the router.
+func dhcpStaticRoutes(v []byte) []string {
+	var out []string
+	for len(v) > 0 {
+		bits := int(v[0])
+		n := (bits + 7) / 8
+		if bits > 32 || len(v) < 1+n+4 {
+			break
+		}
+		dst := make(net.IP, 4)
+		copy(dst, v[1:1+n])
+		out = append(out, fmt.Sprintf("%s/%d via %s", dst, bits, net.IP(v[1+n:1+n+4])))
+		v = v[1+n+4:]
+	}
+	return out
+}
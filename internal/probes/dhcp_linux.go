@@ -0,0 +1,38 @@
+package probes
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenDHCP opens a UDP socket on the DHCP client port bound to iface,
+// allowed to broadcast and to share the port with a DHCP client already
+// running there. Binding to a port below 1024 and to a device needs root
+// or CAP_NET_BIND_SERVICE and CAP_NET_RAW.
+func listenDHCP(iface string) (*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			if serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); serr != nil {
+				return
+			}
+			if serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_BROADCAST, 1); serr != nil {
+				return
+			}
+			serr = unix.BindToDevice(int(fd), iface)
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+	pc, err := lc.ListenPacket(context.Background(), "udp4", ":"+strconv.Itoa(dhcpClientPort))
+	if err != nil {
+		return nil, err
+	}
+	return pc.(*net.UDPConn), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package probes
+
+import (
+	"errors"
+	"net"
+	"runtime"
+)
+
+// listenDHCP needs to bind to a device, which only Linux offers portably.
+func listenDHCP(iface string) (*net.UDPConn, error) {
+	return nil, errors.New("DHCP discovery is not supported on " + runtime.GOOS)
+}
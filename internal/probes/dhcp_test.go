@@ -0,0 +1,240 @@
+package probes
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testClientMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	otherMAC      = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+// dhcpReply builds a BOOTREPLY of message type msgType for xid and mac
+// offering yiaddr, followed by opts, each already encoded as code, length
+// and value.
+func dhcpReply(msgType byte, xid uint32, mac net.HardwareAddr, yiaddr string, opts ...[]byte) []byte {
+	b := make([]byte, dhcpHeaderLen)
+	b[0], b[1], b[2] = 2, 1, 6
+	binary.BigEndian.PutUint32(b[4:8], xid)
+	copy(b[16:20], net.ParseIP(yiaddr).To4())
+	copy(b[28:44], mac)
+	b = append(b, dhcpMagic...)
+	b = append(b, dhcpOptMessageType, 1, msgType)
+	for _, o := range opts {
+		b = append(b, o...)
+	}
+	return append(b, dhcpOptEnd)
+}
+
+func opt(code byte, v ...byte) []byte { return append([]byte{code, byte(len(v))}, v...) }
+
+func ip4(s string) []byte { return net.ParseIP(s).To4() }
+
+// The domain search list "eng.example.com", "corp.example.com", the second
+// name pointing into the first, split in two options mid-name (RFC 3396).
+var (
+	searchPart1 = []byte{3, 'e', 'n', 'g', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 4, 'c'}
+	searchPart2 = []byte{'o', 'r', 'p', 0xc0, 4}
+)
+
+// fakeDHCPServer answers every DISCOVER on loopback with the two offers of
+// a legitimate and a rogue server, each twice, mixed with replies the
+// client must ignore.
+func fakeDHCPServer(t *testing.T) (*net.UDPAddr, *atomic.Int32) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var discovers atomic.Int32
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, src, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			b := buf[:n]
+			if n < dhcpHeaderLen+7 || b[0] != 1 || b[dhcpHeaderLen+6] != dhcpDiscover {
+				continue
+			}
+			discovers.Add(1)
+			xid := binary.BigEndian.Uint32(b[4:8])
+			mac := net.HardwareAddr(b[28:34])
+
+			legit := dhcpReply(dhcpOffer, xid, mac, "10.0.0.57",
+				opt(dhcpOptServerID, ip4("10.0.0.1")...),
+				opt(dhcpOptSubnetMask, 255, 255, 255, 0),
+				opt(dhcpOptRouter, ip4("10.0.0.1")...),
+				opt(dhcpOptDNS, ip4("10.0.0.1")...),
+				opt(dhcpOptDNS, ip4("10.0.0.2")...),
+				opt(dhcpOptDomainName, []byte("example.com\x00")...),
+				opt(dhcpOptLeaseTime, 0, 1, 0x51, 0x80),
+				opt(dhcpOptDomainSearch, searchPart1...),
+				opt(dhcpOptStaticRoutes, 24, 192, 168, 50, 10, 0, 0, 1, 0, 10, 0, 0, 1),
+				opt(dhcpOptDomainSearch, searchPart2...),
+				opt(224, 0xde, 0xad),
+			)
+			rogue := dhcpReply(dhcpOffer, xid, mac, "192.168.99.10",
+				opt(dhcpOptServerID, ip4("192.168.99.1")...),
+				opt(dhcpOptRouter, ip4("192.168.99.1")...),
+				opt(dhcpOptDNS, ip4("192.168.99.1")...),
+			)
+			for _, reply := range [][]byte{
+				dhcpReply(dhcpOffer, xid+1, mac, "10.0.0.58", opt(dhcpOptServerID, ip4("10.0.0.3")...)),
+				dhcpReply(dhcpOffer, xid, otherMAC, "10.0.0.59", opt(dhcpOptServerID, ip4("10.0.0.4")...)),
+				dhcpReply(5, xid, mac, "10.0.0.60", opt(dhcpOptServerID, ip4("10.0.0.5")...)), // DHCPACK
+				legit[:dhcpHeaderLen+20],
+				legit, rogue, legit,
+			} {
+				conn.WriteToUDP(reply, src)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr), &discovers
+}
+
+func TestExchangeDHCP(t *testing.T) {
+	server, discovers := fakeDHCPServer(t)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	offers, err := ExchangeDHCP(context.Background(), conn, server, testClientMAC, 600*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := discovers.Load(); n != 2 {
+		t.Errorf("server got %d DISCOVERs, want 2 (one resent halfway)", n)
+	}
+	// Both rounds of both offers arrive; the repeats are dropped.
+	if len(offers) != 2 {
+		t.Fatalf("got %d offers, want 2: %+v", len(offers), offers)
+	}
+
+	legit, rogue := offers[0], offers[1]
+	if legit.ServerID != "10.0.0.1" || rogue.ServerID != "192.168.99.1" {
+		t.Errorf("server IDs = %q, %q", legit.ServerID, rogue.ServerID)
+	}
+	if legit.From != "127.0.0.1" || legit.Relay != "" {
+		t.Errorf("from %q relay %q, want 127.0.0.1 and no relay", legit.From, legit.Relay)
+	}
+	if legit.OfferedIP != "10.0.0.57" || legit.SubnetMask != "255.255.255.0" || legit.LeaseSec != 86400 {
+		t.Errorf("offered %s/%s for %ds", legit.OfferedIP, legit.SubnetMask, legit.LeaseSec)
+	}
+	if legit.DomainName != "example.com" {
+		t.Errorf("domain name = %q", legit.DomainName)
+	}
+	if !slices.Equal(legit.Routers, []string{"10.0.0.1"}) {
+		t.Errorf("routers = %v", legit.Routers)
+	}
+	// The two DNS options are one option split in two (RFC 3396).
+	if !slices.Equal(legit.DNS, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("DNS = %v, want both halves joined", legit.DNS)
+	}
+	if legit.RTTMs <= 0 {
+		t.Errorf("RTT = %v", legit.RTTMs)
+	}
+
+	want := []DHCPOption{
+		{Code: 54, Name: "server-id", Value: "10.0.0.1"},
+		{Code: 1, Name: "subnet-mask", Value: "255.255.255.0"},
+		{Code: 3, Name: "router", Value: "10.0.0.1"},
+		{Code: 6, Name: "dns", Value: "10.0.0.1, 10.0.0.2"},
+		{Code: 15, Name: "domain-name", Value: "example.com"},
+		{Code: 51, Name: "lease-time", Value: "24h0m0s"},
+		{Code: 119, Name: "domain-search", Value: "eng.example.com, corp.example.com"},
+		{Code: 121, Name: "classless-routes", Value: "192.168.50.0/24 via 10.0.0.1, 0.0.0.0/0 via 10.0.0.1"},
+		{Code: 224, Value: "dead"},
+	}
+	if !slices.Equal(legit.Options, want) {
+		t.Errorf("options:\n got %+v\nwant %+v", legit.Options, want)
+	}
+}
+
+func TestExchangeDHCPNoServer(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	offers, err := ExchangeDHCP(ctx, conn, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}, testClientMAC, time.Second)
+	if len(offers) != 0 || err == nil {
+		t.Errorf("got %v, %v; want no offers and the context's error", offers, err)
+	}
+}
+
+func TestDHCPDiscoverMessage(t *testing.T) {
+	b := dhcpDiscoverMessage(0x01020304, testClientMAC)
+	if len(b) < dhcpMinLen {
+		t.Errorf("DISCOVER is %d bytes, want at least %d", len(b), dhcpMinLen)
+	}
+	if b[0] != 1 || binary.BigEndian.Uint32(b[4:8]) != 0x01020304 || net.HardwareAddr(b[28:34]).String() != testClientMAC.String() {
+		t.Errorf("header = % x", b[:44])
+	}
+	if binary.BigEndian.Uint16(b[10:12])&dhcpBroadcast == 0 {
+		t.Error("broadcast flag not set")
+	}
+	opts, err := dhcpOptions(b[dhcpHeaderLen+4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts[0].code != dhcpOptMessageType || !slices.Equal(opts[0].value, []byte{dhcpDiscover}) {
+		t.Errorf("first option = %+v, want the DISCOVER message type", opts[0])
+	}
+}
+
+func TestDHCPDomainNames(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []string
+	}{
+		{"compressed", append(slices.Clone(searchPart1), searchPart2...), []string{"eng.example.com", "corp.example.com"}},
+		{"pointer loop", []byte{0xc0, 0x00}, nil},
+		{"pointer past the end", []byte{3, 'c', 'o', 'm', 0, 0xc0}, []string{"com"}},
+		{"label past the end", []byte{7, 'e', 'x'}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		if got := dhcpDomainNames(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDHCPStaticRoutes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []string
+	}{
+		{"routes", []byte{24, 192, 168, 50, 10, 0, 0, 1, 0, 10, 0, 0, 1}, []string{"192.168.50.0/24 via 10.0.0.1", "0.0.0.0/0 via 10.0.0.1"}},
+		{"odd prefix", []byte{20, 172, 16, 16, 10, 0, 0, 1}, []string{"172.16.16.0/20 via 10.0.0.1"}},
+		{"host route", []byte{32, 10, 9, 8, 7, 10, 0, 0, 1}, []string{"10.9.8.7/32 via 10.0.0.1"}},
+		{"truncated", []byte{24, 192, 168, 50, 10, 0}, nil},
+		{"bad prefix", []byte{33, 1, 2, 3, 4, 5, 10, 0, 0, 1}, nil},
+	}
+	for _, tt := range tests {
+		if got := dhcpStaticRoutes(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDHCPOptionsTruncated(t *testing.T) {
+	if _, err := dhcpOptions([]byte{dhcpOptRouter, 4, 10, 0}); err == nil {
+		t.Error("no error for an option running past the message")
+	}
+}
@@ -2,16 +2,34 @@ package probes
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync"
 	"time"
 )
 
+// DNSResult times the A and AAAA lookups of a set of names. AvgMs and Answers
+// cover both record types, like a dual-stack client that waits for both; the
+// A and AAAA fields break them out.
 type DNSResult struct {
+	Names   []string `json:"names,omitempty"`
 	AvgMs   float64  `json:"avg_ms"`
 	Answers []string `json:"answers"`
+	AAvgMs  float64  `json:"a_avg_ms"`
+	// AAAAAvgMs averages the AAAA lookups that returned an answer or a
+	// definite "no such record".
+	AAAAAvgMs   float64  `json:"aaaa_avg_ms"`
+	AAAAAnswers []string `json:"aaaa_answers,omitempty"`
+	// AAAAErrors counts AAAA lookups that failed or timed out while the A
+	// lookup for the same name succeeded.
+	AAAAErrors int `json:"aaaa_errors,omitempty"`
 }
 
-func DNSLookupTimed(host string, resolvers []string, timeout time.Duration) (DNSResult, error) {
+// DNSLookupTimed resolves each host through each resolver in turn (the
+// system resolver for an empty entry), looking up A and AAAA records at the
+// same time, and averages the successful lookup times. Each host gets its own
+// timeout.
+func DNSLookupTimed(ctx context.Context, hosts []string, resolvers []string, timeout time.Duration) (DNSResult, error) {
 	if len(resolvers) == 0 {
 		resolvers = []string{""}
 	}
@@ -20,14 +38,73 @@ func DNSLookupTimed(host string, resolvers []string, timeout time.Duration) (DNS
 		timeout = 10 * time.Second
 	}
 
-	baseCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	var total dnsTotals
+	answers := make([]string, 0)
+	var aaaaAnswers []string
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+		t := lookupTimed(ctx, host, resolvers, timeout)
+		total.add(t)
+		answers = append(answers, t.a.ips...)
+		answers = append(answers, t.aaaa.ips...)
+		aaaaAnswers = append(aaaaAnswers, t.aaaa.ips...)
+	}
+
+	return DNSResult{
+		Names:       hosts,
+		AvgMs:       avgMs(total.both, total.bothN),
+		Answers:     answers,
+		AAvgMs:      avgMs(total.a.ms, total.a.n),
+		AAAAAvgMs:   avgMs(total.aaaa.ms, total.aaaa.n),
+		AAAAAnswers: aaaaAnswers,
+		AAAAErrors:  total.aaaaErrors,
+	}, ctx.Err()
+}
+
+// familyLookup sums the timings of the lookups of one record type.
+type familyLookup struct {
+	ms  float64
+	n   int
+	ips []string
+}
+
+// dnsTotals sums the timings of several lookups. both times each resolver
+// until both record types were answered.
+type dnsTotals struct {
+	a, aaaa    familyLookup
+	both       float64
+	bothN      int
+	aaaaErrors int
+}
+
+func (t *dnsTotals) add(o dnsTotals) {
+	t.a.ms += o.a.ms
+	t.a.n += o.a.n
+	t.aaaa.ms += o.aaaa.ms
+	t.aaaa.n += o.aaaa.n
+	t.both += o.both
+	t.bothN += o.bothN
+	t.aaaaErrors += o.aaaaErrors
+}
+
+func avgMs(total float64, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// lookupTimed resolves host through each resolver, querying A and AAAA
+// records in parallel, and sums the lookup times in milliseconds.
+func lookupTimed(ctx context.Context, host string, resolvers []string, timeout time.Duration) dnsTotals {
+	baseCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	deadline, hasDeadline := baseCtx.Deadline()
 
-	var total float64
-	var count int
-	answers := make([]string, 0)
+	var total dnsTotals
 
 	for _, resolver := range resolvers {
 		remaining := timeout
@@ -62,14 +139,29 @@ func DNSLookupTimed(host string, resolvers []string, timeout time.Duration) (DNS
 			}
 		}
 
-		start := time.Now()
-		ips, err := r.LookupHost(lookupCtx, host)
-		elapsed := time.Since(start).Seconds() * 1000
+		var a, aaaa lookupAnswer
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() { defer wg.Done(); a = lookupFamily(lookupCtx, &r, "ip4", host) }()
+		go func() { defer wg.Done(); aaaa = lookupFamily(lookupCtx, &r, "ip6", host) }()
+		wg.Wait()
 		lookupCancel()
-		if err == nil {
-			total += elapsed
-			count++
-			answers = append(answers, ips...)
+
+		if a.err == nil {
+			total.a.ms += a.ms
+			total.a.n++
+			total.a.ips = append(total.a.ips, a.ips...)
+		}
+		if aaaa.err == nil || isNotFound(aaaa.err) {
+			total.aaaa.ms += aaaa.ms
+			total.aaaa.n++
+			total.aaaa.ips = append(total.aaaa.ips, aaaa.ips...)
+		} else if a.err == nil {
+			total.aaaaErrors++
+		}
+		if len(a.ips)+len(aaaa.ips) > 0 {
+			total.both += max(a.ms, aaaa.ms)
+			total.bothN++
 		}
 
 		if hasDeadline && time.Until(deadline) <= 0 {
@@ -77,10 +169,29 @@ func DNSLookupTimed(host string, resolvers []string, timeout time.Duration) (DNS
 		}
 	}
 
-	var avg float64
-	if count > 0 {
-		avg = total / float64(count)
+	return total
+}
+
+type lookupAnswer struct {
+	ms  float64
+	ips []string
+	err error
+}
+
+// lookupFamily looks up the "ip4" (A) or "ip6" (AAAA) addresses of host.
+func lookupFamily(ctx context.Context, r *net.Resolver, network, host string) lookupAnswer {
+	start := time.Now()
+	ips, err := r.LookupIP(ctx, network, host)
+	ans := lookupAnswer{ms: time.Since(start).Seconds() * 1000, err: err}
+	for _, ip := range ips {
+		ans.ips = append(ans.ips, ip.String())
 	}
+	return ans
+}
 
-	return DNSResult{AvgMs: avg, Answers: answers}, nil
+// isNotFound reports whether err is a definite "no such host or record"
+// answer rather than a failed lookup.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
 }
@@ -0,0 +1,277 @@
+package probes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cneate93/vne/internal/dnsx"
+)
+
+// DNSTamperResult holds the checks for DNS answers being rewritten or
+// intercepted on the way. Each list is empty when its check found nothing.
+type DNSTamperResult struct {
+	// Plain is the resolver queried over plain UDP and Reference the same
+	// provider over DNS-over-HTTPS, which the network cannot rewrite.
+	Plain     string `json:"plain"`
+	Reference string `json:"reference"`
+	// ReferenceOK is false when the reference did not answer, so answers
+	// could not be compared.
+	ReferenceOK bool `json:"reference_ok"`
+	// NXNames are the random names that should not exist.
+	NXNames []string `json:"nx_names,omitempty"`
+	// NXRedirects are answers with records to the random names.
+	NXRedirects []DNSTamperAnswer `json:"nx_redirects,omitempty"`
+	// Rewrites are answers that differ from the reference in a way CDNs do
+	// not explain.
+	Rewrites []DNSTamperAnswer `json:"rewrites,omitempty"`
+	// Interceptions are answers from a responder other than the one asked.
+	Interceptions []DNSInterception `json:"interceptions,omitempty"`
+	// PlainID and ReferenceID are the id.server answers of Plain and
+	// Reference; they name the same anycast instance unless plain DNS is
+	// diverted.
+	PlainID     string `json:"plain_id,omitempty"`
+	ReferenceID string `json:"reference_id,omitempty"`
+}
+
+// DNSTamperAnswer is an answer that should not have come back.
+type DNSTamperAnswer struct {
+	Server  string   `json:"server"`
+	Name    string   `json:"name"`
+	Answers []string `json:"answers"`
+	// Expected holds the reference's answers; empty for the random names.
+	Expected []string `json:"expected,omitempty"`
+	// Reason says what is wrong with the answer.
+	Reason string `json:"reason,omitempty"`
+}
+
+// DNSInterception is evidence that someone other than the queried server
+// answered.
+type DNSInterception struct {
+	// Kind is "no-server" for an answer from an address that runs no DNS
+	// server, "source" for an answer from another address than the one
+	// queried, or "identity" when the plain resolver claims to be a
+	// different instance than over HTTPS.
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	From   string `json:"from,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// tamperNoServer runs no DNS server: it is in TEST-NET-2 (RFC 5737), which is
+// never routed, so any answer comes from something on the path.
+const tamperNoServer = "198.51.100.53:53"
+
+// DNSTamperCheck looks for DNS rewriting and interception. It asks the
+// system resolvers for random names that cannot exist, compares their and
+// plain's answers for names with reference's, sends a query to an address
+// that runs no DNS server, and compares plain's and reference's id.server.
+// plain must be a UDP server and reference should be an encrypted one.
+func DNSTamperCheck(ctx context.Context, system []dnsx.Server, plain, reference dnsx.Server, names []string, timeout time.Duration) DNSTamperResult {
+	return dnsTamperCheck(ctx, &dnsx.Client{Timeout: timeout, AnySource: true}, system, plain, reference, names, tamperNoServer)
+}
+
+func dnsTamperCheck(ctx context.Context, client *dnsx.Client, system []dnsx.Server, plain, reference dnsx.Server, names []string, noServer string) DNSTamperResult {
+	res := DNSTamperResult{Plain: plain.String(), Reference: reference.String(), NXNames: randomNames()}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f()
+		}()
+	}
+
+	// NXDOMAIN redirection: a resolver that answers made-up names with an
+	// address is sending typos to a search or ad page.
+	for _, s := range system {
+		for _, name := range res.NXNames {
+			s, name := s, name
+			run(func() {
+				resp, err := client.Query(ctx, s, name, "A")
+				if err != nil || resp.Rcode != "NOERROR" {
+					return
+				}
+				if answers := answerValues(resp, "A"); len(answers) > 0 {
+					mu.Lock()
+					res.NXRedirects = append(res.NXRedirects, DNSTamperAnswer{Server: s.String(), Name: name, Answers: answers})
+					mu.Unlock()
+				}
+			})
+		}
+	}
+
+	// Answers for real names, from the reference and from everyone else.
+	got := make(map[dnsx.Server]map[string][]string)
+	for _, s := range append([]dnsx.Server{reference, plain}, system...) {
+		got[s] = make(map[string][]string)
+	}
+	for s := range got {
+		for _, name := range names {
+			s, name := s, name
+			run(func() {
+				resp, err := client.Query(ctx, s, name, "A")
+				if err != nil || resp.Rcode != "NOERROR" {
+					return
+				}
+				mu.Lock()
+				got[s][name] = answerValues(resp, "A")
+				if s == plain && resp.From != s.Addr && !slices.ContainsFunc(res.Interceptions, func(i DNSInterception) bool { return i.Kind == "source" }) {
+					res.Interceptions = append(res.Interceptions, DNSInterception{
+						Kind: "source", Target: s.Addr, From: resp.From,
+						Detail: fmt.Sprintf("the answer for %s sent to %s came from %s", name, s.Addr, resp.From),
+					})
+				}
+				mu.Unlock()
+			})
+		}
+	}
+
+	// A query to an address without a DNS server must time out.
+	run(func() {
+		if len(names) == 0 {
+			return
+		}
+		s := dnsx.Server{Transport: "udp", Addr: noServer}
+		resp, err := client.Query(ctx, s, names[0], "A")
+		if err != nil {
+			return
+		}
+		who := resp.From
+		if who == noServer {
+			who = "something on the path"
+		}
+		mu.Lock()
+		res.Interceptions = append(res.Interceptions, DNSInterception{
+			Kind: "no-server", Target: noServer, From: resp.From,
+			Detail: fmt.Sprintf("%s runs no DNS server but %s answered %s with %s", noServer, who, names[0], describeAnswer(resp)),
+		})
+		mu.Unlock()
+	})
+
+	var plainID, refID string
+	var plainErr error
+	var refNamed bool
+	run(func() { plainID, _, plainErr = serverID(ctx, client, plain) })
+	run(func() { refID, refNamed, _ = serverID(ctx, client, reference) })
+	wg.Wait()
+
+	// Only a reference that names itself can be compared with; a refused
+	// answer from the plain resolver then counts as a mismatch.
+	res.PlainID, res.ReferenceID = plainID, refID
+	if refNamed && plainErr == nil && plainID != refID {
+		res.Interceptions = append(res.Interceptions, DNSInterception{
+			Kind: "identity", Target: plain.Addr,
+			Detail: fmt.Sprintf("%s says it is %q over plain DNS but %q over %s", plain.Addr, plainID, refID, reference.Transport),
+		})
+	}
+
+	expected := got[reference]
+	res.ReferenceOK = len(expected) > 0
+	if res.ReferenceOK {
+		for s, answers := range got {
+			if s == reference {
+				continue
+			}
+			for _, name := range names {
+				a, want := answers[name], expected[name]
+				if len(a) == 0 || len(want) == 0 {
+					continue
+				}
+				if reason := rewriteReason(s == plain, a, want); reason != "" {
+					res.Rewrites = append(res.Rewrites, DNSTamperAnswer{Server: s.String(), Name: name, Answers: a, Expected: want, Reason: reason})
+				}
+			}
+		}
+	}
+
+	sortTamper(res.NXRedirects)
+	sortTamper(res.Rewrites)
+	slices.SortFunc(res.Interceptions, func(a, b DNSInterception) int { return strings.Compare(a.Kind+a.Detail, b.Kind+b.Detail) })
+	return res
+}
+
+// rewriteReason explains why answers a, compared with the reference's
+// answers want, look rewritten, or returns "". Any resolver may hand out a
+// different CDN address, but not a private one for a public name; the plain
+// path to the reference's own provider must share at least one address.
+func rewriteReason(sameProvider bool, a, want []string) string {
+	if !slices.ContainsFunc(want, isPrivateAddr) {
+		for _, v := range a {
+			if isPrivateAddr(v) {
+				return "private address " + v + " for a public name"
+			}
+		}
+	}
+	if sameProvider && !slices.ContainsFunc(a, func(v string) bool { return slices.Contains(want, v) }) {
+		return "differs from the same resolver over an encrypted transport"
+	}
+	return ""
+}
+
+// isPrivateAddr reports whether s is an address that never appears in
+// public DNS: private, loopback, link-local, shared (CGNAT) or unspecified.
+func isPrivateAddr(s string) bool {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return false
+	}
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		netip.MustParsePrefix("100.64.0.0/10").Contains(ip)
+}
+
+// serverID returns the id.server text of s and true, or the response code
+// and false when s does not name itself.
+func serverID(ctx context.Context, client *dnsx.Client, s dnsx.Server) (string, bool, error) {
+	resp, err := client.ServerID(ctx, s)
+	if err != nil {
+		return "", false, err
+	}
+	if vals := answerValues(resp, "TXT"); resp.Rcode == "NOERROR" && len(vals) > 0 {
+		return vals[0], true, nil
+	}
+	return resp.Rcode, false, nil
+}
+
+func answerValues(resp *dnsx.Response, qtype string) []string {
+	var out []string
+	for _, rec := range resp.Answers {
+		if rec.Type == qtype {
+			out = append(out, rec.Value)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func describeAnswer(resp *dnsx.Response) string {
+	if vals := answerValues(resp, "A"); len(vals) > 0 {
+		return strings.Join(vals, ", ")
+	}
+	return resp.Rcode
+}
+
+// randomNames returns two names under real top-level domains that cannot
+// exist. Some redirecting resolvers only rewrite names under common TLDs.
+func randomNames() []string {
+	var names []string
+	for _, tld := range []string{"com", "net"} {
+		b := make([]byte, 8)
+		rand.Read(b)
+		names = append(names, "vne-"+hex.EncodeToString(b)+"."+tld)
+	}
+	return names
+}
+
+func sortTamper(list []DNSTamperAnswer) {
+	slices.SortFunc(list, func(a, b DNSTamperAnswer) int {
+		return strings.Compare(a.Server+" "+a.Name, b.Server+" "+b.Name)
+	})
+}
@@ -0,0 +1,184 @@
+package probes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cneate93/vne/internal/dnsx"
+	"github.com/cneate93/vne/internal/dnsx/dnstest"
+)
+
+// fakeResolver answers A queries for the names in zone, NXDOMAIN for other
+// names unless nxRedirect is set, and id.server with id, or REFUSED when id
+// is empty.
+type fakeResolver struct {
+	zone       map[string]string
+	nxRedirect string
+	id         string
+	// from makes UDP answers come from another loopback address.
+	from string
+}
+
+func (f fakeResolver) start(t *testing.T, transport string) (dnsx.Server, *dnstest.Server) {
+	t.Helper()
+	h := func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		q := req.Questions[0]
+		name := strings.TrimSuffix(q.Name.String(), ".")
+		switch {
+		case q.Class == dnsmessage.ClassCHAOS:
+			if f.id == "" {
+				return dnstest.Reply(req, dnsmessage.RCodeRefused)
+			}
+			return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.TXT(q, f.id))
+		case f.zone[name] != "":
+			return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.A(q, 300, f.zone[name]))
+		case f.nxRedirect != "":
+			return dnstest.Reply(req, dnsmessage.RCodeSuccess, dnstest.A(q, 300, f.nxRedirect))
+		}
+		return dnstest.Reply(req, dnsmessage.RCodeNameError)
+	}
+	var srv *dnstest.Server
+	if f.from != "" {
+		srv = dnstest.NewServerFrom(h, f.from)
+	} else {
+		srv = dnstest.NewServer(h)
+	}
+	t.Cleanup(srv.Close)
+	return dnsx.Server{Transport: transport, Addr: srv.Addr}, srv
+}
+
+const tamperName = "example.com"
+
+var tamperZone = map[string]string{tamperName: "93.184.216.34"}
+
+func TestDNSTamperCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		system    fakeResolver
+		plain     fakeResolver
+		noServer  bool
+		nx        int
+		rewrites  []string
+		intercept []string
+	}{
+		{
+			name:   "clean",
+			system: fakeResolver{zone: tamperZone},
+			plain:  fakeResolver{zone: tamperZone, id: "AMS"},
+		},
+		{
+			name:   "nx redirect",
+			system: fakeResolver{zone: tamperZone, nxRedirect: "198.51.100.80"},
+			plain:  fakeResolver{zone: tamperZone, id: "AMS"},
+			nx:     2,
+		},
+		{
+			name:     "private rewrite",
+			system:   fakeResolver{zone: map[string]string{tamperName: "10.1.2.3"}},
+			plain:    fakeResolver{zone: tamperZone, id: "AMS"},
+			rewrites: []string{"private address 10.1.2.3 for a public name"},
+		},
+		{
+			// Another provider's CDN answer is fine; the same provider's
+			// must overlap with its encrypted answer.
+			name:     "same provider disjoint",
+			system:   fakeResolver{zone: map[string]string{tamperName: "203.0.113.1"}},
+			plain:    fakeResolver{zone: map[string]string{tamperName: "203.0.113.2"}, id: "AMS"},
+			rewrites: []string{"differs from the same resolver over an encrypted transport"},
+		},
+		{
+			name:      "source",
+			system:    fakeResolver{zone: tamperZone},
+			plain:     fakeResolver{zone: tamperZone, id: "AMS", from: "127.0.0.2"},
+			intercept: []string{"source"},
+		},
+		{
+			name:      "identity",
+			system:    fakeResolver{zone: tamperZone},
+			plain:     fakeResolver{zone: tamperZone, id: "isp-resolver-3"},
+			intercept: []string{"identity"},
+		},
+		{
+			name:      "identity refused",
+			system:    fakeResolver{zone: tamperZone},
+			plain:     fakeResolver{zone: tamperZone},
+			intercept: []string{"identity"},
+		},
+		{
+			name:      "no server",
+			system:    fakeResolver{zone: tamperZone},
+			plain:     fakeResolver{zone: tamperZone, id: "AMS"},
+			noServer:  true,
+			intercept: []string{"no-server"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reference, _ := fakeResolver{zone: tamperZone, id: "AMS"}.start(t, "tcp")
+			system, _ := tt.system.start(t, "udp")
+			plain, plainSrv := tt.plain.start(t, "udp")
+			// Without an answering server the address is a closed port,
+			// which must time out.
+			noServer := "127.0.0.1:9"
+			if tt.noServer {
+				s, _ := fakeResolver{zone: tamperZone}.start(t, "udp")
+				noServer = s.Addr
+			}
+			client := &dnsx.Client{Timeout: 300 * time.Millisecond, AnySource: true}
+			res := dnsTamperCheck(context.Background(), client, []dnsx.Server{system}, plain, reference, []string{tamperName}, noServer)
+
+			if !res.ReferenceOK {
+				t.Fatal("reference did not answer")
+			}
+			if len(res.NXRedirects) != tt.nx {
+				t.Errorf("NX redirects %+v, want %d", res.NXRedirects, tt.nx)
+			}
+			for _, r := range res.NXRedirects {
+				if r.Server != system.String() || len(r.Answers) != 1 || r.Answers[0] != tt.system.nxRedirect {
+					t.Errorf("NX redirect %+v", r)
+				}
+			}
+			var reasons []string
+			for _, r := range res.Rewrites {
+				reasons = append(reasons, r.Reason)
+			}
+			if strings.Join(reasons, "|") != strings.Join(tt.rewrites, "|") {
+				t.Errorf("rewrites %+v, want reasons %q", res.Rewrites, tt.rewrites)
+			}
+			var kinds []string
+			for _, i := range res.Interceptions {
+				kinds = append(kinds, i.Kind)
+				if i.Kind == "source" && i.From != plainSrv.From() {
+					t.Errorf("source interception from %s, want %s", i.From, plainSrv.From())
+				}
+			}
+			if strings.Join(kinds, "|") != strings.Join(tt.intercept, "|") {
+				t.Errorf("interceptions %+v, want kinds %q", res.Interceptions, tt.intercept)
+			}
+		})
+	}
+}
+
+func TestRewriteReason(t *testing.T) {
+	tests := []struct {
+		sameProvider bool
+		a, want      []string
+		reason       string
+	}{
+		{false, []string{"192.168.1.10"}, []string{"93.184.216.34"}, "private address 192.168.1.10 for a public name"},
+		{false, []string{"100.64.1.1"}, []string{"93.184.216.34"}, "private address 100.64.1.1 for a public name"},
+		{false, []string{"10.0.0.1"}, []string{"10.0.0.2"}, ""},
+		{false, []string{"203.0.113.1"}, []string{"93.184.216.34"}, ""},
+		{true, []string{"203.0.113.1", "93.184.216.34"}, []string{"93.184.216.34"}, ""},
+		{true, []string{"203.0.113.1"}, []string{"93.184.216.34"}, "differs from the same resolver over an encrypted transport"},
+	}
+	for _, tt := range tests {
+		if got := rewriteReason(tt.sameProvider, tt.a, tt.want); got != tt.reason {
+			t.Errorf("rewriteReason(%v, %v, %v) = %q, want %q", tt.sameProvider, tt.a, tt.want, got, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package probes
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMP     = 1
+	protocolIPv6ICMP = 58
+
+	icmpPayloadSize  = 56
+	maxPingInterval  = time.Second
+	minPingInterval  = 200 * time.Millisecond
+	maxPingReplyWait = 2 * time.Second
+)
+
+var errICMPUnavailable = errors.New("icmp sockets unavailable")
+
+// icmpConn wraps an ICMP socket together with the details needed to match
+// replies: whether the kernel owns the echo identifier (datagram sockets) and
+// the protocol number used when parsing messages.
+type icmpConn struct {
+	conn     *icmp.PacketConn
+	v6       bool
+	datagram bool
+	method   string
+}
+
+// openICMP opens an unprivileged datagram ICMP socket when the platform allows
+// it (Linux with net.ipv4.ping_group_range, macOS) and falls back to a raw
+// socket, which needs root or CAP_NET_RAW.
+func openICMP(v6 bool) (*icmpConn, error) {
+	type candidate struct {
+		network  string
+		address  string
+		datagram bool
+		method   string
+	}
+	var candidates []candidate
+	if v6 {
+		candidates = []candidate{
+			{network: "udp6", address: "::", datagram: true, method: "icmp-dgram"},
+			{network: "ip6:ipv6-icmp", address: "::", method: "icmp-raw"},
+		}
+	} else {
+		candidates = []candidate{
+			{network: "udp4", address: "0.0.0.0", datagram: true, method: "icmp-dgram"},
+			{network: "ip4:icmp", address: "0.0.0.0", method: "icmp-raw"},
+		}
+	}
+	if runtime.GOOS == "windows" {
+		// Windows has no datagram ICMP sockets.
+		candidates = candidates[1:]
+	}
+
+	var errs []string
+	for _, c := range candidates {
+		conn, err := icmp.ListenPacket(c.network, c.address)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", c.network, err))
+			continue
+		}
+		ic := &icmpConn{conn: conn, v6: v6, datagram: c.datagram, method: c.method}
+		if v6 {
+			_ = conn.IPv6PacketConn().SetControlMessage(ipv6.FlagHopLimit, true)
+		} else {
+			_ = conn.IPv4PacketConn().SetControlMessage(ipv4.FlagTTL, true)
+		}
+		return ic, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errICMPUnavailable, strings.Join(errs, "; "))
+}
+
+func (c *icmpConn) Close() error {
+	return c.conn.Close()
+}
+
+// destination returns the address type expected by WriteTo for this socket.
+func (c *icmpConn) destination(addr *net.IPAddr) net.Addr {
+	if c.datagram {
+		return &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+	return addr
+}
+
+func (c *icmpConn) protocol() int {
+	if c.v6 {
+		return protocolIPv6ICMP
+	}
+	return protocolICMP
+}
+
+// readFrom reads a single ICMP message and returns it with the TTL (or hop
+// limit) reported by the kernel, or -1 when it is not available.
+func (c *icmpConn) readFrom(buf []byte) (int, int, net.Addr, error) {
+	if c.v6 {
+		n, cm, src, err := c.conn.IPv6PacketConn().ReadFrom(buf)
+		ttl := -1
+		if cm != nil {
+			ttl = cm.HopLimit
+		}
+		return n, ttl, src, err
+	}
+	n, cm, src, err := c.conn.IPv4PacketConn().ReadFrom(buf)
+	ttl := -1
+	if cm != nil {
+		ttl = cm.TTL
+	}
+	return n, ttl, src, err
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP
+	case *net.IPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// pingICMP sends count echo requests to addr and collects per-probe samples. The
+// probes are spread over the timeout budget (at most one per second) and each
+// reply is attributed to its sequence number so duplicates and re-ordered
+// replies can be told apart from loss.
+func pingICMP(ctx context.Context, addr *net.IPAddr, count int, timeout time.Duration) (PingResult, error) {
+	ip := addr.IP
+	v6 := ip.To4() == nil
+	conn, err := openICMP(v6)
+	if err != nil {
+		return PingResult{}, err
+	}
+	defer conn.Close()
+
+	interval := maxPingInterval
+	if budget := timeout / time.Duration(count+1); budget < interval {
+		interval = budget
+	}
+	if interval < minPingInterval {
+		interval = minPingInterval
+	}
+	wait := maxPingReplyWait
+	if wait > timeout {
+		wait = timeout
+	}
+
+	id := (os.Getpid() ^ rand.Intn(0xffff)) & 0xffff
+	seqBase := rand.Intn(0x7fff)
+	dst := conn.destination(addr)
+
+	var (
+		mu       sync.Mutex
+		sentAt   = make(map[int]time.Time, count)
+		samples  = make([]PingSample, count)
+		received = make(map[int]bool, count)
+		extra    []PingSample
+		highest  = -1
+		sent     int
+	)
+	for i := range samples {
+		samples[i] = PingSample{Seq: i + 1, TTL: -1, Timeout: true}
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	readDone := make(chan error, 1)
+	stopRead := make(chan struct{})
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-stopRead:
+				readDone <- nil
+				return
+			default:
+			}
+			_ = conn.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, ttl, src, err := conn.readFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					continue
+				}
+				readDone <- err
+				return
+			}
+			if from := addrIP(src); from != nil && !from.Equal(ip) {
+				continue
+			}
+			msg, err := icmp.ParseMessage(conn.protocol(), buf[:n])
+			if err != nil {
+				continue
+			}
+			if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+				continue
+			}
+			echo, ok := msg.Body.(*icmp.Echo)
+			if !ok {
+				continue
+			}
+			// Datagram sockets rewrite the identifier and filter replies in
+			// the kernel, so only raw sockets need to check it.
+			if !conn.datagram && echo.ID != id {
+				continue
+			}
+			idx := (echo.Seq - seqBase) & 0xffff
+			now := time.Now()
+
+			mu.Lock()
+			start, ok := sentAt[idx]
+			if !ok || idx >= count {
+				mu.Unlock()
+				continue
+			}
+			sample := PingSample{
+				Seq:   idx + 1,
+				TTL:   ttl,
+				RTTMs: float64(now.Sub(start)) / float64(time.Millisecond),
+			}
+			switch {
+			case received[idx]:
+				sample.Duplicate = true
+				extra = append(extra, sample)
+			default:
+				received[idx] = true
+				if idx < highest {
+					sample.OutOfOrder = true
+				} else {
+					highest = idx
+				}
+				samples[idx] = sample
+			}
+			mu.Unlock()
+		}
+	}()
+
+	payload := make([]byte, icmpPayloadSize)
+	copy(payload, "vne-ping")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var sendErr error
+sendLoop:
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				break sendLoop
+			case <-ticker.C:
+			}
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		binary.BigEndian.PutUint64(payload[8:], uint64(time.Now().UnixNano()))
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{ID: id, Seq: (seqBase + i) & 0xffff, Data: payload},
+		}
+		if v6 {
+			msg.Type = ipv6.ICMPTypeEchoRequest
+		}
+		wb, err := msg.Marshal(nil)
+		if err != nil {
+			sendErr = err
+			break
+		}
+		mu.Lock()
+		sentAt[i] = time.Now()
+		mu.Unlock()
+		if _, err := conn.conn.WriteTo(wb, dst); err != nil {
+			mu.Lock()
+			delete(sentAt, i)
+			mu.Unlock()
+			sendErr = err
+			break
+		}
+		sent++
+	}
+
+	waitUntil := time.Now().Add(wait)
+	if waitUntil.After(deadline) {
+		waitUntil = deadline
+	}
+	for time.Now().Before(waitUntil) {
+		mu.Lock()
+		done := len(received) >= sent
+		mu.Unlock()
+		if done || ctx.Err() != nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(stopRead)
+	readErr := <-readDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	if sent == 0 {
+		if sendErr == nil {
+			sendErr = ctx.Err()
+		}
+		if sendErr == nil {
+			sendErr = errors.New("no echo requests sent")
+		}
+		return PingResult{Method: conn.method}, fmt.Errorf("send echo request: %w", sendErr)
+	}
+
+	all := append(samples[:sent:sent], extra...)
+	res := summarizeSamples(addr.String(), all, sent)
+	res.Method = conn.method
+	if sendErr != nil {
+		return res, fmt.Errorf("send echo request: %w", sendErr)
+	}
+	if readErr != nil {
+		return res, fmt.Errorf("read echo reply: %w", readErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// summarizeSamples derives the aggregate statistics for a set of samples and
+// renders a ping-like transcript so the raw evidence stays readable in reports
+// and bundles.
+func summarizeSamples(target string, samples []PingSample, sent int) PingResult {
+	res := PingResult{Samples: samples}
+	var (
+		rtts []float64
+		b    strings.Builder
+	)
+	fmt.Fprintf(&b, "PING %s: %d data bytes\n", target, icmpPayloadSize)
+	for _, s := range samples {
+		if s.Timeout {
+			fmt.Fprintf(&b, "Request timeout for icmp_seq %d\n", s.Seq)
+			continue
+		}
+		line := fmt.Sprintf("%d bytes from %s: icmp_seq=%d", icmpPayloadSize+8, target, s.Seq)
+		if s.TTL >= 0 {
+			line += fmt.Sprintf(" ttl=%d", s.TTL)
+		}
+		line += fmt.Sprintf(" time=%.3f ms", s.RTTMs)
+		switch {
+		case s.Duplicate:
+			line += " (DUP!)"
+		case s.OutOfOrder:
+			line += " (out of order)"
+		}
+		b.WriteString(line + "\n")
+		if !s.Duplicate {
+			rtts = append(rtts, s.RTTMs)
+		}
+	}
+	if sent > 0 {
+		res.Loss = float64(sent-len(rtts)) / float64(sent)
+	}
+	res.AvgMs = average(rtts)
+	res.P95Ms = percentile95(rtts)
+	res.JitterMs = jitter(rtts)
+
+	fmt.Fprintf(&b, "\n--- %s ping statistics ---\n", target)
+	fmt.Fprintf(&b, "%d packets transmitted, %d packets received, %.1f%% packet loss\n", sent, len(rtts), res.Loss*100)
+	if len(rtts) > 0 {
+		lo, hi := rtts[0], rtts[0]
+		for _, v := range rtts[1:] {
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		fmt.Fprintf(&b, "round-trip min/avg/max/jitter = %.3f/%.3f/%.3f/%.3f ms\n", lo, res.AvgMs, hi, res.JitterMs)
+	}
+	res.Raw = b.String()
+	return res
+}
@@ -0,0 +1,102 @@
+package probes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPingICMPLoopback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := pingICMP(ctx, &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}, 3, time.Second)
+	if errors.Is(err, errICMPUnavailable) {
+		t.Skip("no ICMP socket:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Method != "icmp-dgram" && res.Method != "icmp-raw" {
+		t.Errorf("method = %q", res.Method)
+	}
+	if res.Loss != 0 || len(res.Samples) != 3 {
+		t.Fatalf("loss %v, %d samples:\n%s", res.Loss, len(res.Samples), res.Raw)
+	}
+	for i, s := range res.Samples {
+		if s.Seq != i+1 || s.Timeout || s.Duplicate || s.OutOfOrder || s.RTTMs <= 0 || s.RTTMs > 1000 {
+			t.Errorf("sample %d: %+v", i, s)
+		}
+	}
+}
+
+func TestSummarizeSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []PingSample
+		sent    int
+		want    PingResult
+		raw     string
+	}{
+		{
+			// Seq 3's reply came after 4's and then again; 2 and 5 were
+			// lost. The raw socket gave no TTL for seq 4.
+			name: "loss, reordering and a duplicate",
+			samples: []PingSample{
+				{Seq: 1, TTL: 64, RTTMs: 10},
+				{Seq: 2, TTL: -1, Timeout: true},
+				{Seq: 3, TTL: 64, RTTMs: 14, OutOfOrder: true},
+				{Seq: 4, TTL: -1, RTTMs: 12},
+				{Seq: 5, TTL: -1, Timeout: true},
+				{Seq: 3, TTL: 64, RTTMs: 15, Duplicate: true},
+			},
+			sent: 5,
+			// The duplicate counts neither as a reply nor in the RTTs:
+			// 10, 14 and 12 ms.
+			want: PingResult{AvgMs: 12, P95Ms: 14, JitterMs: 3, Loss: 0.4},
+			raw: "PING 10.0.0.1: 56 data bytes\n" +
+				"64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=10.000 ms\n" +
+				"Request timeout for icmp_seq 2\n" +
+				"64 bytes from 10.0.0.1: icmp_seq=3 ttl=64 time=14.000 ms (out of order)\n" +
+				"64 bytes from 10.0.0.1: icmp_seq=4 time=12.000 ms\n" +
+				"Request timeout for icmp_seq 5\n" +
+				"64 bytes from 10.0.0.1: icmp_seq=3 ttl=64 time=15.000 ms (DUP!)\n" +
+				"\n--- 10.0.0.1 ping statistics ---\n" +
+				"5 packets transmitted, 3 packets received, 40.0% packet loss\n" +
+				"round-trip min/avg/max/jitter = 10.000/12.000/14.000/3.000 ms\n",
+		},
+		{
+			name: "all lost",
+			samples: []PingSample{
+				{Seq: 1, TTL: -1, Timeout: true},
+				{Seq: 2, TTL: -1, Timeout: true},
+			},
+			sent: 2,
+			want: PingResult{Loss: 1},
+			raw: "PING 10.0.0.1: 56 data bytes\n" +
+				"Request timeout for icmp_seq 1\n" +
+				"Request timeout for icmp_seq 2\n" +
+				"\n--- 10.0.0.1 ping statistics ---\n" +
+				"2 packets transmitted, 0 packets received, 100.0% packet loss\n",
+		},
+		{
+			name: "nothing sent",
+			raw: "PING 10.0.0.1: 56 data bytes\n" +
+				"\n--- 10.0.0.1 ping statistics ---\n" +
+				"0 packets transmitted, 0 packets received, 0.0% packet loss\n",
+		},
+	}
+	for _, tt := range tests {
+		got := summarizeSamples("10.0.0.1", tt.samples, tt.sent)
+		if got.AvgMs != tt.want.AvgMs || got.P95Ms != tt.want.P95Ms || got.JitterMs != tt.want.JitterMs || got.Loss != tt.want.Loss {
+			t.Errorf("%s: got avg %v, p95 %v, jitter %v, loss %v; want %+v", tt.name, got.AvgMs, got.P95Ms, got.JitterMs, got.Loss, tt.want)
+		}
+		if len(got.Samples) != len(tt.samples) {
+			t.Errorf("%s: %d samples, want %d", tt.name, len(got.Samples), len(tt.samples))
+		}
+		if got.Raw != tt.raw {
+			t.Errorf("%s: raw =\n%s\nwant\n%s", tt.name, got.Raw, tt.raw)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package probes
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// maxIdentifyWindow caps how long IdentifyHosts waits for replies.
+const maxIdentifyWindow = 5 * time.Second
+
+// deviceKinds ranks the device kinds the mDNS services and UPnP device types
+// map to, most specific first: a printer that also shares files is a
+// printer.
+var deviceKinds = []string{
+	"printer", "scanner", "camera", "NAS", "router", "access point",
+	"computer", "media player", "speaker", "media server",
+	"smart home device", "file server",
+}
+
+// serviceKinds maps DNS-SD service types to device kinds.
+var serviceKinds = map[string]string{
+	"_ipp._tcp":             "printer",
+	"_ipps._tcp":            "printer",
+	"_printer._tcp":         "printer",
+	"_pdl-datastream._tcp":  "printer",
+	"_uscan._tcp":           "scanner",
+	"_scanner._tcp":         "scanner",
+	"_axis-video._tcp":      "camera",
+	"_rtsp._tcp":            "camera",
+	"_adisk._tcp":           "NAS",
+	"_workstation._tcp":     "computer",
+	"_googlecast._tcp":      "media player",
+	"_airplay._tcp":         "media player",
+	"_raop._tcp":            "speaker",
+	"_spotify-connect._tcp": "speaker",
+	"_sonos._tcp":           "speaker",
+	"_hap._tcp":             "smart home device",
+	"_hap._udp":             "smart home device",
+	"_matter._tcp":          "smart home device",
+	"_smb._tcp":             "file server",
+	"_afpovertcp._tcp":      "file server",
+}
+
+// Label names the host for the device list: the make and model it
+// advertises, or else the vendor of its MAC address, followed by its kind,
+// e.g. "HP LaserJet Pro M404dn (printer)".
+func (h L2Host) Label() string {
+	label := h.Model
+	if label == "" {
+		label = h.Vendor
+	}
+	switch {
+	case h.Kind == "":
+		return label
+	case label == "":
+		return h.Kind
+	}
+	return label + " (" + h.Kind + ")"
+}
+
+// IdentifyHosts asks the discovered hosts what they are. It sends mDNS
+// (DNS-SD) and SSDP queries to the multicast groups on each interface the
+// hosts were found on, and an LLMNR reverse lookup and a NetBIOS node status
+// query to each IPv4 host, then fills in Hostname, Model, Kind and Services
+// from the answers. window is how long replies are awaited; hosts that do
+// not answer are left as they are.
+func IdentifyHosts(ctx context.Context, hosts []L2Host, window time.Duration) {
+	if window <= 0 {
+		window = 2 * time.Second
+	}
+	window = min(window, maxIdentifyWindow)
+
+	var (
+		addrs  []net.IP
+		ifaces []net.Interface
+		seen   = map[string]bool{}
+	)
+	for _, h := range hosts {
+		ip := net.ParseIP(h.IP).To4()
+		if ip == nil {
+			continue
+		}
+		addrs = append(addrs, ip)
+		if h.IfName == "" || seen[h.IfName] {
+			continue
+		}
+		seen[h.IfName] = true
+		if iface, err := net.InterfaceByName(h.IfName); err == nil && iface.Flags&net.FlagMulticast != 0 {
+			ifaces = append(ifaces, *iface)
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+
+	ids := &identities{byIP: map[string]*identity{}}
+	var wg sync.WaitGroup
+	for _, collect := range []func(){
+		func() { mdnsIdentify(ctx, ifaces, addrs, window, ids) },
+		func() { ssdpIdentify(ctx, ifaces, window, ids) },
+		func() { llmnrIdentify(ctx, addrs, window, ids) },
+		func() { netbiosIdentify(ctx, addrs, window, ids) },
+	} {
+		wg.Add(1)
+		go func(collect func()) {
+			defer wg.Done()
+			collect()
+		}(collect)
+	}
+	wg.Wait()
+	ids.apply(hosts)
+}
+
+// identity is what the replies said about one address. Each value keeps
+// the best-ranked answer, lower ranks being better.
+type identity struct {
+	hostname ranked
+	model    ranked
+	kind     ranked
+	services []string
+}
+
+type ranked struct {
+	value string
+	rank  int
+}
+
+func (r *ranked) offer(v string, rank int) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return
+	}
+	if r.value == "" || rank < r.rank {
+		r.value, r.rank = v, rank
+	}
+}
+
+// Hostname ranks: mDNS names are fully qualified and most reliable.
+const (
+	rankMDNS = iota
+	rankLLMNR
+	rankNetBIOS
+)
+
+// identities collects the replies of all collectors by address.
+type identities struct {
+	mu   sync.Mutex
+	byIP map[string]*identity
+}
+
+func (ids *identities) update(ip net.IP, fn func(*identity)) {
+	if ip == nil {
+		return
+	}
+	key := ip.String()
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	id := ids.byIP[key]
+	if id == nil {
+		id = &identity{}
+		ids.byIP[key] = id
+	}
+	fn(id)
+}
+
+func (ids *identities) hostname(ip net.IP, name string, rank int) {
+	name = strings.TrimSuffix(name, ".")
+	ids.update(ip, func(id *identity) { id.hostname.offer(name, rank) })
+}
+
+func (ids *identities) model(ip net.IP, model string, rank int) {
+	ids.update(ip, func(id *identity) { id.model.offer(model, rank) })
+}
+
+func (ids *identities) kind(ip net.IP, kind string) {
+	for rank, k := range deviceKinds {
+		if k == kind {
+			ids.update(ip, func(id *identity) { id.kind.offer(kind, rank) })
+			return
+		}
+	}
+}
+
+func (ids *identities) service(ip net.IP, svc string) {
+	if svc == "" {
+		return
+	}
+	ids.update(ip, func(id *identity) {
+		if !containsString(id.services, svc) {
+			id.services = append(id.services, svc)
+		}
+	})
+	if kind := serviceKinds[svc]; kind != "" {
+		ids.kind(ip, kind)
+	}
+}
+
+// apply copies the identities onto hosts. IPv6 neighbours share the
+// identity of the IPv4 host with the same MAC address.
+func (ids *identities) apply(hosts []L2Host) {
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	byMAC := map[string]*identity{}
+	for i := range hosts {
+		h := &hosts[i]
+		id := ids.byIP[strings.SplitN(h.IP, "%", 2)[0]]
+		if id == nil {
+			continue
+		}
+		id.fill(h)
+		if h.MAC != "" && net.ParseIP(h.IP).To4() != nil {
+			byMAC[h.MAC] = id
+		}
+	}
+	for i := range hosts {
+		h := &hosts[i]
+		if id := byMAC[h.MAC]; id != nil && h.Hostname == "" && h.Model == "" && h.Kind == "" {
+			id.fill(h)
+		}
+	}
+}
+
+func (id *identity) fill(h *L2Host) {
+	if id.hostname.value != "" {
+		h.Hostname = id.hostname.value
+	}
+	if id.model.value != "" {
+		h.Model = id.model.value
+	}
+	if id.kind.value != "" {
+		h.Kind = id.kind.value
+	}
+	for _, svc := range id.services {
+		if !containsString(h.Services, svc) {
+			h.Services = append(h.Services, svc)
+		}
+	}
+}
+
+// listenMulticast opens a UDP socket for queries sent to a multicast group
+// on each of ifaces; the replies come back to it by unicast.
+func listenMulticast() (*net.UDPConn, *ipv4.PacketConn, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, nil, err
+	}
+	pc := ipv4.NewPacketConn(conn)
+	_ = pc.SetMulticastTTL(255)
+	return conn, pc, nil
+}
+
+// sendMulticast writes each payload to group out of every interface.
+func sendMulticast(pc *ipv4.PacketConn, ifaces []net.Interface, group *net.UDPAddr, payloads ...[]byte) {
+	for i := range ifaces {
+		if err := pc.SetMulticastInterface(&ifaces[i]); err != nil {
+			continue
+		}
+		for _, p := range payloads {
+			_, _ = pc.WriteTo(p, nil, group)
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package probes
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLLDPWindow = 60 * time.Second
+	// lldpSettle is how long listening goes on after the last new
+	// neighbour, so a phone and the switch behind it are both heard.
+	lldpSettle = 2 * time.Second
+
+	ethHeaderLen  = 14
+	lldpEtherType = 0x88cc
+
+	// LLDP TLV types (IEEE 802.1AB, section 8.4).
+	lldpEnd         = 0
+	lldpChassisID   = 1
+	lldpPortID      = 2
+	lldpTTL         = 3
+	lldpPortDesc    = 4
+	lldpSysName     = 5
+	lldpSysDesc     = 6
+	lldpCaps        = 7
+	lldpMgmtAddr    = 8
+	lldpOrgSpecific = 127
+
+	// CDP TLV types.
+	cdpDeviceID       = 0x0001
+	cdpAddresses      = 0x0002
+	cdpPortID         = 0x0003
+	cdpCapabilities   = 0x0004
+	cdpVersion        = 0x0005
+	cdpPlatform       = 0x0006
+	cdpNativeVLAN     = 0x000a
+	cdpVoIPVLAN       = 0x000e
+	cdpMgmtAddresses  = 0x0016
+	cdpPowerAvailable = 0x001a
+)
+
+var (
+	// cdpMulticast is the destination of CDP frames, which are 802.3 frames
+	// with an LLC/SNAP header carrying Cisco's OUI and protocol 0x2000.
+	cdpMulticast = net.HardwareAddr{0x01, 0x00, 0x0c, 0xcc, 0xcc, 0xcc}
+	cdpSNAP      = []byte{0xaa, 0xaa, 0x03, 0x00, 0x00, 0x0c, 0x20, 0x00}
+
+	oui8021    = []byte{0x00, 0x80, 0xc2}
+	oui8023    = []byte{0x00, 0x12, 0x0f}
+	ouiLLDPMED = []byte{0x00, 0x12, 0xbb}
+)
+
+// lldpChassisIDTypes and lldpPortIDTypes name the ID subtypes.
+var (
+	lldpChassisIDTypes = map[byte]string{1: "chassis", 2: "ifalias", 3: "port", 4: "mac", 5: "address", 6: "ifname", 7: "local"}
+	lldpPortIDTypes    = map[byte]string{1: "ifalias", 2: "port", 3: "mac", 4: "address", 5: "ifname", 6: "circuit", 7: "local"}
+)
+
+type capabilityBit struct {
+	bit  uint32
+	name string
+}
+
+// lldpCapabilityBits and cdpCapabilityBits map the capability bits to the
+// names reported for both protocols; an 802.1D bridge is a switch.
+var (
+	lldpCapabilityBits = []capabilityBit{
+		{0x10, "router"}, {0x04, "switch"}, {0x08, "access point"}, {0x20, "phone"},
+		{0x40, "cable modem"}, {0x02, "repeater"}, {0x80, "station"},
+	}
+	cdpCapabilityBits = []capabilityBit{
+		{0x01, "router"}, {0x08, "switch"}, {0x02, "switch"}, {0x04, "switch"}, {0x80, "phone"},
+		{0x40, "repeater"}, {0x10, "station"},
+	}
+)
+
+// LLDPResult holds the LLDP and CDP announcements heard on one interface.
+type LLDPResult struct {
+	Iface string `json:"iface"`
+	// WindowSec is the longest the interface was listened on.
+	WindowSec float64        `json:"window_s"`
+	Neighbors []LLDPNeighbor `json:"neighbors,omitempty"`
+}
+
+// LLDPNeighbor is a device announcing itself on the link, normally the
+// switch port the host is plugged into.
+type LLDPNeighbor struct {
+	// Protocol is "lldp" or "cdp".
+	Protocol  string `json:"protocol"`
+	SourceMAC string `json:"source_mac"`
+	// ChassisID identifies the device and ChassisIDType says what it
+	// holds, e.g. "mac" or "local"; CDP's device ID has no type.
+	ChassisID     string `json:"chassis_id"`
+	ChassisIDType string `json:"chassis_id_type,omitempty"`
+	// PortID identifies the neighbour's port and PortIDType says what it
+	// holds: "ifname", "ifalias", "mac", "address", "local", "port" or
+	// "circuit".
+	PortID            string `json:"port_id,omitempty"`
+	PortIDType        string `json:"port_id_type,omitempty"`
+	PortDescription   string `json:"port_description,omitempty"`
+	SystemName        string `json:"system_name,omitempty"`
+	SystemDescription string `json:"system_description,omitempty"`
+	// Platform is the hardware CDP reports, e.g. "cisco WS-C2960X-48FPD-L".
+	Platform string `json:"platform,omitempty"`
+	// Capabilities are the enabled capabilities, e.g. "switch", "router"
+	// or "phone".
+	Capabilities []string `json:"capabilities,omitempty"`
+	MgmtAddrs    []string `json:"mgmt_addrs,omitempty"`
+	// VLAN is the port's untagged VLAN and VoiceVLAN the VLAN phones are
+	// told to use; 0 when not announced.
+	VLAN      int  `json:"vlan,omitempty"`
+	VoiceVLAN int  `json:"voice_vlan,omitempty"`
+	PoE       *PoE `json:"poe,omitempty"`
+	// TTLSec is how long the neighbour's announcement stays valid.
+	TTLSec int `json:"ttl_s"`
+}
+
+// PoE is what the neighbour announces about Power over Ethernet on its port.
+type PoE struct {
+	Supported bool `json:"supported"`
+	Enabled   bool `json:"enabled"`
+	// Class is the 802.3 power class; nil when not announced.
+	Class *int `json:"class,omitempty"`
+	// RequestedW is the power the host asked for and AllocatedW what the
+	// port grants it, in watts.
+	RequestedW float64 `json:"requested_w,omitempty"`
+	AllocatedW float64 `json:"allocated_w,omitempty"`
+}
+
+// CaptureNeighbors listens on iface for LLDP and CDP announcements for up to
+// window (60 s when zero). Switches announce themselves every 30 to 60
+// seconds, so listening stops early once a neighbour has been heard and
+// lldpSettle has passed without another. Capturing needs root or
+// CAP_NET_RAW and is only supported on Linux.
+func CaptureNeighbors(ctx context.Context, iface string, window time.Duration) (*LLDPResult, error) {
+	if window <= 0 {
+		window = defaultLLDPWindow
+	}
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	res := &LLDPResult{Iface: iface, WindowSec: window.Seconds()}
+	deadline := time.Now().Add(window)
+	var heard time.Time
+	until := func() time.Time {
+		if heard.IsZero() {
+			return deadline
+		}
+		return minTime(deadline, heard.Add(lldpSettle))
+	}
+	seen := map[string]int{}
+	err = captureLinkFrames(ctx, ifi, until, func(frame []byte) {
+		n, ok := decodeNeighbor(frame)
+		if !ok {
+			return
+		}
+		key := n.Protocol + "|" + n.ChassisID + "|" + n.PortID
+		if i, ok := seen[key]; ok {
+			res.Neighbors[i] = n
+			return
+		}
+		seen[key] = len(res.Neighbors)
+		res.Neighbors = append(res.Neighbors, n)
+		heard = time.Now()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Switch returns the neighbour to query over SNMP: the first switch or
+// router announcing a management address, else the first neighbour with
+// one, or nil.
+func (r *LLDPResult) Switch() *LLDPNeighbor {
+	if r == nil {
+		return nil
+	}
+	var first *LLDPNeighbor
+	for i := range r.Neighbors {
+		n := &r.Neighbors[i]
+		if n.MgmtAddr() == "" {
+			continue
+		}
+		if containsString(n.Capabilities, "switch") || containsString(n.Capabilities, "router") {
+			return n
+		}
+		if first == nil {
+			first = n
+		}
+	}
+	return first
+}
+
+// Name returns the neighbour's system name, or its chassis ID.
+func (n LLDPNeighbor) Name() string {
+	if n.SystemName != "" {
+		return n.SystemName
+	}
+	return n.ChassisID
+}
+
+// MgmtAddr returns the first IPv4 management address, else the first IPv6
+// one, or "".
+func (n LLDPNeighbor) MgmtAddr() string {
+	var v6 string
+	for _, a := range n.MgmtAddrs {
+		ip := net.ParseIP(a)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil:
+			return a
+		case v6 == "":
+			v6 = a
+		}
+	}
+	return v6
+}
+
+// PortName returns the name the neighbour gives its port, as SNMP would
+// list it in ifName or ifDescr: the port ID when it is a name, else the
+// port description.
+func (n LLDPNeighbor) PortName() string {
+	switch n.PortIDType {
+	case "mac", "address":
+		return n.PortDescription
+	}
+	if n.PortID == "" {
+		return n.PortDescription
+	}
+	return n.PortID
+}
+
+// Summary describes the PoE announcement, e.g. "class 4, 25.5 W allocated".
+func (p *PoE) Summary() string {
+	if p == nil {
+		return ""
+	}
+	var parts []string
+	switch {
+	case !p.Supported:
+		parts = append(parts, "not supported")
+	case !p.Enabled:
+		parts = append(parts, "disabled")
+	}
+	if p.Class != nil {
+		parts = append(parts, fmt.Sprintf("class %d", *p.Class))
+	}
+	if p.AllocatedW > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f W allocated", p.AllocatedW))
+	}
+	if p.RequestedW > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f W requested", p.RequestedW))
+	}
+	if len(parts) == 0 {
+		return "enabled"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// decodeNeighbor decodes an Ethernet frame carrying an LLDP or CDP
+// announcement.
+func decodeNeighbor(b []byte) (LLDPNeighbor, bool) {
+	if len(b) < ethHeaderLen {
+		return LLDPNeighbor{}, false
+	}
+	var (
+		n  LLDPNeighbor
+		ok bool
+	)
+	switch {
+	case binary.BigEndian.Uint16(b[12:14]) == lldpEtherType:
+		n, ok = decodeLLDP(b[ethHeaderLen:])
+	case bytes.Equal(b[0:6], cdpMulticast) && bytes.HasPrefix(b[ethHeaderLen:], cdpSNAP):
+		// CDP rides in 802.3 frames, whose type field is the payload
+		// length; anything after it is padding.
+		p := b[ethHeaderLen:]
+		if length := int(binary.BigEndian.Uint16(b[12:14])); length >= len(cdpSNAP) && length < len(p) {
+			p = p[:length]
+		}
+		n, ok = decodeCDP(p[len(cdpSNAP):])
+	}
+	if !ok {
+		return LLDPNeighbor{}, false
+	}
+	n.SourceMAC = normalizeMAC(net.HardwareAddr(b[6:12]).String())
+	return n, true
+}
+
+// decodeLLDP decodes an LLDPDU. One with a zero TTL announces that the
+// neighbour is shutting down and is ignored.
+func decodeLLDP(p []byte) (LLDPNeighbor, bool) {
+	n := LLDPNeighbor{Protocol: "lldp"}
+	hasTTL := false
+tlvs:
+	for len(p) >= 2 {
+		hdr := binary.BigEndian.Uint16(p)
+		typ, length := hdr>>9, int(hdr&0x1ff)
+		if len(p) < 2+length {
+			return n, false
+		}
+		v := p[2 : 2+length]
+		p = p[2+length:]
+		switch typ {
+		case lldpEnd:
+			break tlvs
+		case lldpChassisID:
+			if len(v) >= 2 {
+				n.ChassisIDType = lldpChassisIDTypes[v[0]]
+				n.ChassisID = lldpID(n.ChassisIDType, v[1:])
+			}
+		case lldpPortID:
+			if len(v) >= 2 {
+				n.PortIDType = lldpPortIDTypes[v[0]]
+				n.PortID = lldpID(n.PortIDType, v[1:])
+			}
+		case lldpTTL:
+			if len(v) >= 2 {
+				n.TTLSec = int(binary.BigEndian.Uint16(v))
+				hasTTL = true
+			}
+		case lldpPortDesc:
+			n.PortDescription = optionString(v)
+		case lldpSysName:
+			n.SystemName = optionString(v)
+		case lldpSysDesc:
+			n.SystemDescription = optionString(v)
+		case lldpCaps:
+			if len(v) >= 4 {
+				n.Capabilities = capabilityNames(lldpCapabilityBits, uint32(binary.BigEndian.Uint16(v[2:4])))
+			}
+		case lldpMgmtAddr:
+			// The address string length counts the subtype byte.
+			if len(v) >= 3 && int(v[0]) >= 2 && len(v) >= 1+int(v[0]) {
+				n.addMgmtAddr(lldpAddress(v[1], v[2:1+int(v[0])]))
+			}
+		case lldpOrgSpecific:
+			if len(v) >= 4 {
+				n.decodeOrgTLV(v[:3], v[3], v[4:])
+			}
+		}
+	}
+	// A lone zero is padding after an LLDPDU without an End TLV; anything
+	// else is a truncated TLV header.
+	if len(p) == 1 && p[0] != 0 {
+		return n, false
+	}
+	if n.ChassisID == "" || !hasTTL || n.TTLSec == 0 {
+		return n, false
+	}
+	return n, true
+}
+
+// decodeOrgTLV decodes the organizationally specific TLVs that carry the
+// VLAN and PoE settings: the 802.1 port VLAN ID, the 802.3 power via MDI
+// TLV and the LLDP-MED network policy and extended power TLVs.
+func (n *LLDPNeighbor) decodeOrgTLV(oui []byte, subtype byte, v []byte) {
+	switch {
+	case bytes.Equal(oui, oui8021) && subtype == 1:
+		if len(v) >= 2 {
+			n.VLAN = int(binary.BigEndian.Uint16(v))
+		}
+	case bytes.Equal(oui, oui8023) && subtype == 2:
+		if len(v) < 3 {
+			return
+		}
+		poe := n.poe()
+		poe.Supported = v[0]&0x02 != 0
+		poe.Enabled = v[0]&0x04 != 0
+		// The class is sent plus one, 0 meaning unknown.
+		if v[2] > 0 {
+			class := int(v[2]) - 1
+			poe.Class = &class
+		}
+		// 802.3at added the requested and allocated power, in 0.1 W.
+		if len(v) >= 8 {
+			poe.RequestedW = float64(binary.BigEndian.Uint16(v[4:6])) / 10
+			poe.AllocatedW = float64(binary.BigEndian.Uint16(v[6:8])) / 10
+		}
+	case bytes.Equal(oui, ouiLLDPMED) && subtype == 2:
+		// Application type 1 is voice. The policy packs the unknown,
+		// tagged and reserved flags, the VLAN ID, priority and DSCP into
+		// three bytes.
+		if len(v) < 4 || v[0] != 1 {
+			return
+		}
+		policy := uint32(v[1])<<16 | uint32(v[2])<<8 | uint32(v[3])
+		if policy&0x800000 == 0 {
+			n.VoiceVLAN = int(policy >> 9 & 0xfff)
+		}
+	case bytes.Equal(oui, ouiLLDPMED) && subtype == 4:
+		// Power type 0 is a power sourcing device; its power value, in
+		// 0.1 W, is what it grants the port.
+		if len(v) < 3 || v[0]>>6 != 0 {
+			return
+		}
+		poe := n.poe()
+		poe.Supported, poe.Enabled = true, true
+		if poe.AllocatedW == 0 {
+			poe.AllocatedW = float64(binary.BigEndian.Uint16(v[1:3])) / 10
+		}
+	}
+}
+
+// decodeCDP decodes a CDP packet following the SNAP header.
+func decodeCDP(p []byte) (LLDPNeighbor, bool) {
+	n := LLDPNeighbor{Protocol: "cdp"}
+	if len(p) < 4 {
+		return n, false
+	}
+	n.TTLSec = int(p[1])
+	p = p[4:]
+	for len(p) >= 4 {
+		typ, length := binary.BigEndian.Uint16(p[0:2]), int(binary.BigEndian.Uint16(p[2:4]))
+		if length < 4 || length > len(p) {
+			return n, false
+		}
+		v := p[4:length]
+		p = p[length:]
+		switch typ {
+		case cdpDeviceID:
+			n.ChassisID = optionString(v)
+			n.SystemName = n.ChassisID
+		case cdpAddresses, cdpMgmtAddresses:
+			for _, a := range cdpAddrs(v) {
+				n.addMgmtAddr(a)
+			}
+		case cdpPortID:
+			n.PortID, n.PortIDType = optionString(v), "ifname"
+		case cdpCapabilities:
+			if len(v) >= 4 {
+				n.Capabilities = capabilityNames(cdpCapabilityBits, binary.BigEndian.Uint32(v))
+			}
+		case cdpVersion:
+			n.SystemDescription = optionString(v)
+		case cdpPlatform:
+			n.Platform = optionString(v)
+		case cdpNativeVLAN:
+			if len(v) >= 2 {
+				n.VLAN = int(binary.BigEndian.Uint16(v))
+			}
+		case cdpVoIPVLAN:
+			if len(v) >= 3 {
+				n.VoiceVLAN = int(binary.BigEndian.Uint16(v[1:3]))
+			}
+		case cdpPowerAvailable:
+			// Request and management IDs, then the available power in mW.
+			if len(v) >= 8 {
+				poe := n.poe()
+				poe.Supported, poe.Enabled = true, true
+				poe.AllocatedW = float64(binary.BigEndian.Uint32(v[4:8])) / 1000
+			}
+		}
+	}
+	if len(p) > 0 {
+		return n, false
+	}
+	if n.ChassisID == "" || n.TTLSec == 0 {
+		return n, false
+	}
+	return n, true
+}
+
+// cdpAddrs decodes a CDP address list: a count, then for each address its
+// protocol type, protocol and address, each with a length.
+func cdpAddrs(v []byte) []string {
+	if len(v) < 4 {
+		return nil
+	}
+	count := binary.BigEndian.Uint32(v)
+	v = v[4:]
+	var out []string
+	for i := uint32(0); i < count && len(v) >= 2; i++ {
+		plen := int(v[1])
+		if len(v) < 2+plen+2 {
+			break
+		}
+		proto := v[2 : 2+plen]
+		alen := int(binary.BigEndian.Uint16(v[2+plen:]))
+		v = v[2+plen+2:]
+		if len(v) < alen {
+			break
+		}
+		addr := v[:alen]
+		v = v[alen:]
+		// IPv4 is NLPID 0xcc; IPv6 is an 802.2 SNAP header for 0x86dd.
+		switch {
+		case alen == net.IPv4len && bytes.Equal(proto, []byte{0xcc}):
+			out = append(out, net.IP(addr).String())
+		case alen == net.IPv6len && bytes.HasSuffix(proto, []byte{0x86, 0xdd}):
+			out = append(out, net.IP(addr).String())
+		}
+	}
+	return out
+}
+
+func (n *LLDPNeighbor) poe() *PoE {
+	if n.PoE == nil {
+		n.PoE = &PoE{}
+	}
+	return n.PoE
+}
+
+func (n *LLDPNeighbor) addMgmtAddr(a string) {
+	if a != "" && !containsString(n.MgmtAddrs, a) {
+		n.MgmtAddrs = append(n.MgmtAddrs, a)
+	}
+}
+
+// lldpID formats a chassis or port ID of the given type.
+func lldpID(kind string, v []byte) string {
+	switch kind {
+	case "mac":
+		if len(v) == 6 {
+			return normalizeMAC(net.HardwareAddr(v).String())
+		}
+	case "address":
+		if len(v) >= 2 {
+			return lldpAddress(v[0], v[1:])
+		}
+		return ""
+	}
+	return optionString(v)
+}
+
+// lldpAddress formats an address by its IANA address family: 1 is IPv4, 2
+// IPv6 and 6 an 802 MAC address.
+func lldpAddress(family byte, a []byte) string {
+	switch {
+	case family == 1 && len(a) == net.IPv4len, family == 2 && len(a) == net.IPv6len:
+		return net.IP(a).String()
+	case family == 6 && len(a) == 6:
+		return normalizeMAC(net.HardwareAddr(a).String())
+	}
+	return ""
+}
+
+func capabilityNames(bits []capabilityBit, caps uint32) []string {
+	var out []string
+	for _, c := range bits {
+		if caps&c.bit != 0 && !containsString(out, c.name) {
+			out = append(out, c.name)
+		}
+	}
+	return out
+}
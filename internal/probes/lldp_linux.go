@@ -0,0 +1,93 @@
+package probes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// lldpPoll bounds each blocking read so cancellation and the deadline are
+// noticed.
+const lldpPoll = 100 * time.Millisecond
+
+// lldpGroups are the multicast addresses LLDP (nearest bridge, nearest
+// non-TPMR bridge, nearest customer bridge) and CDP are sent to. Joining
+// them makes NICs that filter multicast pass the frames up.
+var lldpGroups = []net.HardwareAddr{
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e},
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x03},
+	{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00},
+	cdpMulticast,
+}
+
+// lldpFilter is a classic BPF program that keeps the frames whose EtherType
+// is LLDP or whose destination is the CDP address:
+//
+//	ldh [12]; jeq #0x88cc, accept
+//	ld [0]; jne #0x01000ccc, drop
+//	ldh [4]; jne #0xcccc, drop
+//	accept: ret #0x40000
+//	drop: ret #0
+var lldpFilter = []unix.SockFilter{
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 12},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 4, Jf: 0, K: lldpEtherType},
+	{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: 0},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 3, K: 0x01000ccc},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 4},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 1, K: 0xcccc},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0x40000},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+}
+
+// captureLinkFrames passes the LLDP and CDP frames received on ifi to handle
+// until the time until returns, which is asked again after every read, or
+// cancellation. Frames the host sends itself, e.g. from a local lldpd, are
+// skipped.
+func captureLinkFrames(ctx context.Context, ifi *net.Interface, until func() time.Time, handle func(frame []byte)) error {
+	proto := htons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(proto))
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	prog := unix.SockFprog{Len: uint16(len(lldpFilter)), Filter: &lldpFilter[0]}
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		return err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index}); err != nil {
+		return err
+	}
+	for _, group := range lldpGroups {
+		mreq := unix.PacketMreq{Ifindex: int32(ifi.Index), Type: unix.PACKET_MR_MULTICAST, Alen: uint16(len(group))}
+		copy(mreq.Address[:], group)
+		if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, &mreq); err != nil {
+			return err
+		}
+	}
+	tv := unix.NsecToTimeval(lldpPoll.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 9216)
+	for time.Now().Before(until()) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, from, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return err
+		}
+		if sll, ok := from.(*unix.SockaddrLinklayer); ok && sll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		handle(buf[:n])
+	}
+	return nil
+}
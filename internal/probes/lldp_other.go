@@ -0,0 +1,16 @@
+//go:build !linux
+
+package probes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"runtime"
+	"time"
+)
+
+// captureLinkFrames needs a Linux packet socket.
+func captureLinkFrames(ctx context.Context, ifi *net.Interface, until func() time.Time, handle func(frame []byte)) error {
+	return errors.New("LLDP and CDP capture is not supported on " + runtime.GOOS)
+}
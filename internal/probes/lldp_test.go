@@ -0,0 +1,343 @@
+package probes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// lldpTLV encodes an LLDP TLV: a 7-bit type and 9-bit length, then the value.
+func lldpTLV(typ int, v ...byte) []byte {
+	hdr := binary.BigEndian.AppendUint16(nil, uint16(typ<<9|len(v)))
+	return append(hdr, v...)
+}
+
+// cdpTLV encodes a CDP TLV, whose length counts its 4-byte header.
+func cdpTLV(typ int, v ...byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(typ))
+	b = binary.BigEndian.AppendUint16(b, uint16(4+len(v)))
+	return append(b, v...)
+}
+
+// join concatenates TLVs and returns the offset each one ends at.
+func join(tlvs ...[]byte) ([]byte, []int) {
+	var b []byte
+	var ends []int
+	for _, t := range tlvs {
+		b = append(b, t...)
+		ends = append(ends, len(b))
+	}
+	return b, ends
+}
+
+func cat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func lldpSwitchTLVs() [][]byte {
+	return [][]byte{
+		lldpTLV(lldpChassisID, cat([]byte{4}, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})...),
+		lldpTLV(lldpPortID, cat([]byte{5}, []byte("Gi1/0/7"))...),
+		lldpTLV(lldpTTL, 0, 120),
+		lldpTLV(lldpPortDesc, []byte("GigabitEthernet1/0/7")...),
+		lldpTLV(lldpSysName, []byte("sw-floor2\x00")...),
+		lldpTLV(lldpSysDesc, []byte("Cisco IOS Software, C2960X")...),
+		// Router and bridge, both enabled.
+		lldpTLV(lldpCaps, 0x00, 0x14, 0x00, 0x14),
+		// Address length 5 (subtype plus IPv4), interface subtype and
+		// number, empty OID.
+		lldpTLV(lldpMgmtAddr, 5, 1, 10, 0, 0, 2, 2, 0, 0, 0, 7, 0),
+		lldpTLV(lldpMgmtAddr, 7, 6, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 1, 0, 0, 0, 1, 0),
+		// 802.1 port VLAN ID 20.
+		lldpTLV(lldpOrgSpecific, 0x00, 0x80, 0xc2, 1, 0x00, 20),
+		// LLDP-MED network policy: voice, tagged, VLAN 100, priority 5,
+		// DSCP 46.
+		lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0xbb, 2, 1, 0x40, 0xc9, 0x6e),
+		// LLDP-MED network policy for voice signalling, VLAN 101: ignored.
+		lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0xbb, 2, 2, 0x40, 0xcb, 0x6e),
+		// 802.3 power via MDI: supported and enabled, class 4, 25.5 W
+		// requested and allocated.
+		lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0x0f, 2, 0x07, 0x01, 0x05, 0x51, 0x00, 0xff, 0x00, 0xff),
+		lldpTLV(lldpEnd),
+	}
+}
+
+func TestDecodeLLDP(t *testing.T) {
+	class4 := 4
+	p, _ := join(lldpSwitchTLVs()...)
+	got, ok := decodeLLDP(p)
+	want := LLDPNeighbor{
+		Protocol:      "lldp",
+		ChassisID:     "00:11:22:33:44:55",
+		ChassisIDType: "mac",
+		PortID:        "Gi1/0/7", PortIDType: "ifname",
+		PortDescription:   "GigabitEthernet1/0/7",
+		SystemName:        "sw-floor2",
+		SystemDescription: "Cisco IOS Software, C2960X",
+		Capabilities:      []string{"router", "switch"},
+		MgmtAddrs:         []string{"10.0.0.2", "00:11:22:33:44:55"},
+		VLAN:              20,
+		VoiceVLAN:         100,
+		PoE:               &PoE{Supported: true, Enabled: true, Class: &class4, RequestedW: 25.5, AllocatedW: 25.5},
+		TTLSec:            120,
+	}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeLLDP = %v\n got %+v %+v\nwant %+v %+v", ok, got, got.PoE, want, want.PoE)
+	}
+}
+
+func TestDecodeLLDPVariants(t *testing.T) {
+	chassis := lldpTLV(lldpChassisID, 7, 'p', 'h', 'o', 'n', 'e')
+	ttl := lldpTLV(lldpTTL, 0, 120)
+	tests := []struct {
+		name   string
+		tlvs   [][]byte
+		ok     bool
+		check  func(LLDPNeighbor) bool
+		expect string
+	}{
+		{
+			name: "no End TLV",
+			tlvs: [][]byte{chassis, ttl},
+			ok:   true,
+		},
+		{
+			name: "padding after End",
+			tlvs: [][]byte{chassis, ttl, lldpTLV(lldpEnd), {0, 0, 0, 0xff}},
+			ok:   true,
+		},
+		{
+			name:   "address port ID",
+			tlvs:   [][]byte{chassis, lldpTLV(lldpPortID, 4, 2, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1), ttl},
+			ok:     true,
+			check:  func(n LLDPNeighbor) bool { return n.PortIDType == "address" && n.PortID == "2001:db8::1" },
+			expect: "IPv6 address port ID",
+		},
+		{
+			// The unknown-policy flag means the VLAN is not configured.
+			name:   "unknown voice policy",
+			tlvs:   [][]byte{chassis, ttl, lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0xbb, 2, 1, 0xc0, 0xc9, 0x6e)},
+			ok:     true,
+			check:  func(n LLDPNeighbor) bool { return n.VoiceVLAN == 0 },
+			expect: "no voice VLAN",
+		},
+		{
+			name: "LLDP-MED extended power",
+			tlvs: [][]byte{chassis, ttl, lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0xbb, 4, 0x00, 0x00, 0x9a)},
+			ok:   true,
+			check: func(n LLDPNeighbor) bool {
+				return n.PoE != nil && n.PoE.Enabled && n.PoE.AllocatedW == 15.4 && n.PoE.Class == nil
+			},
+			expect: "15.4 W allocated",
+		},
+		{
+			name: "powered device extended power ignored",
+			tlvs: [][]byte{chassis, ttl, lldpTLV(lldpOrgSpecific, 0x00, 0x12, 0xbb, 4, 0x40, 0x00, 0x9a)},
+			ok:   true,
+			check: func(n LLDPNeighbor) bool {
+				return n.PoE == nil
+			},
+			expect: "no PoE",
+		},
+		{
+			name: "short values ignored",
+			tlvs: [][]byte{
+				chassis, ttl,
+				lldpTLV(lldpPortID, 5), lldpTLV(lldpCaps, 0, 4),
+				lldpTLV(lldpMgmtAddr, 9, 1, 10, 0, 0, 2), lldpTLV(lldpOrgSpecific, 0x00, 0x80),
+				lldpTLV(lldpOrgSpecific, 0x00, 0x80, 0xc2, 1, 20),
+			},
+			ok: true,
+			check: func(n LLDPNeighbor) bool {
+				return n.PortID == "" && n.Capabilities == nil && n.MgmtAddrs == nil && n.VLAN == 0
+			},
+			expect: "nothing decoded from short values",
+		},
+		{name: "shutdown", tlvs: [][]byte{chassis, lldpTLV(lldpTTL, 0, 0)}},
+		{name: "no TTL", tlvs: [][]byte{chassis}},
+		{name: "no chassis ID", tlvs: [][]byte{ttl}},
+		{name: "empty chassis ID", tlvs: [][]byte{lldpTLV(lldpChassisID, 7), ttl}},
+		{name: "empty", tlvs: nil},
+		{
+			name: "over-long TLV",
+			tlvs: [][]byte{chassis, ttl, {lldpSysName << 1, 0xff, 's', 'w'}},
+		},
+		{
+			name: "over-long before End",
+			tlvs: [][]byte{chassis, {lldpTTL << 1, 0x09, 0, 120}, lldpTLV(lldpEnd)},
+		},
+		{
+			name: "lone trailing byte",
+			tlvs: [][]byte{chassis, ttl, {lldpSysName << 1}},
+		},
+	}
+	for _, tt := range tests {
+		p, _ := join(tt.tlvs...)
+		n, ok := decodeLLDP(p)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if tt.check != nil && !tt.check(n) {
+			t.Errorf("%s: want %s, got %+v", tt.name, tt.expect, n)
+		}
+	}
+}
+
+// Every prefix of a valid LLDPDU either ends on a TLV boundary, where it
+// decodes once the chassis ID and TTL are in, or cuts a TLV and is
+// rejected.
+func TestDecodeLLDPTruncated(t *testing.T) {
+	tlvs := lldpSwitchTLVs()
+	p, ends := join(tlvs...)
+	ttlEnd := ends[2]
+	boundary := map[int]bool{0: true}
+	for _, e := range ends {
+		boundary[e] = true
+	}
+	// Half of the End TLV is a zero byte, taken as padding.
+	boundary[len(p)-1] = true
+	for cut := 0; cut < len(p); cut++ {
+		_, ok := decodeLLDP(p[:cut])
+		if want := boundary[cut] && cut >= ttlEnd; ok != want {
+			t.Errorf("cut at %d of %d: ok = %v, want %v", cut, len(p), ok, want)
+		}
+	}
+}
+
+func cdpSwitchPacket() ([]byte, []int) {
+	v6Addr := net.ParseIP("2001:db8::2")
+	return join(
+		// Version 2, TTL 180, checksum.
+		[]byte{2, 180, 0xbe, 0xef},
+		cdpTLV(cdpDeviceID, []byte("sw-floor2.example.com")...),
+		// One IPv4 address: NLPID protocol 0xcc.
+		cdpTLV(cdpAddresses, 0, 0, 0, 1, 1, 1, 0xcc, 0, 4, 10, 0, 0, 2),
+		cdpTLV(cdpPortID, []byte("GigabitEthernet1/0/7")...),
+		// Switch and IGMP snooping, which has no name.
+		cdpTLV(cdpCapabilities, 0, 0, 0, 0x28),
+		cdpTLV(cdpVersion, []byte("Cisco IOS Software, C2960X Software\n")...),
+		cdpTLV(cdpPlatform, []byte("cisco WS-C2960X-48FPD-L")...),
+		cdpTLV(cdpNativeVLAN, 0, 20),
+		cdpTLV(cdpVoIPVLAN, 1, 0, 100),
+		// The same IPv4 address again, then an IPv6 one with an 802.2
+		// SNAP protocol header.
+		cdpTLV(cdpMgmtAddresses, cat(
+			[]byte{0, 0, 0, 2},
+			[]byte{1, 1, 0xcc, 0, 4, 10, 0, 0, 2},
+			[]byte{2, 8, 0xaa, 0xaa, 0x03, 0x00, 0x00, 0x00, 0x86, 0xdd, 0, 16}, v6Addr,
+		)...),
+		// Request ID, management ID, 30 W available, then the maximum.
+		cdpTLV(cdpPowerAvailable, 0, 1, 0, 2, 0, 0, 0x75, 0x30, 0, 0, 0x75, 0x30),
+	)
+}
+
+func TestDecodeCDP(t *testing.T) {
+	p, _ := cdpSwitchPacket()
+	got, ok := decodeCDP(p)
+	want := LLDPNeighbor{
+		Protocol:          "cdp",
+		ChassisID:         "sw-floor2.example.com",
+		SystemName:        "sw-floor2.example.com",
+		PortID:            "GigabitEthernet1/0/7",
+		PortIDType:        "ifname",
+		SystemDescription: "Cisco IOS Software, C2960X Software",
+		Platform:          "cisco WS-C2960X-48FPD-L",
+		Capabilities:      []string{"switch"},
+		MgmtAddrs:         []string{"10.0.0.2", "2001:db8::2"},
+		VLAN:              20,
+		VoiceVLAN:         100,
+		PoE:               &PoE{Supported: true, Enabled: true, AllocatedW: 30},
+		TTLSec:            180,
+	}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCDP = %v\n got %+v %+v\nwant %+v %+v", ok, got, got.PoE, want, want.PoE)
+	}
+}
+
+func TestDecodeCDPInvalid(t *testing.T) {
+	device := cdpTLV(cdpDeviceID, 's', 'w')
+	tests := []struct {
+		name string
+		p    []byte
+	}{
+		{"empty", nil},
+		{"header only", []byte{2, 180, 0, 0}},
+		{"zero TTL", cat([]byte{2, 0, 0, 0}, device)},
+		{"no device ID", cat([]byte{2, 180, 0, 0}, cdpTLV(cdpPortID, 'p'))},
+		{"length under the header", cat([]byte{2, 180, 0, 0}, device, []byte{0, 3, 0, 2, 0, 0})},
+		{"over-long TLV", cat([]byte{2, 180, 0, 0}, device, []byte{0, 3, 0, 40, 'G', 'i'})},
+	}
+	for _, tt := range tests {
+		if n, ok := decodeCDP(tt.p); ok {
+			t.Errorf("%s: decoded %+v", tt.name, n)
+		}
+	}
+}
+
+func TestDecodeCDPTruncated(t *testing.T) {
+	p, ends := cdpSwitchPacket()
+	deviceEnd := ends[1]
+	boundary := map[int]bool{}
+	for _, e := range ends {
+		boundary[e] = true
+	}
+	for cut := 0; cut < len(p); cut++ {
+		_, ok := decodeCDP(p[:cut])
+		if want := boundary[cut] && cut >= deviceEnd; ok != want {
+			t.Errorf("cut at %d of %d: ok = %v, want %v", cut, len(p), ok, want)
+		}
+	}
+}
+
+func TestCDPAddrsTruncated(t *testing.T) {
+	v := []byte{0, 0, 0, 2, 1, 1, 0xcc, 0, 4, 10, 0, 0, 2, 1, 1, 0xcc, 0, 4, 10, 0, 0, 3}
+	for cut := 0; cut <= len(v); cut++ {
+		got := cdpAddrs(v[:cut])
+		want := 0
+		switch {
+		case cut == len(v):
+			want = 2
+		case cut >= 13:
+			want = 1
+		}
+		if len(got) != want {
+			t.Errorf("cut at %d: %q", cut, got)
+		}
+	}
+}
+
+func TestDecodeNeighbor(t *testing.T) {
+	src := []byte{0x00, 0xaa, 0xbb, 0xcc, 0xdd, 0xee}
+	lldpDU, _ := join(lldpSwitchTLVs()...)
+	lldpFrame := cat([]byte{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}, src, []byte{0x88, 0xcc}, lldpDU)
+
+	cdp, _ := cdpSwitchPacket()
+	payload := cat(cdpSNAP, cdp)
+	length := binary.BigEndian.AppendUint16(nil, uint16(len(payload)))
+	cdpFrame := cat(cdpMulticast, src, length, payload)
+	// Padding past the 802.3 length is not part of the packet.
+	padded := cat(cdpFrame, make([]byte, 6))
+
+	for _, tt := range []struct {
+		name     string
+		frame    []byte
+		protocol string
+	}{
+		{"lldp", lldpFrame, "lldp"},
+		{"cdp", cdpFrame, "cdp"},
+		{"cdp padded", padded, "cdp"},
+		{"short", src, ""},
+		{"other ethertype", cat(cdpMulticast, src, []byte{0x08, 0x00}, lldpDU), ""},
+		{"cdp to another address", cat(src, src, length, payload), ""},
+	} {
+		n, ok := decodeNeighbor(tt.frame)
+		if ok != (tt.protocol != "") || n.Protocol != tt.protocol {
+			t.Errorf("%s: ok %v, protocol %q", tt.name, ok, n.Protocol)
+			continue
+		}
+		if ok && n.SourceMAC != "00:aa:bb:cc:dd:ee" {
+			t.Errorf("%s: source MAC %q", tt.name, n.SourceMAC)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package probes
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// mdnsServices is the DNS-SD meta-query that lists every service type
+	// advertised on the link (RFC 6763, section 9).
+	mdnsServices = "_services._dns-sd._udp.local."
+	// maxQuestions bounds the questions packed into one query packet.
+	maxQuestions = 32
+	llmnrPort    = 5355
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsIdentify browses the service types advertised over mDNS and looks up
+// the names of addrs. The queries go out from an ephemeral port, which
+// makes responders answer by unicast (RFC 6762, section 6.7) without
+// competing with a local mDNS daemon for port 5353. Halfway through window
+// each service type found is browsed for its instances, whose SRV and TXT
+// records carry the host name and model; replies are read for window after
+// that.
+func mdnsIdentify(ctx context.Context, ifaces []net.Interface, addrs []net.IP, window time.Duration, ids *identities) {
+	if len(ifaces) == 0 {
+		return
+	}
+	conn, pc, err := listenMulticast()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	names := []string{mdnsServices}
+	for _, ip := range addrs {
+		names = append(names, reverseName(ip))
+	}
+	sendMulticast(pc, ifaces, mdnsGroup, dnsQueries(names, dnsmessage.TypePTR)...)
+
+	start := time.Now()
+	types := map[string]bool{}
+	var browsed bool
+	tick := func() {
+		if browsed || time.Since(start) < window/2 {
+			return
+		}
+		browsed = true
+		var names []string
+		for t := range types {
+			names = append(names, t)
+		}
+		sendMulticast(pc, ifaces, mdnsGroup, dnsQueries(names, dnsmessage.TypePTR)...)
+	}
+	readUDPReplies(ctx, conn, start.Add(window+window/2), tick, func(src net.IP, b []byte) {
+		for _, svc := range mdnsRecords(src, b, ids) {
+			types[svc] = true
+		}
+	})
+}
+
+// mdnsRecords records what an mDNS reply from src says and returns the
+// service types it listed.
+func mdnsRecords(src net.IP, b []byte, ids *identities) []string {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil || !msg.Header.Response {
+		return nil
+	}
+	var types []string
+	records := append(append(msg.Answers, msg.Authorities...), msg.Additionals...)
+	for _, r := range records {
+		name := r.Header.Name.String()
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			target := body.PTR.String()
+			switch {
+			case strings.EqualFold(name, mdnsServices):
+				types = append(types, target)
+				ids.service(src, serviceType(target))
+			case isReverseName(name):
+				ids.hostname(parseReverseName(name), target, rankMDNS)
+			default:
+				ids.service(src, serviceType(name))
+			}
+		case *dnsmessage.SRVResource:
+			ids.service(src, serviceType(name))
+			ids.hostname(src, body.Target.String(), rankMDNS)
+		case *dnsmessage.TXTResource:
+			if model, rank := txtModel(body.TXT); model != "" {
+				ids.model(src, model, rank)
+			}
+		case *dnsmessage.AResource:
+			ids.hostname(net.IP(body.A[:]), name, rankMDNS)
+		case *dnsmessage.AAAAResource:
+			ids.hostname(net.IP(body.AAAA[:]), name, rankMDNS)
+		}
+	}
+	return types
+}
+
+// llmnrIdentify asks every address for its own name with an LLMNR reverse
+// query, which RFC 4795 sends by unicast. Windows hosts answer it.
+func llmnrIdentify(ctx context.Context, addrs []net.IP, window time.Duration, ids *identities) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for _, ip := range addrs {
+		for _, q := range dnsQueries([]string{reverseName(ip)}, dnsmessage.TypePTR) {
+			_, _ = conn.WriteToUDP(q, &net.UDPAddr{IP: ip, Port: llmnrPort})
+		}
+	}
+	readUDPReplies(ctx, conn, time.Now().Add(window), nil, func(src net.IP, b []byte) {
+		var msg dnsmessage.Message
+		if err := msg.Unpack(b); err != nil || !msg.Header.Response {
+			return
+		}
+		for _, r := range msg.Answers {
+			if ptr, ok := r.Body.(*dnsmessage.PTRResource); ok && isReverseName(r.Header.Name.String()) {
+				ids.hostname(parseReverseName(r.Header.Name.String()), ptr.PTR.String(), rankLLMNR)
+			}
+		}
+	})
+}
+
+// dnsQueries packs questions of type t for names into as few queries as
+// needed.
+func dnsQueries(names []string, t dnsmessage.Type) [][]byte {
+	var out [][]byte
+	for len(names) > 0 {
+		chunk := names[:min(len(names), maxQuestions)]
+		names = names[len(chunk):]
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: uint16(rand.Uint32())})
+		b.EnableCompression()
+		if err := b.StartQuestions(); err != nil {
+			continue
+		}
+		for _, n := range chunk {
+			name, err := dnsmessage.NewName(n)
+			if err != nil {
+				continue
+			}
+			_ = b.Question(dnsmessage.Question{Name: name, Type: t, Class: dnsmessage.ClassINET})
+		}
+		if msg, err := b.Finish(); err == nil {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// txtModel picks the make and model out of a DNS-SD TXT record, with its
+// rank: IPP's ty and product keys, the USB device ID fields, then the md
+// and model keys of casting, HomeKit and Apple devices.
+func txtModel(txt []string) (string, int) {
+	kv := map[string]string{}
+	for _, s := range txt {
+		if k, v, ok := strings.Cut(s, "="); ok {
+			kv[strings.ToLower(k)] = strings.TrimSpace(v)
+		}
+	}
+	if v := kv["ty"]; v != "" {
+		return v, 0
+	}
+	if v := strings.Trim(kv["product"], "()"); v != "" {
+		return v, 1
+	}
+	if v := kv["usb_mdl"]; v != "" {
+		return withMaker(kv["usb_mfg"], v), 2
+	}
+	if v := kv["md"]; v != "" {
+		return v, 3
+	}
+	if v := kv["model"]; v != "" {
+		return v, 4
+	}
+	return "", 0
+}
+
+// withMaker prefixes model with maker unless it already starts with it.
+func withMaker(maker, model string) string {
+	maker = strings.TrimSpace(maker)
+	if maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)) {
+		return model
+	}
+	return maker + " " + model
+}
+
+// serviceType returns the "_service._proto" part of a DNS-SD type or
+// instance name, e.g. "_ipp._tcp" for "Office._ipp._tcp.local.".
+func serviceType(name string) string {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, "."), ".local")
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	svc, proto := labels[len(labels)-2], labels[len(labels)-1]
+	if !strings.HasPrefix(svc, "_") || (proto != "_tcp" && proto != "_udp") {
+		return ""
+	}
+	return svc + "." + proto
+}
+
+// reverseName is the in-addr.arpa name of an IPv4 address.
+func reverseName(ip net.IP) string {
+	ip4 := ip.To4()
+	return net.IPv4(ip4[3], ip4[2], ip4[1], ip4[0]).String() + ".in-addr.arpa."
+}
+
+func isReverseName(name string) bool {
+	return parseReverseName(name) != nil
+}
+
+// parseReverseName returns the IPv4 address of an in-addr.arpa name, or
+// nil.
+func parseReverseName(name string) net.IP {
+	rest, ok := strings.CutSuffix(strings.ToLower(name), ".in-addr.arpa.")
+	if !ok {
+		return nil
+	}
+	ip := net.ParseIP(rest).To4()
+	if ip == nil {
+		return nil
+	}
+	return net.IPv4(ip[3], ip[2], ip[1], ip[0])
+}
@@ -0,0 +1,209 @@
+package probes
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsReply packs an mDNS response carrying answers and additionals.
+func mdnsReply(t *testing.T, response bool, answers, additionals []dnsmessage.Resource) []byte {
+	t.Helper()
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: response, Authoritative: true})
+	b.EnableCompression()
+	if err := b.StartAnswers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range answers {
+		if err := addResource(&b, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.StartAdditionals(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range additionals {
+		if err := addResource(&b, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func addResource(b *dnsmessage.Builder, r dnsmessage.Resource) error {
+	r.Header.Class = dnsmessage.ClassINET
+	r.Header.TTL = 120
+	switch body := r.Body.(type) {
+	case *dnsmessage.PTRResource:
+		return b.PTRResource(r.Header, *body)
+	case *dnsmessage.SRVResource:
+		return b.SRVResource(r.Header, *body)
+	case *dnsmessage.TXTResource:
+		return b.TXTResource(r.Header, *body)
+	case *dnsmessage.AResource:
+		return b.AResource(r.Header, *body)
+	case *dnsmessage.AAAAResource:
+		return b.AAAAResource(r.Header, *body)
+	}
+	panic("unsupported record")
+}
+
+func rr(name string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name)}, Body: body}
+}
+
+func ptr(name, target string) dnsmessage.Resource {
+	return rr(name, &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(target)})
+}
+
+// printerReply is a network printer answering both the service enumeration
+// and a browse for IPP printers, as CUPS and HP firmware do.
+func printerReply(t *testing.T) []byte {
+	const instance = "HP LaserJet M404dn._ipp._tcp.local."
+	return mdnsReply(t, true,
+		[]dnsmessage.Resource{
+			ptr(mdnsServices, "_ipp._tcp.local."),
+			ptr(mdnsServices, "_uscan._tcp.local."),
+			ptr("_ipp._tcp.local.", instance),
+		},
+		[]dnsmessage.Resource{
+			rr(instance, &dnsmessage.SRVResource{Port: 631, Target: dnsmessage.MustNewName("NPI3F2A1.local.")}),
+			rr(instance, &dnsmessage.TXTResource{TXT: []string{"txtvers=1", "product=(HP LaserJet Pro M404dn)", "ty=HP LaserJet Pro M404-M405"}}),
+			rr("NPI3F2A1.local.", &dnsmessage.AResource{A: [4]byte{192, 168, 1, 50}}),
+			rr("NPI3F2A1.local.", &dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 0x50}}),
+		})
+}
+
+func TestMDNSRecords(t *testing.T) {
+	src := net.IPv4(192, 168, 1, 50)
+	ids := &identities{byIP: map[string]*identity{}}
+	types := mdnsRecords(src, printerReply(t), ids)
+	if want := []string{"_ipp._tcp.local.", "_uscan._tcp.local."}; !reflect.DeepEqual(types, want) {
+		t.Errorf("types = %q, want %q", types, want)
+	}
+
+	// A reverse lookup answered by another host names that host.
+	nas := mdnsReply(t, true, []dnsmessage.Resource{
+		ptr("51.1.168.192.in-addr.arpa.", "diskstation.local."),
+		rr("DiskStation._smb._tcp.local.", &dnsmessage.SRVResource{Port: 445, Target: dnsmessage.MustNewName("diskstation.local.")}),
+		rr("DiskStation._device-info._tcp.local.", &dnsmessage.TXTResource{TXT: []string{"model=DS920+"}}),
+	}, nil)
+	if types := mdnsRecords(net.IPv4(192, 168, 1, 51), nas, ids); types != nil {
+		t.Errorf("types = %q, want none", types)
+	}
+
+	hosts := []L2Host{
+		{IP: "192.168.1.50", MAC: "3c:52:82:00:00:50"},
+		{IP: "fe80::50%eth0", MAC: "3c:52:82:00:00:50"},
+		{IP: "192.168.1.51", MAC: "00:11:32:00:00:51"},
+		{IP: "fe80::51%eth0", MAC: "00:11:32:00:00:51"},
+		{IP: "192.168.1.52"},
+	}
+	ids.apply(hosts)
+	want := []L2Host{
+		{
+			IP: "192.168.1.50", MAC: "3c:52:82:00:00:50", Hostname: "NPI3F2A1.local",
+			Model: "HP LaserJet Pro M404-M405", Kind: "printer", Services: []string{"_ipp._tcp", "_uscan._tcp"},
+		},
+		// The AAAA record names the IPv6 neighbour itself, so it does not
+		// take on the rest of its IPv4 twin's identity.
+		{IP: "fe80::50%eth0", MAC: "3c:52:82:00:00:50", Hostname: "NPI3F2A1.local"},
+		{
+			IP: "192.168.1.51", MAC: "00:11:32:00:00:51", Hostname: "diskstation.local",
+			Model: "DS920+", Kind: "file server", Services: []string{"_smb._tcp"},
+		},
+		{
+			IP: "fe80::51%eth0", MAC: "00:11:32:00:00:51", Hostname: "diskstation.local",
+			Model: "DS920+", Kind: "file server", Services: []string{"_smb._tcp"},
+		},
+		{IP: "192.168.1.52"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("hosts:\n got %+v\nwant %+v", hosts, want)
+	}
+}
+
+func TestMDNSRecordsRejected(t *testing.T) {
+	query := mdnsReply(t, false, []dnsmessage.Resource{ptr(mdnsServices, "_ipp._tcp.local.")}, nil)
+	tests := map[string][]byte{
+		"query":   query,
+		"garbage": []byte("HTTP/1.1 200 OK\r\n\r\n"),
+		"empty":   nil,
+	}
+	for name, b := range tests {
+		ids := &identities{byIP: map[string]*identity{}}
+		if types := mdnsRecords(net.IPv4(192, 168, 1, 50), b, ids); types != nil || len(ids.byIP) != 0 {
+			t.Errorf("%s: got %q, %d identities", name, types, len(ids.byIP))
+		}
+	}
+}
+
+func TestMDNSRecordsTruncated(t *testing.T) {
+	b := printerReply(t)
+	for n := range len(b) {
+		ids := &identities{byIP: map[string]*identity{}}
+		if types := mdnsRecords(net.IPv4(192, 168, 1, 50), b[:n], ids); types != nil || len(ids.byIP) != 0 {
+			t.Errorf("%d of %d bytes: got %q, %d identities", n, len(b), types, len(ids.byIP))
+		}
+	}
+}
+
+func TestTXTModel(t *testing.T) {
+	tests := []struct {
+		name     string
+		txt      []string
+		want     string
+		wantRank int
+	}{
+		{"ipp ty", []string{"product=(LaserJet)", "ty=HP LaserJet Pro M404-M405"}, "HP LaserJet Pro M404-M405", 0},
+		{"ipp product", []string{"product=(Brother HL-L2350DW series)"}, "Brother HL-L2350DW series", 1},
+		{"usb device id", []string{"usb_MFG=EPSON", "usb_MDL=ET-2750 Series"}, "EPSON ET-2750 Series", 2},
+		{"usb maker repeated", []string{"usb_MFG=Canon", "usb_MDL=Canon MG3600 series"}, "Canon MG3600 series", 2},
+		{"cast md", []string{"id=4f2a", "md=Chromecast Ultra", "fn=Living Room"}, "Chromecast Ultra", 3},
+		{"device-info model", []string{"model=MacBookPro18,3", "osxvers=23"}, "MacBookPro18,3", 4},
+		{"none", []string{"txtvers=1", "ty"}, "", 0},
+	}
+	for _, tt := range tests {
+		if got, rank := txtModel(tt.txt); got != tt.want || rank != tt.wantRank {
+			t.Errorf("%s: got %q rank %d, want %q rank %d", tt.name, got, rank, tt.want, tt.wantRank)
+		}
+	}
+}
+
+func TestServiceType(t *testing.T) {
+	for name, want := range map[string]string{
+		"_ipp._tcp.local.":                    "_ipp._tcp",
+		"Office Printer._ipp._tcp.local.":     "_ipp._tcp",
+		"Kitchen._hap._udp.local":             "_hap._udp",
+		"printer.local.":                      "",
+		"_http._sctp.local.":                  "",
+		"50.1.168.192.in-addr.arpa.":          "",
+		"Living Room._googlecast._tcp.local.": "_googlecast._tcp",
+	} {
+		if got := serviceType(name); got != want {
+			t.Errorf("serviceType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	ip := net.IPv4(192, 168, 1, 50)
+	name := reverseName(ip)
+	if name != "50.1.168.192.in-addr.arpa." {
+		t.Errorf("reverseName = %q", name)
+	}
+	if got := parseReverseName("50.1.168.192.IN-ADDR.ARPA."); !got.Equal(ip) {
+		t.Errorf("parseReverseName = %v, want %v", got, ip)
+	}
+	for _, name := range []string{"printer.local.", "1.168.192.in-addr.arpa.", "x.1.168.192.in-addr.arpa."} {
+		if got := parseReverseName(name); got != nil {
+			t.Errorf("parseReverseName(%q) = %v, want nil", name, got)
+		}
+	}
+}
@@ -1,42 +1,340 @@
 package probes
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+
+	"github.com/cneate93/vne/internal/procx"
 )
 
+// MTUResult is the largest packet that crosses the path to a target with the
+// don't-fragment bit set, found by a binary search to the exact byte.
 type MTUResult struct {
-	PathMTU int    `json:"path_mtu"`
-	Raw     string `json:"raw"`
+	// PathMTU is the size of the largest IP packet that got through, at most
+	// 1500; zero when the search could not run or the target never replied.
+	PathMTU int `json:"path_mtu"`
+	// Method is "icmp-df" for the native raw-socket search or "ping" when
+	// the system ping command was used.
+	Method string `json:"method,omitempty"`
+	// Limit says what happened to the packets one byte larger than PathMTU:
+	// "frag-needed" when a router sent back ICMP Fragmentation Needed or
+	// Packet Too Big, "local" when the host refused to send them because
+	// they exceed the outgoing interface's MTU, and "blackhole" when they
+	// vanished without an error. It is empty when full-size packets pass.
+	Limit string `json:"limit,omitempty"`
+	// ReportedMTU and ReportedBy come from the last Fragmentation Needed or
+	// Packet Too Big message received.
+	ReportedMTU int    `json:"reported_mtu,omitempty"`
+	ReportedBy  string `json:"reported_by,omitempty"`
+	// Encapsulation names the link or tunnel that commonly leaves PathMTU,
+	// e.g. "PPPoE" or "WireGuard", and Overhead is the bytes lost against a
+	// 1500-byte Ethernet MTU.
+	Encapsulation string `json:"encapsulation,omitempty"`
+	Overhead      int    `json:"overhead,omitempty"`
+	// MSS is the TCP maximum segment size that fits PathMTU, the value to
+	// clamp to when it is below 1500.
+	MSS int `json:"mss,omitempty"`
+	// Probes counts the packets sent.
+	Probes int `json:"probes,omitempty"`
+	// Raw lists every size tried and what came back.
+	Raw string `json:"raw"`
+}
+
+const (
+	// ipv6MinMTU is the smallest link MTU IPv6 allows; every IPv6 path
+	// carries at least this much.
+	ipv6MinMTU = 1280
+	// ipv6EchoHeader is the IPv6 header plus the ICMPv6 echo header.
+	ipv6EchoHeader = 48
+	// ipv4EchoHeader is the IPv4 header plus the ICMP echo header.
+	ipv4EchoHeader = 28
+	// ipv4MinMTU is the datagram size every IPv4 host must accept; the
+	// search starts there to check the target answers at all.
+	ipv4MinMTU = 576
+	// ethernetMTU caps the search: larger paths are not of interest.
+	ethernetMTU = 1500
+)
+
+// pmtuOutcome is what came back for one probe size.
+type pmtuOutcome int
+
+const (
+	pmtuDropped pmtuOutcome = iota
+	pmtuPassed
+	pmtuTooBig
+	pmtuLocal
+)
+
+// pmtuReply is the outcome of one probe size. MTU and From are set for
+// pmtuTooBig when the error carried them.
+type pmtuReply struct {
+	outcome pmtuOutcome
+	mtu     int
+	from    string
+	sent    int
 }
 
-func MTUCheck(target string) (MTUResult, error) {
-	if runtime.GOOS == "windows" {
-		sizes := []int{1472, 1460, 1452, 1400, 1300, 1200}
-		for _, sz := range sizes {
-			out, _ := exec.Command("ping", "-f", "-l", strconv.Itoa(sz), "-n", "2", target).CombinedOutput()
-			txt := strings.ToLower(string(out))
-			if !(strings.Contains(txt, "needs to be fragmented") || strings.Contains(txt, "packet needs to be fragmented")) {
-				return MTUResult{PathMTU: sz + 28, Raw: string(out)}, nil
-			}
+func (r pmtuReply) String() string {
+	switch r.outcome {
+	case pmtuPassed:
+		return "reply"
+	case pmtuTooBig:
+		s := "fragmentation needed"
+		if r.mtu > 0 {
+			s += fmt.Sprintf(" (mtu %d)", r.mtu)
 		}
-		return MTUResult{PathMTU: 0, Raw: "DF tests failed"}, nil
+		if r.from != "" {
+			s += " from " + r.from
+		}
+		return s
+	case pmtuLocal:
+		return "larger than the local interface MTU"
+	}
+	return "no reply"
+}
+
+// pmtuSender sends one probe of the given IP packet size with the
+// don't-fragment bit set, retrying a silent drop, and reports the outcome.
+type pmtuSender func(ctx context.Context, size int) (pmtuReply, error)
+
+// MTUCheck finds the IPv4 path MTU to target by binary search between 576
+// and 1500 bytes with the don't-fragment bit set. On Linux with a raw socket
+// it sends the echo requests itself and reads Fragmentation Needed errors
+// directly; elsewhere it runs the system ping once per size. Cancelling ctx
+// stops the search.
+func MTUCheck(ctx context.Context, target string) (MTUResult, error) {
+	return pathMTU(ctx, target, false)
+}
+
+// MTUCheck6 is MTUCheck over IPv6. Routers never fragment IPv6, so an
+// oversized probe either gets through or comes back as Packet Too Big. The
+// search starts at the 1280-byte IPv6 minimum. Without a raw socket only
+// Linux's ping can forbid local fragmentation, so other platforms report an
+// inconclusive result.
+func MTUCheck6(ctx context.Context, target string) (MTUResult, error) {
+	return pathMTU(ctx, target, true)
+}
+
+func pathMTU(ctx context.Context, target string, v6 bool) (MTUResult, error) {
+	network, floor := "ip4", ipv4MinMTU
+	if v6 {
+		network, floor = "ip6", ipv6MinMTU
+	}
+	addr, err := resolvePingTarget(ctx, network, target)
+	if err != nil {
+		return MTUResult{Raw: err.Error()}, fmt.Errorf("resolve %s: %w", target, err)
+	}
+
+	conn, err := openPMTUSocket(v6)
+	if err == nil {
+		defer conn.Close()
+		res, err := searchPMTU(ctx, icmpPMTUSender(conn, addr, v6), floor, v6)
+		res.Method = "icmp-df"
+		return res, err
+	}
+	send, err := pingPMTUSender(addr.String(), v6)
+	if err != nil {
+		return MTUResult{Raw: err.Error()}, err
 	}
+	res, err := searchPMTU(ctx, send, floor, v6)
+	res.Method = "ping"
+	return res, err
+}
 
-	if runtime.GOOS == "linux" {
-		sizes := []int{1472, 1460, 1452, 1400, 1300, 1200}
-		for _, sz := range sizes {
-			out, _ := exec.Command("ping", "-M", "do", "-s", strconv.Itoa(sz), "-c", "2", target).CombinedOutput()
-			txt := strings.ToLower(string(out))
-			if !(strings.Contains(txt, "message too long") || strings.Contains(txt, "frag needed")) {
-				return MTUResult{PathMTU: sz + 28, Raw: string(out)}, nil
-			}
+// searchPMTU checks that a floor-sized packet gets through, then that a
+// 1500-byte one does, and otherwise bisects between them. A router's
+// reported MTU is tried next when it falls inside the range, which usually
+// ends the search in two more probes; silent drops need the full bisection.
+func searchPMTU(ctx context.Context, send pmtuSender, floor int, v6 bool) (MTUResult, error) {
+	var res MTUResult
+	var raw strings.Builder
+	try := func(size int) (pmtuReply, error) {
+		r, err := send(ctx, size)
+		res.Probes += r.sent
+		if err != nil {
+			fmt.Fprintf(&raw, "%d bytes: %v\n", size, err)
+			return r, err
+		}
+		fmt.Fprintf(&raw, "%d bytes: %s\n", size, r)
+		if r.outcome == pmtuTooBig {
+			res.ReportedMTU, res.ReportedBy = r.mtu, r.from
 		}
-		return MTUResult{PathMTU: 0, Raw: "DF tests failed"}, nil
+		return r, nil
+	}
+	finish := func(err error) (MTUResult, error) {
+		res.Raw = raw.String()
+		return res, err
 	}
 
-	out, _ := exec.Command("ping", "-c", "2", target).CombinedOutput()
-	return MTUResult{PathMTU: 0, Raw: string(out)}, nil
+	r, err := try(floor)
+	if err != nil {
+		return finish(err)
+	}
+	if r.outcome != pmtuPassed {
+		fmt.Fprintf(&raw, "no reply at the minimum size; the target does not answer pings\n")
+		return finish(nil)
+	}
+	good, bad := floor, ethernetMTU
+	last, err := try(bad)
+	if err != nil {
+		return finish(err)
+	}
+	if last.outcome == pmtuPassed {
+		res.PathMTU = bad
+		res.MSS = mssFor(bad, v6)
+		return finish(nil)
+	}
+
+	// A router's reported MTU bounds the search: anything larger fails at
+	// that router, so the reported size is tried next.
+	hint := 0
+	narrow := func(r pmtuReply) {
+		if r.outcome == pmtuTooBig && r.mtu > good && r.mtu < bad {
+			bad, hint = r.mtu+1, r.mtu
+		}
+	}
+	narrow(last)
+	for bad-good > 1 {
+		if err := ctx.Err(); err != nil {
+			return finish(err)
+		}
+		size := (good + bad) / 2
+		if hint > good && hint < bad {
+			size = hint
+		}
+		r, err := try(size)
+		if err != nil {
+			return finish(err)
+		}
+		if r.outcome == pmtuPassed {
+			good = size
+			continue
+		}
+		bad, last = size, r
+		narrow(r)
+	}
+
+	res.PathMTU = good
+	res.Limit = map[pmtuOutcome]string{pmtuTooBig: "frag-needed", pmtuLocal: "local", pmtuDropped: "blackhole"}[last.outcome]
+	res.MSS = mssFor(good, v6)
+	res.Overhead = ethernetMTU - good
+	res.Encapsulation = inferEncapsulation(good, v6)
+	return finish(nil)
+}
+
+// mssFor returns the TCP MSS that fits an IP packet of mtu bytes.
+func mssFor(mtu int, v6 bool) int {
+	if v6 {
+		return mtu - 60
+	}
+	return mtu - 40
+}
+
+// inferEncapsulation names the link or tunnel that usually leaves a path MTU
+// of mtu on a 1500-byte Ethernet network, or returns "" when no common one
+// fits. IPsec overhead depends on the cipher and NAT traversal, so it is
+// matched as a range.
+func inferEncapsulation(mtu int, v6 bool) string {
+	switch mtu {
+	case 1492:
+		return "PPPoE"
+	case 1480:
+		if v6 {
+			return "6in4/6rd tunnel"
+		}
+		return "IP-in-IP tunnel"
+	case 1476:
+		return "GRE"
+	case 1468:
+		return "GRE over PPPoE"
+	case 1460:
+		if v6 {
+			return "6in4 over PPPoE"
+		}
+		return "DS-Lite (IPv4 in IPv6)"
+	case 1450:
+		return "VXLAN"
+	case 1440:
+		return "WireGuard over IPv4"
+	case 1420:
+		return "WireGuard"
+	case 1412:
+		return "WireGuard over PPPoE"
+	}
+	if mtu >= 1350 && mtu <= 1438 {
+		return "IPsec"
+	}
+	return ""
+}
+
+// pingMTUPattern and pingFromPattern pick the reported MTU and the sender out
+// of the error lines of iputils, BSD and Windows ping.
+var (
+	pingMTUPattern  = regexp.MustCompile(`(?i)mtu\s*[=:]?\s*(\d+)`)
+	pingFromPattern = regexp.MustCompile(`(?i)from ([0-9a-f.:]*[0-9a-f])`)
+)
+
+// pingPMTUSender runs the system ping with the don't-fragment bit set,
+// two echo requests per size.
+func pingPMTUSender(target string, v6 bool) (pmtuSender, error) {
+	header := ipv4EchoHeader
+	if v6 {
+		header = ipv6EchoHeader
+	}
+	var args func(payload string) []string
+	switch {
+	case runtime.GOOS == "linux" && v6:
+		args = func(p string) []string { return []string{"-6", "-M", "do", "-s", p, "-c", "2", "-W", "1", target} }
+	case runtime.GOOS == "linux":
+		args = func(p string) []string { return []string{"-4", "-M", "do", "-s", p, "-c", "2", "-W", "1", target} }
+	case v6:
+		return nil, fmt.Errorf("path MTU over IPv6 needs a raw socket or Linux's ping on %s", runtime.GOOS)
+	case runtime.GOOS == "windows":
+		args = func(p string) []string { return []string{"-f", "-l", p, "-n", "2", "-w", "1000", target} }
+	default:
+		args = func(p string) []string { return []string{"-D", "-s", p, "-c", "2", "-W", "1000", target} }
+	}
+	return func(ctx context.Context, size int) (pmtuReply, error) {
+		out, err := procx.CommandContext(ctx, "ping", args(strconv.Itoa(size-header))...).CombinedOutput()
+		if ctx.Err() != nil {
+			return pmtuReply{}, ctx.Err()
+		}
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			return pmtuReply{}, err
+		}
+		r := parsePingDF(string(out))
+		r.sent = 2
+		return r, nil
+	}, nil
+}
+
+// parsePingDF classifies the output of a don't-fragment ping. Errors are
+// checked before replies because BSD ping prints "bytes from" on
+// Fragmentation Needed lines too.
+func parsePingDF(out string) pmtuReply {
+	lower := strings.ToLower(out)
+	switch {
+	case strings.Contains(lower, "message too long"):
+		return pmtuReply{outcome: pmtuLocal}
+	case strings.Contains(lower, "frag needed"), strings.Contains(lower, "packet too big"),
+		strings.Contains(lower, "needs to be fragmented"):
+		r := pmtuReply{outcome: pmtuTooBig}
+		if m := pingMTUPattern.FindStringSubmatch(out); m != nil {
+			r.mtu, _ = strconv.Atoi(m[1])
+		}
+		if m := pingFromPattern.FindStringSubmatch(out); m != nil {
+			r.from = m[1]
+		}
+		return r
+	case strings.Contains(lower, "bytes from"), strings.Contains(lower, "bytes="):
+		return pmtuReply{outcome: pmtuPassed}
+	}
+	return pmtuReply{outcome: pmtuDropped}
 }
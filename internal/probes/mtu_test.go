@@ -0,0 +1,201 @@
+package probes
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakePath answers probes up to mtu bytes and gives over for larger ones.
+// Each probe counts as sent packets.
+type fakePath struct {
+	mtu   int
+	over  pmtuReply
+	sent  int
+	sizes []int
+}
+
+func (p *fakePath) send(_ context.Context, size int) (pmtuReply, error) {
+	p.sizes = append(p.sizes, size)
+	r := p.over
+	if size <= p.mtu {
+		r = pmtuReply{outcome: pmtuPassed}
+	}
+	r.sent = p.sent
+	return r, nil
+}
+
+func TestSearchPMTU(t *testing.T) {
+	tooBig := func(mtu int) pmtuReply { return pmtuReply{outcome: pmtuTooBig, mtu: mtu, from: "192.0.2.1"} }
+	tests := []struct {
+		name string
+		path fakePath
+		v6   bool
+		want MTUResult
+		// sizes, when set, is the exact sequence of sizes tried.
+		sizes []int
+	}{
+		{
+			name:  "full size",
+			path:  fakePath{mtu: 1500, sent: 1},
+			want:  MTUResult{PathMTU: 1500, MSS: 1460, Probes: 2},
+			sizes: []int{576, 1500},
+		},
+		{
+			// The router's hint is tried next and ends the search.
+			name:  "frag-needed with hint",
+			path:  fakePath{mtu: 1492, over: tooBig(1492), sent: 1},
+			want:  MTUResult{PathMTU: 1492, Limit: "frag-needed", ReportedMTU: 1492, ReportedBy: "192.0.2.1", Encapsulation: "PPPoE", Overhead: 8, MSS: 1452, Probes: 3},
+			sizes: []int{576, 1500, 1492},
+		},
+		{
+			name: "frag-needed without hint",
+			path: fakePath{mtu: 1420, over: pmtuReply{outcome: pmtuTooBig, from: "192.0.2.1"}, sent: 1},
+			want: MTUResult{PathMTU: 1420, Limit: "frag-needed", ReportedBy: "192.0.2.1", Encapsulation: "WireGuard", Overhead: 80, MSS: 1380, Probes: 11},
+		},
+		{
+			// Two packets per size, as the ping fallback sends.
+			name: "blackhole",
+			path: fakePath{mtu: 1476, over: pmtuReply{outcome: pmtuDropped}, sent: 2},
+			want: MTUResult{PathMTU: 1476, Limit: "blackhole", Encapsulation: "GRE", Overhead: 24, MSS: 1436, Probes: 24},
+		},
+		{
+			// A hint above the real limit: the hinted size is dropped too,
+			// so the search falls back to bisection and the drop decides.
+			name: "stale hint",
+			path: fakePath{mtu: 1476, over: tooBig(1492), sent: 1},
+			want: MTUResult{PathMTU: 1476, Limit: "frag-needed", ReportedMTU: 1492, ReportedBy: "192.0.2.1", Encapsulation: "GRE", Overhead: 24, MSS: 1436, Probes: 13},
+		},
+		{
+			name: "hint outside the range",
+			path: fakePath{mtu: 1412, over: tooBig(9000), sent: 1},
+			want: MTUResult{PathMTU: 1412, Limit: "frag-needed", ReportedMTU: 9000, ReportedBy: "192.0.2.1", Encapsulation: "WireGuard over PPPoE", Overhead: 88, MSS: 1372, Probes: 12},
+		},
+		{
+			name: "local",
+			path: fakePath{mtu: 1480, over: pmtuReply{outcome: pmtuLocal}, sent: 1},
+			want: MTUResult{PathMTU: 1480, Limit: "local", Encapsulation: "IP-in-IP tunnel", Overhead: 20, MSS: 1440, Probes: 12},
+		},
+		{
+			name: "IPsec range",
+			path: fakePath{mtu: 1400, over: pmtuReply{outcome: pmtuDropped}, sent: 1},
+			want: MTUResult{PathMTU: 1400, Limit: "blackhole", Encapsulation: "IPsec", Overhead: 100, MSS: 1360, Probes: 12},
+		},
+		{
+			name:  "no reply at the floor",
+			path:  fakePath{mtu: 0, over: pmtuReply{outcome: pmtuDropped}, sent: 2},
+			want:  MTUResult{Probes: 2},
+			sizes: []int{576},
+		},
+		{
+			name:  "IPv6 from 1280",
+			path:  fakePath{mtu: 1480, over: tooBig(1480), sent: 1},
+			v6:    true,
+			want:  MTUResult{PathMTU: 1480, Limit: "frag-needed", ReportedMTU: 1480, ReportedBy: "192.0.2.1", Encapsulation: "6in4/6rd tunnel", Overhead: 20, MSS: 1420, Probes: 3},
+			sizes: []int{1280, 1500, 1480},
+		},
+		{
+			name: "IPv6 minimum",
+			path: fakePath{mtu: 1280, over: pmtuReply{outcome: pmtuDropped}, sent: 1},
+			v6:   true,
+			want: MTUResult{PathMTU: 1280, Limit: "blackhole", Overhead: 220, MSS: 1220, Probes: 9},
+		},
+		{
+			name:  "IPv6 no reply at the floor",
+			path:  fakePath{mtu: 1279, over: pmtuReply{outcome: pmtuTooBig, mtu: 1279}, sent: 1},
+			v6:    true,
+			want:  MTUResult{ReportedMTU: 1279, Probes: 1},
+			sizes: []int{1280},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := tt.path
+			floor := ipv4MinMTU
+			if tt.v6 {
+				floor = ipv6MinMTU
+			}
+			got, err := searchPMTU(context.Background(), path.send, floor, tt.v6)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Raw == "" {
+				t.Error("no raw log")
+			}
+			if tt.want.PathMTU == 0 && !strings.Contains(got.Raw, "no reply at the minimum size") {
+				t.Errorf("raw = %q", got.Raw)
+			}
+			got.Raw = ""
+			if got != tt.want {
+				t.Errorf("got  %+v\nwant %+v\nsizes %v", got, tt.want, path.sizes)
+			}
+			if tt.sizes != nil && !slices.Equal(path.sizes, tt.sizes) {
+				t.Errorf("sizes = %v, want %v", path.sizes, tt.sizes)
+			}
+			if len(path.sizes) != len(slicesCompact(path.sizes)) {
+				t.Errorf("a size was tried twice: %v", path.sizes)
+			}
+		})
+	}
+}
+
+func slicesCompact(sizes []int) []int {
+	s := slices.Clone(sizes)
+	slices.Sort(s)
+	return slices.Compact(s)
+}
+
+func TestSearchPMTUErrors(t *testing.T) {
+	boom := errors.New("boom")
+	send := func(ctx context.Context, size int) (pmtuReply, error) {
+		if size == ethernetMTU {
+			return pmtuReply{sent: 1}, boom
+		}
+		return pmtuReply{outcome: pmtuPassed, sent: 1}, nil
+	}
+	res, err := searchPMTU(context.Background(), send, ipv4MinMTU, false)
+	if !errors.Is(err, boom) || res.PathMTU != 0 || res.Probes != 2 {
+		t.Errorf("got %+v, %v", res, err)
+	}
+	if !strings.Contains(res.Raw, "1500 bytes: boom") {
+		t.Errorf("raw = %q", res.Raw)
+	}
+
+	// Cancelling stops the bisection.
+	ctx, cancel := context.WithCancel(context.Background())
+	path := &fakePath{mtu: 1400, over: pmtuReply{outcome: pmtuDropped}, sent: 1}
+	send = func(ctx context.Context, size int) (pmtuReply, error) {
+		if len(path.sizes) == 3 {
+			cancel()
+		}
+		return path.send(ctx, size)
+	}
+	res, err = searchPMTU(ctx, send, ipv4MinMTU, false)
+	if !errors.Is(err, context.Canceled) || len(path.sizes) != 4 {
+		t.Errorf("after cancel: %v, %d sizes tried", err, len(path.sizes))
+	}
+}
+
+func TestParsePingDF(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want pmtuReply
+	}{
+		{"iputils reply", "1480 bytes from 1.1.1.1: icmp_seq=1 ttl=57 time=11.2 ms", pmtuReply{outcome: pmtuPassed}},
+		{"iputils local", "ping: local error: message too long, mtu=1400", pmtuReply{outcome: pmtuLocal}},
+		{"iputils frag needed", "From 192.0.2.1 icmp_seq=1 Frag needed and DF set (mtu = 1492)", pmtuReply{outcome: pmtuTooBig, mtu: 1492, from: "192.0.2.1"}},
+		{"iputils v6", "From 2001:db8::1 icmp_seq=1 Packet too big: mtu=1480", pmtuReply{outcome: pmtuTooBig, mtu: 1480, from: "2001:db8::1"}},
+		{"windows frag", "Packet needs to be fragmented but DF set.", pmtuReply{outcome: pmtuTooBig}},
+		{"windows reply", "Reply from 1.1.1.1: bytes=1472 time=12ms TTL=57", pmtuReply{outcome: pmtuPassed}},
+		{"bsd frag", "36 bytes from 192.0.2.1: frag needed and DF set (MTU 1476)", pmtuReply{outcome: pmtuTooBig, mtu: 1476, from: "192.0.2.1"}},
+		{"timeout", "Request timeout for icmp_seq 0", pmtuReply{outcome: pmtuDropped}},
+	}
+	for _, tt := range tests {
+		if got := parsePingDF(tt.out); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package probes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cneate93/vne/internal/procx"
+)
+
+// NDPScan is the IPv6 counterpart of L2Scan. IPv6 subnets are far too large
+// to sweep, so it pings the all-nodes multicast group (ff02::1) on each
+// active interface with an IPv6 address and then parses the system neighbour
+// cache. Routers are flagged from their cache entries.
+func NDPScan(ctx context.Context, timeout time.Duration) ([]L2Host, error) {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return []L2Host{}, fmt.Errorf("list interfaces: %w", err)
+	}
+
+	for _, iface := range interfaces {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if isLikelyCellularInterface(iface) || !hasIPv6(iface) {
+			continue
+		}
+		zone := iface.Name
+		if runtime.GOOS == "windows" {
+			zone = strconv.Itoa(iface.Index)
+		}
+		name, args := allNodesPing("ff02::1%"+zone, timeout)
+		pingCtx, cancel := context.WithTimeout(ctx, timeout+time.Second)
+		_ = procx.CommandContext(pingCtx, name, args...).Run()
+		cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		out   []byte
+		parse func(string) []L2Host
+	)
+	switch runtime.GOOS {
+	case "windows":
+		out, err = procx.CommandContext(ctx, "netsh", "interface", "ipv6", "show", "neighbors").CombinedOutput()
+		parse = parseNetshNeighbors
+	case "linux":
+		out, err = procx.CommandContext(ctx, "ip", "-6", "neigh", "show").CombinedOutput()
+		parse = parseIPNeigh
+	default:
+		if _, lookErr := exec.LookPath("ndp"); lookErr != nil {
+			return []L2Host{}, fmt.Errorf("ndp command not found: %w", lookErr)
+		}
+		out, err = procx.CommandContext(ctx, "ndp", "-an").CombinedOutput()
+		parse = parseNDP
+	}
+	if err != nil {
+		return []L2Host{}, fmt.Errorf("read neighbour cache: %w", err)
+	}
+	return parse(string(out)), ctx.Err()
+}
+
+func hasIPv6(iface net.Interface) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// allNodesPing returns the command that pings a scoped multicast address.
+func allNodesPing(dst string, timeout time.Duration) (string, []string) {
+	switch runtime.GOOS {
+	case "windows":
+		ms := int(timeout / time.Millisecond)
+		if ms < 1000 {
+			ms = 1000
+		}
+		return "ping", []string{"-6", "-n", "2", "-w", strconv.Itoa(ms), dst}
+	case "linux":
+		sec := int(timeout / time.Second)
+		if sec < 1 {
+			sec = 1
+		}
+		return "ping", []string{"-6", "-c", "2", "-W", strconv.Itoa(sec), dst}
+	default:
+		return "ping6", []string{"-c", "2", dst}
+	}
+}
+
+// parseIPNeigh handles Linux "ip -6 neigh show" output:
+//
+//	fe80::1 dev eth0 lladdr 00:11:22:33:44:55 router REACHABLE
+func parseIPNeigh(output string) []L2Host {
+	var hosts []L2Host
+	seen := map[string]struct{}{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		h := L2Host{IP: fields[0]}
+		for i := 1; i < len(fields); i++ {
+			switch fields[i] {
+			case "dev":
+				if i+1 < len(fields) {
+					h.IfName = fields[i+1]
+				}
+			case "lladdr":
+				if i+1 < len(fields) {
+					h.MAC = fields[i+1]
+				}
+			case "router":
+				h.Router = true
+			case "FAILED", "INCOMPLETE":
+				h.MAC = ""
+			}
+		}
+		addNeighbor(&hosts, seen, h)
+	}
+	return hosts
+}
+
+// parseNDP handles BSD/macOS "ndp -an" output, where the flags column holds
+// R for routers:
+//
+//	Neighbor                Linklayer Address  Netif Expire    St Flgs Prbs
+//	fe80::1%en0             0:11:22:33:44:55     en0 23h59m58s S  R
+func parseNDP(output string) []L2Host {
+	var hosts []L2Host
+	seen := map[string]struct{}{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "Neighbor" {
+			continue
+		}
+		h := L2Host{IP: fields[0], MAC: fields[1], IfName: fields[2]}
+		if len(fields) >= 6 && strings.Contains(fields[5], "R") {
+			h.Router = true
+		}
+		addNeighbor(&hosts, seen, h)
+	}
+	return hosts
+}
+
+// parseNetshNeighbors handles Windows "netsh interface ipv6 show neighbors"
+// output, which groups entries under an interface header:
+//
+//	Interface 12: Ethernet
+//	fe80::1                                       00-11-22-33-44-55  Reachable (Router)
+func parseNetshNeighbors(output string) []L2Host {
+	var hosts []L2Host
+	seen := map[string]struct{}{}
+	iface := ""
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "Interface ") {
+			if _, name, ok := strings.Cut(trimmed, ":"); ok {
+				iface = strings.TrimSpace(name)
+			}
+			continue
+		}
+		fields := strings.Fields(trimmed)
+		if len(fields) < 3 || strings.HasPrefix(fields[2], "Unreachable") {
+			continue
+		}
+		h := L2Host{IfName: iface, IP: fields[0], MAC: fields[1], Router: strings.Contains(trimmed, "(Router)")}
+		addNeighbor(&hosts, seen, h)
+	}
+	return hosts
+}
+
+// addNeighbor appends a neighbour cache entry with a usable unicast address
+// and MAC, dropping the zone from the address.
+func addNeighbor(hosts *[]L2Host, seen map[string]struct{}, h L2Host) {
+	addr, zone, _ := strings.Cut(h.IP, "%")
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() != nil || ip.IsMulticast() || ip.IsUnspecified() {
+		return
+	}
+	mac := normalizeMAC(h.MAC)
+	if mac == "" || strings.HasPrefix(mac, "33:33:") {
+		return
+	}
+	if h.IfName == "" {
+		h.IfName = zone
+	}
+	h.IP, h.MAC, h.Source = ip.String(), mac, "ndp"
+	key := h.IfName + "|" + h.IP + "|" + h.MAC
+	if _, ok := seen[key]; ok {
+		return
+	}
+	seen[key] = struct{}{}
+	if info, ok := VendorFromMAC(mac); ok {
+		h.Vendor = info.Name
+	}
+	*hosts = append(*hosts, h)
+}
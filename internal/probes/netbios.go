@@ -0,0 +1,105 @@
+package probes
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	netbiosPort = 137
+	// nbstatType is the NetBIOS node status query type (RFC 1002, 4.2.17).
+	nbstatType = 0x21
+	// netbiosGroup flags a group name in a node status reply.
+	netbiosGroup = 0x8000
+	// Name suffixes: the workstation service carries the host name and
+	// the server service means the host shares files.
+	netbiosWorkstation = 0x00
+	netbiosServer      = 0x20
+)
+
+// netbiosIdentify sends a NetBIOS node status query to every address, which
+// Windows hosts, Samba servers and many NAS boxes answer with the names
+// they have registered.
+func netbiosIdentify(ctx context.Context, addrs []net.IP, window time.Duration, ids *identities) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	for _, ip := range addrs {
+		_, _ = conn.WriteToUDP(nbstatQuery(uint16(rand.Uint32())), &net.UDPAddr{IP: ip, Port: netbiosPort})
+	}
+	readUDPReplies(ctx, conn, time.Now().Add(window), nil, func(src net.IP, b []byte) {
+		name, server, ok := parseNBStat(b)
+		if !ok {
+			return
+		}
+		ids.hostname(src, name, rankNetBIOS)
+		if server {
+			ids.service(src, "netbios:file-server")
+		}
+	})
+}
+
+// nbstatQuery builds a node status request for the wildcard name "*".
+func nbstatQuery(id uint16) []byte {
+	b := make([]byte, 12, 50)
+	binary.BigEndian.PutUint16(b[0:2], id)
+	binary.BigEndian.PutUint16(b[4:6], 1)
+	b = append(b, 32)
+	// First-level encoding (RFC 1001, 14.1) splits each byte of the name,
+	// padded to 16 bytes with zeros, into two nibbles offset by 'A'.
+	name := [16]byte{'*'}
+	for _, c := range name {
+		b = append(b, 'A'+(c>>4), 'A'+(c&0x0f))
+	}
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, nbstatType)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	return b
+}
+
+// parseNBStat reads a node status reply: the host's unique workstation
+// name, and whether it runs the server service.
+func parseNBStat(b []byte) (name string, server bool, ok bool) {
+	if len(b) < 12 || b[2]&0x80 == 0 || binary.BigEndian.Uint16(b[6:8]) == 0 {
+		return "", false, false
+	}
+	p := b[12:]
+	// The answer repeats the encoded name, or points back at it.
+	switch {
+	case len(p) >= 2 && p[0]&0xc0 == 0xc0:
+		p = p[2:]
+	case len(p) >= 34 && p[0] == 32:
+		p = p[34:]
+	default:
+		return "", false, false
+	}
+	if len(p) < 11 || binary.BigEndian.Uint16(p[0:2]) != nbstatType {
+		return "", false, false
+	}
+	count := int(p[10])
+	p = p[11:]
+	for i := 0; i < count && len(p) >= 18; i++ {
+		entry := strings.TrimRight(string(p[:15]), " \x00")
+		suffix := p[15]
+		flags := binary.BigEndian.Uint16(p[16:18])
+		p = p[18:]
+		if flags&netbiosGroup != 0 {
+			continue
+		}
+		switch suffix {
+		case netbiosWorkstation:
+			if name == "" {
+				name = entry
+			}
+		case netbiosServer:
+			server = true
+		}
+	}
+	return name, server, name != ""
+}
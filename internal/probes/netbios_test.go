@@ -0,0 +1,150 @@
+package probes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+type nbName struct {
+	name   string
+	suffix byte
+	flags  uint16
+}
+
+// nbstatReply builds a node status reply listing names. A compressed reply
+// points back at the query's name instead of repeating it.
+func nbstatReply(compressed bool, rtype uint16, names ...nbName) []byte {
+	b := []byte{0x12, 0x34, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 0}
+	if compressed {
+		b = append(b, 0xc0, 0x0c)
+	} else {
+		b = append(b, nbstatQuery(0)[12:12+34]...)
+	}
+	b = binary.BigEndian.AppendUint16(b, rtype)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	rdata := []byte{byte(len(names))}
+	for _, n := range names {
+		entry := []byte(n.name + "               ")[:15]
+		entry = append(entry, n.suffix)
+		rdata = append(rdata, binary.BigEndian.AppendUint16(entry, n.flags)...)
+	}
+	// The statistics that follow the names: the MAC address and counters.
+	rdata = append(rdata, make([]byte, 46)...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// A Windows workstation that shares files: its names as nbtstat -A lists
+// them.
+var windowsNames = []nbName{
+	{"DESKTOP-7QK2M", netbiosWorkstation, 0x0400},
+	{"WORKGROUP", netbiosWorkstation, 0x8400},
+	{"DESKTOP-7QK2M", netbiosServer, 0x0400},
+	{"WORKGROUP", 0x1e, 0x8400},
+}
+
+func TestNBStatQuery(t *testing.T) {
+	q := nbstatQuery(0xbeef)
+	want := []byte{0xbe, 0xef, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 32, 'C', 'K'}
+	want = append(want, bytes.Repeat([]byte("AA"), 15)...)
+	want = append(want, 0, 0, nbstatType, 0, 1)
+	if !bytes.Equal(q, want) {
+		t.Errorf("nbstatQuery =\n% x\nwant\n% x", q, want)
+	}
+}
+
+func TestParseNBStat(t *testing.T) {
+	tests := []struct {
+		name       string
+		b          []byte
+		wantName   string
+		wantServer bool
+		wantOK     bool
+	}{
+		{
+			name:       "file server",
+			b:          nbstatReply(false, nbstatType, windowsNames...),
+			wantName:   "DESKTOP-7QK2M",
+			wantServer: true,
+			wantOK:     true,
+		},
+		{
+			name:       "compressed name",
+			b:          nbstatReply(true, nbstatType, windowsNames...),
+			wantName:   "DESKTOP-7QK2M",
+			wantServer: true,
+			wantOK:     true,
+		},
+		{
+			name:     "group name first",
+			b:        nbstatReply(false, nbstatType, windowsNames[1], windowsNames[0]),
+			wantName: "DESKTOP-7QK2M",
+			wantOK:   true,
+		},
+		{
+			name:     "first workstation name wins",
+			b:        nbstatReply(false, nbstatType, nbName{"NAS", 0, 0}, nbName{"NAS-ALIAS", 0, 0}),
+			wantName: "NAS",
+			wantOK:   true,
+		},
+		{
+			// Only the server service: there is no name to report.
+			name:       "no workstation name",
+			b:          nbstatReply(false, nbstatType, windowsNames[1], windowsNames[2]),
+			wantServer: true,
+		},
+		{
+			name: "no names",
+			b:    nbstatReply(false, nbstatType),
+		},
+		{
+			name: "wrong type",
+			b:    nbstatReply(false, 0x20, windowsNames...),
+		},
+		{
+			name: "query",
+			b:    nbstatQuery(1),
+		},
+		{
+			name: "no answers",
+			b:    []byte{0x12, 0x34, 0x84, 0x00, 0, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "bad name",
+			b:    append([]byte{0x12, 0x34, 0x84, 0x00, 0, 0, 0, 1, 0, 0, 0, 0, 16}, make([]byte, 60)...),
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		name, server, ok := parseNBStat(tt.b)
+		if name != tt.wantName || server != tt.wantServer || ok != tt.wantOK {
+			t.Errorf("%s: got %q, %v, %v; want %q, %v, %v", tt.name, name, server, ok, tt.wantName, tt.wantServer, tt.wantOK)
+		}
+	}
+}
+
+func TestParseNBStatTruncated(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		b := nbstatReply(compressed, nbstatType, windowsNames...)
+		// The names start after the header, answer name, type, class, TTL,
+		// length and count.
+		names := 12 + 34 + 11
+		if compressed {
+			names = 12 + 2 + 11
+		}
+		for n := range len(b) {
+			name, server, ok := parseNBStat(b[:n])
+			// A reply cut short still yields the entries that arrived
+			// whole.
+			wantOK := n >= names+18
+			wantServer := n >= names+3*18
+			if ok != wantOK || server != wantServer || (ok && name != "DESKTOP-7QK2M") {
+				t.Errorf("compressed %v, %d of %d bytes: got %q, %v, %v", compressed, n, len(b), name, server, ok)
+			}
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package probes
 
 import (
+	"math"
 	"net"
-	"os/exec"
 	"regexp"
-	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -13,14 +13,122 @@ type NetInfo struct {
 	Interfaces     []IF     `json:"interfaces"`
 	Gateways       []string `json:"gateways"`
 	DefaultGateway string   `json:"default_gateway"`
-	DNSServers     []string `json:"dns_servers"`
+	// Gateways6 are the IPv6 default routers. Link-local addresses carry
+	// their zone, e.g. "fe80::1%eth0".
+	Gateways6       []string `json:"gateways6,omitempty"`
+	DefaultGateway6 string   `json:"default_gateway6,omitempty"`
+	DNSServers      []string `json:"dns_servers"`
+	// DNSSearch and DNSOptions come from resolv.conf, e.g. ["corp.example"]
+	// and ["ndots:5", "timeout:2"].
+	DNSSearch  []string `json:"dns_search,omitempty"`
+	DNSOptions []string `json:"dns_options,omitempty"`
+	// Routes is the routing table, including policy routing tables, where
+	// the platform exposes it (Linux).
+	Routes []Route `json:"routes,omitempty"`
 }
 
+// IF is a network interface. The link and counter fields are filled in where
+// the platform exposes them (Linux, from /sys/class/net).
 type IF struct {
 	Name string   `json:"name"`
 	IPs  []string `json:"ips"`
 	Mac  string   `json:"mac"`
 	Up   bool     `json:"up"`
+	MTU  int      `json:"mtu,omitempty"`
+	// SpeedMbps is the negotiated link speed; 0 when unknown or down.
+	SpeedMbps int    `json:"speed_mbps,omitempty"`
+	Duplex    string `json:"duplex,omitempty"`
+	// Carrier reports whether the link is physically up; nil when unknown.
+	Carrier   *bool    `json:"carrier,omitempty"`
+	OperState string   `json:"oper_state,omitempty"`
+	Stats     *IFStats `json:"stats,omitempty"`
+}
+
+// NoCarrier reports whether the interface is known to have no link.
+func (i IF) NoCarrier() bool {
+	return i.Carrier != nil && !*i.Carrier
+}
+
+// IFStats are an interface's lifetime counters. RxErrors and TxErrors include
+// the more specific CRC, frame and carrier error counts.
+type IFStats struct {
+	RxBytes         uint64 `json:"rx_bytes"`
+	TxBytes         uint64 `json:"tx_bytes"`
+	RxPackets       uint64 `json:"rx_packets"`
+	TxPackets       uint64 `json:"tx_packets"`
+	RxErrors        uint64 `json:"rx_errors"`
+	TxErrors        uint64 `json:"tx_errors"`
+	RxDropped       uint64 `json:"rx_dropped"`
+	TxDropped       uint64 `json:"tx_dropped"`
+	RxCRCErrors     uint64 `json:"rx_crc_errors"`
+	RxFrameErrors   uint64 `json:"rx_frame_errors"`
+	TxCarrierErrors uint64 `json:"tx_carrier_errors"`
+	Collisions      uint64 `json:"collisions"`
+}
+
+// Sub returns how much each counter grew since before. The counters are
+// only 32 bits wide on 32-bit Linux, so a 32-bit value that fell by more
+// than half that range is taken to have wrapped. Any other counter that went
+// backwards, e.g. because the driver reset it, counts as no growth.
+func (s IFStats) Sub(before IFStats) IFStats {
+	grew := func(now, then uint64) uint64 {
+		switch {
+		case now >= then:
+			return now - then
+		case then <= math.MaxUint32 && then-now > math.MaxUint32/2:
+			return now + (math.MaxUint32 - then) + 1
+		}
+		return 0
+	}
+	return IFStats{
+		RxBytes:         grew(s.RxBytes, before.RxBytes),
+		TxBytes:         grew(s.TxBytes, before.TxBytes),
+		RxPackets:       grew(s.RxPackets, before.RxPackets),
+		TxPackets:       grew(s.TxPackets, before.TxPackets),
+		RxErrors:        grew(s.RxErrors, before.RxErrors),
+		TxErrors:        grew(s.TxErrors, before.TxErrors),
+		RxDropped:       grew(s.RxDropped, before.RxDropped),
+		TxDropped:       grew(s.TxDropped, before.TxDropped),
+		RxCRCErrors:     grew(s.RxCRCErrors, before.RxCRCErrors),
+		RxFrameErrors:   grew(s.RxFrameErrors, before.RxFrameErrors),
+		TxCarrierErrors: grew(s.TxCarrierErrors, before.TxCarrierErrors),
+		Collisions:      grew(s.Collisions, before.Collisions),
+	}
+}
+
+// Route is one routing table entry.
+type Route struct {
+	// Table is the routing table ID; 254 is the main table.
+	Table int `json:"table"`
+	// Destination is a CIDR prefix; the default route is 0.0.0.0/0 or ::/0.
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	Iface       string `json:"iface,omitempty"`
+	Metric      int    `json:"metric"`
+}
+
+const (
+	routeTableDefault = 253
+	routeTableMain    = 254
+	routeTableLocal   = 255
+)
+
+// TableName returns the name "ip route" uses for the route's table.
+func (r Route) TableName() string {
+	switch r.Table {
+	case routeTableDefault:
+		return "default"
+	case routeTableMain:
+		return "main"
+	case routeTableLocal:
+		return "local"
+	}
+	return strconv.Itoa(r.Table)
+}
+
+// IsDefault reports whether the route is an IPv4 or IPv6 default route.
+func (r Route) IsDefault() bool {
+	return r.Destination == "0.0.0.0/0" || r.Destination == "::/0"
 }
 
 // VPNAdapterNames returns the set of active interfaces that appear to be
@@ -41,11 +149,44 @@ func (ni NetInfo) VPNAdapterNames() []string {
 	return matches
 }
 
+// GlobalIPv6 returns the global unicast IPv6 addresses of the active
+// interfaces. Unique local (fc00::/7) addresses are left out since they do
+// not reach the internet.
+func (ni NetInfo) GlobalIPv6() []string {
+	var out []string
+	for _, iface := range ni.Interfaces {
+		if !iface.Up {
+			continue
+		}
+		for _, cidr := range iface.IPs {
+			ip, _, err := net.ParseCIDR(cidr)
+			if err != nil {
+				ip = net.ParseIP(cidr)
+			}
+			if ip == nil || ip.To4() != nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				continue
+			}
+			out = append(out, ip.String())
+		}
+	}
+	return out
+}
+
+// GetBasics collects the host name, interfaces, DNS settings and default
+// gateways.
 func GetBasics() (NetInfo, error) {
-	var ni NetInfo
-	hn, _ := execLook("hostname")
-	ni.HostName = hn
+	return getBasics()
+}
+
+// InterfaceStats reads the current counters of every interface, keyed by
+// interface name. Counters are only available on Linux.
+func InterfaceStats() (map[string]IFStats, error) {
+	return interfaceStats()
+}
 
+// listInterfaces returns every interface with its addresses and MTU.
+func listInterfaces() []IF {
+	var out []IF
 	ifs, _ := net.Interfaces()
 	for _, it := range ifs {
 		addrs, _ := it.Addrs()
@@ -53,104 +194,43 @@ func GetBasics() (NetInfo, error) {
 		for _, a := range addrs {
 			ips = append(ips, a.String())
 		}
-		ni.Interfaces = append(ni.Interfaces, IF{
+		out = append(out, IF{
 			Name: it.Name, IPs: ips, Mac: it.HardwareAddr.String(),
-			Up: it.Flags&net.FlagUp != 0,
+			Up: it.Flags&net.FlagUp != 0, MTU: it.MTU,
 		})
 	}
-
-	ni.DNSServers = readResolvConf()
-
-	gws := guessGateways()
-	ni.Gateways = gws
-	if len(gws) > 0 {
-		ni.DefaultGateway = gws[0]
-	}
-	return ni, nil
+	return out
 }
 
-func readResolvConf() []string {
-	if runtime.GOOS == "windows" {
-		out, _ := exec.Command("ipconfig", "/all").CombinedOutput()
-		lines := strings.Split(string(out), "\n")
-		var dns []string
-		capturing := false
-		for _, l := range lines {
-			ll := strings.TrimSpace(l)
-			lc := strings.ToLower(ll)
-			if strings.HasPrefix(lc, "dns servers") {
-				capturing = true
-				parts := strings.Split(ll, ":")
-				if len(parts) > 1 {
-					d := strings.TrimSpace(parts[1])
-					if d != "" {
-						dns = append(dns, d)
-					}
-				}
-				continue
-			}
-			if capturing {
-				// subsequent lines often list more servers until a blank or new section
-				if ll == "" || strings.Contains(ll, ":") {
-					capturing = false
-					continue
-				}
-				if strings.Count(ll, ".") >= 1 {
-					dns = append(dns, ll)
-				}
-			}
+// parseResolvConf reads the nameservers, search domains and options from
+// resolv.conf content. As in glibc, the last "search" or "domain" line
+// sets the search list.
+func parseResolvConf(content string) (servers, search, options []string) {
+	for _, l := range strings.Split(content, "\n") {
+		fields := strings.Fields(l)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], ";") {
+			continue
 		}
-		return dns
-	}
-	// Unix-like: parse /etc/resolv.conf via cat (portable)
-	b, err := exec.Command("cat", "/etc/resolv.conf").CombinedOutput()
-	if err != nil {
-		return nil
-	}
-	var dns []string
-	for _, l := range strings.Split(string(b), "\n") {
-		l = strings.TrimSpace(l)
-		if strings.HasPrefix(l, "nameserver") {
-			fields := strings.Fields(l)
-			if len(fields) >= 2 {
-				dns = append(dns, fields[1])
-			}
+		switch fields[0] {
+		case "nameserver":
+			servers = append(servers, fields[1])
+		case "search":
+			search = append([]string(nil), fields[1:]...)
+		case "domain":
+			search = []string{fields[1]}
+		case "options":
+			options = append(options, fields[1:]...)
 		}
 	}
-	return dns
+	return servers, search, options
 }
 
-func guessGateways() []string {
-	if runtime.GOOS == "windows" {
-		out, _ := exec.Command("route", "print", "0.0.0.0").CombinedOutput()
-		// Best-effort parse: look for lines like "0.0.0.0 ... <gateway> ..."
-		var gws []string
-		for _, l := range strings.Split(string(out), "\n") {
-			ll := strings.Fields(strings.TrimSpace(l))
-			if len(ll) >= 4 && ll[0] == "0.0.0.0" && ll[1] == "0.0.0.0" {
-				gws = append(gws, ll[2])
-			}
-		}
-		return gws
+// scopedGateway adds the zone to a link-local gateway address, which cannot
+// be reached without it.
+func scopedGateway(addr, zone string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil || !ip.IsLinkLocalUnicast() || zone == "" {
+		return addr
 	}
-	out, _ := exec.Command("ip", "route").CombinedOutput()
-	if len(out) == 0 {
-		out, _ = exec.Command("route", "-n").CombinedOutput()
-	}
-	var gws []string
-	for _, l := range strings.Split(string(out), "\n") {
-		ll := strings.TrimSpace(l)
-		if strings.HasPrefix(ll, "default via") {
-			parts := strings.Fields(ll) // default via X dev Y
-			if len(parts) >= 3 {
-				gws = append(gws, parts[2])
-			}
-		}
-	}
-	return gws
-}
-
-func execLook(cmd string) (string, error) {
-	b, err := exec.Command(cmd).CombinedOutput()
-	return strings.TrimSpace(string(b)), err
+	return addr + "%" + zone
 }
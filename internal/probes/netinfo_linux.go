@@ -0,0 +1,159 @@
+package probes
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysClassNet is where the kernel exposes per-interface link state and
+// counters.
+const sysClassNet = "/sys/class/net"
+
+// getBasics reads the network info straight from the kernel: routes over
+// netlink (or /proc/net/route and /proc/net/ipv6_route when netlink is not
+// available), link state and counters from /sys/class/net and the resolver
+// settings from /etc/resolv.conf.
+func getBasics() (NetInfo, error) {
+	var ni NetInfo
+	ni.HostName, _ = os.Hostname()
+	ni.Interfaces = listInterfaces()
+	for i := range ni.Interfaces {
+		readSysfsLink(&ni.Interfaces[i])
+	}
+
+	if b, err := os.ReadFile("/etc/resolv.conf"); err == nil {
+		ni.DNSServers, ni.DNSSearch, ni.DNSOptions = parseResolvConf(string(b))
+	}
+
+	routes, err := netlinkRoutes()
+	if err != nil {
+		routes = procRoutes()
+	}
+	ni.Routes = routes
+	ni.Gateways = defaultGateways(routes, false)
+	if len(ni.Gateways) > 0 {
+		ni.DefaultGateway = ni.Gateways[0]
+	}
+	ni.Gateways6 = defaultGateways(routes, true)
+	if len(ni.Gateways6) > 0 {
+		ni.DefaultGateway6 = ni.Gateways6[0]
+	}
+	return ni, nil
+}
+
+// readSysfsLink fills in the link settings and counters of iface from
+// /sys/class/net. Attributes a driver does not support are left unset.
+func readSysfsLink(iface *IF) {
+	dir := filepath.Join(sysClassNet, iface.Name)
+	if mtu, ok := readSysfsInt(dir, "mtu"); ok {
+		iface.MTU = int(mtu)
+	}
+	// speed reads as -1 or fails with EINVAL while the link is down.
+	if speed, ok := readSysfsInt(dir, "speed"); ok && speed > 0 {
+		iface.SpeedMbps = int(speed)
+	}
+	if duplex := readSysfsString(dir, "duplex"); duplex != "" && duplex != "unknown" {
+		iface.Duplex = duplex
+	}
+	if carrier, ok := readSysfsInt(dir, "carrier"); ok {
+		up := carrier == 1
+		iface.Carrier = &up
+	}
+	iface.OperState = readSysfsString(dir, "operstate")
+
+	if stats, ok := readSysfsStats(dir); ok {
+		iface.Stats = &stats
+	}
+}
+
+func interfaceStats() (map[string]IFStats, error) {
+	entries, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]IFStats, len(entries))
+	for _, e := range entries {
+		if stats, ok := readSysfsStats(filepath.Join(sysClassNet, e.Name())); ok {
+			out[e.Name()] = stats
+		}
+	}
+	return out, nil
+}
+
+// readSysfsStats reads the counters under an interface's statistics
+// directory.
+func readSysfsStats(dir string) (IFStats, bool) {
+	stats := filepath.Join(dir, "statistics")
+	if _, err := os.Stat(stats); err != nil {
+		return IFStats{}, false
+	}
+	counter := func(name string) uint64 {
+		v, _ := readSysfsInt(stats, name)
+		return uint64(v)
+	}
+	return IFStats{
+		RxBytes:         counter("rx_bytes"),
+		TxBytes:         counter("tx_bytes"),
+		RxPackets:       counter("rx_packets"),
+		TxPackets:       counter("tx_packets"),
+		RxErrors:        counter("rx_errors"),
+		TxErrors:        counter("tx_errors"),
+		RxDropped:       counter("rx_dropped"),
+		TxDropped:       counter("tx_dropped"),
+		RxCRCErrors:     counter("rx_crc_errors"),
+		RxFrameErrors:   counter("rx_frame_errors"),
+		TxCarrierErrors: counter("tx_carrier_errors"),
+		Collisions:      counter("collisions"),
+	}, true
+}
+
+func readSysfsString(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readSysfsInt(dir, name string) (int64, bool) {
+	s := readSysfsString(dir, name)
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+// defaultGateways returns the gateways of the main table's default routes
+// for one address family, lowest metric first. IPv6 link-local gateways get
+// their interface as zone.
+func defaultGateways(routes []Route, v6 bool) []string {
+	var defaults []Route
+	for _, r := range routes {
+		if r.Table != routeTableMain || !r.IsDefault() || r.Gateway == "" {
+			continue
+		}
+		if (r.Destination == "::/0") != v6 {
+			continue
+		}
+		defaults = append(defaults, r)
+	}
+	sort.SliceStable(defaults, func(i, j int) bool { return defaults[i].Metric < defaults[j].Metric })
+
+	var gws []string
+	seen := map[string]bool{}
+	for _, r := range defaults {
+		gw := r.Gateway
+		if v6 {
+			gw = scopedGateway(gw, r.Iface)
+		}
+		if !seen[gw] {
+			seen[gw] = true
+			gws = append(gws, gw)
+		}
+	}
+	return gws
+}
@@ -0,0 +1,43 @@
+package probes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDefaultGateways(t *testing.T) {
+	routes := []Route{
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Gateway: "192.168.1.1", Iface: "wlan0", Metric: 600},
+		{Table: routeTableMain, Destination: "10.0.0.0/8", Gateway: "10.8.0.1", Iface: "tun0"},
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Gateway: "10.0.0.1", Iface: "eth0", Metric: 100},
+		// A policy table, as VPN clients and Tailscale add, is not the
+		// host's default.
+		{Table: 52, Destination: "0.0.0.0/0", Gateway: "100.64.0.1", Iface: "tailscale0"},
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Iface: "wg0", Metric: 50},
+		// The same gateway reached twice is listed once.
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Gateway: "10.0.0.1", Iface: "eth0", Metric: 1024},
+		{Table: routeTableMain, Destination: "::/0", Gateway: "fe80::1", Iface: "wlan0", Metric: 600},
+		{Table: routeTableMain, Destination: "::/0", Gateway: "fe80::1", Iface: "eth0", Metric: 100},
+		{Table: routeTableMain, Destination: "::/0", Gateway: "2001:db8::1", Iface: "eth0", Metric: 1024},
+		{Table: routeTableLocal, Destination: "::/0", Gateway: "fe80::2", Iface: "eth0"},
+		{Table: routeTableMain, Destination: "2000::/3", Gateway: "fe80::3", Iface: "eth0"},
+	}
+	if got, want := defaultGateways(routes, false), []string{"10.0.0.1", "192.168.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv4 gateways = %q, want %q", got, want)
+	}
+	// The same link-local gateway on two interfaces is two gateways.
+	if got, want := defaultGateways(routes, true), []string{"fe80::1%eth0", "fe80::1%wlan0", "2001:db8::1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("IPv6 gateways = %q, want %q", got, want)
+	}
+	// Equal metrics keep the kernel's order.
+	tie := []Route{
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Gateway: "10.0.0.2", Metric: 100},
+		{Table: routeTableMain, Destination: "0.0.0.0/0", Gateway: "10.0.0.1", Metric: 100},
+	}
+	if got, want := defaultGateways(tie, false), []string{"10.0.0.2", "10.0.0.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tied gateways = %q, want %q", got, want)
+	}
+	if got := defaultGateways(nil, false); got != nil {
+		t.Errorf("no routes: %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+//go:build !linux
+
+package probes
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// getBasics gathers the network info from the platform's command-line tools.
+func getBasics() (NetInfo, error) {
+	var ni NetInfo
+	hn, _ := execLook("hostname")
+	ni.HostName = hn
+	ni.Interfaces = listInterfaces()
+
+	ni.DNSServers, ni.DNSSearch, ni.DNSOptions = readResolvConf()
+
+	gws := guessGateways()
+	ni.Gateways = gws
+	if len(gws) > 0 {
+		ni.DefaultGateway = gws[0]
+	}
+	gws6 := guessGateways6()
+	ni.Gateways6 = gws6
+	if len(gws6) > 0 {
+		ni.DefaultGateway6 = gws6[0]
+	}
+	return ni, nil
+}
+
+func readResolvConf() (servers, search, options []string) {
+	if runtime.GOOS == "windows" {
+		out, _ := exec.Command("ipconfig", "/all").CombinedOutput()
+		lines := strings.Split(string(out), "\n")
+		var dns []string
+		capturing := false
+		for _, l := range lines {
+			ll := strings.TrimSpace(l)
+			lc := strings.ToLower(ll)
+			if strings.HasPrefix(lc, "dns servers") {
+				capturing = true
+				parts := strings.Split(ll, ":")
+				if len(parts) > 1 {
+					d := strings.TrimSpace(parts[1])
+					if d != "" {
+						dns = append(dns, d)
+					}
+				}
+				continue
+			}
+			if capturing {
+				// subsequent lines often list more servers until a blank or new section
+				if ll == "" || strings.Contains(ll, ":") {
+					capturing = false
+					continue
+				}
+				if strings.Count(ll, ".") >= 1 {
+					dns = append(dns, ll)
+				}
+			}
+		}
+		return dns, nil, nil
+	}
+	b, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, nil, nil
+	}
+	return parseResolvConf(string(b))
+}
+
+func guessGateways() []string {
+	if runtime.GOOS == "windows" {
+		out, _ := exec.Command("route", "print", "0.0.0.0").CombinedOutput()
+		// Best-effort parse: look for lines like "0.0.0.0 ... <gateway> ..."
+		var gws []string
+		for _, l := range strings.Split(string(out), "\n") {
+			ll := strings.Fields(strings.TrimSpace(l))
+			if len(ll) >= 4 && ll[0] == "0.0.0.0" && ll[1] == "0.0.0.0" {
+				gws = append(gws, ll[2])
+			}
+		}
+		return gws
+	}
+	out, _ := exec.Command("ip", "route").CombinedOutput()
+	if len(out) == 0 {
+		out, _ = exec.Command("route", "-n").CombinedOutput()
+	}
+	var gws []string
+	for _, l := range strings.Split(string(out), "\n") {
+		ll := strings.TrimSpace(l)
+		if strings.HasPrefix(ll, "default via") {
+			parts := strings.Fields(ll) // default via X dev Y
+			if len(parts) >= 3 {
+				gws = append(gws, parts[2])
+			}
+		}
+	}
+	return gws
+}
+
+// guessGateways6 lists the IPv6 default routers from the routing table.
+func guessGateways6() []string {
+	var gws []string
+	switch runtime.GOOS {
+	case "windows":
+		// "route print -6" lists "If Metric Network Destination Gateway";
+		// a link-local gateway is scoped by the interface index.
+		out, _ := exec.Command("route", "print", "-6", "::/0").CombinedOutput()
+		for _, l := range strings.Split(string(out), "\n") {
+			ll := strings.Fields(strings.TrimSpace(l))
+			if len(ll) >= 4 && ll[2] == "::/0" && ll[3] != "On-link" {
+				gws = append(gws, scopedGateway(ll[3], ll[0]))
+			}
+		}
+	default:
+		// BSD netstat: "default fe80::1%en0 UGcg en0"
+		out, _ := exec.Command("netstat", "-rn", "-f", "inet6").CombinedOutput()
+		for _, l := range strings.Split(string(out), "\n") {
+			ll := strings.Fields(strings.TrimSpace(l))
+			if len(ll) >= 2 && ll[0] == "default" && net.ParseIP(strings.SplitN(ll[1], "%", 2)[0]) != nil {
+				gws = append(gws, ll[1])
+			}
+		}
+	}
+	return gws
+}
+
+func interfaceStats() (map[string]IFStats, error) {
+	return nil, errors.New("interface counters are not available on " + runtime.GOOS)
+}
+
+func execLook(cmd string) (string, error) {
+	b, err := exec.Command(cmd).CombinedOutput()
+	return strings.TrimSpace(string(b)), err
+}
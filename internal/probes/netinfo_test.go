@@ -0,0 +1,115 @@
+package probes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestIFStatsSub(t *testing.T) {
+	tests := []struct {
+		name      string
+		then, now uint64
+		want      uint64
+	}{
+		{"unchanged", 42, 42, 0},
+		{"grew", 42, 50, 8},
+		{"64-bit", 1 << 40, 1<<40 + 5, 5},
+		{"32-bit wrap", math.MaxUint32 - 2, 4, 7},
+		{"wrap to zero", math.MaxUint32, 0, 1},
+		// A drop of less than half the 32-bit range is a reset.
+		{"reset", 3_000_000_000, 1_000_000_000, 0},
+		{"reset to zero", 1000, 0, 0},
+		{"reset of a 64-bit value", math.MaxUint32 + 10, 3, 0},
+	}
+	for _, tt := range tests {
+		got := IFStats{RxErrors: tt.now, Collisions: tt.now}.Sub(IFStats{RxErrors: tt.then, Collisions: tt.then})
+		if got.RxErrors != tt.want || got.Collisions != tt.want || got.TxBytes != 0 {
+			t.Errorf("%s: %d → %d grew %+v, want %d", tt.name, tt.then, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	tests := []struct {
+		name                     string
+		content                  string
+		servers, search, options []string
+	}{
+		{
+			name: "systemd-resolved stub",
+			content: "# This is /run/systemd/resolve/stub-resolv.conf managed by man:systemd-resolved(8).\n" +
+				"nameserver 127.0.0.53\n" +
+				"options edns0 trust-ad\n" +
+				"search corp.example.com lab.example.com\n",
+			servers: []string{"127.0.0.53"},
+			search:  []string{"corp.example.com", "lab.example.com"},
+			options: []string{"edns0", "trust-ad"},
+		},
+		{
+			name: "several servers and options lines",
+			content: "nameserver 10.0.0.2\n" +
+				"nameserver fe80::1%eth0\n" +
+				"  nameserver\t10.0.0.3  \n" +
+				"options timeout:2\n" +
+				"options attempts:3 rotate\n",
+			servers: []string{"10.0.0.2", "fe80::1%eth0", "10.0.0.3"},
+			options: []string{"timeout:2", "attempts:3", "rotate"},
+		},
+		{
+			name:    "domain",
+			content: "domain example.com\nnameserver 192.168.1.1\n",
+			servers: []string{"192.168.1.1"},
+			search:  []string{"example.com"},
+		},
+		{
+			name:    "search before domain",
+			content: "search a.example b.example\ndomain example.com\n",
+			search:  []string{"example.com"},
+		},
+		{
+			name:    "domain before search",
+			content: "domain example.com\nsearch a.example\n",
+			search:  []string{"a.example"},
+		},
+		{
+			name:    "last search wins",
+			content: "search a.example\nsearch b.example c.example\n",
+			search:  []string{"b.example", "c.example"},
+		},
+		{
+			name: "comments and junk",
+			content: "# nameserver 1.1.1.1\n" +
+				"; nameserver 8.8.8.8\n" +
+				"#search old.example\n" +
+				"nameserver\n" +
+				"search\n" +
+				"sortlist 130.155.160.0/255.255.240.0\n" +
+				"nameserver 9.9.9.9\r\n",
+			servers: []string{"9.9.9.9"},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, tt := range tests {
+		servers, search, options := parseResolvConf(tt.content)
+		if !reflect.DeepEqual(servers, tt.servers) || !reflect.DeepEqual(search, tt.search) || !reflect.DeepEqual(options, tt.options) {
+			t.Errorf("%s: got %q, %q, %q; want %q, %q, %q", tt.name, servers, search, options, tt.servers, tt.search, tt.options)
+		}
+	}
+}
+
+func TestScopedGateway(t *testing.T) {
+	for _, tt := range []struct{ addr, zone, want string }{
+		{"fe80::1", "eth0", "fe80::1%eth0"},
+		{"fe80::1", "", "fe80::1"},
+		{"2001:db8::1", "eth0", "2001:db8::1"},
+		{"192.168.1.1", "eth0", "192.168.1.1"},
+		{"", "eth0", ""},
+	} {
+		if got := scopedGateway(tt.addr, tt.zone); got != tt.want {
+			t.Errorf("scopedGateway(%q, %q) = %q, want %q", tt.addr, tt.zone, got, tt.want)
+		}
+	}
+}
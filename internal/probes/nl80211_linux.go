@@ -0,0 +1,401 @@
+package probes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Generic netlink and nl80211 constants, from linux/genetlink.h and
+// linux/nl80211.h.
+const (
+	genlIDCtrl          = 0x10
+	ctrlCmdGetFamily    = 3
+	ctrlAttrFamilyID    = 1
+	ctrlAttrFamilyName  = 2
+	nlaTypeMask         = 0x3fff
+	nl80211CmdGetIface  = 5
+	nl80211CmdGetSta    = 17
+	nl80211CmdGetScan   = 32
+	nl80211CmdGetSurvey = 50
+
+	nl80211AttrIfindex    = 3
+	nl80211AttrIfname     = 4
+	nl80211AttrIftype     = 5
+	nl80211AttrMAC        = 6
+	nl80211AttrStaInfo    = 21
+	nl80211AttrWiphyFreq  = 38
+	nl80211AttrBSS        = 47
+	nl80211AttrSSID       = 52
+	nl80211AttrSurveyInfo = 84
+
+	nl80211IftypeStation = 2
+
+	nl80211StaInfoSignal    = 7
+	nl80211StaInfoTxBitrate = 8
+	nl80211StaInfoTxPackets = 10
+	nl80211StaInfoTxRetries = 11
+	nl80211StaInfoTxFailed  = 12
+
+	nl80211RateInfoBitrate   = 1
+	nl80211RateInfoBitrate32 = 5
+
+	nl80211BSSBSSID     = 1
+	nl80211BSSFrequency = 2
+	nl80211BSSIEs       = 6
+	nl80211BSSStatus    = 9
+
+	nl80211BSSStatusAssociated = 1
+
+	nl80211SurveyFrequency = 1
+	nl80211SurveyNoise     = 2
+	nl80211SurveyInUse     = 3
+	nl80211SurveyTime      = 4
+	nl80211SurveyTimeBusy  = 5
+)
+
+// genlConn is a generic netlink socket.
+type genlConn struct {
+	fd  int
+	seq uint32
+}
+
+func dialGenl(timeout time.Duration) (*genlConn, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_GENERIC)
+	if err != nil {
+		return nil, fmt.Errorf("generic netlink socket: %w", err)
+	}
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("bind generic netlink socket: %w", err)
+	}
+	return &genlConn{fd: fd}, nil
+}
+
+func (c *genlConn) Close() error {
+	return syscall.Close(c.fd)
+}
+
+// request sends one generic netlink command and returns the attribute
+// payload of each reply: every message up to NLMSG_DONE for a dump, the
+// first one otherwise.
+func (c *genlConn) request(family uint16, cmd uint8, dump bool, attrs []byte) ([][]byte, error) {
+	c.seq++
+	flags := uint16(syscall.NLM_F_REQUEST)
+	if dump {
+		flags |= syscall.NLM_F_DUMP
+	}
+	msg := make([]byte, syscall.NLMSG_HDRLEN+4, syscall.NLMSG_HDRLEN+4+len(attrs))
+	msg = append(msg, attrs...)
+	binary.NativeEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.NativeEndian.PutUint16(msg[4:], family)
+	binary.NativeEndian.PutUint16(msg[6:], flags)
+	binary.NativeEndian.PutUint32(msg[8:], c.seq)
+	msg[syscall.NLMSG_HDRLEN] = cmd
+	msg[syscall.NLMSG_HDRLEN+1] = 1 // genl version
+	if err := syscall.Sendto(c.fd, msg, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	var out [][]byte
+	buf := make([]byte, 256<<10)
+	for {
+		n, _, err := syscall.Recvfrom(c.fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != c.seq {
+				continue
+			}
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return out, nil
+			case syscall.NLMSG_ERROR:
+				if len(m.Data) < 4 {
+					return nil, errors.New("short netlink error message")
+				}
+				if errno := int32(binary.NativeEndian.Uint32(m.Data)); errno != 0 {
+					return nil, syscall.Errno(-errno)
+				}
+				return out, nil
+			}
+			if len(m.Data) < 4 {
+				continue
+			}
+			out = append(out, m.Data[4:])
+			if !dump {
+				return out, nil
+			}
+		}
+	}
+}
+
+// familyID resolves a generic netlink family name to its message type.
+func (c *genlConn) familyID(name string) (uint16, error) {
+	replies, err := c.request(genlIDCtrl, ctrlCmdGetFamily, false, nlAttr(ctrlAttrFamilyName, append([]byte(name), 0)))
+	if err != nil {
+		return 0, fmt.Errorf("resolve %s: %w", name, err)
+	}
+	for _, r := range replies {
+		if id, ok := nlAttrs(r)[ctrlAttrFamilyID]; ok && len(id) >= 2 {
+			return binary.NativeEndian.Uint16(id), nil
+		}
+	}
+	return 0, fmt.Errorf("resolve %s: no family id", name)
+}
+
+// nlAttr encodes one netlink attribute, padded to four bytes.
+func nlAttr(typ uint16, value []byte) []byte {
+	b := make([]byte, 4, 4+len(value)+3)
+	binary.NativeEndian.PutUint16(b[0:], uint16(4+len(value)))
+	binary.NativeEndian.PutUint16(b[2:], typ)
+	b = append(b, value...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// nlAttrs decodes a run of netlink attributes by type. Nested attributes are
+// decoded by calling it again on the value.
+func nlAttrs(b []byte) map[uint16][]byte {
+	attrs := map[uint16][]byte{}
+	for len(b) >= 4 {
+		l := int(binary.NativeEndian.Uint16(b[0:]))
+		if l < 4 || l > len(b) {
+			break
+		}
+		attrs[binary.NativeEndian.Uint16(b[2:])&nlaTypeMask] = b[4:l]
+		l = (l + 3) &^ 3
+		if l >= len(b) {
+			break
+		}
+		b = b[l:]
+	}
+	return attrs
+}
+
+func nlUint32(b []byte) (uint32, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	return binary.NativeEndian.Uint32(b), true
+}
+
+func nlUint64(b []byte) (uint64, bool) {
+	if len(b) < 8 {
+		return 0, false
+	}
+	return binary.NativeEndian.Uint64(b), true
+}
+
+// nl80211Iface is a wireless interface as reported by NL80211_CMD_GET_INTERFACE.
+type nl80211Iface struct {
+	index   int
+	name    string
+	station bool
+	ssid    string
+	freq    int
+}
+
+// nl80211Link queries nl80211 for the station, survey and scan information
+// of a wireless interface. It returns nil when no interface matches.
+func nl80211Link(want string) (*WirelessInfo, error) {
+	c, err := dialGenl(2 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	family, err := c.familyID("nl80211")
+	if errors.Is(err, syscall.ENOENT) {
+		// No wireless driver has registered the nl80211 family.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.request(family, nl80211CmdGetIface, true, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list wireless interfaces: %w", err)
+	}
+	var chosen *nl80211Iface
+	for _, r := range replies {
+		iface := parseNL80211Iface(nlAttrs(r))
+		if !iface.station {
+			continue
+		}
+		if iface.name == want {
+			chosen = &iface
+			break
+		}
+		if chosen == nil || (chosen.ssid == "" && iface.ssid != "") {
+			chosen = &iface
+		}
+	}
+	if chosen == nil {
+		return nil, nil
+	}
+
+	info := &WirelessInfo{Iface: chosen.name, SSID: chosen.ssid, FreqMHz: chosen.freq}
+	ifindex := make([]byte, 4)
+	binary.NativeEndian.PutUint32(ifindex, uint32(chosen.index))
+	byIndex := nlAttr(nl80211AttrIfindex, ifindex)
+
+	if replies, err := c.request(family, nl80211CmdGetSta, true, byIndex); err == nil && len(replies) > 0 {
+		applyStationInfo(info, nlAttrs(replies[0]))
+	}
+	if replies, err := c.request(family, nl80211CmdGetSurvey, true, byIndex); err == nil {
+		for _, r := range replies {
+			applySurvey(info, nlAttrs(nlAttrs(r)[nl80211AttrSurveyInfo]))
+		}
+	}
+	if replies, err := c.request(family, nl80211CmdGetScan, true, byIndex); err == nil {
+		var bsses []map[uint16][]byte
+		for _, r := range replies {
+			bsses = append(bsses, nlAttrs(nlAttrs(r)[nl80211AttrBSS]))
+		}
+		applyScan(info, bsses)
+	}
+	return info, nil
+}
+
+func parseNL80211Iface(attrs map[uint16][]byte) nl80211Iface {
+	var iface nl80211Iface
+	if v, ok := nlUint32(attrs[nl80211AttrIfindex]); ok {
+		iface.index = int(v)
+	}
+	iface.name = nlString(attrs[nl80211AttrIfname])
+	if v, ok := nlUint32(attrs[nl80211AttrIftype]); ok {
+		iface.station = v == nl80211IftypeStation
+	}
+	iface.ssid = string(attrs[nl80211AttrSSID])
+	if v, ok := nlUint32(attrs[nl80211AttrWiphyFreq]); ok {
+		iface.freq = int(v)
+	}
+	return iface
+}
+
+// applyStationInfo reads the access point's station entry: its MAC is the
+// BSSID, and the nested station info holds the signal, bitrate and counters.
+func applyStationInfo(info *WirelessInfo, attrs map[uint16][]byte) {
+	if mac := attrs[nl80211AttrMAC]; len(mac) == 6 {
+		info.BSSID = net.HardwareAddr(mac).String()
+	}
+	sta := nlAttrs(attrs[nl80211AttrStaInfo])
+	if v := sta[nl80211StaInfoSignal]; len(v) >= 1 {
+		info.SignalDBm = int(int8(v[0]))
+	}
+	rate := nlAttrs(sta[nl80211StaInfoTxBitrate])
+	if v, ok := nlUint32(rate[nl80211RateInfoBitrate32]); ok {
+		info.TxBitrateMbps = float64(v) / 10
+	} else if v := rate[nl80211RateInfoBitrate]; len(v) >= 2 {
+		info.TxBitrateMbps = float64(binary.NativeEndian.Uint16(v)) / 10
+	}
+	if v, ok := nlUint32(sta[nl80211StaInfoTxPackets]); ok {
+		info.TxPackets = uint64(v)
+	}
+	if v, ok := nlUint32(sta[nl80211StaInfoTxRetries]); ok {
+		info.TxRetries = uint64(v)
+	}
+	if v, ok := nlUint32(sta[nl80211StaInfoTxFailed]); ok {
+		info.TxFailed = uint64(v)
+	}
+}
+
+// applySurvey takes the noise floor and channel busy time from the survey
+// entry of the channel in use.
+func applySurvey(info *WirelessInfo, survey map[uint16][]byte) {
+	if _, inUse := survey[nl80211SurveyInUse]; !inUse {
+		return
+	}
+	if info.FreqMHz == 0 {
+		if v, ok := nlUint32(survey[nl80211SurveyFrequency]); ok {
+			info.FreqMHz = int(v)
+		}
+	}
+	if v := survey[nl80211SurveyNoise]; len(v) >= 1 {
+		info.NoiseDBm = int(int8(v[0]))
+	}
+	active, ok1 := nlUint64(survey[nl80211SurveyTime])
+	busy, ok2 := nlUint64(survey[nl80211SurveyTimeBusy])
+	if ok1 && ok2 && active > 0 {
+		info.ChannelBusy = float64(busy) / float64(active)
+	}
+}
+
+// applyScan fills in the associated BSS's SSID and frequency when the
+// interface did not report them, and counts the other access points on
+// overlapping channels.
+func applyScan(info *WirelessInfo, bsses []map[uint16][]byte) {
+	for _, bss := range bsses {
+		if v, ok := nlUint32(bss[nl80211BSSStatus]); !ok || v != nl80211BSSStatusAssociated {
+			continue
+		}
+		if info.BSSID == "" && len(bss[nl80211BSSBSSID]) == 6 {
+			info.BSSID = net.HardwareAddr(bss[nl80211BSSBSSID]).String()
+		}
+		if info.FreqMHz == 0 {
+			if v, ok := nlUint32(bss[nl80211BSSFrequency]); ok {
+				info.FreqMHz = int(v)
+			}
+		}
+		if info.SSID == "" {
+			info.SSID = ssidFromIEs(bss[nl80211BSSIEs])
+		}
+	}
+	channel, band := wifiChannel(info.FreqMHz)
+	if channel == 0 {
+		return
+	}
+	for _, bss := range bsses {
+		if net.HardwareAddr(bss[nl80211BSSBSSID]).String() == info.BSSID {
+			continue
+		}
+		freq, ok := nlUint32(bss[nl80211BSSFrequency])
+		if !ok {
+			continue
+		}
+		if ch, b := wifiChannel(int(freq)); b == band && channelsOverlap(band, ch, channel) {
+			info.Neighbors++
+		}
+	}
+}
+
+// ssidFromIEs returns the SSID element (ID 0) of a beacon's information
+// elements.
+func ssidFromIEs(ies []byte) string {
+	for len(ies) >= 2 {
+		id, l := ies[0], int(ies[1])
+		if 2+l > len(ies) {
+			break
+		}
+		if id == 0 {
+			return string(ies[2 : 2+l])
+		}
+		ies = ies[2+l:]
+	}
+	return ""
+}
+
+func nlString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
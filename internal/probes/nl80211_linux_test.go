@@ -0,0 +1,85 @@
+package probes
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func nlU32(typ uint16, v uint32) []byte {
+	return nlAttr(typ, binary.NativeEndian.AppendUint32(nil, v))
+}
+
+func TestParseNL80211Iface(t *testing.T) {
+	msg := func(attrs ...[]byte) map[uint16][]byte {
+		var b []byte
+		for _, a := range attrs {
+			b = append(b, a...)
+		}
+		return nlAttrs(b)
+	}
+	tests := []struct {
+		name  string
+		attrs map[uint16][]byte
+		want  nl80211Iface
+	}{
+		{
+			name: "associated station",
+			attrs: msg(
+				nlU32(nl80211AttrIfindex, 3),
+				nlAttr(nl80211AttrIfname, []byte("wlan0\x00")),
+				nlU32(nl80211AttrIftype, nl80211IftypeStation),
+				nlAttr(nl80211AttrMAC, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}),
+				nlAttr(nl80211AttrSSID, []byte("Office Wi-Fi")),
+				nlU32(nl80211AttrWiphyFreq, 5180),
+			),
+			want: nl80211Iface{index: 3, name: "wlan0", station: true, ssid: "Office Wi-Fi", freq: 5180},
+		},
+		{
+			name: "not associated",
+			attrs: msg(
+				nlU32(nl80211AttrIfindex, 4),
+				nlAttr(nl80211AttrIfname, []byte("wlan1\x00")),
+				nlU32(nl80211AttrIftype, nl80211IftypeStation),
+			),
+			want: nl80211Iface{index: 4, name: "wlan1", station: true},
+		},
+		{
+			// Access point mode.
+			name: "not a station",
+			attrs: msg(
+				nlU32(nl80211AttrIfindex, 5),
+				nlAttr(nl80211AttrIfname, []byte("ap0\x00")),
+				nlU32(nl80211AttrIftype, 3),
+				nlAttr(nl80211AttrSSID, []byte("guest")),
+			),
+			want: nl80211Iface{index: 5, name: "ap0", ssid: "guest"},
+		},
+		{
+			name: "short values",
+			attrs: msg(
+				nlAttr(nl80211AttrIfindex, []byte{3}),
+				nlAttr(nl80211AttrIfname, []byte("wlan0")),
+				nlAttr(nl80211AttrIftype, []byte{2, 0}),
+			),
+			want: nl80211Iface{name: "wlan0"},
+		},
+		{
+			name:  "empty",
+			attrs: msg(),
+		},
+	}
+	for _, tt := range tests {
+		if got := parseNL80211Iface(tt.attrs); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNLAttrsTruncated(t *testing.T) {
+	b := append(nlU32(nl80211AttrIfindex, 3), nlAttr(nl80211AttrSSID, []byte("abcdef"))...)
+	// The SSID attribute claims more bytes than are left.
+	attrs := nlAttrs(b[:len(b)-4])
+	if _, ok := attrs[nl80211AttrSSID]; ok || len(attrs) != 1 {
+		t.Errorf("decoded %v", attrs)
+	}
+}
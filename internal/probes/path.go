@@ -0,0 +1,472 @@
+package probes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// PathResult is the outcome of an MTR-style analysis: every hop on the path to
+// the target is probed repeatedly so loss and latency can be attributed to the
+// hop where they start.
+type PathResult struct {
+	Target  string      `json:"target"`
+	Cycles  int         `json:"cycles"`
+	Method  string      `json:"method,omitempty"`
+	Reached bool        `json:"reached"`
+	Hops    []PathHop   `json:"hops,omitempty"`
+	Verdict PathVerdict `json:"verdict"`
+}
+
+// PathHop aggregates the probes sent to a single TTL.
+type PathHop struct {
+	TTL      int      `json:"ttl"`
+	Addr     string   `json:"addr,omitempty"`
+	Addrs    []string `json:"addrs,omitempty"`
+	Sent     int      `json:"sent"`
+	Received int      `json:"received"`
+	Loss     float64  `json:"loss"`
+	AvgMs    float64  `json:"avg_ms"`
+	BestMs   float64  `json:"best_ms"`
+	WorstMs  float64  `json:"worst_ms"`
+	StdDevMs float64  `json:"stddev_ms"`
+	JitterMs float64  `json:"jitter_ms"`
+	// RateLimited is set when the hop drops probes but later hops do not,
+	// which points at ICMP rate limiting on the router rather than loss of
+	// forwarded traffic.
+	RateLimited bool `json:"rate_limited,omitempty"`
+}
+
+// PathVerdict summarises where forwarding loss starts, if anywhere.
+type PathVerdict struct {
+	ForwardingLossHop int     `json:"forwarding_loss_hop,omitempty"`
+	ForwardingLossAt  string  `json:"forwarding_loss_at,omitempty"`
+	ForwardingLoss    float64 `json:"forwarding_loss,omitempty"`
+	RateLimitedHops   []int   `json:"rate_limited_hops,omitempty"`
+}
+
+const (
+	pathLossEpsilon      = 0.02
+	pathRateLimitTailMax = 0.5
+	pathProbeGap         = 10 * time.Millisecond
+)
+
+// PathAnalysis discovers the route to target and probes every hop for the
+// given number of cycles. With a raw ICMP socket it sends TTL-limited echo
+// requests like mtr; otherwise it traces the path once and pings each hop
+// address directly.
+func PathAnalysis(ctx context.Context, target string, cycles, maxHops int, interval, timeout time.Duration) (PathResult, error) {
+	if cycles <= 0 {
+		cycles = 10
+	}
+	if maxHops <= 0 {
+		maxHops = 30
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	res := PathResult{Target: target, Cycles: cycles}
+
+	addr, err := resolvePingTarget(ctx, "ip", target)
+	if err != nil {
+		return res, fmt.Errorf("resolve %s: %w", target, err)
+	}
+	ip := addr.IP
+
+	conn, err := openICMP(ip.To4() == nil)
+	if err == nil && conn.datagram {
+		// Datagram ICMP sockets only deliver Time Exceeded errors through
+		// the socket error queue, so TTL-limited probing needs a raw socket.
+		conn.Close()
+		err = errICMPUnavailable
+	}
+	if err == nil {
+		defer conn.Close()
+		res.Method = "icmp-ttl"
+		res.Hops, res.Reached, err = probePathTTL(ctx, conn, ip, cycles, maxHops, interval)
+	} else {
+		res.Method = "trace+ping"
+		res.Hops, res.Reached, err = probePathByHop(ctx, target, ip, cycles, maxHops, interval, timeout)
+	}
+	res.Verdict = analyzePath(res.Hops)
+	for i := range res.Hops {
+		for _, ttl := range res.Verdict.RateLimitedHops {
+			if res.Hops[i].TTL == ttl {
+				res.Hops[i].RateLimited = true
+			}
+		}
+	}
+	return res, err
+}
+
+type pathProbe struct {
+	ttl    int
+	sentAt time.Time
+}
+
+type hopSamples struct {
+	sent  int
+	rtts  []float64
+	addrs map[string]int
+}
+
+func probePathTTL(ctx context.Context, conn *icmpConn, ip net.IP, cycles, maxHops int, interval time.Duration) ([]PathHop, bool, error) {
+	id := (os.Getpid() ^ rand.Intn(0xffff)) & 0xffff
+	seqBase := rand.Intn(0x7fff)
+	dst := conn.destination(&net.IPAddr{IP: ip})
+
+	var (
+		mu       sync.Mutex
+		inflight = map[int]pathProbe{}
+		stats    = make([]hopSamples, maxHops+1)
+		destTTL  = 0
+	)
+	for i := range stats {
+		stats[i].addrs = map[string]int{}
+	}
+
+	record := func(seq int, from net.IP, reachedDest bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		p, ok := inflight[seq]
+		if !ok {
+			return
+		}
+		delete(inflight, seq)
+		rtt := float64(time.Since(p.sentAt)) / float64(time.Millisecond)
+		st := &stats[p.ttl]
+		st.rtts = append(st.rtts, rtt)
+		if from != nil {
+			st.addrs[from.String()]++
+		}
+		if reachedDest && (destTTL == 0 || p.ttl < destTTL) {
+			destTTL = p.ttl
+		}
+	}
+
+	stopRead := make(chan struct{})
+	readDone := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-stopRead:
+				readDone <- nil
+				return
+			default:
+			}
+			_ = conn.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, _, src, err := conn.readFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					continue
+				}
+				readDone <- err
+				return
+			}
+			msg, err := icmp.ParseMessage(conn.protocol(), buf[:n])
+			if err != nil {
+				continue
+			}
+			from := addrIP(src)
+			switch body := msg.Body.(type) {
+			case *icmp.Echo:
+				if msg.Type != ipv4.ICMPTypeEchoReply && msg.Type != ipv6.ICMPTypeEchoReply {
+					continue
+				}
+				if body.ID != id {
+					continue
+				}
+				record(body.Seq, from, true)
+			case *icmp.TimeExceeded:
+				if echoID, seq, ok := quotedEcho(body.Data, conn.v6); ok && echoID == id {
+					record(seq, from, false)
+				}
+			case *icmp.DstUnreach:
+				if echoID, seq, ok := quotedEcho(body.Data, conn.v6); ok && echoID == id {
+					record(seq, from, true)
+				}
+			}
+		}
+	}()
+
+	payload := []byte("vne-path-probe")
+	var sendErr error
+	seqOf := func(cycle, ttl int) int {
+		return (seqBase + cycle*maxHops + ttl - 1) & 0xffff
+	}
+
+cycleLoop:
+	for cycle := 0; cycle < cycles; cycle++ {
+		start := time.Now()
+		mu.Lock()
+		limit := maxHops
+		if destTTL > 0 {
+			limit = destTTL
+		}
+		mu.Unlock()
+		for ttl := 1; ttl <= limit; ttl++ {
+			if ctx.Err() != nil {
+				break cycleLoop
+			}
+			if conn.v6 {
+				err := conn.conn.IPv6PacketConn().SetHopLimit(ttl)
+				if err != nil {
+					sendErr = err
+					break cycleLoop
+				}
+			} else if err := conn.conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+				sendErr = err
+				break cycleLoop
+			}
+			seq := seqOf(cycle, ttl)
+			msg := icmp.Message{Type: ipv4.ICMPTypeEcho, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}
+			if conn.v6 {
+				msg.Type = ipv6.ICMPTypeEchoRequest
+			}
+			wb, err := msg.Marshal(nil)
+			if err != nil {
+				sendErr = err
+				break cycleLoop
+			}
+			mu.Lock()
+			inflight[seq] = pathProbe{ttl: ttl, sentAt: time.Now()}
+			stats[ttl].sent++
+			mu.Unlock()
+			if _, err := conn.conn.WriteTo(wb, dst); err != nil {
+				sendErr = err
+				break cycleLoop
+			}
+			time.Sleep(pathProbeGap)
+		}
+		wait := interval - time.Since(start)
+		if cycle == cycles-1 {
+			wait = maxPingReplyWait
+		}
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				break cycleLoop
+			case <-time.After(wait):
+			}
+		}
+	}
+	close(stopRead)
+	readErr := <-readDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := maxHops
+	if destTTL > 0 {
+		last = destTTL
+	} else {
+		// Trim trailing hops that never answered.
+		for last > 0 && len(stats[last].rtts) == 0 {
+			last--
+		}
+	}
+	hops := make([]PathHop, 0, last)
+	for ttl := 1; ttl <= last; ttl++ {
+		hops = append(hops, summarizeHop(ttl, stats[ttl]))
+	}
+	if sendErr != nil {
+		return hops, destTTL > 0, fmt.Errorf("send probe: %w", sendErr)
+	}
+	if readErr != nil {
+		return hops, destTTL > 0, fmt.Errorf("read reply: %w", readErr)
+	}
+	return hops, destTTL > 0, ctx.Err()
+}
+
+// quotedEcho extracts the echo identifier and sequence from the original
+// datagram quoted inside an ICMP error message.
+func quotedEcho(data []byte, v6 bool) (int, int, bool) {
+	var hdrLen int
+	if v6 {
+		hdrLen = ipv6.HeaderLen
+	} else {
+		if len(data) < 1 {
+			return 0, 0, false
+		}
+		hdrLen = int(data[0]&0x0f) * 4
+	}
+	if len(data) < hdrLen+8 {
+		return 0, 0, false
+	}
+	inner := data[hdrLen:]
+	id := int(inner[4])<<8 | int(inner[5])
+	seq := int(inner[6])<<8 | int(inner[7])
+	return id, seq, true
+}
+
+func probePathByHop(ctx context.Context, target string, ip net.IP, cycles, maxHops int, interval, timeout time.Duration) ([]PathHop, bool, error) {
+	trace, err := Trace(ctx, target, maxHops, timeout)
+	if len(trace.Hops) == 0 {
+		if err == nil {
+			err = errors.New("traceroute returned no hops")
+		}
+		return nil, false, err
+	}
+
+	hops := make([]PathHop, len(trace.Hops))
+	pingTimeout := interval*time.Duration(cycles) + maxPingReplyWait
+	var wg sync.WaitGroup
+	for i, th := range trace.Hops {
+		hops[i] = PathHop{TTL: th.TTL, Addrs: th.Addrs}
+		if len(th.Addrs) == 0 {
+			hops[i].Sent = cycles
+			hops[i].Loss = 1
+			continue
+		}
+		hops[i].Addr = th.Addrs[0]
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			ping, _ := PingHost(ctx, addr, cycles, pingTimeout)
+			st := hopSamples{addrs: map[string]int{addr: 1}}
+			for _, s := range ping.Samples {
+				if s.Duplicate {
+					continue
+				}
+				st.sent++
+				if !s.Timeout {
+					st.rtts = append(st.rtts, s.RTTMs)
+				}
+			}
+			if st.sent == 0 {
+				st.sent = cycles
+			}
+			hop := summarizeHop(hops[i].TTL, st)
+			hop.Addrs = hops[i].Addrs
+			hops[i] = hop
+		}(i, th.Addrs[0])
+	}
+	wg.Wait()
+
+	reached := false
+	if last := hops[len(hops)-1]; last.Addr == ip.String() {
+		reached = true
+	}
+	return hops, reached, ctx.Err()
+}
+
+func summarizeHop(ttl int, st hopSamples) PathHop {
+	hop := PathHop{TTL: ttl, Sent: st.sent, Received: len(st.rtts)}
+	if hop.Received > hop.Sent {
+		hop.Received = hop.Sent
+	}
+	if hop.Sent > 0 {
+		hop.Loss = float64(hop.Sent-hop.Received) / float64(hop.Sent)
+	}
+	type addrCount struct {
+		addr  string
+		count int
+	}
+	var counts []addrCount
+	for a, c := range st.addrs {
+		counts = append(counts, addrCount{a, c})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].addr < counts[j].addr
+	})
+	for _, c := range counts {
+		hop.Addrs = append(hop.Addrs, c.addr)
+	}
+	if len(hop.Addrs) > 0 {
+		hop.Addr = hop.Addrs[0]
+	}
+	if len(st.rtts) == 0 {
+		return hop
+	}
+	hop.AvgMs = average(st.rtts)
+	hop.BestMs, hop.WorstMs = st.rtts[0], st.rtts[0]
+	var variance float64
+	for _, v := range st.rtts {
+		if v < hop.BestMs {
+			hop.BestMs = v
+		}
+		if v > hop.WorstMs {
+			hop.WorstMs = v
+		}
+		d := v - hop.AvgMs
+		variance += d * d
+	}
+	hop.StdDevMs = math.Sqrt(variance / float64(len(st.rtts)))
+	hop.JitterMs = jitter(st.rtts)
+	return hop
+}
+
+// analyzePath separates loss that is carried forward to every later hop
+// (forwarding loss) from loss that later hops do not show, which is typical
+// of routers rate limiting or filtering the ICMP replies they generate
+// themselves.
+func analyzePath(hops []PathHop) PathVerdict {
+	var v PathVerdict
+	for i, hop := range hops {
+		if hop.Sent == 0 || hop.Loss <= pathLossEpsilon {
+			continue
+		}
+		tail := hops[i+1:]
+		if hop.Received == 0 {
+			if hopsAfterRespond(tail) {
+				v.RateLimitedHops = append(v.RateLimitedHops, hop.TTL)
+			}
+			continue
+		}
+		tailLoss := hop.Loss
+		if hopsAfterRespond(tail) {
+			tailLoss = 1
+			for _, t := range tail {
+				if t.Received > 0 && t.Loss < tailLoss {
+					tailLoss = t.Loss
+				}
+			}
+		}
+		if tailLoss > pathLossEpsilon && tailLoss >= hop.Loss*pathRateLimitTailMax {
+			if v.ForwardingLossHop == 0 {
+				v.ForwardingLossHop = hop.TTL
+				v.ForwardingLossAt = hop.Addr
+				v.ForwardingLoss = tailLoss
+			}
+			continue
+		}
+		v.RateLimitedHops = append(v.RateLimitedHops, hop.TTL)
+	}
+	return v
+}
+
+func hopsAfterRespond(hops []PathHop) bool {
+	for _, h := range hops {
+		if h.Received > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HopLabel formats a hop for findings, e.g. "hop 3 (10.0.0.1)".
+func (h PathHop) HopLabel() string {
+	if h.Addr == "" {
+		return fmt.Sprintf("hop %d", h.TTL)
+	}
+	return fmt.Sprintf("hop %d (%s)", h.TTL, strings.TrimSpace(h.Addr))
+}
@@ -0,0 +1,149 @@
+package probes
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSummarizeHop(t *testing.T) {
+	tests := []struct {
+		name string
+		st   hopSamples
+		want PathHop
+	}{
+		{
+			name: "replies from two routers",
+			st:   hopSamples{sent: 4, rtts: []float64{10, 12, 11}, addrs: map[string]int{"10.0.0.2": 1, "10.0.0.1": 2}},
+			want: PathHop{
+				TTL: 3, Addr: "10.0.0.1", Addrs: []string{"10.0.0.1", "10.0.0.2"},
+				Sent: 4, Received: 3, Loss: 0.25,
+				AvgMs: 11, BestMs: 10, WorstMs: 12, StdDevMs: math.Sqrt(2.0 / 3), JitterMs: 1.5,
+			},
+		},
+		{
+			name: "equal counts sort by address",
+			st:   hopSamples{sent: 2, rtts: []float64{5, 5}, addrs: map[string]int{"10.0.0.9": 1, "10.0.0.10": 1}},
+			want: PathHop{
+				TTL: 3, Addr: "10.0.0.10", Addrs: []string{"10.0.0.10", "10.0.0.9"},
+				Sent: 2, Received: 2, AvgMs: 5, BestMs: 5, WorstMs: 5,
+			},
+		},
+		{
+			name: "no replies",
+			st:   hopSamples{sent: 5, addrs: map[string]int{}},
+			want: PathHop{TTL: 3, Sent: 5, Loss: 1},
+		},
+		{
+			// Late replies to an earlier cycle can outnumber what was sent.
+			name: "more replies than probes",
+			st:   hopSamples{sent: 2, rtts: []float64{1, 2, 3}, addrs: map[string]int{"10.0.0.1": 3}},
+			want: PathHop{
+				TTL: 3, Addr: "10.0.0.1", Addrs: []string{"10.0.0.1"},
+				Sent: 2, Received: 2, AvgMs: 2, BestMs: 1, WorstMs: 3, StdDevMs: math.Sqrt(2.0 / 3),
+			},
+		},
+		{
+			name: "nothing sent",
+			st:   hopSamples{},
+			want: PathHop{TTL: 3},
+		},
+	}
+	for _, tt := range tests {
+		got := summarizeHop(3, tt.st)
+		if math.Abs(got.StdDevMs-tt.want.StdDevMs) < 1e-9 {
+			got.StdDevMs = tt.want.StdDevMs
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// hopLoss is a hop at ttl that answered received of sent probes; received -1
+// is a "*" hop that never answered.
+func hopLoss(ttl, sent, received int) PathHop {
+	h := PathHop{TTL: ttl, Sent: sent}
+	if received < 0 {
+		h.Loss = 1
+		return h
+	}
+	h.Addr = "10.0.0." + string(rune('0'+ttl))
+	h.Received = received
+	h.Loss = float64(sent-received) / float64(sent)
+	return h
+}
+
+func TestAnalyzePath(t *testing.T) {
+	tests := []struct {
+		name string
+		hops []PathHop
+		want PathVerdict
+	}{
+		{
+			name: "clean",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 10), hopLoss(3, 10, 10)},
+		},
+		{
+			name: "loss under the noise floor",
+			hops: []PathHop{hopLoss(1, 100, 100), hopLoss(2, 100, 99), hopLoss(3, 100, 99)},
+		},
+		{
+			// Hop 2 drops half its replies but forwards everything.
+			name: "intermediate loss not carried forward",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 5), hopLoss(3, 10, 10), hopLoss(4, 10, 10)},
+			want: PathVerdict{RateLimitedHops: []int{2}},
+		},
+		{
+			name: "loss carried to the destination",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 10), hopLoss(3, 10, 7), hopLoss(4, 10, 7), hopLoss(5, 10, 7)},
+			want: PathVerdict{ForwardingLossHop: 3, ForwardingLossAt: "10.0.0.3", ForwardingLoss: 0.3},
+		},
+		{
+			// The first lossy hop is blamed, with the loss that is still
+			// there at the end of the path.
+			name: "loss growing along the path",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 8), hopLoss(3, 10, 6), hopLoss(4, 10, 6)},
+			want: PathVerdict{ForwardingLossHop: 2, ForwardingLossAt: "10.0.0.2", ForwardingLoss: 0.4},
+		},
+		{
+			// Most of hop 2's loss disappears downstream; what is left
+			// starts at the destination.
+			name: "rate limiting and destination loss",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 4), hopLoss(3, 10, 9)},
+			want: PathVerdict{ForwardingLossHop: 3, ForwardingLossAt: "10.0.0.3", ForwardingLoss: 0.1, RateLimitedHops: []int{2}},
+		},
+		{
+			name: "silent hop before a responding one",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, -1), hopLoss(3, 10, -1), hopLoss(4, 10, 10)},
+			want: PathVerdict{RateLimitedHops: []int{2, 3}},
+		},
+		{
+			// Trailing "*" hops are a target or firewall that does not
+			// answer, not loss.
+			name: "destination does not respond",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 10), hopLoss(3, 10, -1), hopLoss(4, 10, -1)},
+		},
+		{
+			name: "loss before an unresponsive destination",
+			hops: []PathHop{hopLoss(1, 10, 10), hopLoss(2, 10, 6), hopLoss(3, 10, -1)},
+			want: PathVerdict{ForwardingLossHop: 2, ForwardingLossAt: "10.0.0.2", ForwardingLoss: 0.4},
+		},
+		{
+			name: "hop never probed",
+			hops: []PathHop{hopLoss(1, 10, 10), {TTL: 2, Loss: 1}, hopLoss(3, 10, 10)},
+		},
+		{
+			name: "no hops",
+		},
+	}
+	for _, tt := range tests {
+		got := analyzePath(tt.hops)
+		if math.Abs(got.ForwardingLoss-tt.want.ForwardingLoss) < 1e-9 {
+			got.ForwardingLoss = tt.want.ForwardingLoss
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
+	"net/netip"
 	"os/exec"
 	"regexp"
 	"runtime"
@@ -13,17 +15,48 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cneate93/vne/internal/procx"
 )
 
 type PingResult struct {
-	AvgMs    float64 `json:"avg_ms"`
-	P95Ms    float64 `json:"p95_ms"`
-	JitterMs float64 `json:"jitter_ms"`
-	Loss     float64 `json:"loss"`
-	Raw      string  `json:"raw"`
+	AvgMs    float64      `json:"avg_ms"`
+	P95Ms    float64      `json:"p95_ms"`
+	JitterMs float64      `json:"jitter_ms"`
+	Loss     float64      `json:"loss"`
+	Samples  []PingSample `json:"samples,omitempty"`
+	Method   string       `json:"method,omitempty"`
+	Raw      string       `json:"raw"`
+}
+
+// PingSample is a single echo request and, unless it timed out, its reply.
+// Duplicate replies are recorded as additional samples with Duplicate set.
+type PingSample struct {
+	Seq        int     `json:"seq"`
+	TTL        int     `json:"ttl"`
+	RTTMs      float64 `json:"rtt_ms"`
+	Timeout    bool    `json:"timeout,omitempty"`
+	Duplicate  bool    `json:"duplicate,omitempty"`
+	OutOfOrder bool    `json:"out_of_order,omitempty"`
+}
+
+// PingHost measures round-trip time and loss to target. It uses a native ICMP
+// echo implementation and falls back to the system ping command when ICMP
+// sockets cannot be opened (for example without CAP_NET_RAW on Windows).
+// Cancelling ctx stops the run and returns whatever was measured so far.
+func PingHost(ctx context.Context, target string, count int, timeout time.Duration) (PingResult, error) {
+	return pingHost(ctx, "ip", target, count, timeout)
+}
+
+// PingHost6 is PingHost over IPv6 only: a host name is resolved to its AAAA
+// address. Link-local targets need a zone, e.g. "fe80::1%eth0".
+func PingHost6(ctx context.Context, target string, count int, timeout time.Duration) (PingResult, error) {
+	return pingHost(ctx, "ip6", target, count, timeout)
 }
 
-func PingHost(target string, count int, timeout time.Duration) (PingResult, error) {
+// pingHost pings target over network, which is "ip" (preferring IPv4),
+// "ip4" or "ip6".
+func pingHost(ctx context.Context, network, target string, count int, timeout time.Duration) (PingResult, error) {
 	if count <= 0 {
 		count = 4
 	}
@@ -31,15 +64,79 @@ func PingHost(target string, count int, timeout time.Duration) (PingResult, erro
 		timeout = 10 * time.Second
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	addr, err := resolvePingTarget(ctx, network, target)
+	if err == nil {
+		res, err := pingICMP(ctx, addr, count, timeout)
+		if !errors.Is(err, errICMPUnavailable) {
+			return res, err
+		}
+	} else if network == "ip6" {
+		// The ping utility cannot do better without an IPv6 address.
+		return PingResult{}, err
+	}
+	if ctx.Err() != nil {
+		return PingResult{}, ctx.Err()
+	}
+	return pingExec(ctx, network == "ip6", target, count, timeout)
+}
+
+// resolvePingTarget resolves target to an address of the given network
+// ("ip", "ip4" or "ip6"). For "ip" an IPv4 address is preferred. A literal
+// address keeps its zone.
+func resolvePingTarget(ctx context.Context, network, target string) (*net.IPAddr, error) {
+	target = strings.TrimSpace(target)
+	if a, err := netip.ParseAddr(target); err == nil {
+		a = a.Unmap()
+		if network == "ip4" && !a.Is4() || network == "ip6" && !a.Is6() {
+			return nil, fmt.Errorf("%s is not an %s address", target, familyName(network))
+		}
+		return &net.IPAddr{IP: net.IP(a.AsSlice()), Zone: a.Zone()}, nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, target)
+	if err != nil {
+		return nil, err
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return &net.IPAddr{IP: ip}, nil
+		}
+	}
+	if len(ips) > 0 {
+		return &net.IPAddr{IP: ips[0]}, nil
+	}
+	return nil, fmt.Errorf("no %s addresses found for %s", familyName(network), target)
+}
+
+func familyName(network string) string {
+	switch network {
+	case "ip4":
+		return "IPv4"
+	case "ip6":
+		return "IPv6"
+	}
+	return "IP"
+}
+
+func pingExec(ctx context.Context, v6 bool, target string, count int, timeout time.Duration) (PingResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.CommandContext(ctx, "ping", "-n", strconv.Itoa(count), target)
+	switch {
+	case runtime.GOOS == "windows" && v6:
+		cmd = procx.CommandContext(ctx, "ping", "-6", "-n", strconv.Itoa(count), target)
+	case runtime.GOOS == "windows":
+		cmd = procx.CommandContext(ctx, "ping", "-n", strconv.Itoa(count), target)
+	case runtime.GOOS == "linux" && v6:
+		cmd = procx.CommandContext(ctx, "ping", "-6", "-c", strconv.Itoa(count), "-n", target)
+	case v6:
+		// BSD and macOS keep IPv6 in a separate utility.
+		cmd = procx.CommandContext(ctx, "ping6", "-c", strconv.Itoa(count), "-n", target)
 	default:
-		cmd = exec.CommandContext(ctx, "ping", "-c", strconv.Itoa(count), "-n", target)
+		cmd = procx.CommandContext(ctx, "ping", "-c", strconv.Itoa(count), "-n", target)
 	}
 
 	var stderr bytes.Buffer
@@ -60,6 +157,10 @@ func PingHost(target string, count int, timeout time.Duration) (PingResult, erro
 	}
 
 	res := parsePing(string(output))
+	res.Method = "exec"
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return res, ctx.Err()
+	}
 	if err != nil {
 		return res, errors.New(strings.TrimSpace(err.Error() + " " + stderr.String()))
 	}
@@ -69,13 +170,21 @@ func PingHost(target string, count int, timeout time.Duration) (PingResult, erro
 var lossRe = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)%\s*loss`)
 var percentRe = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
 
-var pingTimeRe = regexp.MustCompile(`(?i)time[=<]?\s*([0-9]+(?:\.[0-9]+)?)\s*ms`)
+var pingTimeRe = regexp.MustCompile(`(?i)time[=<]\s*([0-9]+(?:\.[0-9]+)?)\s*ms`)
+var pingSeqRe = regexp.MustCompile(`(?i)icmp_seq=(\d+)`)
+var pingTTLRe = regexp.MustCompile(`(?i)ttl=(\d+)`)
 
 func parsePing(out string) PingResult {
 	result := PingResult{Raw: out}
 	lines := strings.Split(out, "\n")
 	parsedLoss := false
-	samples := extractPingSamples(out)
+	replies := extractPingReplies(lines)
+	var samples []float64
+	for _, r := range replies {
+		if !r.Duplicate {
+			samples = append(samples, r.RTTMs)
+		}
+	}
 
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -112,10 +221,47 @@ func parsePing(out string) PingResult {
 	}
 	result.P95Ms = percentile95(samples)
 	result.JitterMs = jitter(samples)
+	result.Samples = replies
 
 	return result
 }
 
+// extractPingReplies builds per-reply samples from the reply lines of system
+// ping output. Sequence and TTL are filled in when the platform's ping prints
+// them.
+func extractPingReplies(lines []string) []PingSample {
+	var replies []PingSample
+	seen := map[int]bool{}
+	for _, line := range lines {
+		if !isPingReply(line) {
+			continue
+		}
+		m := pingTimeRe.FindStringSubmatch(line)
+		if len(m) < 2 {
+			continue
+		}
+		rtt, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		sample := PingSample{Seq: len(replies) + 1, TTL: -1, RTTMs: rtt}
+		if sm := pingSeqRe.FindStringSubmatch(line); len(sm) == 2 {
+			if v, err := strconv.Atoi(sm[1]); err == nil {
+				sample.Seq = v
+			}
+		}
+		if tm := pingTTLRe.FindStringSubmatch(line); len(tm) == 2 {
+			if v, err := strconv.Atoi(tm[1]); err == nil {
+				sample.TTL = v
+			}
+		}
+		sample.Duplicate = seen[sample.Seq] || strings.Contains(strings.ToUpper(line), "DUP!")
+		seen[sample.Seq] = true
+		replies = append(replies, sample)
+	}
+	return replies
+}
+
 func extractAvg(line string) float64 {
 	parts := strings.Split(line, "=")
 	if len(parts) < 2 {
@@ -156,23 +302,17 @@ func parseNumberBetween(line, left, right string) (float64, error) {
 	return strconv.ParseFloat(segment, 64)
 }
 
-func extractPingSamples(raw string) []float64 {
-	matches := pingTimeRe.FindAllStringSubmatch(raw, -1)
-	if len(matches) == 0 {
-		return nil
-	}
-	samples := make([]float64, 0, len(matches))
-	for _, m := range matches {
-		if len(m) < 2 {
-			continue
-		}
-		v, err := strconv.ParseFloat(m[1], 64)
-		if err != nil {
-			continue
-		}
-		samples = append(samples, v)
+// isPingReply reports whether line is an echo reply ("64 bytes from ...:
+// icmp_seq=1 ttl=57 time=12.3 ms" or Windows' "Reply from ...: bytes=32
+// time<1ms TTL=57") rather than a summary such as iputils' "2 packets
+// transmitted, 2 received, 0% packet loss, time 1001ms".
+func isPingReply(line string) bool {
+	lower := strings.ToLower(line)
+	if !strings.Contains(lower, "time=") && !strings.Contains(lower, "time<") {
+		return false
 	}
-	return samples
+	return strings.Contains(lower, "bytes from") || strings.Contains(lower, "icmp_seq=") ||
+		strings.HasPrefix(strings.TrimSpace(lower), "reply from")
 }
 
 func average(values []float64) float64 {
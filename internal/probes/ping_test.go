@@ -0,0 +1,127 @@
+package probes
+
+import (
+	"math"
+	"testing"
+)
+
+const iputilsPing = `PING 1.1.1.1 (1.1.1.1) 56(84) bytes of data.
+64 bytes from 1.1.1.1: icmp_seq=1 ttl=57 time=11.8 ms
+64 bytes from 1.1.1.1: icmp_seq=2 ttl=57 time=12.6 ms
+
+--- 1.1.1.1 ping statistics ---
+2 packets transmitted, 2 received, 0% packet loss, time 1001ms
+rtt min/avg/max/mdev = 11.800/12.200/12.600/0.400 ms
+`
+
+const iputilsPingLoss = `PING 10.0.0.1 (10.0.0.1) 56(84) bytes of data.
+64 bytes from 10.0.0.1: icmp_seq=1 ttl=64 time=0.412 ms
+64 bytes from 10.0.0.1: icmp_seq=3 ttl=64 time=0.388 ms
+64 bytes from 10.0.0.1: icmp_seq=3 ttl=64 time=0.901 ms (DUP!)
+64 bytes from 10.0.0.1: icmp_seq=4 ttl=64 time=0.400 ms
+
+--- 10.0.0.1 ping statistics ---
+4 packets transmitted, 3 received, +1 duplicates, 25% packet loss, time 3004ms
+rtt min/avg/max/mdev = 0.388/0.525/0.901/0.215 ms
+`
+
+const bsdPing = `PING 1.1.1.1 (1.1.1.1): 56 data bytes
+64 bytes from 1.1.1.1: icmp_seq=0 ttl=57 time=14.215 ms
+64 bytes from 1.1.1.1: icmp_seq=1 ttl=57 time=13.102 ms
+Request timeout for icmp_seq 2
+
+--- 1.1.1.1 ping statistics ---
+3 packets transmitted, 2 packets received, 33.3% packet loss
+round-trip min/avg/max/stddev = 13.102/13.658/14.215/0.557 ms
+`
+
+const windowsPing = "\r\nPinging 1.1.1.1 with 32 bytes of data:\r\n" +
+	"Reply from 1.1.1.1: bytes=32 time=12ms TTL=57\r\n" +
+	"Reply from 1.1.1.1: bytes=32 time<1ms TTL=57\r\n" +
+	"Request timed out.\r\n" +
+	"Reply from 1.1.1.1: bytes=32 time=14ms TTL=57\r\n" +
+	"\r\n" +
+	"Ping statistics for 1.1.1.1:\r\n" +
+	"    Packets: Sent = 4, Received = 3, Lost = 1 (25% loss),\r\n" +
+	"Approximate round trip times in milli-seconds:\r\n" +
+	"    Minimum = 1ms, Maximum = 14ms, Average = 9ms\r\n"
+
+func TestParsePing(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     string
+		loss    float64
+		avg     float64
+		samples []PingSample
+	}{
+		{
+			name: "iputils",
+			out:  iputilsPing,
+			loss: 0,
+			avg:  12.2,
+			samples: []PingSample{
+				{Seq: 1, TTL: 57, RTTMs: 11.8},
+				{Seq: 2, TTL: 57, RTTMs: 12.6},
+			},
+		},
+		{
+			name: "iputils loss and duplicate",
+			out:  iputilsPingLoss,
+			loss: 0.25,
+			avg:  0.525,
+			samples: []PingSample{
+				{Seq: 1, TTL: 64, RTTMs: 0.412},
+				{Seq: 3, TTL: 64, RTTMs: 0.388},
+				{Seq: 3, TTL: 64, RTTMs: 0.901, Duplicate: true},
+				{Seq: 4, TTL: 64, RTTMs: 0.4},
+			},
+		},
+		{
+			name: "bsd",
+			out:  bsdPing,
+			loss: 0.333,
+			avg:  13.658,
+			samples: []PingSample{
+				{Seq: 0, TTL: 57, RTTMs: 14.215},
+				{Seq: 1, TTL: 57, RTTMs: 13.102},
+			},
+		},
+		{
+			name: "windows",
+			out:  windowsPing,
+			loss: 0.25,
+			avg:  9,
+			samples: []PingSample{
+				{Seq: 1, TTL: 57, RTTMs: 12},
+				{Seq: 2, TTL: 57, RTTMs: 1},
+				{Seq: 3, TTL: 57, RTTMs: 14},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := parsePing(tt.out)
+			if math.Abs(res.Loss-tt.loss) > 1e-9 {
+				t.Errorf("loss = %v, want %v", res.Loss, tt.loss)
+			}
+			if math.Abs(res.AvgMs-tt.avg) > 1e-9 {
+				t.Errorf("avg = %v, want %v", res.AvgMs, tt.avg)
+			}
+			if len(res.Samples) != len(tt.samples) {
+				t.Fatalf("samples = %+v, want %+v", res.Samples, tt.samples)
+			}
+			for i, s := range res.Samples {
+				if s != tt.samples[i] {
+					t.Errorf("sample %d = %+v, want %+v", i, s, tt.samples[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePingIgnoresSummaryTime(t *testing.T) {
+	res := parsePing(iputilsPing)
+	if res.P95Ms > 12.6 {
+		t.Errorf("p95 = %v, includes the summary's total time", res.P95Ms)
+	}
+}
@@ -0,0 +1,113 @@
+package probes
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// pmtuWait is how long one probe waits for a reply and pmtuTries how
+	// often a size is sent before it counts as silently dropped.
+	pmtuWait  = time.Second
+	pmtuTries = 2
+)
+
+// icmpPMTUSender sends echo requests of the probed size on a socket from
+// openPMTUSocket and waits for the echo reply or for an ICMP error quoting
+// the request. Raw sockets see every ICMP message, so both are matched on
+// the echo identifier and sequence number.
+func icmpPMTUSender(conn *net.IPConn, addr *net.IPAddr, v6 bool) pmtuSender {
+	id := (os.Getpid() ^ rand.Intn(0xffff)) & 0xffff
+	seq := rand.Intn(0x7fff)
+	header, proto := ipv4EchoHeader, protocolICMP
+	var reqType icmp.Type = ipv4.ICMPTypeEcho
+	if v6 {
+		header, proto, reqType = ipv6EchoHeader, protocolIPv6ICMP, ipv6.ICMPTypeEchoRequest
+	}
+	buf := make([]byte, 2048)
+
+	return func(ctx context.Context, size int) (pmtuReply, error) {
+		var r pmtuReply
+		for try := 0; try < pmtuTries; try++ {
+			seq = (seq + 1) & 0xffff
+			payload := make([]byte, size-header)
+			copy(payload, "vne-pmtu")
+			wb, err := (&icmp.Message{Type: reqType, Body: &icmp.Echo{ID: id, Seq: seq, Data: payload}}).Marshal(nil)
+			if err != nil {
+				return r, err
+			}
+			r.sent++
+			if _, err := conn.WriteTo(wb, addr); err != nil {
+				if errors.Is(err, syscall.EMSGSIZE) {
+					r.outcome = pmtuLocal
+					return r, nil
+				}
+				return r, err
+			}
+
+			deadline := time.Now().Add(pmtuWait)
+			if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+				deadline = d
+			}
+			_ = conn.SetReadDeadline(deadline)
+			for {
+				n, src, err := conn.ReadFrom(buf)
+				if err != nil {
+					var netErr net.Error
+					if errors.As(err, &netErr) && netErr.Timeout() {
+						break
+					}
+					return r, err
+				}
+				msg, err := icmp.ParseMessage(proto, buf[:n])
+				if err != nil {
+					continue
+				}
+				switch body := msg.Body.(type) {
+				case *icmp.Echo:
+					if (msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply) &&
+						body.ID == id && body.Seq == seq && addrIP(src).Equal(addr.IP) {
+						r.outcome = pmtuPassed
+						return r, nil
+					}
+				case *icmp.DstUnreach:
+					// Fragmentation Needed is code 4; the next-hop MTU sits
+					// in the header's otherwise unused last two bytes.
+					if msg.Code != 4 || n < 8 {
+						continue
+					}
+					if qid, qseq, ok := quotedEcho(body.Data, false); ok && qid == id && qseq == seq {
+						return pmtuReply{outcome: pmtuTooBig, mtu: int(binary.BigEndian.Uint16(buf[6:8])), from: pmtuHost(src), sent: r.sent}, nil
+					}
+				case *icmp.PacketTooBig:
+					if qid, qseq, ok := quotedEcho(body.Data, true); ok && qid == id && qseq == seq {
+						return pmtuReply{outcome: pmtuTooBig, mtu: body.MTU, from: pmtuHost(src), sent: r.sent}, nil
+					}
+				}
+			}
+			if err := ctx.Err(); err != nil {
+				return r, err
+			}
+		}
+		r.outcome = pmtuDropped
+		return r, nil
+	}
+}
+
+// pmtuHost formats addr for the transcript.
+func pmtuHost(addr net.Addr) string {
+	if ip := addrIP(addr); ip != nil {
+		return ip.String()
+	}
+	return addr.String()
+}
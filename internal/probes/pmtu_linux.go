@@ -0,0 +1,41 @@
+package probes
+
+import (
+	"net"
+	"syscall"
+)
+
+// openPMTUSocket opens a raw ICMP socket that sets the don't-fragment bit on
+// every packet and ignores the kernel's cached path MTU, so each probe goes
+// out at the size asked for. Datagram ICMP sockets only report
+// Fragmentation Needed through the socket error queue, so it needs root or
+// CAP_NET_RAW.
+func openPMTUSocket(v6 bool) (*net.IPConn, error) {
+	network, address := "ip4:icmp", "0.0.0.0"
+	level, opt, val := syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE
+	if v6 {
+		network, address = "ip6:ipv6-icmp", "::"
+		level, opt, val = syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE
+	}
+	pc, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	conn := pc.(*net.IPConn)
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), level, opt, val)
+	}); err != nil {
+		serr = err
+	}
+	if serr != nil {
+		conn.Close()
+		return nil, serr
+	}
+	return conn, nil
+}
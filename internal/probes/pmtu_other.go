@@ -0,0 +1,15 @@
+//go:build !linux
+
+package probes
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// openPMTUSocket fails outside Linux: there is no portable way to set the
+// don't-fragment bit on a raw ICMP socket, so the ping command is used.
+func openPMTUSocket(v6 bool) (*net.IPConn, error) {
+	return nil, fmt.Errorf("%w: no don't-fragment control on %s", errICMPUnavailable, runtime.GOOS)
+}
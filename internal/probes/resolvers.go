@@ -0,0 +1,247 @@
+package probes
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cneate93/vne/internal/dnsx"
+)
+
+// ResolverTypes are the record types each resolver is asked for.
+var ResolverTypes = []string{"A", "AAAA", "CNAME", "MX"}
+
+// ResolverResult holds the queries sent to one resolver over one transport.
+type ResolverResult struct {
+	// Server is the resolver spec, e.g. "192.168.1.1", "tls://1.1.1.1" or a
+	// DNS-over-HTTPS URL.
+	Server string `json:"server"`
+	// Transport is "udp", "tcp", "tls" or "https".
+	Transport string `json:"transport"`
+	// System marks the resolvers configured on the host.
+	System bool `json:"system,omitempty"`
+	// AvgMs and MaxMs cover the queries that got an answer of any kind.
+	AvgMs float64 `json:"avg_ms"`
+	MaxMs float64 `json:"max_ms"`
+	// The counts split the queries by outcome. Failed counts queries with no
+	// usable answer: timeouts, refused connections and TLS or HTTP errors.
+	OK        int `json:"ok"`
+	NXDomain  int `json:"nxdomain"`
+	ServFail  int `json:"servfail"`
+	Refused   int `json:"refused"`
+	Failed    int `json:"failed"`
+	Truncated int `json:"truncated"`
+	// NXDomainNames are the names the resolver said do not exist.
+	NXDomainNames []string        `json:"nxdomain_names,omitempty"`
+	Queries       []ResolverQuery `json:"queries"`
+}
+
+// ResolverQuery is one query and its outcome.
+type ResolverQuery struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// RTTMs is zero when no answer arrived.
+	RTTMs float64 `json:"rtt_ms"`
+	Rcode string  `json:"rcode,omitempty"`
+	// Truncated is set when the UDP answer was cut short and repeated over
+	// TCP.
+	Truncated bool `json:"truncated,omitempty"`
+	// Answers are the values of the answer records of the queried type; a
+	// CNAME chain leading to them is left out.
+	Answers []string `json:"answers,omitempty"`
+	// TTL is the lowest TTL among the answer records.
+	TTL   uint32 `json:"ttl,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// DNSMismatch records resolvers giving different answers to one question.
+type DNSMismatch struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Kind is "rcode" when resolvers disagree whether the name exists, or
+	// "answers" when they return records with nothing in common.
+	Kind   string           `json:"kind"`
+	Groups []DNSAnswerGroup `json:"groups"`
+	// Detail lists the groups on one line, e.g.
+	// "NXDOMAIN from 192.168.1.1; 104.16.132.229 from 1.1.1.1, tls://1.1.1.1".
+	Detail string `json:"detail"`
+}
+
+// maxDetailAnswers caps the records listed per group in DNSMismatch.Detail.
+const maxDetailAnswers = 4
+
+// DNSAnswerGroup is a set of resolvers that gave the same answer.
+type DNSAnswerGroup struct {
+	Servers []string `json:"servers"`
+	Rcode   string   `json:"rcode"`
+	Answers []string `json:"answers,omitempty"`
+}
+
+// CheckResolvers asks every server for the ResolverTypes records of every
+// name, each server on its own so a broken one cannot hide behind the
+// others, and compares the answers between servers. Each query gets its
+// own timeout.
+func CheckResolvers(ctx context.Context, servers []dnsx.Server, names []string, timeout time.Duration) ([]ResolverResult, []DNSMismatch) {
+	return checkResolvers(ctx, &dnsx.Client{Timeout: timeout}, servers, names)
+}
+
+func checkResolvers(ctx context.Context, client *dnsx.Client, servers []dnsx.Server, names []string) ([]ResolverResult, []DNSMismatch) {
+	results := make([]ResolverResult, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		results[i] = ResolverResult{Server: s.String(), Transport: s.Transport}
+		for _, name := range names {
+			for _, t := range ResolverTypes {
+				results[i].Queries = append(results[i].Queries, ResolverQuery{Name: name, Type: t})
+			}
+		}
+		for j := range results[i].Queries {
+			wg.Add(1)
+			go func(s dnsx.Server, q *ResolverQuery) {
+				defer wg.Done()
+				*q = resolverQuery(ctx, client, s, q.Name, q.Type)
+			}(s, &results[i].Queries[j])
+		}
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i].tally()
+	}
+	return results, compareResolvers(results)
+}
+
+func resolverQuery(ctx context.Context, client *dnsx.Client, s dnsx.Server, name, qtype string) ResolverQuery {
+	q := ResolverQuery{Name: name, Type: qtype}
+	resp, err := client.Query(ctx, s, name, qtype)
+	if err != nil {
+		q.Error = err.Error()
+		return q
+	}
+	q.RTTMs = float64(resp.RTT) / float64(time.Millisecond)
+	q.Rcode = resp.Rcode
+	q.Truncated = resp.Truncated
+	for _, rec := range resp.Answers {
+		if rec.Type != qtype {
+			continue
+		}
+		q.Answers = append(q.Answers, rec.Value)
+		if q.TTL == 0 || rec.TTL < q.TTL {
+			q.TTL = rec.TTL
+		}
+	}
+	slices.Sort(q.Answers)
+	return q
+}
+
+// tally fills in the counts and timings from the queries.
+func (r *ResolverResult) tally() {
+	var total float64
+	var answered int
+	for _, q := range r.Queries {
+		if q.Error != "" {
+			r.Failed++
+			continue
+		}
+		answered++
+		total += q.RTTMs
+		r.MaxMs = max(r.MaxMs, q.RTTMs)
+		if q.Truncated {
+			r.Truncated++
+		}
+		switch q.Rcode {
+		case "NOERROR":
+			r.OK++
+		case "NXDOMAIN":
+			r.NXDomain++
+			if !slices.Contains(r.NXDomainNames, q.Name) {
+				r.NXDomainNames = append(r.NXDomainNames, q.Name)
+			}
+		case "SERVFAIL":
+			r.ServFail++
+		case "REFUSED":
+			r.Refused++
+		}
+	}
+	r.AvgMs = avgMs(total, answered)
+}
+
+// compareResolvers looks for questions the resolvers answered differently.
+// Only NOERROR and NXDOMAIN answers are compared; SERVFAIL and timeouts are
+// failures of one resolver rather than a different view of the name. Answer
+// sets that overlap, as with round-robin records, are not a mismatch.
+func compareResolvers(results []ResolverResult) []DNSMismatch {
+	if len(results) < 2 {
+		return nil
+	}
+	var out []DNSMismatch
+	for qi, q := range results[0].Queries {
+		var groups []DNSAnswerGroup
+		for _, r := range results {
+			if qi >= len(r.Queries) {
+				continue
+			}
+			a := r.Queries[qi]
+			if a.Error != "" || (a.Rcode != "NOERROR" && a.Rcode != "NXDOMAIN") {
+				continue
+			}
+			found := false
+			for gi := range groups {
+				if groups[gi].Rcode == a.Rcode && slices.Equal(groups[gi].Answers, a.Answers) {
+					groups[gi].Servers = append(groups[gi].Servers, r.Server)
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, DNSAnswerGroup{Servers: []string{r.Server}, Rcode: a.Rcode, Answers: a.Answers})
+			}
+		}
+		if len(groups) < 2 {
+			continue
+		}
+
+		m := DNSMismatch{Name: q.Name, Type: q.Type, Groups: groups}
+		switch {
+		case slices.ContainsFunc(groups, func(g DNSAnswerGroup) bool { return g.Rcode == "NXDOMAIN" }):
+			m.Kind = "rcode"
+		case hasDisjointAnswers(groups):
+			m.Kind = "answers"
+		default:
+			continue
+		}
+		var parts []string
+		for _, g := range groups {
+			what := g.Rcode
+			if g.Rcode == "NOERROR" {
+				what = "no records"
+				if len(g.Answers) > 0 {
+					what = strings.Join(g.Answers[:min(len(g.Answers), maxDetailAnswers)], ", ")
+				}
+				if n := len(g.Answers) - maxDetailAnswers; n > 0 {
+					what += fmt.Sprintf(" and %d more", n)
+				}
+			}
+			parts = append(parts, what+" from "+strings.Join(g.Servers, ", "))
+		}
+		m.Detail = strings.Join(parts, "; ")
+		out = append(out, m)
+	}
+	return out
+}
+
+// hasDisjointAnswers reports whether two groups share no record. A group
+// with no records counts as disjoint from one with records.
+func hasDisjointAnswers(groups []DNSAnswerGroup) bool {
+	for i := range groups {
+		for j := i + 1; j < len(groups); j++ {
+			if !slices.ContainsFunc(groups[i].Answers, func(v string) bool { return slices.Contains(groups[j].Answers, v) }) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package probes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/cneate93/vne/internal/dnsx"
+	"github.com/cneate93/vne/internal/dnsx/dnstest"
+)
+
+// zoneServer starts a DNS server answering A queries from zone, NXDOMAIN
+// for names listed with no addresses, and NOERROR without records for
+// everything else.
+func zoneServer(t *testing.T, zone map[string][]string) dnsx.Server {
+	t.Helper()
+	srv := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		q := req.Questions[0]
+		addrs, ok := zone[strings.TrimSuffix(q.Name.String(), ".")]
+		if !ok {
+			return dnstest.Reply(req, dnsmessage.RCodeSuccess)
+		}
+		if addrs == nil {
+			return dnstest.Reply(req, dnsmessage.RCodeNameError)
+		}
+		if q.Type != dnsmessage.TypeA {
+			return dnstest.Reply(req, dnsmessage.RCodeSuccess)
+		}
+		var answers []dnsmessage.Resource
+		for _, a := range addrs {
+			answers = append(answers, dnstest.A(q, 300, a))
+		}
+		return dnstest.Reply(req, dnsmessage.RCodeSuccess, answers...)
+	})
+	t.Cleanup(srv.Close)
+	return dnsx.Server{Transport: "udp", Addr: srv.Addr}
+}
+
+func TestCheckResolvers(t *testing.T) {
+	a := zoneServer(t, map[string][]string{
+		"rr.example":    {"192.0.2.1", "192.0.2.2"},
+		"gone.example":  nil,
+		"split.example": {"192.0.2.10"},
+	})
+	b := zoneServer(t, map[string][]string{
+		"rr.example":    {"192.0.2.2", "192.0.2.3"},
+		"gone.example":  {"198.51.100.7"},
+		"split.example": {"203.0.113.10"},
+	})
+	failing := dnstest.NewServer(func(req *dnsmessage.Message, tcp bool) *dnsmessage.Message {
+		return dnstest.Reply(req, dnsmessage.RCodeServerFailure)
+	})
+	defer failing.Close()
+	c := dnsx.Server{Transport: "tcp", Addr: failing.Addr}
+
+	names := []string{"rr.example", "gone.example", "split.example"}
+	client := &dnsx.Client{Timeout: time.Second}
+	results, mismatches := checkResolvers(context.Background(), client, []dnsx.Server{a, b, c}, names)
+
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	perServer := len(names) * len(ResolverTypes)
+	if r := results[0]; r.NXDomain != len(ResolverTypes) || r.OK != perServer-len(ResolverTypes) ||
+		len(r.NXDomainNames) != 1 || r.NXDomainNames[0] != "gone.example" {
+		t.Errorf("%s: ok %d nxdomain %d %v", r.Server, r.OK, r.NXDomain, r.NXDomainNames)
+	}
+	if r := results[2]; r.ServFail != perServer || r.Transport != "tcp" || r.Failed != 0 {
+		t.Errorf("%s: servfail %d failed %d, want every query SERVFAIL", r.Server, r.ServFail, r.Failed)
+	}
+
+	// The round-robin sets overlap, so rr.example is not a mismatch; the
+	// failing resolver is not compared at all.
+	kinds := map[string]string{}
+	for _, m := range mismatches {
+		if m.Type != "A" && m.Kind == "answers" {
+			t.Errorf("%s %s: mismatch between empty answers", m.Name, m.Type)
+		}
+		kinds[m.Name+" "+m.Type] = m.Kind
+		for _, g := range m.Groups {
+			for _, s := range g.Servers {
+				if s == c.String() {
+					t.Errorf("%s %s: SERVFAIL resolver compared", m.Name, m.Type)
+				}
+			}
+		}
+	}
+	if _, ok := kinds["rr.example A"]; ok {
+		t.Errorf("overlapping round-robin answers flagged")
+	}
+	if kinds["gone.example A"] != "rcode" {
+		t.Errorf("gone.example A: kind %q, want rcode", kinds["gone.example A"])
+	}
+	if kinds["split.example A"] != "answers" {
+		t.Errorf("split.example A: kind %q, want answers", kinds["split.example A"])
+	}
+	for _, m := range mismatches {
+		if m.Name == "split.example" && m.Type == "A" {
+			want := "192.0.2.10 from " + a.String() + "; 203.0.113.10 from " + b.String()
+			if m.Detail != want {
+				t.Errorf("detail %q, want %q", m.Detail, want)
+			}
+		}
+	}
+}
+
+func TestCompareResolversEmptyAnswer(t *testing.T) {
+	q := func(answers ...string) []ResolverQuery {
+		return []ResolverQuery{{Name: "x.example", Type: "A", Rcode: "NOERROR", Answers: answers}}
+	}
+	results := []ResolverResult{
+		{Server: "a", Queries: q("192.0.2.1")},
+		{Server: "b", Queries: q()},
+	}
+	m := compareResolvers(results)
+	if len(m) != 1 || m[0].Kind != "answers" || !strings.Contains(m[0].Detail, "no records from b") {
+		t.Errorf("mismatches %+v, want an answers mismatch against no records", m)
+	}
+	if m := compareResolvers(results[:1]); m != nil {
+		t.Errorf("one resolver compared with itself: %+v", m)
+	}
+}
@@ -0,0 +1,197 @@
+package probes
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// netlinkRoutes dumps the unicast routes of every routing table, so routes
+// in policy routing tables are included. Routes in the local table and to
+// link-local or multicast prefixes are left out.
+func netlinkRoutes() ([]Route, error) {
+	names := interfaceNames()
+	var routes []Route
+	for _, family := range []int{syscall.AF_INET, syscall.AF_INET6} {
+		rib, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, family)
+		if err != nil {
+			return nil, fmt.Errorf("netlink route dump: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(rib)
+		if err != nil {
+			return nil, fmt.Errorf("parse netlink routes: %w", err)
+		}
+		for _, m := range msgs {
+			if m.Header.Type != syscall.RTM_NEWROUTE || len(m.Data) < syscall.SizeofRtMsg {
+				continue
+			}
+			if r, ok := parseRouteMessage(m, names); ok {
+				routes = append(routes, r)
+			}
+		}
+	}
+	return routes, nil
+}
+
+// parseRouteMessage converts one RTM_NEWROUTE message. The rtmsg header is
+// family, dst_len, src_len, tos, table, protocol, scope, type and flags.
+func parseRouteMessage(m syscall.NetlinkMessage, names map[int]string) (Route, bool) {
+	family, dstLen, table, kind := m.Data[0], int(m.Data[1]), int(m.Data[4]), m.Data[7]
+	if kind != syscall.RTN_UNICAST {
+		return Route{}, false
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil {
+		return Route{}, false
+	}
+	var dst net.IP
+	r := Route{Table: table}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_DST:
+			dst = net.IP(a.Value)
+		case syscall.RTA_GATEWAY:
+			r.Gateway = net.IP(a.Value).String()
+		case syscall.RTA_OIF:
+			if len(a.Value) >= 4 {
+				r.Iface = names[int(binary.NativeEndian.Uint32(a.Value))]
+			}
+		case syscall.RTA_PRIORITY:
+			if len(a.Value) >= 4 {
+				r.Metric = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		case syscall.RTA_TABLE:
+			// Table IDs above 255 only fit in the attribute.
+			if len(a.Value) >= 4 {
+				r.Table = int(binary.NativeEndian.Uint32(a.Value))
+			}
+		}
+	}
+	bits := 32
+	if family == syscall.AF_INET6 {
+		bits = 128
+	}
+	if dst == nil {
+		dst = make(net.IP, bits/8)
+	}
+	prefix := &net.IPNet{IP: dst, Mask: net.CIDRMask(dstLen, bits)}
+	r.Destination = prefix.String()
+	return r, keepRoute(r.Table, dst)
+}
+
+// procRoutes reads the main table from /proc/net/route and
+// /proc/net/ipv6_route, which do not show policy routing tables.
+func procRoutes() []Route {
+	var routes []Route
+	if b, err := os.ReadFile("/proc/net/route"); err == nil {
+		routes = append(routes, parseProcRoute(string(b))...)
+	}
+	if b, err := os.ReadFile("/proc/net/ipv6_route"); err == nil {
+		routes = append(routes, parseProcIPv6Route(string(b))...)
+	}
+	return routes
+}
+
+const (
+	rtfUp      = 0x0001
+	rtfGateway = 0x0002
+	rtfReject  = 0x0200
+)
+
+// parseProcRoute parses /proc/net/route, whose addresses are little-endian
+// hex:
+//
+//	Iface Destination Gateway  Flags RefCnt Use Metric Mask     MTU Window IRTT
+//	eth0  00000000    0101A8C0 0003  0      0   100    00000000 0   0      0
+func parseProcRoute(content string) []Route {
+	var routes []Route
+	for _, line := range strings.Split(content, "\n")[1:] {
+		f := strings.Fields(line)
+		if len(f) < 8 {
+			continue
+		}
+		flags, _ := strconv.ParseUint(f[3], 16, 32)
+		dst, mask := procIPv4(f[1]), procIPv4(f[7])
+		if flags&rtfUp == 0 || flags&rtfReject != 0 || dst == nil || mask == nil {
+			continue
+		}
+		metric, _ := strconv.Atoi(f[6])
+		r := Route{
+			Table:       routeTableMain,
+			Destination: (&net.IPNet{IP: dst.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)}).String(),
+			Iface:       f[0],
+			Metric:      metric,
+		}
+		if gw := procIPv4(f[2]); flags&rtfGateway != 0 && gw != nil {
+			r.Gateway = gw.String()
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+func procIPv4(h string) net.IP {
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return nil
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip
+}
+
+// parseProcIPv6Route parses /proc/net/ipv6_route: destination, prefix
+// length, source, source prefix length, next hop, metric, refcount, use,
+// flags and interface, all in hex.
+func parseProcIPv6Route(content string) []Route {
+	var routes []Route
+	for _, line := range strings.Split(content, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 10 {
+			continue
+		}
+		dst, err1 := hex.DecodeString(f[0])
+		dstLen, err2 := strconv.ParseUint(f[1], 16, 8)
+		gw, err3 := hex.DecodeString(f[4])
+		metric, err4 := strconv.ParseUint(f[5], 16, 32)
+		flags, err5 := strconv.ParseUint(f[8], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil || len(dst) != 16 || len(gw) != 16 {
+			continue
+		}
+		if flags&rtfUp == 0 || flags&rtfReject != 0 || f[9] == "lo" {
+			continue
+		}
+		if !keepRoute(routeTableMain, net.IP(dst)) {
+			continue
+		}
+		r := Route{
+			Table:       routeTableMain,
+			Destination: (&net.IPNet{IP: net.IP(dst), Mask: net.CIDRMask(int(dstLen), 128)}).String(),
+			Iface:       f[9],
+			Metric:      int(metric),
+		}
+		if flags&rtfGateway != 0 && !net.IP(gw).IsUnspecified() {
+			r.Gateway = net.IP(gw).String()
+		}
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+func keepRoute(table int, dst net.IP) bool {
+	return table != routeTableLocal && !dst.IsMulticast() && !dst.IsLinkLocalUnicast()
+}
+
+func interfaceNames() map[int]string {
+	names := map[int]string{}
+	ifs, _ := net.Interfaces()
+	for _, it := range ifs {
+		names[it.Index] = it.Name
+	}
+	return names
+}
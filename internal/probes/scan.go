@@ -5,12 +5,15 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/cneate93/vne/internal/procx"
 )
 
 const maxScanWorkers = 128
@@ -20,20 +23,121 @@ type L2Host struct {
 	IP     string `json:"ip"`
 	MAC    string `json:"mac"`
 	Vendor string `json:"vendor,omitempty"`
+	// Router is set for IPv6 neighbours that advertise themselves as routers.
+	Router bool `json:"router,omitempty"`
+	// Source is how the host was found: "arp" for a reply to an ARP
+	// request, "arp-passive" for ARP traffic overheard during the scan,
+	// "arp-cache" for the system ARP cache and "ndp" for the IPv6
+	// neighbour cache.
+	Source string `json:"source,omitempty"`
+	// RTTMs is how long the host took to answer the ARP request.
+	RTTMs float64 `json:"rtt_ms,omitempty"`
+	// ConflictMACs lists the other MAC addresses seen for IP during the
+	// scan or in the ARP cache, a sign of an address conflict or of ARP
+	// spoofing.
+	ConflictMACs []string `json:"conflict_macs,omitempty"`
+	// Gratuitous is set when the host announced its address unasked
+	// during the scan.
+	Gratuitous bool `json:"gratuitous,omitempty"`
+	// Gateway is set when IP is one of this host's default gateways.
+	Gateway bool `json:"gateway,omitempty"`
+	// Hostname is the name the host answered mDNS, LLMNR or NetBIOS
+	// queries with.
+	Hostname string `json:"hostname,omitempty"`
+	// Model is the make and model the host advertises over mDNS or UPnP,
+	// e.g. "HP LaserJet Pro M404dn", and Kind the sort of device its
+	// services make it, e.g. "printer".
+	Model string `json:"model,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	// Services lists what the host advertised: DNS-SD service types such
+	// as "_ipp._tcp", UPnP device types such as "upnp:MediaRenderer" and
+	// "netbios:file-server".
+	Services []string `json:"services,omitempty"`
+}
+
+// L2Change is a discovered address that answers from another MAC address
+// than it did in an earlier run: a replaced device, an address handed to
+// another device, or ARP spoofing.
+type L2Change struct {
+	IfName  string `json:"if_name"`
+	IP      string `json:"ip"`
+	Gateway bool   `json:"gateway,omitempty"`
+	// BeforeMAC and BeforeVendor are what the earlier run recorded.
+	BeforeMAC    string `json:"before_mac"`
+	AfterMAC     string `json:"after_mac"`
+	BeforeVendor string `json:"before_vendor,omitempty"`
+	AfterVendor  string `json:"after_vendor,omitempty"`
+	// Run identifies the earlier run, e.g. its history ID.
+	Run string `json:"run,omitempty"`
+}
+
+// CompareL2Hosts lists the addresses in after that answered from a MAC
+// address other than the one recorded for them on the same interface in
+// before; the same private address on another interface is another host.
+// An address whose old MAC still answered alongside the new one is left to
+// its ConflictMACs.
+func CompareL2Hosts(before, after []L2Host) []L2Change {
+	type hostKey struct{ ifName, ip string }
+	known := map[hostKey]L2Host{}
+	for _, h := range before {
+		if h.MAC != "" {
+			known[hostKey{h.IfName, h.IP}] = h
+		}
+	}
+	var changes []L2Change
+	for _, h := range after {
+		old, ok := known[hostKey{h.IfName, h.IP}]
+		if !ok || h.MAC == "" || old.MAC == h.MAC || containsString(h.ConflictMACs, old.MAC) {
+			continue
+		}
+		changes = append(changes, L2Change{
+			IfName:       h.IfName,
+			IP:           h.IP,
+			Gateway:      h.Gateway || old.Gateway,
+			BeforeMAC:    old.MAC,
+			AfterMAC:     h.MAC,
+			BeforeVendor: old.Vendor,
+			AfterVendor:  h.Vendor,
+		})
+	}
+	return changes
 }
 
 type scanTarget struct {
 	IfName  string
+	Index   int
+	HWAddr  net.HardwareAddr
 	LocalIP net.IP
 	Network *net.IPNet
-	Hosts   []string
+	// Gateways are the default gateways on the interface's subnet that lie
+	// outside Network; they are scanned regardless of the CIDR limit.
+	Gateways []net.IP
+	Hosts    []string
 }
 
-// L2Scan performs a best-effort layer-2 discovery by ping sweeping the local
-// subnets for each active interface with a private IPv4 address. The sweep is
-// bounded by the provided guardrails (timeout, host budget, and CIDR limit) and
-// then parses the system ARP cache to return discovered hosts.
-func L2Scan(ctx context.Context, timeout time.Duration, maxHosts int, cidrLimit int) ([]L2Host, error) {
+// covers reports whether ip is scanned on t.
+func (t *scanTarget) covers(ip net.IP) bool {
+	if t.Network.Contains(ip) {
+		return true
+	}
+	for _, gw := range t.Gateways {
+		if gw.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// L2Scan performs a best-effort layer-2 discovery of the local subnets for
+// each active interface with a private IPv4 address, bounded by the
+// provided guardrails (timeout, host budget, and CIDR limit). On Linux it
+// sends ARP requests itself over a packet socket, which finds hosts that
+// drop ICMP and notices conflicting and gratuitous replies, then adds the
+// system ARP cache. Without the privileges for that, and on other
+// platforms, it ping sweeps the subnets and parses the ARP cache instead.
+// The IPv4 addresses in gateways are always scanned and marked as
+// gateways. NDPScan covers IPv6 neighbours.
+func L2Scan(ctx context.Context, timeout time.Duration, maxHosts int, cidrLimit int, gateways []string) ([]L2Host, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -47,22 +151,55 @@ func L2Scan(ctx context.Context, timeout time.Duration, maxHosts int, cidrLimit
 		cidrLimit = 24
 	}
 
-	pingPath, err := exec.LookPath("ping")
-	if err != nil {
-		return []L2Host{}, fmt.Errorf("ping command not found: %w", err)
+	var gws []net.IP
+	for _, gw := range gateways {
+		if ip := net.ParseIP(gw).To4(); ip != nil {
+			gws = append(gws, ip)
+		}
 	}
-	arpPath, err := exec.LookPath("arp")
+	targets, err := scanTargets(ctx, maxHosts, cidrLimit, gws)
 	if err != nil {
-		return []L2Host{}, fmt.Errorf("arp command not found: %w", err)
+		return []L2Host{}, err
+	}
+	if len(targets) == 0 {
+		return []L2Host{}, nil
 	}
 
-	if err := ctx.Err(); err != nil {
-		return nil, err
+	hosts, err := arpScan(ctx, targets, timeout)
+	if err == nil {
+		// The cache adds hosts that talked to this machine recently but
+		// missed the requests.
+		cached, _ := readARPCache(ctx, targets)
+		hosts = mergeCachedHosts(hosts, cached)
+		err = ctx.Err()
+	} else if ctx.Err() != nil {
+		return nil, ctx.Err()
+	} else {
+		hosts, err = sweepScan(ctx, targets, timeout)
+	}
+	markGateways(hosts, gws)
+	return hosts, err
+}
+
+// markGateways sets Gateway on the hosts whose address is in gws.
+func markGateways(hosts []L2Host, gws []net.IP) {
+	for i := range hosts {
+		ip := net.ParseIP(hosts[i].IP)
+		for _, gw := range gws {
+			if gw.Equal(ip) {
+				hosts[i].Gateway = true
+			}
+		}
 	}
+}
 
+// scanTargets lists the subnets to sweep, at most maxHosts addresses in
+// all. Gateways on an interface's subnet are added even when the CIDR limit
+// or the budget would leave them out.
+func scanTargets(ctx context.Context, maxHosts, cidrLimit int, gateways []net.IP) ([]*scanTarget, error) {
 	interfaces, err := net.Interfaces()
 	if err != nil {
-		return []L2Host{}, fmt.Errorf("list interfaces: %w", err)
+		return nil, fmt.Errorf("list interfaces: %w", err)
 	}
 
 	remaining := maxHosts
@@ -116,21 +253,47 @@ func L2Scan(ctx context.Context, timeout time.Duration, maxHosts int, cidrLimit
 				filtered = append(filtered, host)
 			}
 			hosts = filtered
-			if len(hosts) == 0 {
-				continue
-			}
 			remaining -= len(hosts)
-			targets = append(targets, &scanTarget{
+			t := &scanTarget{
 				IfName:  iface.Name,
+				Index:   iface.Index,
+				HWAddr:  iface.HardwareAddr,
 				LocalIP: append(net.IP(nil), ip4...),
 				Network: sweepNet,
-				Hosts:   hosts,
-			})
+			}
+			for _, gw := range gateways {
+				if !ipNet.Contains(gw) || gw.Equal(ip4) {
+					continue
+				}
+				if !sweepNet.Contains(gw) {
+					t.Gateways = append(t.Gateways, gw)
+				}
+				if !containsString(hosts, gw.String()) {
+					hosts = append(hosts, gw.String())
+				}
+			}
+			if len(hosts) == 0 {
+				continue
+			}
+			t.Hosts = hosts
+			targets = append(targets, t)
 		}
 	}
+	return targets, nil
+}
 
-	if len(targets) == 0 {
-		return []L2Host{}, nil
+// sweepScan pings every target address so the system resolves it, then
+// reads the ARP cache. It needs no privileges but misses hosts that are
+// slow to answer ARP and sees only one MAC address per IP.
+func sweepScan(ctx context.Context, targets []*scanTarget, timeout time.Duration) ([]L2Host, error) {
+	pingPath, err := exec.LookPath("ping")
+	if err != nil {
+		// The cache alone still lists the hosts this machine talked to.
+		hosts, _ := readARPCache(ctx, targets)
+		if hosts == nil {
+			hosts = []L2Host{}
+		}
+		return hosts, fmt.Errorf("ping command not found: %w", err)
 	}
 
 	hostSet := map[string]struct{}{}
@@ -194,20 +357,89 @@ func L2Scan(ctx context.Context, timeout time.Duration, maxHosts int, cidrLimit
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-
-	arpCmd := exec.CommandContext(ctx, arpPath, "-a")
-	arpOut, err := arpCmd.CombinedOutput()
+	hosts, err := readARPCache(ctx, targets)
 	if err != nil {
-		return []L2Host{}, fmt.Errorf("execute arp -a: %w", err)
+		return []L2Host{}, err
 	}
-
-	hosts := parseARP(string(arpOut), targets)
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	return hosts, nil
 }
 
+// readARPCache returns the system ARP cache entries inside targets, from
+// /proc/net/arp on Linux and "arp -a" elsewhere.
+func readARPCache(ctx context.Context, targets []*scanTarget) ([]L2Host, error) {
+	if runtime.GOOS == "linux" {
+		if data, err := os.ReadFile("/proc/net/arp"); err == nil {
+			return parseProcARP(string(data), targets), nil
+		}
+	}
+	arpPath, err := exec.LookPath("arp")
+	if err != nil {
+		return nil, fmt.Errorf("arp command not found: %w", err)
+	}
+	out, err := procx.CommandContext(ctx, arpPath, "-a").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("execute arp -a: %w", err)
+	}
+	return parseARP(string(out), targets), nil
+}
+
+// parseProcARP handles Linux /proc/net/arp, skipping incomplete entries
+// (flags without ATF_COM, 0x2):
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.1      0x1         0x2         00:11:22:33:44:55     *        eth0
+func parseProcARP(output string, targets []*scanTarget) []L2Host {
+	var hosts []L2Host
+	seen := map[string]int{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || flags&0x2 == 0 {
+			continue
+		}
+		mac := normalizeMAC(fields[3])
+		if mac == "" {
+			continue
+		}
+		addHost(&hosts, seen, targets, ip, fields[5], mac)
+	}
+	return hosts
+}
+
+// mergeCachedHosts adds the cache entries for addresses the ARP scan did
+// not find. A cached MAC that differs from the one the scan saw is kept
+// as a conflict: the cache may still hold a spoofed reply.
+func mergeCachedHosts(hosts, cached []L2Host) []L2Host {
+	known := map[string]int{}
+	for i, h := range hosts {
+		known[h.IfName+"|"+h.IP] = i
+	}
+	for _, c := range cached {
+		i, ok := known[c.IfName+"|"+c.IP]
+		if !ok {
+			hosts = append(hosts, c)
+			continue
+		}
+		h := &hosts[i]
+		for _, mac := range append([]string{c.MAC}, c.ConflictMACs...) {
+			if mac != h.MAC && !containsString(h.ConflictMACs, mac) {
+				h.ConflictMACs = append(h.ConflictMACs, mac)
+			}
+		}
+	}
+	return hosts
+}
+
 func runPing(ctx context.Context, pingPath, ip string, timeout time.Duration) error {
 	if ctx == nil {
 		ctx = context.Background()
@@ -215,7 +447,7 @@ func runPing(ctx context.Context, pingPath, ip string, timeout time.Duration) er
 	pingCtx, cancel := context.WithTimeout(ctx, timeout+time.Second)
 	defer cancel()
 	args := pingArgs(ip, timeout)
-	cmd := exec.CommandContext(pingCtx, pingPath, args...)
+	cmd := procx.CommandContext(pingCtx, pingPath, args...)
 	return cmd.Run()
 }
 
@@ -329,7 +561,7 @@ func parseARP(output string, targets []*scanTarget) []L2Host {
 
 	lines := strings.Split(output, "\n")
 	var current []*scanTarget
-	seen := map[string]struct{}{}
+	seen := map[string]int{}
 	var hosts []L2Host
 
 	for _, raw := range lines {
@@ -416,41 +648,47 @@ func parseARP(output string, targets []*scanTarget) []L2Host {
 	return hosts
 }
 
-func addHost(hosts *[]L2Host, seen map[string]struct{}, candidates []*scanTarget, ip net.IP, ifaceHint, mac string) bool {
+// addHost records that ip answered from mac on the first candidate subnet
+// holding it, preferring the interface named by ifaceHint. A second MAC for
+// an address already listed is added to its ConflictMACs. seen maps
+// interface and address to the host's index in hosts.
+func addHost(hosts *[]L2Host, seen map[string]int, candidates []*scanTarget, ip net.IP, ifaceHint, mac string) bool {
 	if len(candidates) == 0 {
 		return false
 	}
-	vendor := ""
-	if info, ok := VendorFromMAC(mac); ok {
-		vendor = info.Name
+	add := func(cand *scanTarget) {
+		key := cand.IfName + "|" + ip.String()
+		if i, exists := seen[key]; exists {
+			h := &(*hosts)[i]
+			if mac != h.MAC && !containsString(h.ConflictMACs, mac) {
+				h.ConflictMACs = append(h.ConflictMACs, mac)
+			}
+			return
+		}
+		vendor := ""
+		if info, ok := VendorFromMAC(mac); ok {
+			vendor = info.Name
+		}
+		seen[key] = len(*hosts)
+		*hosts = append(*hosts, L2Host{IfName: cand.IfName, IP: ip.String(), MAC: mac, Vendor: vendor, Source: "arp-cache"})
 	}
 	for _, cand := range candidates {
-		if cand == nil || !cand.Network.Contains(ip) {
+		if cand == nil || !cand.covers(ip) {
 			continue
 		}
 		if ifaceHint != "" && !strings.EqualFold(cand.IfName, ifaceHint) {
 			// If we have an interface hint, prefer matching it.
 			continue
 		}
-		key := cand.IfName + "|" + ip.String() + "|" + mac
-		if _, exists := seen[key]; exists {
-			return true
-		}
-		seen[key] = struct{}{}
-		*hosts = append(*hosts, L2Host{IfName: cand.IfName, IP: ip.String(), MAC: mac, Vendor: vendor})
+		add(cand)
 		return true
 	}
 	// no strict match; try again without interface hint requirement
 	for _, cand := range candidates {
-		if cand == nil || !cand.Network.Contains(ip) {
+		if cand == nil || !cand.covers(ip) {
 			continue
 		}
-		key := cand.IfName + "|" + ip.String() + "|" + mac
-		if _, exists := seen[key]; exists {
-			return true
-		}
-		seen[key] = struct{}{}
-		*hosts = append(*hosts, L2Host{IfName: cand.IfName, IP: ip.String(), MAC: mac, Vendor: vendor})
+		add(cand)
 		return true
 	}
 	return false
@@ -474,12 +712,29 @@ func normalizeMAC(raw string) string {
 	if !strings.Contains(mac, ":") {
 		return ""
 	}
+	// BSD and macOS drop leading zeros, e.g. "0:11:22:3:44:55".
+	octets := strings.Split(mac, ":")
+	for i, o := range octets {
+		if len(o) == 1 {
+			octets[i] = "0" + o
+		}
+	}
+	mac = strings.Join(octets, ":")
 	if strings.Contains(mac, "ff:ff:ff:ff:ff:ff") || strings.Contains(mac, "00:00:00:00:00:00") {
 		return ""
 	}
 	return mac
 }
 
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func extractBetween(s, start, end string) string {
 	i := strings.Index(s, start)
 	if i == -1 {
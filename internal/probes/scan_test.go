@@ -0,0 +1,96 @@
+package probes
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareL2Hosts(t *testing.T) {
+	const (
+		macA = "00:11:22:33:44:55"
+		macB = "66:77:88:99:aa:bb"
+		macC = "cc:dd:ee:ff:00:11"
+	)
+	host := func(ifName, ip, mac string) L2Host { return L2Host{IfName: ifName, IP: ip, MAC: mac} }
+	tests := []struct {
+		name          string
+		before, after []L2Host
+		want          []L2Change
+	}{
+		{
+			name:   "unchanged",
+			before: []L2Host{host("eth0", "10.0.0.5", macA)},
+			after:  []L2Host{host("eth0", "10.0.0.5", macA)},
+		},
+		{
+			name:   "new MAC",
+			before: []L2Host{{IfName: "eth0", IP: "10.0.0.5", MAC: macA, Vendor: "Dell"}},
+			after:  []L2Host{{IfName: "eth0", IP: "10.0.0.5", MAC: macB, Vendor: "HP"}},
+			want:   []L2Change{{IfName: "eth0", IP: "10.0.0.5", BeforeMAC: macA, AfterMAC: macB, BeforeVendor: "Dell", AfterVendor: "HP"}},
+		},
+		{
+			// The old MAC still answered too: a conflict, reported as such.
+			name:   "old MAC among the conflicts",
+			before: []L2Host{host("eth0", "10.0.0.5", macA)},
+			after:  []L2Host{{IfName: "eth0", IP: "10.0.0.5", MAC: macB, ConflictMACs: []string{macC, macA}}},
+		},
+		{
+			name:   "other conflicts only",
+			before: []L2Host{host("eth0", "10.0.0.5", macA)},
+			after:  []L2Host{{IfName: "eth0", IP: "10.0.0.5", MAC: macB, ConflictMACs: []string{macC}}},
+			want:   []L2Change{{IfName: "eth0", IP: "10.0.0.5", BeforeMAC: macA, AfterMAC: macB}},
+		},
+		{
+			name:   "no MAC now",
+			before: []L2Host{host("eth0", "10.0.0.5", macA)},
+			after:  []L2Host{host("eth0", "10.0.0.5", "")},
+		},
+		{
+			name:   "no MAC before",
+			before: []L2Host{host("eth0", "10.0.0.5", "")},
+			after:  []L2Host{host("eth0", "10.0.0.5", macB)},
+		},
+		{
+			name:   "gateway before",
+			before: []L2Host{{IfName: "eth0", IP: "10.0.0.1", MAC: macA, Gateway: true}},
+			after:  []L2Host{host("eth0", "10.0.0.1", macB)},
+			want:   []L2Change{{IfName: "eth0", IP: "10.0.0.1", Gateway: true, BeforeMAC: macA, AfterMAC: macB}},
+		},
+		{
+			name:   "gateway now",
+			before: []L2Host{host("eth0", "10.0.0.1", macA)},
+			after:  []L2Host{{IfName: "eth0", IP: "10.0.0.1", MAC: macB, Gateway: true}},
+			want:   []L2Change{{IfName: "eth0", IP: "10.0.0.1", Gateway: true, BeforeMAC: macA, AfterMAC: macB}},
+		},
+		{
+			// The same private address behind another interface is another
+			// host.
+			name:   "other interface",
+			before: []L2Host{host("eth0", "192.168.1.1", macA), host("wlan0", "192.168.1.1", macB)},
+			after:  []L2Host{host("wlan0", "192.168.1.1", macB), host("eth0", "192.168.1.1", macA)},
+		},
+		{
+			name:   "moved interface",
+			before: []L2Host{host("eth0", "192.168.1.1", macA)},
+			after:  []L2Host{host("eth1", "192.168.1.1", macB)},
+		},
+		{
+			name:   "in the order found",
+			before: []L2Host{host("eth0", "10.0.0.1", macA), host("eth0", "10.0.0.2", macB), host("eth0", "10.0.0.3", macC)},
+			after:  []L2Host{host("eth0", "10.0.0.3", macA), host("eth0", "10.0.0.9", macA), host("eth0", "10.0.0.1", macC)},
+			want: []L2Change{
+				{IfName: "eth0", IP: "10.0.0.3", BeforeMAC: macC, AfterMAC: macA},
+				{IfName: "eth0", IP: "10.0.0.1", BeforeMAC: macA, AfterMAC: macC},
+			},
+		},
+		{
+			name:  "no earlier run",
+			after: []L2Host{host("eth0", "10.0.0.5", macA)},
+		},
+	}
+	for _, tt := range tests {
+		if got := CompareL2Hosts(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
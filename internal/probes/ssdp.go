@@ -0,0 +1,168 @@
+package probes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxDescription bounds the UPnP device description read from a host.
+	maxDescription = 256 << 10
+	// upnpModelRank ranks UPnP models after the DNS-SD TXT keys, which
+	// name printers more precisely.
+	upnpModelRank = 10
+)
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// upnpKinds maps UPnP device types to device kinds.
+var upnpKinds = map[string]string{
+	"InternetGatewayDevice": "router",
+	"WLANAccessPointDevice": "access point",
+	"MediaRenderer":         "media player",
+	"dial":                  "media player",
+	"ZonePlayer":            "speaker",
+	"MediaServer":           "media server",
+	"Printer":               "printer",
+	"Scanner":               "scanner",
+	"DigitalSecurityCamera": "camera",
+}
+
+// upnpDevice is the part of a UPnP device description (UPnP Device
+// Architecture, section 2.3) that names the device.
+type upnpDevice struct {
+	DeviceType   string `xml:"deviceType"`
+	Manufacturer string `xml:"manufacturer"`
+	ModelName    string `xml:"modelName"`
+	ModelNumber  string `xml:"modelNumber"`
+}
+
+// ssdpIdentify sends an SSDP M-SEARCH for all devices and fetches the
+// device description each responder points to. Only descriptions served
+// by the responder itself are fetched.
+func ssdpIdentify(ctx context.Context, ifaces []net.Interface, window time.Duration, ids *identities) {
+	if len(ifaces) == 0 {
+		return
+	}
+	conn, pc, err := listenMulticast()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	search := []byte(fmt.Sprintf("M-SEARCH * HTTP/1.1\r\nHOST: %s\r\nMAN: \"ssdp:discover\"\r\nMX: %d\r\nST: ssdp:all\r\n\r\n",
+		ssdpGroup, max(int(window/time.Second)-1, 1)))
+	// SSDP runs over UDP without retries of its own, so the search is sent
+	// twice.
+	sendMulticast(pc, ifaces, ssdpGroup, search)
+	start := time.Now()
+	var resent bool
+	tick := func() {
+		if !resent && time.Since(start) >= window/4 {
+			resent = true
+			sendMulticast(pc, ifaces, ssdpGroup, search)
+		}
+	}
+	locations := map[string]string{}
+	readUDPReplies(ctx, conn, start.Add(window), tick, func(src net.IP, b []byte) {
+		key := src.String()
+		if _, ok := locations[key]; ok {
+			return
+		}
+		if loc, ok := ssdpLocation(src, b); ok {
+			locations[key] = loc
+		}
+	})
+
+	client := &http.Client{Timeout: window}
+	var wg sync.WaitGroup
+	for addr, loc := range locations {
+		wg.Add(1)
+		go func(src net.IP, loc string) {
+			defer wg.Done()
+			dev, err := upnpDescribe(ctx, client, loc)
+			if err != nil {
+				return
+			}
+			ids.model(src, dev.model(), upnpModelRank)
+			if t := upnpType(dev.DeviceType); t != "" {
+				ids.service(src, "upnp:"+t)
+				ids.kind(src, upnpKinds[t])
+			}
+		}(net.ParseIP(addr), loc)
+	}
+	wg.Wait()
+}
+
+// ssdpLocation returns the device description URL of an SSDP search
+// response from src, provided src serves it over plain HTTP.
+func ssdpLocation(src net.IP, b []byte) (string, bool) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+	if err != nil {
+		return "", false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	u, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || u.Scheme != "http" || u.Hostname() != src.String() {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// model joins the manufacturer, model name and number, leaving out what
+// repeats.
+func (d upnpDevice) model() string {
+	model := strings.TrimSpace(d.ModelName)
+	if n := strings.TrimSpace(d.ModelNumber); n != "" && !strings.Contains(model, n) {
+		model = strings.TrimSpace(model + " " + n)
+	}
+	if model == "" {
+		return ""
+	}
+	return withMaker(d.Manufacturer, model)
+}
+
+// upnpDescribe fetches and decodes the root device of a UPnP description.
+func upnpDescribe(ctx context.Context, client *http.Client, loc string) (upnpDevice, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc, nil)
+	if err != nil {
+		return upnpDevice{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return upnpDevice{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return upnpDevice{}, fmt.Errorf("device description: %s", resp.Status)
+	}
+	var root struct {
+		Device upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxDescription)).Decode(&root); err != nil {
+		return upnpDevice{}, err
+	}
+	return root.Device, nil
+}
+
+// upnpType returns the type name of a device type URN, e.g. "MediaRenderer"
+// for "urn:schemas-upnp-org:device:MediaRenderer:1".
+func upnpType(urn string) string {
+	parts := strings.Split(urn, ":")
+	if len(parts) < 4 || parts[2] != "device" {
+		return ""
+	}
+	return parts[3]
+}
@@ -0,0 +1,132 @@
+package probes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ssdpReply is a search response as a home router sends it.
+func ssdpReply(status, location string) []byte {
+	return []byte("HTTP/1.1 " + status + "\r\n" +
+		"CACHE-CONTROL: max-age=120\r\n" +
+		"ST: upnp:rootdevice\r\n" +
+		"USN: uuid:2d5e1e2a-0000-1000-8000-00259c000001::upnp:rootdevice\r\n" +
+		"EXT:\r\n" +
+		"SERVER: Linux/3.14 UPnP/1.0 MiniUPnPd/2.1\r\n" +
+		"LOCATION: " + location + "\r\n" +
+		"\r\n")
+}
+
+func TestSSDPLocation(t *testing.T) {
+	src := net.IPv4(192, 168, 1, 1)
+	tests := []struct {
+		name string
+		b    []byte
+		want string
+	}{
+		{"same host", ssdpReply("200 OK", "http://192.168.1.1:5000/rootDesc.xml"), "http://192.168.1.1:5000/rootDesc.xml"},
+		{"other host", ssdpReply("200 OK", "http://192.168.1.99:5000/rootDesc.xml"), ""},
+		{"name for host", ssdpReply("200 OK", "http://router.lan:5000/rootDesc.xml"), ""},
+		{"https", ssdpReply("200 OK", "https://192.168.1.1/rootDesc.xml"), ""},
+		{"bad url", ssdpReply("200 OK", "http://192.168.1.1:port/"), ""},
+		{"no location", []byte("HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\n\r\n"), ""},
+		{"not ok", ssdpReply("404 Not Found", "http://192.168.1.1:5000/rootDesc.xml"), ""},
+		{"notify", []byte("NOTIFY * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nLOCATION: http://192.168.1.1:5000/rootDesc.xml\r\n\r\n"), ""},
+		{"garbage", []byte{0x12, 0x34, 0x84, 0x00}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := ssdpLocation(src, tt.b)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestSSDPLocationTruncated(t *testing.T) {
+	b := ssdpReply("200 OK", "http://192.168.1.1:5000/rootDesc.xml")
+	for n := range len(b) {
+		if got, ok := ssdpLocation(net.IPv4(192, 168, 1, 1), b[:n]); ok {
+			t.Errorf("%d of %d bytes: got %q", n, len(b), got)
+		}
+	}
+}
+
+const routerDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<friendlyName>ASUS Router</friendlyName>
+<manufacturer>ASUSTeK Computer Inc.</manufacturer>
+<modelName>RT-AX58U</modelName>
+<modelNumber>3.0.0.4</modelNumber>
+<deviceList><device>
+<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<modelName>WAN Device</modelName>
+</device></deviceList>
+</device>
+</root>`
+
+func TestUPnPDescribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rootDesc.xml":
+			w.Write([]byte(routerDescription))
+		case "/cut.xml":
+			w.Write([]byte(routerDescription[:len(routerDescription)/2]))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dev, err := upnpDescribe(context.Background(), srv.Client(), srv.URL+"/rootDesc.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dev.model(), "ASUSTeK Computer Inc. RT-AX58U 3.0.0.4"; got != want {
+		t.Errorf("model = %q, want %q", got, want)
+	}
+	if got := upnpType(dev.DeviceType); got != "InternetGatewayDevice" || upnpKinds[got] != "router" {
+		t.Errorf("type = %q, kind %q", got, upnpKinds[got])
+	}
+	for _, path := range []string{"/cut.xml", "/missing.xml"} {
+		if _, err := upnpDescribe(context.Background(), srv.Client(), srv.URL+path); err == nil {
+			t.Errorf("%s: no error", path)
+		}
+	}
+}
+
+func TestUPnPDeviceModel(t *testing.T) {
+	tests := []struct {
+		dev  upnpDevice
+		want string
+	}{
+		{upnpDevice{Manufacturer: "Sonos, Inc.", ModelName: "Sonos One", ModelNumber: "S18"}, "Sonos, Inc. Sonos One S18"},
+		{upnpDevice{Manufacturer: "Synology", ModelName: "DS920+", ModelNumber: "DS920+"}, "Synology DS920+"},
+		{upnpDevice{Manufacturer: "Roku", ModelName: "Roku Ultra", ModelNumber: "4800X"}, "Roku Ultra 4800X"},
+		{upnpDevice{ModelNumber: "WNR2000"}, "WNR2000"},
+		{upnpDevice{Manufacturer: "NETGEAR"}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.dev.model(); got != tt.want {
+			t.Errorf("%+v: model = %q, want %q", tt.dev, got, tt.want)
+		}
+	}
+}
+
+func TestUPnPType(t *testing.T) {
+	for urn, want := range map[string]string{
+		"urn:schemas-upnp-org:device:MediaRenderer:1":  "MediaRenderer",
+		"urn:dial-multiscreen-org:device:dial:1":       "dial",
+		"urn:schemas-upnp-org:service:WANIPConnection": "",
+		"MediaRenderer": "",
+	} {
+		if got := upnpType(urn); got != want {
+			t.Errorf("upnpType(%q) = %q, want %q", urn, got, want)
+		}
+	}
+}
@@ -9,13 +9,76 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cneate93/vne/internal/procx"
 )
 
 type TraceResult struct {
-	Raw string `json:"raw"`
+	Tool string     `json:"tool,omitempty"`
+	Hops []TraceHop `json:"hops,omitempty"`
+	Raw  string     `json:"raw"`
+}
+
+// LastResponding returns the last hop that answered at least one probe.
+func (t TraceResult) LastResponding() (TraceHop, bool) {
+	for i := len(t.Hops) - 1; i >= 0; i-- {
+		if len(t.Hops[i].RTTs) > 0 {
+			return t.Hops[i], true
+		}
+	}
+	return TraceHop{}, false
+}
+
+// SilentTail reports the first TTL after which no hop answered, or 0 when the
+// final hop replied. A silent tail usually means the trace never reached the
+// target (or the target filters probes).
+func (t TraceResult) SilentTail() int {
+	if len(t.Hops) == 0 {
+		return 0
+	}
+	last, ok := t.LastResponding()
+	if !ok {
+		return t.Hops[0].TTL
+	}
+	if last.TTL == t.Hops[len(t.Hops)-1].TTL {
+		return 0
+	}
+	return last.TTL + 1
 }
 
-func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, error) {
+// LatencyJump returns the first hop whose best RTT exceeds the highest best
+// RTT of the earlier hops by at least thresholdMs, along with that increase.
+// Best RTTs are compared so a single slow ICMP reply from a busy router does
+// not count as a jump.
+func (t TraceResult) LatencyJump(thresholdMs float64) (TraceHop, float64, bool) {
+	prevBest := -1.0
+	for _, hop := range t.Hops {
+		best := hop.BestMs()
+		if len(hop.RTTs) == 0 {
+			continue
+		}
+		if prevBest >= 0 && best-prevBest >= thresholdMs {
+			return hop, best - prevBest, true
+		}
+		if prevBest < 0 || best > prevBest {
+			prevBest = best
+		}
+	}
+	return TraceHop{}, 0, false
+}
+
+// Trace runs the platform traceroute utility against target. Cancelling ctx
+// kills the utility and returns the hops printed so far.
+func Trace(ctx context.Context, target string, maxHops int, timeout time.Duration) (TraceResult, error) {
+	return trace(ctx, false, target, maxHops, timeout)
+}
+
+// Trace6 is Trace over IPv6 only.
+func Trace6(ctx context.Context, target string, maxHops int, timeout time.Duration) (TraceResult, error) {
+	return trace(ctx, true, target, maxHops, timeout)
+}
+
+func trace(ctx context.Context, v6 bool, target string, maxHops int, timeout time.Duration) (TraceResult, error) {
 	if maxHops <= 0 {
 		maxHops = 30
 	}
@@ -23,7 +86,7 @@ func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, erro
 		timeout = 10 * time.Second
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	var (
@@ -38,29 +101,45 @@ func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, erro
 			return TraceResult{Raw: msg}, fmt.Errorf("tracert lookup failed: %w", err)
 		}
 		commandName = "tracert"
-		cmd = exec.CommandContext(ctx, commandName, "-d", "-h", strconv.Itoa(maxHops), target)
+		args := []string{"-d", "-h", strconv.Itoa(maxHops), target}
+		if v6 {
+			args = append([]string{"-6"}, args...)
+		}
+		cmd = procx.CommandContext(ctx, commandName, args...)
 	case "linux":
 		traceroutePath, tracerouteErr := exec.LookPath("traceroute")
 		if tracerouteErr == nil {
 			commandName = "traceroute"
-			cmd = exec.CommandContext(ctx, traceroutePath, "-n", "-m", strconv.Itoa(maxHops), target)
+			args := []string{"-n", "-m", strconv.Itoa(maxHops), target}
+			if v6 {
+				args = append([]string{"-6"}, args...)
+			}
+			cmd = procx.CommandContext(ctx, traceroutePath, args...)
 		} else {
 			tracepathPath, tracepathErr := exec.LookPath("tracepath")
 			if tracepathErr == nil {
 				commandName = "tracepath"
-				cmd = exec.CommandContext(ctx, tracepathPath, "-n", target)
+				args := []string{"-n", "-m", strconv.Itoa(maxHops), target}
+				if v6 {
+					args = append([]string{"-6"}, args...)
+				}
+				cmd = procx.CommandContext(ctx, tracepathPath, args...)
 			} else {
 				msg := "Neither traceroute nor tracepath commands were found on this Linux system. Install traceroute (or tracepath) to enable network path tracing."
 				return TraceResult{Raw: msg}, fmt.Errorf("no traceroute utility found: traceroute: %w, tracepath: %w", tracerouteErr, tracepathErr)
 			}
 		}
 	default:
-		if _, err := exec.LookPath("traceroute"); err != nil {
-			msg := "traceroute command not found; install traceroute to enable network path tracing."
-			return TraceResult{Raw: msg}, fmt.Errorf("traceroute lookup failed: %w", err)
-		}
+		// BSD and macOS keep IPv6 in a separate utility.
 		commandName = "traceroute"
-		cmd = exec.CommandContext(ctx, commandName, "-n", "-m", strconv.Itoa(maxHops), target)
+		if v6 {
+			commandName = "traceroute6"
+		}
+		if _, err := exec.LookPath(commandName); err != nil {
+			msg := commandName + " command not found; install it to enable network path tracing."
+			return TraceResult{Raw: msg}, fmt.Errorf("%s lookup failed: %w", commandName, err)
+		}
+		cmd = procx.CommandContext(ctx, commandName, "-n", "-m", strconv.Itoa(maxHops), target)
 	}
 
 	out, err := cmd.CombinedOutput()
@@ -68,6 +147,9 @@ func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, erro
 	if errors.Is(ctx.Err(), context.DeadlineExceeded) && raw == "" {
 		raw = fmt.Sprintf("traceroute timed out after %s", timeout)
 	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return TraceResult{Tool: commandName, Hops: ParseTrace(commandName, raw), Raw: raw}, ctx.Err()
+	}
 
 	if err != nil {
 		if raw == "" {
@@ -85,7 +167,7 @@ func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, erro
 				}
 			}
 		}
-		return TraceResult{Raw: raw}, err
+		return TraceResult{Tool: commandName, Hops: ParseTrace(commandName, raw), Raw: raw}, err
 	}
 
 	if raw == "" {
@@ -95,5 +177,5 @@ func Trace(target string, maxHops int, timeout time.Duration) (TraceResult, erro
 		raw = fmt.Sprintf("%s completed without producing output.", commandName)
 	}
 
-	return TraceResult{Raw: raw}, nil
+	return TraceResult{Tool: commandName, Hops: ParseTrace(commandName, raw), Raw: raw}, nil
 }
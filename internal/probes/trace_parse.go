@@ -0,0 +1,265 @@
+package probes
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TraceHop is one TTL step of a traceroute. A hop can have several responding
+// addresses when the path is load balanced, and up to three RTT samples.
+type TraceHop struct {
+	TTL         int       `json:"ttl"`
+	Addrs       []string  `json:"addrs,omitempty"`
+	RTTs        []float64 `json:"rtts,omitempty"`
+	Timeouts    int       `json:"timeouts,omitempty"`
+	Annotations []string  `json:"annotations,omitempty"`
+	// PMTU is the path MTU tracepath reported from this hop on, when it
+	// changed there.
+	PMTU int `json:"pmtu,omitempty"`
+}
+
+// Probes returns the number of probes sent for the hop.
+func (h TraceHop) Probes() int {
+	return len(h.RTTs) + h.Timeouts
+}
+
+// Loss returns the fraction of probes for the hop that received no reply.
+func (h TraceHop) Loss() float64 {
+	n := h.Probes()
+	if n == 0 {
+		return 0
+	}
+	return float64(h.Timeouts) / float64(n)
+}
+
+// BestMs returns the lowest RTT recorded for the hop, or 0 when none replied.
+func (h TraceHop) BestMs() float64 {
+	if len(h.RTTs) == 0 {
+		return 0
+	}
+	best := h.RTTs[0]
+	for _, v := range h.RTTs[1:] {
+		if v < best {
+			best = v
+		}
+	}
+	return best
+}
+
+const maxTraceRTTs = 3
+
+var (
+	traceHopStartRe = regexp.MustCompile(`^\s*(\d+)\??:?\s+(.*)$`)
+	traceRTTRe      = regexp.MustCompile(`^<?(\d+(?:\.\d+)?)(ms)?$`)
+	traceAnnotRe    = regexp.MustCompile(`^!([A-Za-z]?\d*|<\d+>)$`)
+	tracepathRTTRe  = regexp.MustCompile(`(\d+(?:\.\d+)?)ms`)
+)
+
+// ParseTrace converts traceroute, tracepath, or tracert output into hops. The
+// tool name selects the dialect; unknown names are treated as traceroute.
+func ParseTrace(tool, raw string) []TraceHop {
+	switch tool {
+	case "tracepath":
+		return parseTracepath(raw)
+	case "tracert":
+		return parseTracert(raw)
+	default:
+		return parseTraceroute(raw)
+	}
+}
+
+// parseTraceroute handles BSD/Linux traceroute output such as:
+//
+//	3  10.0.0.1  5.1 ms 10.0.0.2  5.3 ms !H  *
+func parseTraceroute(raw string) []TraceHop {
+	var hops []TraceHop
+	for _, line := range strings.Split(raw, "\n") {
+		m := traceHopStartRe.FindStringSubmatch(line)
+		if len(m) != 3 {
+			// Continuation lines list additional responders for the
+			// previous TTL on some platforms.
+			if len(hops) > 0 && strings.HasPrefix(line, "  ") {
+				addTracerouteFields(&hops[len(hops)-1], strings.Fields(line))
+			}
+			continue
+		}
+		ttl, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		hop := TraceHop{TTL: ttl}
+		addTracerouteFields(&hop, strings.Fields(m[2]))
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+func addTracerouteFields(hop *TraceHop, fields []string) {
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		switch {
+		case f == "*":
+			hop.Timeouts++
+		case f == "ms":
+			continue
+		case traceAnnotRe.MatchString(f):
+			hop.Annotations = appendUnique(hop.Annotations, f)
+		case net.ParseIP(strings.Trim(f, "()")) != nil:
+			hop.Addrs = appendUnique(hop.Addrs, strings.Trim(f, "()"))
+		default:
+			if rm := traceRTTRe.FindStringSubmatch(f); len(rm) >= 2 {
+				if v, err := strconv.ParseFloat(rm[1], 64); err == nil && len(hop.RTTs) < maxTraceRTTs {
+					hop.RTTs = append(hop.RTTs, v)
+				}
+			}
+		}
+	}
+}
+
+// parseTracepath handles tracepath output, where each probe is a separate line
+// and lines sharing a TTL are merged into one hop:
+//
+//	1:  192.168.1.1                                           1.234ms
+//	2:  no reply
+//	3:  10.20.0.1                                            12.118ms pmtu 1492
+func parseTracepath(raw string) []TraceHop {
+	var hops []TraceHop
+	byTTL := map[int]int{}
+	for _, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "Resume:") || strings.Contains(trimmed, "[LOCALHOST]") {
+			continue
+		}
+		m := traceHopStartRe.FindStringSubmatch(trimmed)
+		if len(m) != 3 {
+			continue
+		}
+		ttl, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		idx, ok := byTTL[ttl]
+		if !ok {
+			hops = append(hops, TraceHop{TTL: ttl})
+			idx = len(hops) - 1
+			byTTL[ttl] = idx
+		}
+		hop := &hops[idx]
+		rest := m[2]
+		if strings.HasPrefix(rest, "no reply") {
+			hop.Timeouts++
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) > 0 && net.ParseIP(fields[0]) != nil {
+			hop.Addrs = appendUnique(hop.Addrs, fields[0])
+		}
+		if rm := tracepathRTTRe.FindStringSubmatch(rest); len(rm) == 2 {
+			if v, err := strconv.ParseFloat(rm[1], 64); err == nil && len(hop.RTTs) < maxTraceRTTs {
+				hop.RTTs = append(hop.RTTs, v)
+			}
+		}
+		for i, f := range fields {
+			switch f {
+			case "pmtu":
+				if i+1 < len(fields) {
+					if v, err := strconv.Atoi(fields[i+1]); err == nil {
+						hop.PMTU = v
+					}
+				}
+			case "reached", "asymm":
+				hop.Annotations = appendUnique(hop.Annotations, f)
+			}
+		}
+	}
+	return hops
+}
+
+// parseTracert handles Windows tracert output:
+//
+//	2     *        *        *     Request timed out.
+//	3    10 ms     9 ms    11 ms  10.0.0.1
+//	5  192.168.1.1  reports: Destination host unreachable.
+func parseTracert(raw string) []TraceHop {
+	var hops []TraceHop
+	for _, line := range strings.Split(raw, "\n") {
+		m := traceHopStartRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if len(m) != 3 {
+			continue
+		}
+		ttl, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		hop := TraceHop{TTL: ttl}
+		rest := m[2]
+		if idx := strings.Index(rest, "reports:"); idx != -1 {
+			fields := strings.Fields(rest[:idx])
+			for _, f := range fields {
+				if net.ParseIP(f) != nil {
+					hop.Addrs = appendUnique(hop.Addrs, f)
+				}
+			}
+			hop.Annotations = appendUnique(hop.Annotations, tracertAnnotation(rest[idx+len("reports:"):]))
+			hops = append(hops, hop)
+			continue
+		}
+		fields := strings.Fields(rest)
+		probes := 0
+		for i := 0; i < len(fields) && probes < maxTraceRTTs; i++ {
+			f := fields[i]
+			if f == "*" {
+				hop.Timeouts++
+				probes++
+				continue
+			}
+			rm := traceRTTRe.FindStringSubmatch(f)
+			if len(rm) < 2 {
+				break
+			}
+			if v, err := strconv.ParseFloat(rm[1], 64); err == nil {
+				hop.RTTs = append(hop.RTTs, v)
+				probes++
+			}
+			if i+1 < len(fields) && fields[i+1] == "ms" {
+				i++
+			}
+		}
+		for _, f := range fields {
+			ip := strings.Trim(f, "[]")
+			if net.ParseIP(ip) != nil {
+				hop.Addrs = appendUnique(hop.Addrs, ip)
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// tracertAnnotation maps tracert's "reports:" messages onto the traceroute
+// style !H/!N/!P/!X markers.
+func tracertAnnotation(msg string) string {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "host unreachable"):
+		return "!H"
+	case strings.Contains(lower, "net unreachable"), strings.Contains(lower, "network unreachable"):
+		return "!N"
+	case strings.Contains(lower, "protocol unreachable"):
+		return "!P"
+	case strings.Contains(lower, "prohibited"):
+		return "!X"
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(msg), "."))
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, existing := range list {
+		if existing == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
@@ -0,0 +1,59 @@
+package probes
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// TestParseTraceGolden parses each capture under testdata/trace and compares
+// the hops with the .golden.json file next to it. Run with -update after a
+// deliberate change to the parser to rewrite them.
+func TestParseTraceGolden(t *testing.T) {
+	tests := []struct{ file, tool string }{
+		{"traceroute_linux.txt", "traceroute"},
+		{"traceroute_macos.txt", "traceroute"},
+		{"tracepath.txt", "tracepath"},
+		// tracepath -m 4 stopping short of the target.
+		{"tracepath_maxhops.txt", "tracepath"},
+		{"tracert.txt", "tracert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join("testdata", "trace", tt.file)
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ParseTrace(tt.tool, string(raw))
+			golden := path[:len(path)-len(filepath.Ext(path))] + ".golden.json"
+			if *updateGolden {
+				b, err := json.MarshalIndent(got, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, append(b, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			b, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []TraceHop
+			if err := json.Unmarshal(b, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.MarshalIndent(got, "", "  ")
+				t.Errorf("hops differ from %s:\n%s", golden, gotJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package probes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cneate93/vne/internal/reflector"
+)
+
+// VoiceResult is a stream of RTP-sized UDP packets echoed by a reflector,
+// measured the way a voice or video call would experience it and scored
+// with the ITU-T G.107 E-model. ICMP pings are sent far less often, are
+// often deprioritised, and say nothing about reordering.
+type VoiceResult struct {
+	// Endpoint is the reflector's host:port.
+	Endpoint string `json:"endpoint"`
+	// Rate is the packets sent per second and PacketSize their UDP
+	// payload in bytes.
+	Rate       int `json:"rate"`
+	PacketSize int `json:"packet_size"`
+	Sent       int `json:"sent"`
+	Received   int `json:"received"`
+	// Loss is the fraction of packets that did not come back. UpLoss and
+	// DownLoss split it using the reflector's receive count.
+	Loss     float64 `json:"loss"`
+	UpLoss   float64 `json:"up_loss"`
+	DownLoss float64 `json:"down_loss"`
+	// Reordered counts packets that arrived after a later one, and
+	// Duplicates packets that arrived more than once.
+	Reordered  int `json:"reordered"`
+	Duplicates int `json:"duplicates"`
+	// RTTs are the round-trip times of the echoed packets.
+	AvgMs float64 `json:"avg_ms"`
+	P95Ms float64 `json:"p95_ms"`
+	MaxMs float64 `json:"max_ms"`
+	// JitterMs is the RFC 3550 interarrival jitter of the round trip, and
+	// UpJitterMs and DownJitterMs that of each direction.
+	JitterMs     float64 `json:"jitter_ms"`
+	UpJitterMs   float64 `json:"up_jitter_ms"`
+	DownJitterMs float64 `json:"down_jitter_ms"`
+	// RFactor is the E-model transmission rating for a G.711 call over
+	// this path, MOS the mean opinion score it maps to and Quality the
+	// G.109 category: "best", "high", "medium", "low" or "poor".
+	RFactor float64 `json:"r_factor"`
+	MOS     float64 `json:"mos"`
+	Quality string  `json:"quality,omitempty"`
+	Error   string  `json:"error,omitempty"`
+}
+
+const (
+	// voiceDrain is how long replies are awaited after the last packet.
+	voiceDrain = time.Second
+	// voiceHandshake is how long the first echo may take before the
+	// reflector counts as unreachable.
+	voiceHandshake = 2 * time.Second
+)
+
+// VoiceQuality sends rate packets a second of size bytes to a reflector's
+// UDP echo for duration and scores what comes back. endpoint is host:port,
+// optionally udp://, or the http:// URL of the reflector; a bare host uses
+// the reflector's default port. Zero values pick 10 s of 50 packets a
+// second of 172 bytes, a G.711 call with 20 ms packets.
+func VoiceQuality(ctx context.Context, endpoint string, duration time.Duration, rate, size int) VoiceResult {
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+	if rate <= 0 {
+		rate = 50
+	}
+	if size <= 0 {
+		size = 172
+	}
+	size = min(max(size, reflector.EchoHeader), 1400)
+	res := VoiceResult{Endpoint: voiceAddr(endpoint), Rate: rate, PacketSize: size}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", res.Endpoint)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	sender := func(stream uint32) func(seq uint32) error {
+		return func(seq uint32) error {
+			p := make([]byte, size)
+			reflector.Echo{Stream: stream, Seq: seq, Sent: int64(time.Since(start))}.Put(p)
+			_, err := conn.Write(p)
+			return err
+		}
+	}
+	// The handshake uses a stream of its own so its retries do not count
+	// towards the reflector's receive count of the measured stream.
+	hs := rand.Uint32()
+	if err := voiceHandshakeEcho(ctx, conn, sender(hs), hs); err != nil {
+		res.Error = fmt.Sprintf("reflector unreachable: %v", err)
+		return res
+	}
+
+	stream := hs + 1
+	send := sender(stream)
+	total := max(int(duration.Seconds()*float64(rate)), 1)
+	interval := time.Second / time.Duration(rate)
+	sendErr := make(chan error, 1)
+	go func() {
+		defer close(sendErr)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for i := 1; i <= total; i++ {
+			if err := send(uint32(i)); err != nil {
+				sendErr <- err
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+
+	st := newVoiceStats(total)
+	buf := make([]byte, 2048)
+	rctx, cancel := context.WithTimeout(ctx, duration+voiceDrain)
+	defer cancel()
+	conn.SetReadDeadline(time.Time{})
+	stop := context.AfterFunc(rctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+	for st.received < total {
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		now := int64(time.Since(start))
+		e, ok := reflector.ParseEcho(buf[:n])
+		if !ok || e.Stream != stream || e.Seq == 0 || int(e.Seq) > total {
+			continue
+		}
+		st.add(e, now)
+	}
+	if err := <-sendErr; err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if ctx.Err() != nil {
+		res.Error = ctx.Err().Error()
+		return res
+	}
+	st.fill(&res)
+	res.RFactor, res.MOS = eModel(res.AvgMs, res.JitterMs, res.Loss, float64(interval)/float64(time.Millisecond))
+	res.Quality = voiceQuality(res.RFactor)
+	return res
+}
+
+// voiceHandshakeEcho sends packets until one comes back, proving the
+// reflector is there before the stream starts.
+func voiceHandshakeEcho(ctx context.Context, conn net.Conn, send func(uint32) error, stream uint32) error {
+	buf := make([]byte, 2048)
+	deadline := time.Now().Add(voiceHandshake)
+	for time.Now().Before(deadline) {
+		if err := send(1); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(voiceHandshake / 4))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				break
+			}
+			if e, ok := reflector.ParseEcho(buf[:n]); ok && e.Stream == stream {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no UDP echo within %s", voiceHandshake)
+}
+
+// voiceStats accumulates the echoed packets in arrival order.
+type voiceStats struct {
+	total      int
+	seen       []bool
+	received   int
+	reordered  int
+	duplicates int
+	highest    uint32
+	// reflected is the highest receive count the reflector reported.
+	reflected uint32
+	rtts      []float64
+	// jitter holds the RFC 3550 estimators of the round trip, upstream
+	// and downstream leg, and prev the previous packet's timestamps.
+	jitter, upJitter, downJitter float64
+	prev                         *reflector.Echo
+	prevRecv                     int64
+}
+
+func newVoiceStats(total int) *voiceStats {
+	return &voiceStats{total: total, seen: make([]bool, total+1)}
+}
+
+func (s *voiceStats) add(e reflector.Echo, recv int64) {
+	if s.seen[e.Seq] {
+		s.duplicates++
+		return
+	}
+	s.seen[e.Seq] = true
+	s.received++
+	if e.Seq < s.highest {
+		s.reordered++
+	}
+	s.highest = max(s.highest, e.Seq)
+	s.reflected = max(s.reflected, e.Received)
+	s.rtts = append(s.rtts, float64(recv-e.Sent)/1e6)
+
+	if p := s.prev; p != nil {
+		// D(i,j) = (Rj - Ri) - (Sj - Si); J += (|D| - J) / 16.
+		s.jitter = rfc3550Jitter(s.jitter, (recv-s.prevRecv)-(e.Sent-p.Sent))
+		s.upJitter = rfc3550Jitter(s.upJitter, (e.Reflected-p.Reflected)-(e.Sent-p.Sent))
+		s.downJitter = rfc3550Jitter(s.downJitter, (recv-s.prevRecv)-(e.Reflected-p.Reflected))
+	}
+	s.prev, s.prevRecv = &e, recv
+}
+
+func rfc3550Jitter(j float64, d int64) float64 {
+	return j + (math.Abs(float64(d)/1e6)-j)/16
+}
+
+func (s *voiceStats) fill(res *VoiceResult) {
+	res.Sent = s.total
+	res.Received = s.received
+	res.Reordered = s.reordered
+	res.Duplicates = s.duplicates
+	if s.total > 0 {
+		res.Loss = float64(s.total-s.received) / float64(s.total)
+		// The last echoes carrying the count may themselves be lost, so
+		// the reflector's count is at least the received packets.
+		reflected := max(int(s.reflected), s.received)
+		res.UpLoss = float64(s.total-reflected) / float64(s.total)
+		if reflected > 0 {
+			res.DownLoss = float64(reflected-s.received) / float64(reflected)
+		}
+	}
+	res.AvgMs = average(s.rtts)
+	res.P95Ms = percentile95(s.rtts)
+	for _, r := range s.rtts {
+		res.MaxMs = max(res.MaxMs, r)
+	}
+	res.JitterMs = s.jitter
+	res.UpJitterMs = s.upJitter
+	res.DownJitterMs = s.downJitter
+}
+
+// eModel rates a G.711 call with packet loss concealment using the
+// simplified ITU-T G.107 E-model. The mouth-to-ear delay is half the round
+// trip plus a jitter buffer of twice the jitter and one packet of
+// packetization delay; loss is taken as random (BurstR 1).
+func eModel(rttMs, jitterMs, loss, packetMs float64) (r, mos float64) {
+	ta := rttMs/2 + 2*jitterMs + packetMs
+	id := 0.024 * ta
+	if ta > 177.3 {
+		id += 0.11 * (ta - 177.3)
+	}
+	// Ie is 0 and Bpl 25.1 for G.711 with concealment (G.113 Appendix I).
+	ppl := loss * 100
+	ieEff := 95 * ppl / (ppl + 25.1)
+	r = min(max(93.2-id-ieEff, 0), 100)
+	mos = max(1+0.035*r+r*(r-60)*(100-r)*7e-6, 1)
+	return math.Round(r*10) / 10, math.Round(mos*100) / 100
+}
+
+// voiceQuality is the G.109 category of an R-factor.
+func voiceQuality(r float64) string {
+	switch {
+	case r >= 90:
+		return "best"
+	case r >= 80:
+		return "high"
+	case r >= 70:
+		return "medium"
+	case r >= 60:
+		return "low"
+	}
+	return "poor"
+}
+
+// voiceAddr turns an endpoint into the reflector's UDP host:port.
+func voiceAddr(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			endpoint = u.Host
+			if u.Port() == "" {
+				endpoint = net.JoinHostPort(u.Hostname(), reflector.DefaultPort)
+			}
+		}
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(strings.Trim(endpoint, "[]"), reflector.DefaultPort)
+	}
+	return endpoint
+}
@@ -0,0 +1,172 @@
+package probes
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cneate93/vne/internal/reflector"
+)
+
+const ms = int64(time.Millisecond)
+
+func TestVoiceStatsJitter(t *testing.T) {
+	// Packets sent every 20 ms; the reflector's clock is 1 s off ours,
+	// which the differences cancel out.
+	type arrival struct{ up, down int64 }
+	arrivals := []arrival{{4, 6}, {4, 8}, {4, 5}, {10, 5}}
+	st := newVoiceStats(len(arrivals))
+	for i, a := range arrivals {
+		sent := int64(i) * 20 * ms
+		e := reflector.Echo{Seq: uint32(i + 1), Received: uint32(i + 1), Sent: sent, Reflected: time.Second.Nanoseconds() + sent + a.up*ms}
+		st.add(e, sent+(a.up+a.down)*ms)
+	}
+	var res VoiceResult
+	st.fill(&res)
+
+	// Transit times of 10, 12, 9 and 15 ms give |D| of 2, 3 and 6 ms, and
+	// J += (|D| - J) / 16 after each.
+	want := map[string][2]float64{
+		"round trip": {res.JitterMs, 0.125 + (3-0.125)/16 + (6-(0.125+(3-0.125)/16))/16},
+		"upstream":   {res.UpJitterMs, 6.0 / 16},
+		"downstream": {res.DownJitterMs, 0.3046875 - 0.3046875/16},
+	}
+	for name, v := range want {
+		if math.Abs(v[0]-v[1]) > 1e-9 {
+			t.Errorf("%s jitter = %v, want %v", name, v[0], v[1])
+		}
+	}
+	if res.AvgMs != 11.5 || res.MaxMs != 15 || res.Loss != 0 {
+		t.Errorf("got avg %v, max %v, loss %v", res.AvgMs, res.MaxMs, res.Loss)
+	}
+}
+
+func TestVoiceStatsCounting(t *testing.T) {
+	tests := []struct {
+		name string
+		// seqs are the echoes in arrival order and counts the reflector's
+		// receive count each carries; a nil counts is a reflector that
+		// does not report one.
+		seqs, counts []uint32
+		total        int
+		want         VoiceResult
+	}{
+		{
+			name:   "clean",
+			seqs:   []uint32{1, 2, 3, 4},
+			counts: []uint32{1, 2, 3, 4},
+			total:  4,
+			want:   VoiceResult{Sent: 4, Received: 4},
+		},
+		{
+			name:   "reordered and duplicated",
+			seqs:   []uint32{1, 2, 4, 3, 3, 6, 5, 8, 7},
+			counts: []uint32{1, 2, 4, 4, 4, 6, 6, 8, 8},
+			total:  8,
+			want:   VoiceResult{Sent: 8, Received: 8, Reordered: 3, Duplicates: 1},
+		},
+		{
+			// Seq 3 never reaches the reflector, seq 5's echo is lost on
+			// the way back.
+			name:   "loss split by direction",
+			seqs:   []uint32{1, 2, 4, 6, 7, 8, 9, 10},
+			counts: []uint32{1, 2, 3, 5, 6, 7, 8, 9},
+			total:  10,
+			want:   VoiceResult{Sent: 10, Received: 8, Loss: 0.2, UpLoss: 0.1, DownLoss: 1.0 / 9},
+		},
+		{
+			// The reflector got all ten, but the echoes of 9 and 10 are
+			// lost; the last count heard is 8, so their loss is put
+			// upstream.
+			name:   "last echoes lost",
+			seqs:   []uint32{1, 2, 3, 4, 5, 6, 7, 8},
+			counts: []uint32{1, 2, 3, 4, 5, 6, 7, 8},
+			total:  10,
+			want:   VoiceResult{Sent: 10, Received: 8, Loss: 0.2, UpLoss: 0.2},
+		},
+		{
+			// A stale count lower than what came back is raised to the
+			// received count rather than giving negative downstream loss.
+			name:   "count behind what was received",
+			seqs:   []uint32{1, 2, 3, 4},
+			counts: []uint32{1, 1, 1, 1},
+			total:  5,
+			want:   VoiceResult{Sent: 5, Received: 4, Loss: 0.2, UpLoss: 0.2},
+		},
+		{
+			name:  "reflector without counts",
+			seqs:  []uint32{2, 3},
+			total: 4,
+			want:  VoiceResult{Sent: 4, Received: 2, Loss: 0.5, UpLoss: 0.5},
+		},
+		{
+			name:  "nothing back",
+			total: 3,
+			want:  VoiceResult{Sent: 3, Loss: 1, UpLoss: 1},
+		},
+	}
+	for _, tt := range tests {
+		st := newVoiceStats(tt.total)
+		for i, seq := range tt.seqs {
+			e := reflector.Echo{Seq: seq, Sent: int64(seq) * 20 * ms}
+			if tt.counts != nil {
+				e.Received = tt.counts[i]
+			}
+			st.add(e, e.Sent+10*ms)
+		}
+		var got VoiceResult
+		st.fill(&got)
+		if tt.want.Received > 0 {
+			tt.want.AvgMs, tt.want.P95Ms, tt.want.MaxMs = 10, 10, 10
+		}
+		got.JitterMs, got.UpJitterMs, got.DownJitterMs = 0, 0, 0
+		if math.Abs(got.DownLoss-tt.want.DownLoss) < 1e-9 {
+			got.DownLoss = tt.want.DownLoss
+		}
+		if got != tt.want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEModel(t *testing.T) {
+	tests := []struct {
+		name                   string
+		rtt, jitter, loss, pkt float64
+		wantR, wantMOS         float64
+		wantQuality            string
+	}{
+		{"clean 20 ms", 20, 0, 0, 20, 92.5, 4.39, "best"},
+		{"1% loss", 20, 0, 0.01, 20, 88.8, 4.31, "high"},
+		{"past the delay knee", 400, 10, 0, 20, 80.5, 4.04, "high"},
+		{"20% loss", 20, 0, 0.2, 20, 50.4, 2.59, "poor"},
+		{"unusable", 5000, 0, 0, 20, 0, 1, "poor"},
+	}
+	for _, tt := range tests {
+		r, mos := eModel(tt.rtt, tt.jitter, tt.loss, tt.pkt)
+		if r != tt.wantR || mos != tt.wantMOS || voiceQuality(r) != tt.wantQuality {
+			t.Errorf("%s: R %v, MOS %v, %s; want %v, %v, %s", tt.name, r, mos, voiceQuality(r), tt.wantR, tt.wantMOS, tt.wantQuality)
+		}
+	}
+	// The jitter buffer adds twice the jitter to the one-way delay, which
+	// is half the round trip.
+	if a, b := eModelR(200, 10), eModelR(240, 0); a != b {
+		t.Errorf("10 ms jitter rated %v, 40 ms more RTT %v", a, b)
+	}
+}
+
+func eModelR(rtt, jitter float64) float64 {
+	r, _ := eModel(rtt, jitter, 0, 20)
+	return r
+}
+
+func TestVoiceQuality(t *testing.T) {
+	for r, want := range map[float64]string{
+		100: "best", 90: "best", 89.9: "high", 80: "high", 79.9: "medium",
+		70: "medium", 60: "low", 59.9: "poor", 0: "poor",
+	} {
+		if got := voiceQuality(r); got != want {
+			t.Errorf("voiceQuality(%v) = %q, want %q", r, got, want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package probes
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// udpPoll bounds each blocking read so cancellation and the deadline are
+// noticed.
+const udpPoll = 100 * time.Millisecond
+
+// readUDPReplies passes every datagram received on conn to handle until
+// deadline or cancellation. tick runs between reads, e.g. to send a second
+// round of queries.
+func readUDPReplies(ctx context.Context, conn *net.UDPConn, deadline time.Time, tick func(), handle func(src net.IP, b []byte)) {
+	buf := make([]byte, 9000)
+	for ctx.Err() == nil {
+		now := time.Now()
+		if !now.Before(deadline) {
+			return
+		}
+		if tick != nil {
+			tick()
+		}
+		_ = conn.SetReadDeadline(minTime(deadline, now.Add(udpPoll)))
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			return
+		}
+		handle(addr.IP, buf[:n])
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// optionString decodes a text field of a TLV or option: trailing NULs and
+// surrounding space are dropped and invalid UTF-8 removed.
+func optionString(v []byte) string {
+	return strings.TrimSpace(strings.ToValidUTF8(strings.TrimRight(string(v), "\x00"), ""))
+}
@@ -0,0 +1,81 @@
+package probes
+
+// WirelessInfo describes the Wi-Fi link of the active wireless interface.
+// Fields a driver does not report are left zero.
+type WirelessInfo struct {
+	Iface   string `json:"iface"`
+	SSID    string `json:"ssid,omitempty"`
+	BSSID   string `json:"bssid,omitempty"`
+	FreqMHz int    `json:"freq_mhz,omitempty"`
+	Channel int    `json:"channel,omitempty"`
+	// Band is "2.4GHz", "5GHz" or "6GHz".
+	Band      string `json:"band,omitempty"`
+	SignalDBm int    `json:"signal_dbm,omitempty"`
+	NoiseDBm  int    `json:"noise_dbm,omitempty"`
+	// LinkQuality is the driver's link quality from /proc/net/wireless,
+	// out of 70 for most drivers.
+	LinkQuality   int     `json:"link_quality,omitempty"`
+	TxBitrateMbps float64 `json:"tx_bitrate_mbps,omitempty"`
+	// TxPackets, TxRetries and TxFailed count since the association.
+	TxPackets uint64 `json:"tx_packets"`
+	TxRetries uint64 `json:"tx_retries"`
+	TxFailed  uint64 `json:"tx_failed"`
+	// RetryRate is TxRetries per transmitted packet.
+	RetryRate float64 `json:"retry_rate"`
+	// ChannelBusy is the share of time the radio found the channel busy,
+	// from the driver's channel survey.
+	ChannelBusy float64 `json:"channel_busy,omitempty"`
+	// Neighbors counts the other access points in the last scan whose
+	// channels overlap this one.
+	Neighbors int `json:"neighbors"`
+}
+
+// Wireless reads the Wi-Fi link of the named interface or, when iface is
+// empty or not wireless, of the first connected wireless interface. It
+// returns nil without an error when the host has no wireless interface.
+// Wi-Fi details are only read on Linux.
+func Wireless(iface string) (*WirelessInfo, error) {
+	return wireless(iface)
+}
+
+// wifiChannel converts a centre frequency to its channel number and band.
+// The 5 GHz band ends with channel 177 at 5885 MHz; 6 GHz channels start at
+// 5955 MHz apart from channel 2 at 5935 MHz.
+func wifiChannel(freq int) (int, string) {
+	switch {
+	case freq == 2484:
+		return 14, "2.4GHz"
+	case freq >= 2412 && freq < 2484:
+		return (freq - 2407) / 5, "2.4GHz"
+	case freq == 5935:
+		return 2, "6GHz"
+	case freq >= 5955 && freq <= 7115:
+		return (freq - 5950) / 5, "6GHz"
+	case freq >= 5000 && freq <= 5885:
+		return (freq - 5000) / 5, "5GHz"
+	}
+	return 0, ""
+}
+
+// channelsOverlap reports whether two channels in the same band interfere.
+// 2.4 GHz channels are 20 MHz wide but only 5 MHz apart, so channels whose
+// centres are less than 25 MHz apart overlap; channel 14 sits 12 MHz above
+// 13.
+func channelsOverlap(band string, a, b int) bool {
+	if band == "2.4GHz" {
+		d := wifi24Freq(a) - wifi24Freq(b)
+		if d < 0 {
+			d = -d
+		}
+		return d < 25
+	}
+	return a == b
+}
+
+// wifi24Freq is the centre frequency of a 2.4 GHz channel.
+func wifi24Freq(ch int) int {
+	if ch == 14 {
+		return 2484
+	}
+	return 2407 + 5*ch
+}
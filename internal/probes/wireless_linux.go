@@ -0,0 +1,88 @@
+package probes
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// wireless combines nl80211 with /proc/net/wireless. nl80211 has the SSID,
+// BSSID, channel, bitrate and retry counters; the older wireless extensions
+// file adds the link quality and fills in the signal and noise for drivers
+// that report them only there.
+func wireless(iface string) (*WirelessInfo, error) {
+	var procLinks map[string]procWirelessLink
+	if b, err := os.ReadFile("/proc/net/wireless"); err == nil {
+		procLinks = parseProcWireless(string(b))
+	}
+
+	info, err := nl80211Link(iface)
+	if info == nil {
+		if len(procLinks) == 0 {
+			return nil, err
+		}
+		// Without nl80211 only the wireless extensions data is left.
+		name := iface
+		if _, ok := procLinks[name]; !ok {
+			name = ""
+			for n := range procLinks {
+				if name == "" || n < name {
+					name = n
+				}
+			}
+		}
+		info = &WirelessInfo{Iface: name}
+	}
+
+	if link, ok := procLinks[info.Iface]; ok {
+		info.LinkQuality = link.quality
+		if info.SignalDBm == 0 {
+			info.SignalDBm = link.level
+		}
+		if info.NoiseDBm == 0 {
+			info.NoiseDBm = link.noise
+		}
+	}
+	info.Channel, info.Band = wifiChannel(info.FreqMHz)
+	if info.TxPackets > 0 {
+		info.RetryRate = float64(info.TxRetries) / float64(info.TxPackets)
+	}
+	return info, nil
+}
+
+type procWirelessLink struct {
+	quality, level, noise int
+}
+
+// parseProcWireless parses /proc/net/wireless. Values with a trailing dot
+// were updated since the last read; a noise of -256 means none is reported.
+//
+//	Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+//	 face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+//	 wlan0: 0000   54.  -56.  -256        0      0      0      0      0        0
+func parseProcWireless(content string) map[string]procWirelessLink {
+	links := map[string]procWirelessLink{}
+	for _, line := range strings.Split(content, "\n") {
+		name, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		f := strings.Fields(rest)
+		if len(f) < 4 {
+			continue
+		}
+		num := func(s string) int {
+			v, _ := strconv.ParseFloat(strings.TrimSuffix(s, "."), 64)
+			return int(v)
+		}
+		link := procWirelessLink{quality: num(f[1]), level: num(f[2]), noise: num(f[3])}
+		if link.level >= 0 {
+			link.level = 0
+		}
+		if link.noise <= -256 || link.noise >= 0 {
+			link.noise = 0
+		}
+		links[strings.TrimSpace(name)] = link
+	}
+	return links
+}
@@ -0,0 +1,61 @@
+package probes
+
+import (
+	"reflect"
+	"testing"
+)
+
+const procWirelessHeader = `Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE
+ face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22
+`
+
+func TestParseProcWireless(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]procWirelessLink
+	}{
+		{
+			// Trailing dots mark values updated since the last read, and a
+			// noise of -256 is none.
+			name:    "updated values without noise",
+			content: procWirelessHeader + " wlan0: 0000   54.  -56.  -256        0      0      0      0      0        0\n",
+			want:    map[string]procWirelessLink{"wlan0": {quality: 54, level: -56}},
+		},
+		{
+			name: "two interfaces",
+			content: procWirelessHeader +
+				" wlan0: 0000   70   -38   -95        0      0      0      0      0        0\n" +
+				"wlp3s0: 0000   31.  -79.  -92.       0      0      0     12      0        3\n",
+			want: map[string]procWirelessLink{
+				"wlan0":  {quality: 70, level: -38, noise: -95},
+				"wlp3s0": {quality: 31, level: -79, noise: -92},
+			},
+		},
+		{
+			// Drivers without dBm report unsigned or zero levels.
+			name:    "no dBm",
+			content: procWirelessHeader + " wlan1: 0000    0     0     0        0      0      0      0      0        0\n",
+			want:    map[string]procWirelessLink{"wlan1": {}},
+		},
+		{
+			name:    "short line",
+			content: procWirelessHeader + " wlan0: 0000   54.\n",
+			want:    map[string]procWirelessLink{},
+		},
+		{
+			name:    "no interfaces",
+			content: procWirelessHeader,
+			want:    map[string]procWirelessLink{},
+		},
+		{
+			name: "empty",
+			want: map[string]procWirelessLink{},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseProcWireless(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
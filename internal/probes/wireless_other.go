@@ -0,0 +1,12 @@
+//go:build !linux
+
+package probes
+
+import (
+	"errors"
+	"runtime"
+)
+
+func wireless(string) (*WirelessInfo, error) {
+	return nil, errors.New("Wi-Fi details are not available on " + runtime.GOOS)
+}
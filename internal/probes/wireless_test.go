@@ -0,0 +1,62 @@
+package probes
+
+import "testing"
+
+func TestWifiChannel(t *testing.T) {
+	tests := []struct {
+		freq    int
+		channel int
+		band    string
+	}{
+		{2412, 1, "2.4GHz"},
+		{2437, 6, "2.4GHz"},
+		{2472, 13, "2.4GHz"},
+		{2484, 14, "2.4GHz"},
+		{2407, 0, ""},
+		{2500, 0, ""},
+		{5180, 36, "5GHz"},
+		{5825, 165, "5GHz"},
+		{5885, 177, "5GHz"},
+		{5925, 0, ""},
+		{5935, 2, "6GHz"},
+		{5955, 1, "6GHz"},
+		{6115, 33, "6GHz"},
+		{7115, 233, "6GHz"},
+		{7135, 0, ""},
+		{0, 0, ""},
+	}
+	for _, tt := range tests {
+		if ch, band := wifiChannel(tt.freq); ch != tt.channel || band != tt.band {
+			t.Errorf("wifiChannel(%d) = %d, %q; want %d, %q", tt.freq, ch, band, tt.channel, tt.band)
+		}
+	}
+}
+
+func TestChannelsOverlap(t *testing.T) {
+	tests := []struct {
+		band string
+		a, b int
+		want bool
+	}{
+		{"2.4GHz", 6, 6, true},
+		{"2.4GHz", 1, 5, true},
+		{"2.4GHz", 1, 6, false},
+		{"2.4GHz", 11, 6, false},
+		{"2.4GHz", 13, 9, true},
+		// Channel 14 is 12 MHz above 13, not 5.
+		{"2.4GHz", 14, 11, true},
+		{"2.4GHz", 14, 10, false},
+		{"5GHz", 36, 36, true},
+		{"5GHz", 36, 40, false},
+		{"6GHz", 1, 5, false},
+		{"6GHz", 37, 37, true},
+	}
+	for _, tt := range tests {
+		if got := channelsOverlap(tt.band, tt.a, tt.b); got != tt.want {
+			t.Errorf("channelsOverlap(%s, %d, %d) = %v", tt.band, tt.a, tt.b, got)
+		}
+		if got := channelsOverlap(tt.band, tt.b, tt.a); got != tt.want {
+			t.Errorf("channelsOverlap(%s, %d, %d) = %v", tt.band, tt.b, tt.a, got)
+		}
+	}
+}
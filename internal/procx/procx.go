@@ -0,0 +1,25 @@
+// Package procx starts external commands that are torn down together with
+// any children they spawn when their context is cancelled.
+package procx
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// waitDelay bounds how long Wait keeps reading output after the process has
+// been killed, in case a grandchild still holds the pipes open.
+const waitDelay = 2 * time.Second
+
+// CommandContext is like exec.CommandContext, but cancelling ctx kills the
+// whole process group rather than only the direct child.
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
@@ -0,0 +1,227 @@
+// Package reflector is the server side of the latency-under-load test: run
+// with "vne-agent reflector" on infrastructure you control, it gives the
+// bufferbloat probe something to saturate the link against. One TCP port
+// serves both an HTTP mode and a raw TCP mode:
+//
+//	GET  /download?seconds=N  streams incompressible data for N seconds
+//	POST /upload              reads and discards the request body
+//	GET  /ping                answers at once, for latency samples
+//
+// A raw TCP connection whose first line is "DOWNLOAD" is sent data until
+// the client closes it, and one starting with "UPLOAD" has its data
+// discarded. Any other connection is handed to the HTTP server.
+//
+// The same port number over UDP echoes the voice-quality probe's packets.
+package reflector
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the reflector's port unless told otherwise.
+const DefaultPort = "8790"
+
+const (
+	// MaxStream caps how long one download or upload may run, so a
+	// forgotten client cannot keep the reflector busy.
+	MaxStream = 60 * time.Second
+	// firstLineWait is how long a new connection has to say what it is.
+	firstLineWait = 10 * time.Second
+	chunkSize     = 64 << 10
+)
+
+// Raw TCP mode commands, each followed by a newline.
+const (
+	CmdDownload = "DOWNLOAD"
+	CmdUpload   = "UPLOAD"
+)
+
+// Server is a reflector listening on one TCP and one UDP port of the same
+// number.
+type Server struct {
+	ln    net.Listener
+	udp   net.PacketConn
+	http  *http.Server
+	chunk []byte
+	conns chan net.Conn
+	// ctx is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Listen opens the reflector's ports; addr ":0" picks a free one.
+func Listen(addr string) (*Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// The UDP echo takes the TCP port's number, so ":0" works too.
+	host, _, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	udp, err := net.ListenPacket("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	s := &Server{ln: ln, udp: udp, chunk: make([]byte, chunkSize), conns: make(chan net.Conn)}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	// Random data keeps compressing links and proxies from shrinking the
+	// load.
+	rand.Read(s.chunk)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download", s.handleDownload)
+	mux.HandleFunc("/upload", s.handleUpload)
+	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	s.http = &http.Server{Handler: mux, ReadHeaderTimeout: firstLineWait}
+	return s, nil
+}
+
+// Addr returns the address the reflector listens on.
+func (s *Server) Addr() net.Addr { return s.ln.Addr() }
+
+// Serve accepts connections until ctx is cancelled or Close is called.
+func (s *Server) Serve(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { s.Close() })
+	defer stop()
+	go s.http.Serve(&connListener{s: s})
+	go s.serveUDP()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops the reflector and drops the connections in flight.
+func (s *Server) Close() error {
+	s.cancel()
+	err := s.ln.Close()
+	s.udp.Close()
+	s.http.Close()
+	return err
+}
+
+// handle reads the first line of a connection to pick the raw TCP mode, or
+// passes the connection on to the HTTP server.
+func (s *Server) handle(conn net.Conn) {
+	br := bufio.NewReaderSize(conn, 4096)
+	conn.SetReadDeadline(time.Now().Add(firstLineWait))
+	cmd := readCommand(br)
+	conn.SetReadDeadline(time.Time{})
+	if cmd == "" {
+		select {
+		case s.conns <- &peekedConn{Conn: conn, r: br}:
+		case <-s.ctx.Done():
+			conn.Close()
+		}
+		return
+	}
+
+	defer conn.Close()
+	stop := context.AfterFunc(s.ctx, func() { conn.Close() })
+	defer stop()
+	br.Discard(len(cmd) + 1)
+	if cmd == CmdDownload {
+		s.stream(s.ctx, conn, MaxStream)
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(MaxStream))
+	io.Copy(io.Discard, br)
+}
+
+// readCommand peeks at br one byte at a time until it holds a raw TCP mode
+// command line, which it returns without the newline, or until it cannot
+// become one, when it returns "". Peeking byte by byte means an UPLOAD
+// client that sends nothing after the command is not kept waiting for more,
+// and an HTTP request is told apart by its first byte. Nothing is consumed.
+func readCommand(br *bufio.Reader) string {
+	for n := 1; n <= len(CmdDownload)+1; n++ {
+		peek, err := br.Peek(n)
+		if err != nil {
+			return ""
+		}
+		line := string(peek)
+		switch {
+		case line == CmdDownload+"\n":
+			return CmdDownload
+		case line == CmdUpload+"\n":
+			return CmdUpload
+		case !strings.HasPrefix(CmdDownload+"\n", line) && !strings.HasPrefix(CmdUpload+"\n", line):
+			return ""
+		}
+	}
+	return ""
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	d := MaxStream
+	if secs, err := strconv.ParseFloat(r.URL.Query().Get("seconds"), 64); err == nil && secs > 0 {
+		d = min(d, time.Duration(secs*float64(time.Second)))
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	s.stream(r.Context(), w, d)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		http.Error(w, "POST the data to discard", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), MaxStream)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { r.Body.Close() })
+	defer stop()
+	n, _ := io.Copy(io.Discard, r.Body)
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, strconv.FormatInt(n, 10)+"\n")
+}
+
+// stream writes data to w until d has passed, ctx is done or a write fails.
+func (s *Server) stream(ctx context.Context, w io.Writer, d time.Duration) {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		if _, err := w.Write(s.chunk); err != nil {
+			return
+		}
+	}
+}
+
+// connListener feeds the HTTP server the connections handle passed on.
+type connListener struct{ s *Server }
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.s.conns:
+		return conn, nil
+	case <-l.s.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error   { return nil }
+func (l *connListener) Addr() net.Addr { return l.s.ln.Addr() }
+
+// peekedConn replays the bytes read while picking the mode.
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
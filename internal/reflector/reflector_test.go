@@ -0,0 +1,138 @@
+package reflector
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"DOWNLOAD\n", CmdDownload},
+		{"UPLOAD\n", CmdUpload},
+		{"UPLOAD\ndata", CmdUpload},
+		{"GET /ping HTTP/1.1\r\n\r\n", ""},
+		{"POST /upload HTTP/1.1\r\n\r\n", ""},
+		{"UPLOADS\n", ""},
+		{"DOWNLOAD", ""},
+		{"DOWN", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		br := bufio.NewReader(strings.NewReader(tt.in))
+		if got := readCommand(br); got != tt.want {
+			t.Errorf("readCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		// Nothing is consumed, so the HTTP server sees the whole request.
+		if rest, _ := io.ReadAll(br); string(rest) != tt.in {
+			t.Errorf("readCommand(%q) consumed input, %q left", tt.in, rest)
+		}
+	}
+}
+
+// An upload client that sends the command and then waits must not be held
+// until firstLineWait runs out.
+func TestReadCommandUploadWithoutData(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go io.WriteString(client, CmdUpload+"\n")
+
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	if got := readCommand(bufio.NewReader(server)); got != CmdUpload {
+		t.Fatalf("readCommand = %q, want %q", got, CmdUpload)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("readCommand took %v, waited for more data", d)
+	}
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Serve(ctx)
+	t.Cleanup(cancel)
+	return s.Addr().String()
+}
+
+func TestHandleDispatch(t *testing.T) {
+	addr := startServer(t)
+	dial := func(t *testing.T) net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	t.Run("download", func(t *testing.T) {
+		conn := dial(t)
+		io.WriteString(conn, CmdDownload+"\n")
+		buf := make([]byte, 2*chunkSize)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+	})
+
+	t.Run("upload", func(t *testing.T) {
+		conn := dial(t)
+		io.WriteString(conn, CmdUpload+"\n")
+		conn.Write(make([]byte, chunkSize))
+		conn.(*net.TCPConn).CloseWrite()
+		// The data is discarded without a reply, and the reflector hangs up
+		// once the client is done.
+		b, err := io.ReadAll(conn)
+		if err != nil || len(b) != 0 {
+			t.Fatalf("got %q, %v; want no reply", b, err)
+		}
+	})
+
+	t.Run("upload without data", func(t *testing.T) {
+		conn := dial(t)
+		io.WriteString(conn, CmdUpload+"\n")
+		time.Sleep(100 * time.Millisecond)
+		conn.(*net.TCPConn).CloseWrite()
+		// Handed to the HTTP server, the line would get a 400 back.
+		if b, _ := io.ReadAll(conn); len(b) != 0 {
+			t.Fatalf("got %q, want no reply", b)
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		resp, err := http.Get("http://" + addr + "/ping")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("GET /ping: %s, want 204", resp.Status)
+		}
+	})
+
+	t.Run("http upload", func(t *testing.T) {
+		resp, err := http.Post("http://"+addr+"/upload", "application/octet-stream", strings.NewReader("twelve bytes"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "12\n" {
+			t.Errorf("POST /upload answered %q, want %q", b, "12\n")
+		}
+	})
+}
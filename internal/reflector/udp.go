@@ -0,0 +1,107 @@
+package reflector
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// UDP echo packets carry a 32-byte header:
+//
+//	0   EchoMagic
+//	4   stream ID, picked at random by the sender
+//	8   sequence number
+//	12  packets of the stream received so far, written by the reflector
+//	16  sender's send time in nanoseconds
+//	24  reflector's receive time in nanoseconds, written by the reflector
+//
+// The rest of a packet is padding up to the size under test. The receive
+// count tells upstream loss from downstream loss, and the two timestamps
+// the jitter of each direction: the clocks need not agree, only tick at the
+// same rate. Packets without the magic are dropped, which keeps the port
+// from reflecting arbitrary traffic.
+const (
+	EchoMagic  = "VNE2"
+	EchoHeader = 32
+	// maxEcho is the largest packet echoed.
+	maxEcho = 1500
+	// maxStreams bounds the receive counters; idle streams are forgotten
+	// once it is reached.
+	maxStreams = 1024
+)
+
+// Echo is the header of a UDP echo packet.
+type Echo struct {
+	Stream    uint32
+	Seq       uint32
+	Received  uint32
+	Sent      int64
+	Reflected int64
+}
+
+// ParseEcho reads the header of p, reporting false when p is not an echo
+// packet.
+func ParseEcho(p []byte) (Echo, bool) {
+	if len(p) < EchoHeader || string(p[:len(EchoMagic)]) != EchoMagic {
+		return Echo{}, false
+	}
+	return Echo{
+		Stream:    binary.BigEndian.Uint32(p[4:8]),
+		Seq:       binary.BigEndian.Uint32(p[8:12]),
+		Received:  binary.BigEndian.Uint32(p[12:16]),
+		Sent:      int64(binary.BigEndian.Uint64(p[16:24])),
+		Reflected: int64(binary.BigEndian.Uint64(p[24:32])),
+	}, true
+}
+
+// Put writes the header into the first EchoHeader bytes of p.
+func (e Echo) Put(p []byte) {
+	copy(p, EchoMagic)
+	binary.BigEndian.PutUint32(p[4:8], e.Stream)
+	binary.BigEndian.PutUint32(p[8:12], e.Seq)
+	binary.BigEndian.PutUint32(p[12:16], e.Received)
+	binary.BigEndian.PutUint64(p[16:24], uint64(e.Sent))
+	binary.BigEndian.PutUint64(p[24:32], uint64(e.Reflected))
+}
+
+// udpStream counts the packets of one sender's stream.
+type udpStream struct {
+	received uint32
+	last     time.Time
+}
+
+// serveUDP echoes packets until the socket is closed.
+func (s *Server) serveUDP() {
+	streams := make(map[uint32]*udpStream)
+	buf := make([]byte, maxEcho+1)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		e, ok := ParseEcho(buf[:n])
+		if !ok || n > maxEcho {
+			continue
+		}
+		st := streams[e.Stream]
+		if st == nil {
+			if len(streams) >= maxStreams {
+				for id, old := range streams {
+					if now.Sub(old.last) > MaxStream {
+						delete(streams, id)
+					}
+				}
+				if len(streams) >= maxStreams {
+					continue
+				}
+			}
+			st = &udpStream{}
+			streams[e.Stream] = st
+		}
+		st.received++
+		st.last = now
+		e.Received, e.Reflected = st.received, now.UnixNano()
+		e.Put(buf)
+		s.udp.WriteTo(buf[:n], addr)
+	}
+}
@@ -18,6 +18,9 @@ var defaultReportTemplate string
 type Finding struct {
 	Severity string `json:"severity"`
 	Message  string `json:"message"`
+	// Rule is the ID of the rule that produced the finding, if any.
+	Rule        string `json:"rule,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
 }
 
 type CiscoInterface struct {
@@ -36,32 +39,123 @@ type CiscoPackResults struct {
 }
 
 type Results struct {
-	When              time.Time             `json:"when"`
-	UserNote          string                `json:"user_note"`
-	NetInfo           probes.NetInfo        `json:"net_info"`
-	Discovered        []probes.L2Host       `json:"discovered,omitempty"`
-	GwPing            probes.PingResult     `json:"gw_ping"`
-	WanPing           probes.PingResult     `json:"wan_ping"`
-	DNSLocal          probes.DNSResult      `json:"dns_local"`
-	DNSCF             probes.DNSResult      `json:"dns_cf"`
-	Trace             probes.TraceResult    `json:"trace"`
-	MTU               probes.MTUResult      `json:"mtu"`
-	Findings          []Finding             `json:"findings"`
-	FortiRaw          any                   `json:"forti_raw,omitempty"`
-	CiscoIOS          *CiscoPackResults     `json:"cisco_ios,omitempty"`
-	IfaceHealth       *snmp.InterfaceHealth `json:"iface_health,omitempty"`
-	GwLossPct         string                `json:"gw_loss_pct"`
-	WanLossPct        string                `json:"wan_loss_pct"`
-	TargetHost        string                `json:"target_host"`
-	HasGateway        bool                  `json:"has_gateway"`
-	GatewayUsed       string                `json:"gateway_used"`
-	GwJitterMs        float64               `json:"gw_jitter_ms"`
-	WanJitterMs       float64               `json:"wan_jitter_ms"`
-	Classification    string                `json:"classification"`
-	Reasons           []string              `json:"reasons"`
-	VendorSuggestions []string              `json:"vendor_suggestions,omitempty"`
-	VendorSummaries   []Finding             `json:"vendor_summaries,omitempty"`
-	VendorFindings    []Finding             `json:"vendor_findings,omitempty"`
+	When       time.Time         `json:"when"`
+	Partial    bool              `json:"partial,omitempty"`
+	UserNote   string            `json:"user_note"`
+	NetInfo    probes.NetInfo    `json:"net_info"`
+	Discovered []probes.L2Host   `json:"discovered,omitempty"`
+	L2Changes  []probes.L2Change `json:"l2_changes,omitempty"`
+	GwPing     probes.PingResult `json:"gw_ping"`
+	// Targets holds the WAN checks for each target. The first target is the
+	// primary one; its results are also kept in TargetHost, WanPing, Trace,
+	// Path and MTU.
+	Targets  []TargetResult    `json:"targets,omitempty"`
+	WanPing  probes.PingResult `json:"wan_ping"`
+	DNSLocal probes.DNSResult  `json:"dns_local"`
+	DNSCF    probes.DNSResult  `json:"dns_cf"`
+	// Resolvers holds the per-resolver queries: the system nameservers
+	// first, then the configured resolvers.
+	Resolvers []probes.ResolverResult `json:"resolvers,omitempty"`
+	// DNSMismatches lists the questions the resolvers answered differently.
+	DNSMismatches []probes.DNSMismatch `json:"dns_mismatches,omitempty"`
+	// DNSTamper holds the DNS rewriting and interception checks; nil when
+	// they did not run.
+	DNSTamper *probes.DNSTamperResult `json:"dns_tamper,omitempty"`
+	Trace     probes.TraceResult      `json:"trace"`
+	Path      probes.PathResult       `json:"path"`
+	MTU       probes.MTUResult        `json:"mtu"`
+	IPv6      IPv6Result              `json:"ipv6"`
+	// Apps holds the application checks, in the configured order.
+	Apps []probes.AppResult `json:"apps,omitempty"`
+	// Bufferbloat holds the latency-under-load test; nil when no reflector
+	// is configured.
+	Bufferbloat *probes.BufferbloatResult `json:"bufferbloat,omitempty"`
+	// Voice holds the voice/video quality stream; nil when no reflector is
+	// configured.
+	Voice *probes.VoiceResult `json:"voice,omitempty"`
+	// Wireless describes the Wi-Fi link; nil when the host is not on Wi-Fi
+	// or the platform does not expose it.
+	Wireless *probes.WirelessInfo `json:"wireless,omitempty"`
+	// LLDP holds the LLDP and CDP announcements heard on the wired
+	// interface; nil when the capture did not run.
+	LLDP *probes.LLDPResult `json:"lldp,omitempty"`
+	// DHCP holds the offers made to a DHCPDISCOVER; nil when discovery did
+	// not run.
+	DHCP *probes.DHCPResult `json:"dhcp,omitempty"`
+	// NICCounters holds how much the local interfaces' counters grew while
+	// the probes ran.
+	NICCounters []NICCounter      `json:"nic_counters,omitempty"`
+	Findings    []Finding         `json:"findings"`
+	FortiRaw    any               `json:"forti_raw,omitempty"`
+	CiscoIOS    *CiscoPackResults `json:"cisco_ios,omitempty"`
+	// IfaceHealth is the first entry of IfaceHealths, kept for readers of
+	// older result files.
+	IfaceHealth       *snmp.InterfaceHealth   `json:"iface_health,omitempty"`
+	IfaceHealths      []*snmp.InterfaceHealth `json:"iface_healths,omitempty"`
+	GwLossPct         string                  `json:"gw_loss_pct"`
+	WanLossPct        string                  `json:"wan_loss_pct"`
+	TargetHost        string                  `json:"target_host"`
+	HasGateway        bool                    `json:"has_gateway"`
+	GatewayUsed       string                  `json:"gateway_used"`
+	GwJitterMs        float64                 `json:"gw_jitter_ms"`
+	WanJitterMs       float64                 `json:"wan_jitter_ms"`
+	Classification    string                  `json:"classification"`
+	Reasons           []string                `json:"reasons"`
+	VendorSuggestions []string                `json:"vendor_suggestions,omitempty"`
+	VendorSummaries   []Finding               `json:"vendor_summaries,omitempty"`
+	VendorFindings    []Finding               `json:"vendor_findings,omitempty"`
+}
+
+// TargetResult holds the WAN checks run against one target.
+type TargetResult struct {
+	Name  string             `json:"name"`
+	Host  string             `json:"host"`
+	Ping  probes.PingResult  `json:"ping"`
+	Trace probes.TraceResult `json:"trace"`
+	Path  probes.PathResult  `json:"path"`
+	MTU   probes.MTUResult   `json:"mtu"`
+}
+
+// IPv6Result holds the IPv6 side of a dual-stack run. Addrs are the host's
+// global IPv6 addresses and Gateway its IPv6 default router; the WAN checks
+// run against Target over IPv6 only.
+type IPv6Result struct {
+	Addrs   []string           `json:"addrs,omitempty"`
+	Gateway string             `json:"gateway,omitempty"`
+	GwPing  probes.PingResult  `json:"gw_ping"`
+	Target  string             `json:"target,omitempty"`
+	Ping    probes.PingResult  `json:"ping"`
+	Trace   probes.TraceResult `json:"trace"`
+	MTU     probes.MTUResult   `json:"mtu"`
+}
+
+// NICCounter is the growth of one local interface's counters between the
+// network info snapshot and the end of the ping phases. Errors and Drops add
+// up the receive and transmit sides.
+type NICCounter struct {
+	Name   string         `json:"name"`
+	Delta  probes.IFStats `json:"delta"`
+	Errors uint64         `json:"errors"`
+	Drops  uint64         `json:"drops"`
+}
+
+// WANTargets returns the per-target results, building a single entry from
+// the primary fields for results saved before targets were recorded.
+func (r Results) WANTargets() []TargetResult {
+	if len(r.Targets) > 0 {
+		return r.Targets
+	}
+	if r.TargetHost == "" {
+		return nil
+	}
+	return []TargetResult{{
+		Name:  r.TargetHost,
+		Host:  r.TargetHost,
+		Ping:  r.WanPing,
+		Trace: r.Trace,
+		Path:  r.Path,
+		MTU:   r.MTU,
+	}}
 }
 
 func RenderHTML(r Results, tmplPath, outPath string) error {
@@ -73,6 +167,9 @@ func RenderHTML(r Results, tmplPath, outPath string) error {
 		"pct": func(v float64) string {
 			return fmt.Sprintf("%.0f%%", v*100)
 		},
+		"pct1": func(v float64) string {
+			return fmt.Sprintf("%.1f%%", v*100)
+		},
 		"ms1": func(v float64) string {
 			return fmt.Sprintf("%.1f ms", v)
 		},
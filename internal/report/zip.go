@@ -87,9 +87,13 @@ func renderBundleHTML(results Results) ([]byte, error) {
 		"pct": func(v float64) string {
 			return fmt.Sprintf("%.0f%%", v*100)
 		},
+		"pct1": func(v float64) string {
+			return fmt.Sprintf("%.1f%%", v*100)
+		},
 		"ms1": func(v float64) string {
 			return fmt.Sprintf("%.1f ms", v)
 		},
+		"humanSpeed": humanSpeed,
 	}
 
 	tpl, err := template.New("rep").Funcs(funcMap).Parse(string(tplBytes))
@@ -0,0 +1,311 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+// Outcome is what a rule set concludes about one set of results.
+type Outcome struct {
+	Findings       []report.Finding
+	Classification string
+	Reasons        []string
+}
+
+// Healthy is the classification when no classifying rule fires.
+const Healthy = "Healthy"
+
+// scope is what expressions and templates see: the results in their JSON
+// form plus a few derived values, the current "it" for each-rules, and the
+// rules that have fired so far.
+type scope struct {
+	env   map[string]any
+	res   *report.Results
+	it    any
+	hasIt bool
+	fired map[string]bool
+}
+
+func (sc *scope) lookup(name string) any {
+	if name == "it" && sc.hasIt {
+		return sc.it
+	}
+	return sc.env[name]
+}
+
+func (sc *scope) data() map[string]any {
+	if !sc.hasIt {
+		return sc.env
+	}
+	data := make(map[string]any, len(sc.env)+1)
+	for k, v := range sc.env {
+		data[k] = v
+	}
+	data["it"] = sc.it
+	return data
+}
+
+// derived holds values computed by Go helpers that rules cannot express
+// themselves. They sit next to the result fields at the top level.
+type derived struct {
+	VPNAdapters         []string         `json:"vpn_adapters"`
+	TraceSilentTail     int              `json:"trace_silent_tail"`
+	TraceLastResponding *probes.TraceHop `json:"trace_last_responding"`
+}
+
+func newEnv(res report.Results) (map[string]any, error) {
+	env := map[string]any{}
+	if err := jsonInto(res, &env); err != nil {
+		return nil, err
+	}
+	d := derived{
+		VPNAdapters:     res.NetInfo.VPNAdapterNames(),
+		TraceSilentTail: res.Trace.SilentTail(),
+	}
+	if last, ok := res.Trace.LastResponding(); ok {
+		d.TraceLastResponding = &last
+	}
+	if err := jsonInto(d, &env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func jsonInto(v any, dst *map[string]any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// Evaluate runs every rule against res. A rule whose condition or templates
+// fail is skipped and its error included in the returned error; the other
+// rules still contribute to the outcome.
+func (s *Set) Evaluate(res report.Results) (Outcome, error) {
+	env, err := newEnv(res)
+	if err != nil {
+		return Outcome{Classification: Healthy}, err
+	}
+	sc := &scope{env: env, res: &res, fired: map[string]bool{}}
+	out := Outcome{Findings: make([]report.Finding, 0), Classification: Healthy}
+	bestPriority := 0
+	var errs []error
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.Disabled {
+			continue
+		}
+		findings, reasons, err := r.evaluate(sc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", r.ID, err))
+			continue
+		}
+		if len(findings) == 0 {
+			continue
+		}
+		sc.fired[r.ID] = true
+		out.Findings = append(out.Findings, findings...)
+		if r.Classify != nil {
+			out.Reasons = append(out.Reasons, reasons...)
+			if out.Classification == Healthy || r.Classify.Priority > bestPriority {
+				out.Classification = r.Classify.Label
+				bestPriority = r.Classify.Priority
+			}
+		}
+	}
+	if out.Reasons == nil {
+		out.Reasons = make([]string, 0)
+	}
+	return out, errors.Join(errs...)
+}
+
+// Apply evaluates s against res and returns a copy with the rule findings,
+// classification and reasons replaced. Findings that did not come from a
+// rule, such as vendor pack results, are kept after the rule findings.
+func (s *Set) Apply(res report.Results) (report.Results, error) {
+	out, err := s.Evaluate(res)
+	findings := out.Findings
+	for _, f := range res.Findings {
+		if f.Rule == "" {
+			findings = append(findings, f)
+		}
+	}
+	res.Findings = findings
+	res.Classification = out.Classification
+	res.Reasons = out.Reasons
+	return res, err
+}
+
+func (r *Rule) evaluate(sc *scope) ([]report.Finding, []string, error) {
+	items := []any{nil}
+	if r.each != nil {
+		v, err := r.each.eval(sc)
+		if err != nil {
+			return nil, nil, err
+		}
+		list, _ := v.([]any)
+		items = list
+	}
+	defer func() { sc.it, sc.hasIt = nil, false }()
+
+	var findings []report.Finding
+	var reasons []string
+	for _, item := range items {
+		sc.it, sc.hasIt = item, r.each != nil
+		if r.when != nil {
+			ok, err := r.when.eval(sc)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !truthy(ok) {
+				continue
+			}
+		}
+		data := sc.data()
+		msg, err := render(r.message, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		remediation, err := render(r.remediation, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		findings = append(findings, report.Finding{
+			Severity:    r.Severity,
+			Message:     msg,
+			Rule:        r.ID,
+			Remediation: remediation,
+		})
+		if r.Classify != nil {
+			reason := msg
+			if r.reason != nil {
+				if reason, err = render(r.reason, data); err != nil {
+					return nil, nil, err
+				}
+			}
+			reasons = append(reasons, reason)
+		}
+	}
+	return findings, reasons, nil
+}
+
+func render(t *template.Template, data map[string]any) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// functions are callable from condition expressions.
+var functions map[string]func(sc *scope, args []any) (any, error)
+
+func init() {
+	functions = map[string]func(sc *scope, args []any) (any, error){
+		// len(x) is the length of a list, string or object; 0 for null.
+		"len": func(_ *scope, args []any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("len takes one argument")
+			}
+			switch v := args[0].(type) {
+			case []any:
+				return float64(len(v)), nil
+			case string:
+				return float64(len(v)), nil
+			case map[string]any:
+				return float64(len(v)), nil
+			}
+			return 0.0, nil
+		},
+		// contains(list, x) is the function form of "x in list".
+		"contains": func(_ *scope, args []any) (any, error) {
+			if len(args) != 2 {
+				return nil, errors.New("contains takes two arguments")
+			}
+			return contains(args[0], args[1]), nil
+		},
+		"lower": func(_ *scope, args []any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("lower takes one argument")
+			}
+			return strings.ToLower(toString(args[0])), nil
+		},
+		// fired("id") reports whether an earlier rule has fired.
+		"fired": func(sc *scope, args []any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("fired takes one argument")
+			}
+			return sc.fired[toString(args[0])], nil
+		},
+		// impaired_targets(loss, jitter_ms) lists the WAN targets whose
+		// ping loss or jitter reaches the given limits.
+		"impaired_targets": func(sc *scope, args []any) (any, error) {
+			if len(args) != 2 {
+				return nil, errors.New("impaired_targets takes two arguments")
+			}
+			loss, jitter := toNumber(args[0]), toNumber(args[1])
+			targets, _ := sc.env["targets"].([]any)
+			out := make([]any, 0, len(targets))
+			for _, t := range targets {
+				obj, _ := t.(map[string]any)
+				ping, _ := obj["ping"].(map[string]any)
+				if toNumber(ping["loss"]) >= loss || toNumber(ping["jitter_ms"]) >= jitter {
+					out = append(out, t)
+				}
+			}
+			return out, nil
+		},
+		// latency_jumps(ms) lists the traceroute hop where the best RTT
+		// first rises by at least ms over the earlier hops, as
+		// {ttl, addrs, delta_ms}; the list is empty when there is none.
+		"latency_jumps": func(sc *scope, args []any) (any, error) {
+			if len(args) != 1 {
+				return nil, errors.New("latency_jumps takes one argument")
+			}
+			hop, delta, ok := sc.res.Trace.LatencyJump(toNumber(args[0]))
+			if !ok {
+				return []any{}, nil
+			}
+			addrs := make([]any, len(hop.Addrs))
+			for i, a := range hop.Addrs {
+				addrs[i] = a
+			}
+			return []any{map[string]any{
+				"ttl":      float64(hop.TTL),
+				"addrs":    addrs,
+				"delta_ms": delta,
+			}}, nil
+		},
+	}
+}
+
+// templateFuncs are available in message, remediation and reason templates.
+var templateFuncs = template.FuncMap{
+	// pct formats a 0–1 ratio as a whole percentage.
+	"pct": func(v any) string { return fmt.Sprintf("%.0f%%", toNumber(v)*100) },
+	// pct1 formats a 0–1 ratio as a percentage with one decimal.
+	"pct1": func(v any) string { return fmt.Sprintf("%.1f%%", toNumber(v)*100) },
+	// ms formats a millisecond value without decimals.
+	"ms": func(v any) string { return fmt.Sprintf("%.0f", toNumber(v)) },
+	// ms1 formats a millisecond value with one decimal.
+	"ms1": func(v any) string { return fmt.Sprintf("%.1f", toNumber(v)) },
+	"join": func(v any, sep string) string {
+		list, _ := v.([]any)
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, sep)
+	},
+}
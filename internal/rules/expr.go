@@ -0,0 +1,533 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The condition language is a small expression syntax over the JSON form of
+// report.Results:
+//
+//	gw_ping.loss >= 0.1 && !fired("gateway-unstable")
+//	len(vpn_adapters) > 0 && mtu.path_mtu < 1500
+//	"fortigate" in vendor_suggestions
+//
+// Values are numbers, strings, booleans, null, lists and objects. A missing
+// field evaluates to null, and null counts as zero in arithmetic and ordering
+// so fields dropped by omitempty compare like their zero value.
+
+type node interface {
+	eval(sc *scope) (any, error)
+}
+
+type (
+	literalNode struct{ v any }
+	identNode   struct{ name string }
+	fieldNode   struct {
+		x    node
+		name string
+	}
+	indexNode struct{ x, i node }
+	callNode  struct {
+		name string
+		args []node
+	}
+	unaryNode struct {
+		op string
+		x  node
+	}
+	binaryNode struct {
+		op   string
+		l, r node
+	}
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(src) {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q at %d", src[start:i], start)
+			}
+			toks = append(toks, token{kind: tokNumber, num: n, text: src[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			toks = append(toks, token{kind: tokString, text: sb.String(), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			toks = append(toks, token{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			op := ""
+			for _, cand := range []string{"&&", "||", "==", "!=", "<=", ">="} {
+				if strings.HasPrefix(src[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				if !strings.ContainsRune("()[],.!<>+-*/%", c) {
+					return nil, fmt.Errorf("unexpected %q at %d", c, i)
+				}
+				op = string(c)
+			}
+			toks = append(toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: len(src)})
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// parseExpr compiles a condition expression into an evaluable tree.
+func parseExpr(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	n, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return n, nil
+}
+
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4, "in": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(op string) error {
+	if t := p.next(); t.kind != tokOp || t.text != op {
+		return fmt.Errorf("expected %q at %d", op, t.pos)
+	}
+	return nil
+}
+
+func (p *parser) binaryOp() (string, int) {
+	t := p.peek()
+	if t.kind == tokOp || (t.kind == tokIdent && t.text == "in") {
+		if prec, ok := precedence[t.text]; ok {
+			return t.text, prec
+		}
+	}
+	return "", 0
+}
+
+func (p *parser) binary(minPrec int) (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, prec := p.binaryOp()
+		if op == "" || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, l: left, r: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "!" || t.text == "-") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: t.text, x: x}, nil
+	}
+	return p.postfix()
+}
+
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp {
+			return x, nil
+		}
+		switch t.text {
+		case ".":
+			p.next()
+			name := p.next()
+			if name.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at %d", name.pos)
+			}
+			x = fieldNode{x: x, name: name.text}
+		case "[":
+			p.next()
+			i, err := p.binary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = indexNode{x: x, i: i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return literalNode{v: t.num}, nil
+	case tokString:
+		return literalNode{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return literalNode{v: true}, nil
+		case "false":
+			return literalNode{v: false}, nil
+		case "null":
+			return literalNode{v: nil}, nil
+		}
+		if next := p.peek(); next.kind == tokOp && next.text == "(" {
+			p.next()
+			var args []node
+			for {
+				if t := p.peek(); t.kind == tokOp && t.text == ")" {
+					p.next()
+					break
+				}
+				if len(args) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := p.binary(0)
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, arg)
+			}
+			if _, ok := functions[t.text]; !ok {
+				return nil, fmt.Errorf("unknown function %q at %d", t.text, t.pos)
+			}
+			return callNode{name: t.text, args: args}, nil
+		}
+		return identNode{name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.binary(0)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (n literalNode) eval(*scope) (any, error) { return n.v, nil }
+
+func (n identNode) eval(sc *scope) (any, error) { return sc.lookup(n.name), nil }
+
+func (n fieldNode) eval(sc *scope) (any, error) {
+	x, err := n.x.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := x.(map[string]any); ok {
+		return m[n.name], nil
+	}
+	return nil, nil
+}
+
+func (n indexNode) eval(sc *scope) (any, error) {
+	x, err := n.x.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.i.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case []any:
+		idx := int(toNumber(i))
+		if idx < 0 {
+			idx += len(x)
+		}
+		if idx < 0 || idx >= len(x) {
+			return nil, nil
+		}
+		return x[idx], nil
+	case map[string]any:
+		s, _ := i.(string)
+		return x[s], nil
+	}
+	return nil, nil
+}
+
+func (n callNode) eval(sc *scope) (any, error) {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(sc)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return functions[n.name](sc, args)
+}
+
+func (n unaryNode) eval(sc *scope) (any, error) {
+	x, err := n.x.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(x), nil
+	}
+	return -toNumber(x), nil
+}
+
+func (n binaryNode) eval(sc *scope) (any, error) {
+	l, err := n.l.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	// && and || short-circuit so guards like has_gateway && ... stay cheap.
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := n.r.eval(sc)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := n.r.eval(sc)
+		return truthy(r), err
+	}
+	r, err := n.r.eval(sc)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		return contains(r, l), nil
+	case "<", "<=", ">", ">=":
+		c := compare(l, r)
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case "+":
+		if ls, ok := l.(string); ok {
+			return ls + toString(r), nil
+		}
+		return toNumber(l) + toNumber(r), nil
+	case "-":
+		return toNumber(l) - toNumber(r), nil
+	case "*":
+		return toNumber(l) * toNumber(r), nil
+	case "/":
+		d := toNumber(r)
+		if d == 0 {
+			return 0.0, nil
+		}
+		return toNumber(l) / d, nil
+	case "%":
+		d := toNumber(r)
+		if d == 0 {
+			return 0.0, nil
+		}
+		return math.Mod(toNumber(l), d), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", n.op)
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+func toNumber(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		n, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n
+	}
+	return 0
+}
+
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func equal(l, r any) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	switch l := l.(type) {
+	case string:
+		rs, ok := r.(string)
+		return ok && l == rs
+	case bool:
+		rb, ok := r.(bool)
+		return ok && l == rb
+	case float64:
+		return l == toNumber(r)
+	}
+	return false
+}
+
+func compare(l, r any) int {
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		return strings.Compare(ls, rs)
+	}
+	a, b := toNumber(l), toNumber(r)
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func contains(haystack, needle any) bool {
+	switch h := haystack.(type) {
+	case []any:
+		for _, v := range h {
+			if equal(v, needle) {
+				return true
+			}
+		}
+	case string:
+		return strings.Contains(h, toString(needle))
+	case map[string]any:
+		_, ok := h[toString(needle)]
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+// Package rules turns diagnostic results into findings and an overall
+// classification using declarative rules. A default rule set is embedded in
+// the binary; users can add, replace or disable rules with their own YAML or
+// JSON file.
+package rules
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed default_rules.yaml
+var defaultRules []byte
+
+// Rule is one condition over the results and what to report when it holds.
+type Rule struct {
+	// ID names the rule in findings and lets a user file replace or disable
+	// a default rule.
+	ID          string `yaml:"id" json:"id"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Each, when set, is an expression yielding a list; the rule is checked
+	// once per element with the element bound to "it".
+	Each string `yaml:"each,omitempty" json:"each,omitempty"`
+	// When is the condition expression. An empty condition always holds.
+	When     string `yaml:"when,omitempty" json:"when,omitempty"`
+	Severity string `yaml:"severity" json:"severity"`
+	// Message and Remediation are text/template strings rendered against
+	// the same values the condition sees.
+	Message     string          `yaml:"message" json:"message"`
+	Remediation string          `yaml:"remediation,omitempty" json:"remediation,omitempty"`
+	Classify    *Classification `yaml:"classify,omitempty" json:"classify,omitempty"`
+	// Disabled drops the rule, including a default rule with the same ID.
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
+
+	each        node
+	when        node
+	message     *template.Template
+	remediation *template.Template
+	reason      *template.Template
+}
+
+// Classification is the verdict a rule contributes when it fires. The label
+// of the highest-priority fired rule becomes the overall classification.
+type Classification struct {
+	Label    string `yaml:"label" json:"label"`
+	Priority int    `yaml:"priority" json:"priority"`
+	// Reason is a template for the classification reason; the rendered
+	// message is used when it is empty.
+	Reason string `yaml:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// Set is an ordered, compiled list of rules. Rules are evaluated in order, so
+// a rule can refer to earlier rules through fired("id").
+type Set struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Default returns the embedded rule set.
+func Default() (*Set, error) {
+	set, err := Parse(defaultRules, "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("default rules: %w", err)
+	}
+	return set, nil
+}
+
+// Load reads a rule file. Files ending in .json are parsed as JSON and
+// anything else as YAML.
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		format = "json"
+	}
+	set, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return set, nil
+}
+
+// LoadWithDefaults returns the default rules with the rules in path merged on
+// top. An empty path returns the defaults alone.
+func LoadWithDefaults(path string) (*Set, error) {
+	set, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(path) == "" {
+		return set, nil
+	}
+	user, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return set.Merge(user), nil
+}
+
+// Parse decodes and compiles a rule set in the given format ("yaml" or
+// "json").
+func Parse(data []byte, format string) (*Set, error) {
+	var set Set
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&set); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&set); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule format %q", format)
+	}
+	return NewSet(set.Rules)
+}
+
+// NewSet validates and compiles rules decoded elsewhere, such as the rules
+// section of a config file.
+func NewSet(list []Rule) (*Set, error) {
+	set := &Set{Rules: append([]Rule(nil), list...)}
+	seen := make(map[string]bool, len(set.Rules))
+	for i := range set.Rules {
+		r := &set.Rules[i]
+		r.ID = strings.TrimSpace(r.ID)
+		if r.ID == "" {
+			return nil, fmt.Errorf("rule %d: missing id", i+1)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("rule %q: duplicate id", r.ID)
+		}
+		seen[r.ID] = true
+		if r.Disabled {
+			continue
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.ID, err)
+		}
+	}
+	return set, nil
+}
+
+// Merge returns a new set with other's rules applied on top of s: a rule with
+// an existing ID replaces it in place, a disabled rule removes it, and new
+// rules are appended.
+func (s *Set) Merge(other *Set) *Set {
+	merged := &Set{Rules: append([]Rule(nil), s.Rules...)}
+	for _, r := range other.Rules {
+		idx := -1
+		for i := range merged.Rules {
+			if merged.Rules[i].ID == r.ID {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case idx >= 0 && r.Disabled:
+			merged.Rules = append(merged.Rules[:idx], merged.Rules[idx+1:]...)
+		case idx >= 0:
+			merged.Rules[idx] = r
+		case !r.Disabled:
+			merged.Rules = append(merged.Rules, r)
+		}
+	}
+	return merged
+}
+
+func (r *Rule) compile() error {
+	var err error
+	if strings.TrimSpace(r.Each) != "" {
+		if r.each, err = parseExpr(r.Each); err != nil {
+			return fmt.Errorf("each: %w", err)
+		}
+	}
+	if strings.TrimSpace(r.When) != "" {
+		if r.when, err = parseExpr(r.When); err != nil {
+			return fmt.Errorf("when: %w", err)
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(r.Severity)) {
+	case "high", "medium", "info":
+		r.Severity = strings.ToLower(strings.TrimSpace(r.Severity))
+	default:
+		return fmt.Errorf("severity must be high, medium or info, not %q", r.Severity)
+	}
+	if strings.TrimSpace(r.Message) == "" {
+		return fmt.Errorf("missing message")
+	}
+	if r.message, err = newTemplate("message", r.Message); err != nil {
+		return err
+	}
+	if r.remediation, err = newTemplate("remediation", r.Remediation); err != nil {
+		return err
+	}
+	if r.Classify != nil {
+		if strings.TrimSpace(r.Classify.Label) == "" {
+			return fmt.Errorf("classify: missing label")
+		}
+		if r.reason, err = newTemplate("reason", r.Classify.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTemplate(name, text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
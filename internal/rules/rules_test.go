@@ -0,0 +1,543 @@
+package rules
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cneate93/vne/internal/probes"
+	"github.com/cneate93/vne/internal/report"
+)
+
+// testEnv is what the expression tests evaluate against.
+var testEnv = map[string]any{
+	"n":     2.0,
+	"s":     "abc",
+	"yes":   true,
+	"list":  []any{"a", "b", 3.0},
+	"obj":   map[string]any{"k": 1.0, "nested": map[string]any{"v": 5.0}},
+	"empty": []any{},
+	"null":  nil,
+}
+
+func evalExpr(src string) (any, error) {
+	n, err := parseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	return n.eval(&scope{env: testEnv, fired: map[string]bool{"earlier": true}})
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"1 & 2", `unexpected '&' at 2`},
+		{"n # 1", `unexpected '#' at 2`},
+		{"'abc", "unterminated string at 0"},
+		{"1.2.3", `bad number "1.2.3" at 0`},
+		{"", "unexpected end of expression"},
+		{"n >", "unexpected end of expression"},
+		{"(1 + 2", `expected ")" at 6`},
+		{"1 2", `unexpected "2" at 2`},
+		{"obj.", "expected field name at 4"},
+		{"obj.1", "expected field name at 4"},
+		{"list[1", `expected "]" at 6`},
+		{"len(1 2)", `expected "," at 6`},
+		{"nosuch(1)", `unknown function "nosuch" at 0`},
+		{")", `unexpected ")" at 0`},
+	}
+	for _, tt := range tests {
+		_, err := parseExpr(tt.src)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("parseExpr(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		// Precedence and associativity.
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"10 - 4 - 3", 3.0},
+		{"8 / 4 / 2", 1.0},
+		{"-n * 3", -6.0},
+		{"10 % 4 + 1", 3.0},
+		{"1 + 1 == 2", true},
+		{"1 < 2 == 2 < 3", true},
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"n > 1 && n < 3 || false", true},
+		{"1 / 0", 0.0},
+		{"5 % 0", 0.0},
+
+		// Comparisons and membership.
+		{"s == 'abc'", true},
+		{"s != \"abc\"", false},
+		{"'a' < 'b'", true},
+		{"'10' > 9", true},
+		{"yes == true", true},
+		{"n == '2'", true},
+		{"'b' in list", true},
+		{"3 in list", true},
+		{"'z' in list", false},
+		{"'bc' in s", true},
+		{"'k' in obj", true},
+		{"contains(list, 'a')", true},
+		{"s + 1", "abc1"},
+		{"lower('ABC') == s", true},
+
+		// Fields, indexes and functions.
+		{"obj.k", 1.0},
+		{"obj.nested.v * 2", 10.0},
+		{"obj['k']", 1.0},
+		{"list[0]", "a"},
+		{"list[-1]", 3.0},
+		{"list[9]", nil},
+		{"len(list)", 3.0},
+		{"len(s)", 3.0},
+		{"len(obj)", 2.0},
+		{"fired('earlier')", true},
+		{"fired('later')", false},
+
+		// Missing and null values: null equals only null but orders and
+		// adds up like zero, so omitted zero values compare as zero.
+		{"missing", nil},
+		{"missing == null", true},
+		{"null == null", true},
+		{"missing == 0", false},
+		{"missing != 0", true},
+		{"missing < 1", true},
+		{"missing >= 0", true},
+		{"missing > 0", false},
+		{"missing + 1", 1.0},
+		{"missing.field.deeper", nil},
+		{"missing.field >= 0.1", false},
+		{"s.field", nil},
+		{"missing[0]", nil},
+		{"len(missing)", 0.0},
+		{"len(null) == 0", true},
+		{"!missing", true},
+		{"'a' in missing", false},
+		{"missing && true", false},
+		{"!empty", true},
+	}
+	for _, tt := range tests {
+		got, err := evalExpr(tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// The right-hand side of && and || is not evaluated when the left decides,
+// so a guard keeps a failing expression from running.
+func TestEvalShortCircuit(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    any
+		wantErr bool
+	}{
+		{"false && len(1, 2) > 0", false, false},
+		{"missing && len(1, 2) > 0", false, false},
+		{"true || len(1, 2) > 0", true, false},
+		{"n || len(1, 2) > 0", true, false},
+		{"true && len(1, 2) > 0", nil, true},
+		{"false || len(1, 2) > 0", nil, true},
+		{"len(1, 2) > 0 && false", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := evalExpr(tt.src)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.src, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestNewSetErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"missing id", Rule{Severity: "info", Message: "m"}, "rule 2: missing id"},
+		{"duplicate id", Rule{ID: " ok ", Severity: "info", Message: "m"}, `rule "ok": duplicate id`},
+		{"severity", Rule{ID: "r", Severity: "critical", Message: "m"}, `rule "r": severity must be high, medium or info, not "critical"`},
+		{"message", Rule{ID: "r", Severity: "info"}, `rule "r": missing message`},
+		{"when", Rule{ID: "r", Severity: "info", Message: "m", When: "n >"}, `rule "r": when: unexpected end of expression`},
+		{"each", Rule{ID: "r", Severity: "info", Message: "m", Each: "'abc"}, `rule "r": each: unterminated string at 0`},
+		{"template", Rule{ID: "r", Severity: "info", Message: "{{ .x"}, `rule "r": message: template: message:1: unclosed action`},
+		{"label", Rule{ID: "r", Severity: "info", Message: "m", Classify: &Classification{}}, `rule "r": classify: missing label`},
+	}
+	for _, tt := range tests {
+		_, err := NewSet([]Rule{{ID: "ok", Severity: "info", Message: "m"}, tt.rule})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// A disabled rule is not compiled, so it may be incomplete.
+	if _, err := NewSet([]Rule{{ID: "off", Disabled: true, When: "("}}); err != nil {
+		t.Errorf("disabled rule: %v", err)
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	if _, err := Parse([]byte("rules:\n  - id: r\n    severity: info\n    message: m\n    colour: red\n"), "yaml"); err == nil {
+		t.Error("yaml: unknown field accepted")
+	}
+	if _, err := Parse([]byte(`{"rules": [{"id": "r", "severity": "info", "message": "m", "colour": "red"}]}`), "json"); err == nil {
+		t.Error("json: unknown field accepted")
+	}
+	set, err := Parse([]byte(`{"rules": [{"id": "r", "severity": "INFO", "message": "m"}]}`), "json")
+	if err != nil || set.Rules[0].Severity != "info" {
+		t.Errorf("json: %v, %+v", err, set)
+	}
+	if _, err := Parse(nil, "toml"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+const eachRules = `
+rules:
+  - id: noisy
+    each: nic_counters
+    when: it.errors > 0
+    severity: high
+    message: "{{ .it.name }} has {{ .it.errors }} errors"
+    classify:
+      label: LAN problem likely
+      priority: 3
+      reason: "Errors on {{ .it.name }}"
+  - id: after-noisy
+    when: fired("noisy") && !fired("never")
+    severity: info
+    message: after {{ len .nic_counters }} interfaces
+  - id: never
+    when: false
+    severity: info
+    message: never
+  - id: before-never
+    when: '!fired("never") && it == null'
+    severity: info
+    message: it is unbound outside each
+  - id: slow
+    when: dns_local.avg_ms > 100
+    severity: medium
+    message: slow
+    classify:
+      label: DNS slow
+      priority: 1
+`
+
+func TestEvaluateEachAndFired(t *testing.T) {
+	set, err := Parse([]byte(eachRules), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := report.Results{
+		NICCounters: []report.NICCounter{
+			{Name: "eth0", Errors: 3},
+			{Name: "eth1"},
+			{Name: "eth2", Errors: 1},
+		},
+		DNSLocal: probes.DNSResult{AvgMs: 300},
+	}
+	out, err := set.Evaluate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range out.Findings {
+		got = append(got, f.Rule+": "+f.Message)
+	}
+	want := []string{
+		"noisy: eth0 has 3 errors",
+		"noisy: eth2 has 1 errors",
+		"after-noisy: after 3 interfaces",
+		"before-never: it is unbound outside each",
+		"slow: slow",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("findings:\n got %q\nwant %q", got, want)
+	}
+	// The higher priority wins and every classifying finding adds a reason.
+	if out.Classification != "LAN problem likely" {
+		t.Errorf("classification = %q", out.Classification)
+	}
+	if want := []string{"Errors on eth0", "Errors on eth2", "slow"}; !slices.Equal(out.Reasons, want) {
+		t.Errorf("reasons = %q, want %q", out.Reasons, want)
+	}
+
+	// Nothing to iterate: the each-rule and the rule after it stay quiet.
+	out, err = set.Evaluate(report.Results{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Classification != Healthy || len(out.Findings) != 1 || out.Findings[0].Rule != "before-never" {
+		t.Errorf("empty results: %q, %+v", out.Classification, out.Findings)
+	}
+}
+
+func TestEvaluateKeepsGoingAfterError(t *testing.T) {
+	set, err := NewSet([]Rule{
+		{ID: "broken", When: "len(1, 2) > 0", Severity: "info", Message: "m"},
+		{ID: "fine", Severity: "info", Message: "fine"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := set.Evaluate(report.Results{})
+	if err == nil || !strings.Contains(err.Error(), `rule "broken"`) {
+		t.Errorf("error = %v, want one naming the broken rule", err)
+	}
+	if len(out.Findings) != 1 || out.Findings[0].Rule != "fine" {
+		t.Errorf("findings = %+v", out.Findings)
+	}
+}
+
+func TestApplyKeepsFindingsWithoutRule(t *testing.T) {
+	set, err := NewSet([]Rule{{ID: "always", Severity: "info", Message: "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := report.Results{
+		Findings: []report.Finding{
+			{Rule: "always", Message: "old"},
+			{Rule: "gone", Message: "stale"},
+			{Severity: "high", Message: "from a vendor pack"},
+		},
+		Classification: "LAN problem likely",
+	}
+	got, err := set.Apply(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, f := range got.Findings {
+		msgs = append(msgs, f.Message)
+	}
+	if want := []string{"new", "from a vendor pack"}; !slices.Equal(msgs, want) {
+		t.Errorf("findings = %q, want %q", msgs, want)
+	}
+	if got.Classification != Healthy {
+		t.Errorf("classification = %q", got.Classification)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rule := func(id, msg string) Rule { return Rule{ID: id, Severity: "info", Message: msg} }
+	base, err := NewSet([]Rule{rule("a", "a"), rule("b", "b"), rule("c", "c")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := NewSet([]Rule{
+		rule("b", "b2"),
+		{ID: "c", Disabled: true},
+		rule("d", "d"),
+		{ID: "e", Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := base.Merge(user)
+	var got []string
+	for _, r := range merged.Rules {
+		got = append(got, r.ID+"="+r.Message)
+	}
+	if want := []string{"a=a", "b=b2", "d=d"}; !slices.Equal(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+	if len(base.Rules) != 3 || base.Rules[1].Message != "b" {
+		t.Errorf("Merge changed the base set: %+v", base.Rules)
+	}
+
+	out, err := merged.Evaluate(report.Results{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Findings) != 3 || out.Findings[1].Message != "b2" {
+		t.Errorf("findings = %+v", out.Findings)
+	}
+}
+
+// legacyClassify is the classification engine.Run used before the rules
+// existed, kept here as the reference the default rules must agree with.
+func legacyClassify(res report.Results) (string, []string) {
+	type issue struct {
+		label, reason string
+		severity      int
+	}
+	gwPing, wanPing, path := res.GwPing, res.WanPing, res.Path
+	hasGateway := res.NetInfo.DefaultGateway != "" || len(res.NetInfo.Gateways) > 0
+	gatewayBad := hasGateway && (gwPing.Loss >= 0.1 || gwPing.JitterMs >= 20)
+	wanBad := wanPing.Loss >= 0.05 || wanPing.JitterMs >= 30
+	pathLossHop := 0
+	if path.Verdict.ForwardingLoss >= 0.05 {
+		pathLossHop = path.Verdict.ForwardingLossHop
+	}
+	var issues []issue
+	if gatewayBad {
+		issues = append(issues, issue{"LAN problem likely", "gateway", 3})
+	}
+	if !gatewayBad && hasGateway && pathLossHop == 1 {
+		gatewayBad = true
+		issues = append(issues, issue{"LAN problem likely", "first hop", 3})
+	}
+	if !gatewayBad && wanBad {
+		issues = append(issues, issue{"WAN/ISP issue likely", "wan", 2})
+	}
+	if !gatewayBad && pathLossHop > 1 {
+		issues = append(issues, issue{"WAN/ISP issue likely", "path", 2})
+	}
+	if !gatewayBad && !wanBad && res.DNSLocal.AvgMs >= 150 && gwPing.Loss < 0.02 && wanPing.Loss < 0.02 {
+		issues = append(issues, issue{"DNS slow", "dns", 1})
+	}
+	if vpn := res.NetInfo.VPNAdapterNames(); res.MTU.PathMTU > 0 && res.MTU.PathMTU < 1500 && len(vpn) > 0 {
+		issues = append(issues, issue{"MTU/MSS issue", "mtu", 2})
+	}
+	label, best := Healthy, 0
+	var reasons []string
+	for _, i := range issues {
+		reasons = append(reasons, i.reason)
+		if label == Healthy || i.severity > best {
+			label, best = i.label, i.severity
+		}
+	}
+	return label, reasons
+}
+
+func TestDefaultRulesMatchLegacyClassification(t *testing.T) {
+	set, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lan := func(res report.Results) report.Results {
+		res.HasGateway = true
+		res.NetInfo.DefaultGateway = "192.168.1.1"
+		res.NetInfo.Gateways = append(res.NetInfo.Gateways, "192.168.1.1")
+		res.NetInfo.Interfaces = append(res.NetInfo.Interfaces, probes.IF{Name: "eth0", Up: true})
+		return res
+	}
+	vpn := func(res report.Results) report.Results {
+		res.NetInfo.Interfaces = append(res.NetInfo.Interfaces, probes.IF{Name: "wg0", Up: true})
+		return res
+	}
+	verdict := func(hop int, loss float64) probes.PathResult {
+		return probes.PathResult{Verdict: probes.PathVerdict{ForwardingLossHop: hop, ForwardingLoss: loss, ForwardingLossAt: "203.0.113.1"}}
+	}
+
+	tests := []struct {
+		name string
+		res  report.Results
+		// rules are the IDs of the rules expected to fire, in order.
+		rules []string
+	}{
+		{"healthy", lan(report.Results{DNSLocal: probes.DNSResult{AvgMs: 20}}), nil},
+		{"gateway loss hides wan loss", lan(report.Results{
+			GwPing:  probes.PingResult{Loss: 0.35},
+			WanPing: probes.PingResult{Loss: 0.4},
+		}), []string{"gateway-unstable"}},
+		{"gateway jitter", lan(report.Results{GwPing: probes.PingResult{JitterMs: 25}}), []string{"gateway-unstable"}},
+		{"gateway loss just below", lan(report.Results{GwPing: probes.PingResult{Loss: 0.099}}), nil},
+		{"no gateway", report.Results{GwPing: probes.PingResult{Loss: 1}}, nil},
+		{"wan loss", lan(report.Results{WanPing: probes.PingResult{Loss: 0.05}}), []string{"wan-impaired"}},
+		{"wan jitter", lan(report.Results{WanPing: probes.PingResult{JitterMs: 35}}), []string{"wan-impaired"}},
+		{"first hop loss hides slow dns", lan(report.Results{
+			Path:     verdict(1, 0.2),
+			DNSLocal: probes.DNSResult{AvgMs: 400},
+		}), []string{"lan-forwarding-loss"}},
+		{"later hop loss", lan(report.Results{Path: verdict(4, 0.1)}), []string{"wan-forwarding-loss"}},
+		{"later hop loss with wan loss", lan(report.Results{
+			Path:    verdict(4, 0.1),
+			WanPing: probes.PingResult{Loss: 0.1},
+		}), []string{"wan-impaired", "wan-forwarding-loss"}},
+		{"slight hop loss", lan(report.Results{Path: verdict(3, 0.04)}), nil},
+		{"slow dns", lan(report.Results{
+			DNSLocal: probes.DNSResult{AvgMs: 180},
+			WanPing:  probes.PingResult{Loss: 0.01},
+		}), []string{"dns-slow"}},
+		{"slow dns on a lossy wan", lan(report.Results{
+			DNSLocal: probes.DNSResult{AvgMs: 180},
+			WanPing:  probes.PingResult{Loss: 0.03},
+		}), nil},
+		{"vpn mtu", vpn(lan(report.Results{MTU: probes.MTUResult{PathMTU: 1420}})), []string{"mtu-vpn"}},
+		{"vpn mtu behind wan loss", vpn(lan(report.Results{
+			MTU:     probes.MTUResult{PathMTU: 1420},
+			WanPing: probes.PingResult{Loss: 0.06},
+		})), []string{"wan-impaired", "mtu-vpn"}},
+		{"vpn mtu behind gateway loss", vpn(lan(report.Results{
+			MTU:    probes.MTUResult{PathMTU: 1420},
+			GwPing: probes.PingResult{Loss: 0.2},
+		})), []string{"gateway-unstable", "mtu-vpn"}},
+		{"low mtu without vpn", lan(report.Results{MTU: probes.MTUResult{PathMTU: 1492}}), []string{"mtu-low"}},
+		{"vpn without mtu", vpn(lan(report.Results{})), []string{"mtu-vpn-inconclusive"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := set.Evaluate(tt.res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fired []string
+			for _, f := range out.Findings {
+				fired = append(fired, f.Rule)
+			}
+			if !slices.Equal(fired, tt.rules) {
+				t.Errorf("fired %q, want %q", fired, tt.rules)
+			}
+			label, reasons := legacyClassify(tt.res)
+			if out.Classification != label || len(out.Reasons) != len(reasons) {
+				t.Errorf("classification %q with %d reasons %q, legacy %q with %d reasons %q",
+					out.Classification, len(out.Reasons), out.Reasons, label, len(reasons), reasons)
+			}
+		})
+	}
+}
+
+func TestDefaultRulesMessages(t *testing.T) {
+	set, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := report.Results{
+		HasGateway: true,
+		GwPing:     probes.PingResult{Loss: 0.125, JitterMs: 3.04},
+		Trace: probes.TraceResult{Hops: []probes.TraceHop{
+			{TTL: 1, Addrs: []string{"192.168.1.1"}, RTTs: []float64{1}},
+			{TTL: 2, Addrs: []string{"100.64.0.1"}, RTTs: []float64{70}},
+			{TTL: 3, Timeouts: 3},
+		}},
+	}
+	out, err := set.Evaluate(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"gateway-unstable":   "Gateway ping unstable (loss 12.5%, jitter 3.0 ms).",
+		"trace-silent-tail":  "Traceroute gets no replies from hop 3 onward (last reply from 100.64.0.1 at hop 2).",
+		"trace-latency-jump": "Latency rises by ~69 ms at hop 2 (100.64.0.1).",
+	}
+	got := map[string]string{}
+	for _, f := range out.Findings {
+		got[f.Rule] = f.Message
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("messages:\n got %q\nwant %q", got, want)
+	}
+}
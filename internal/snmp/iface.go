@@ -24,6 +24,7 @@ const (
 
 // InterfaceHealth represents selected SNMP counters for a single interface.
 type InterfaceHealth struct {
+	Host        string `json:"host,omitempty"`
 	Index       int    `json:"index"`
 	Name        string `json:"name"`
 	OperStatus  string `json:"oper_status"`
@@ -90,6 +91,7 @@ func GetInterfaceHealth(ctx context.Context, host, community, ifaceName string)
 	}
 
 	health := &InterfaceHealth{
+		Host:  host,
 		Index: index,
 		Name:  resolvedName,
 	}
@@ -2,16 +2,19 @@ package sshx
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"os/exec"
+
+	"github.com/cneate93/vne/internal/procx"
 )
 
 // RunPythonPack executes a Python script with a JSON payload piped to stdin.
-// It returns the stdout of the Python script (usually JSON output).
-func RunPythonPack(pythonPath, scriptPath string, payload any) ([]byte, error) {
+// It returns the stdout of the Python script (usually JSON output). Cancelling
+// ctx kills the interpreter and anything it spawned.
+func RunPythonPack(ctx context.Context, pythonPath, scriptPath string, payload any) ([]byte, error) {
 	in, _ := json.Marshal(payload)
 
-	cmd := exec.Command(pythonPath, scriptPath)
+	cmd := procx.CommandContext(ctx, pythonPath, scriptPath)
 	cmd.Stdin = bytes.NewReader(in)
 
 	var out bytes.Buffer
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cneate93/vne/internal/engine"
 	"github.com/cneate93/vne/internal/history"
 	"github.com/cneate93/vne/internal/progress"
 	"github.com/cneate93/vne/internal/report"
@@ -54,6 +56,8 @@ type runState struct {
 	log          []streamEvent
 	baseFindings []report.Finding
 	historyID    string
+	// cancel stops the job in progress; nil when nothing is running.
+	cancel context.CancelFunc
 }
 
 type streamEvent struct {
@@ -95,21 +99,51 @@ func (c vendorCreds) hasCisco() bool {
 	return c.CiscoHost != "" && c.CiscoUser != "" && c.CiscoPass != ""
 }
 
-var phasePercents = map[string]float64{
+// Progress anchors for the phases that surround the engine's probes. The
+// probes themselves are spread evenly between probeFirstPercent and
+// probeLastPercent in execution order.
+var fixedPhasePercents = map[string]float64{
 	"idle":         0,
 	"starting":     5,
-	"netinfo":      12,
-	"l2-scan":      25,
-	"gateway":      38,
-	"dns":          52,
-	"wan":          68,
-	"traceroute":   80,
-	"mtu":          88,
 	"python-packs": 94,
 	"snmp":         97,
 	"finalizing":   99,
 	"finished":     100,
 	"error":        100,
+	"cancelled":    100,
+}
+
+const (
+	probeFirstPercent = 12
+	probeLastPercent  = 90
+)
+
+var phasePercents, probePhases = buildPhases()
+
+// Phase describes a probe phase for the web UI progress display.
+type Phase struct {
+	Name    string  `json:"name"`
+	Label   string  `json:"label"`
+	Percent float64 `json:"percent"`
+}
+
+func buildPhases() (map[string]float64, []Phase) {
+	percents := make(map[string]float64, len(fixedPhasePercents))
+	for name, pct := range fixedPhasePercents {
+		percents[name] = pct
+	}
+	registered := engine.Probes()
+	phases := make([]Phase, 0, len(registered))
+	for i, p := range registered {
+		pct := float64(probeFirstPercent)
+		if len(registered) > 1 {
+			pct += float64(probeLastPercent-probeFirstPercent) * float64(i) / float64(len(registered)-1)
+		}
+		pct = math.Round(pct)
+		percents[p.Name()] = pct
+		phases = append(phases, Phase{Name: p.Name(), Label: p.Title(), Percent: pct})
+	}
+	return percents, phases
 }
 
 func NewServer(runner RunFunc) (*Server, error) {
@@ -132,7 +166,9 @@ func NewServer(runner RunFunc) (*Server, error) {
 	mux.HandleFunc("/", srv.handleIndex)
 	mux.Handle("/static/", http.StripPrefix("/static/", srv.files))
 	mux.HandleFunc("/api/start", srv.handleStart)
+	mux.HandleFunc("/api/cancel", srv.handleCancel)
 	mux.HandleFunc("/api/status", srv.handleStatus)
+	mux.HandleFunc("/api/phases", srv.handlePhases)
 	mux.HandleFunc("/api/results", srv.handleResults)
 	mux.HandleFunc("/api/bundle", srv.handleBundle)
 	mux.HandleFunc("/api/vendor", srv.handleVendor)
@@ -183,6 +219,7 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "run already in progress", http.StatusConflict)
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	s.state.running = true
 	s.state.phase = "starting"
 	s.state.percent = 5
@@ -190,18 +227,39 @@ func (s *Server) handleStart(w http.ResponseWriter, r *http.Request) {
 	s.state.results = nil
 	s.state.log = nil
 	s.state.historyID = ""
+	s.state.cancel = cancel
 	s.mu.Unlock()
 
 	s.recordPhase("starting", "Starting diagnostics…", true)
 	s.recordStep("Starting diagnostics…")
 
-	go s.execute(req)
+	go s.execute(ctx, cancel, req)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "started"})
 }
 
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	cancel := s.state.cancel
+	s.mu.Unlock()
+	if cancel == nil {
+		http.Error(w, "no run in progress", http.StatusConflict)
+		return
+	}
+	cancel()
+	s.recordStep("Cancelling run…")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"status": "cancelling"})
+}
+
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -218,6 +276,15 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
+func (s *Server) handlePhases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(probePhases)
+}
+
 func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -228,7 +295,7 @@ func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
 	phase := s.state.phase
 	historyID := s.state.historyID
 	s.mu.Unlock()
-	if res == nil || phase != "finished" {
+	if res == nil || (phase != "finished" && phase != "cancelled") {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -313,7 +380,7 @@ func (s *Server) handleBundle(w http.ResponseWriter, r *http.Request) {
 	res := s.state.results
 	phase := s.state.phase
 	s.mu.Unlock()
-	if res == nil || phase != "finished" {
+	if res == nil || (phase != "finished" && phase != "cancelled") {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
@@ -370,30 +437,35 @@ func (s *Server) handleVendor(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no vendor credentials provided", http.StatusBadRequest)
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
 	s.state.running = true
 	s.state.phase = "python-packs"
 	if pct, ok := phasePercents["python-packs"]; ok {
 		s.state.percent = pct
 	}
 	s.state.message = "Running vendor checks…"
+	s.state.cancel = cancel
 	s.mu.Unlock()
 
 	s.recordPhase("python-packs", "Running vendor checks…", false)
 	s.recordStep("Running vendor checks…")
 
-	go s.executeVendor(creds, suggestions)
+	go s.executeVendor(ctx, cancel, creds, suggestions)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(map[string]string{"status": "vendor-running"})
 }
 
-func (s *Server) execute(req RunRequest) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+func (s *Server) execute(ctx context.Context, cancel context.CancelFunc, req RunRequest) {
 	defer cancel()
 	progress := &progressEmitter{server: s}
 	res, err := s.runner(ctx, req, progress)
 
+	if errors.Is(ctx.Err(), context.Canceled) {
+		s.finishCancelled(res)
+		return
+	}
 	if err != nil {
 		s.mu.Lock()
 		s.state.phase = "error"
@@ -402,6 +474,7 @@ func (s *Server) execute(req RunRequest) {
 		s.state.running = false
 		s.state.results = nil
 		s.state.historyID = ""
+		s.state.cancel = nil
 		s.mu.Unlock()
 		s.recordPhase("error", err.Error(), false)
 		s.recordStep(fmt.Sprintf("Run failed: %s", err.Error()))
@@ -425,13 +498,47 @@ func (s *Server) execute(req RunRequest) {
 	s.state.results = &resCopy
 	s.state.baseFindings = append([]report.Finding(nil), resCopy.Findings...)
 	s.state.historyID = historyID
+	s.state.cancel = nil
 	s.mu.Unlock()
 	s.recordPhase("finished", "Diagnostics complete", false)
 	s.recordStep("Diagnostics complete.")
 	s.recordDone("finished", "Diagnostics complete")
 }
 
-func (s *Server) executeVendor(creds vendorCreds, suggestions []string) {
+// finishCancelled records a run stopped through /api/cancel. Whatever the
+// probes gathered before they were stopped is kept and saved to history,
+// flagged as partial.
+func (s *Server) finishCancelled(res report.Results) {
+	resCopy := res
+	resCopy.Partial = true
+	if resCopy.When.IsZero() {
+		resCopy.When = time.Now()
+	}
+	historyID := ""
+	if s.hist != nil {
+		if id, saveErr := s.hist.Save(resCopy); saveErr != nil {
+			s.recordStep(fmt.Sprintf("⚠️ Unable to store run history: %v", saveErr))
+		} else {
+			historyID = id
+		}
+	}
+	s.mu.Lock()
+	s.state.phase = "cancelled"
+	s.state.percent = 100
+	s.state.message = "Run cancelled"
+	s.state.running = false
+	s.state.results = &resCopy
+	s.state.baseFindings = append([]report.Finding(nil), resCopy.Findings...)
+	s.state.historyID = historyID
+	s.state.cancel = nil
+	s.mu.Unlock()
+	s.recordPhase("cancelled", "Run cancelled", false)
+	s.recordStep("Run cancelled; partial results saved.")
+	s.recordDone("cancelled", "Run cancelled")
+}
+
+func (s *Server) executeVendor(ctx context.Context, cancel context.CancelFunc, creds vendorCreds, suggestions []string) {
+	defer cancel()
 	pythonPath := defaultPythonPath()
 	shouldRunForti := containsString(suggestions, "fortigate") && creds.hasForti()
 	shouldRunCisco := containsString(suggestions, "cisco_ios") && creds.hasCisco()
@@ -456,7 +563,7 @@ func (s *Server) executeVendor(creds vendorCreds, suggestions []string) {
 			},
 		}
 		parserPath := filepath.Join("packs", "python", "fortigate", "parser.py")
-		out, err := sshx.RunPythonPack(pythonPath, parserPath, payload)
+		out, err := sshx.RunPythonPack(ctx, pythonPath, parserPath, payload)
 		if err != nil {
 			msg := fmt.Sprintf("FortiGate vendor pack error: %v", err)
 			s.recordStep(msg)
@@ -488,7 +595,7 @@ func (s *Server) executeVendor(creds vendorCreds, suggestions []string) {
 			payload["port"] = creds.CiscoPort
 		}
 		parserPath := filepath.Join("packs", "python", "cisco_ios", "parser.py")
-		out, err := sshx.RunPythonPack(pythonPath, parserPath, payload)
+		out, err := sshx.RunPythonPack(ctx, pythonPath, parserPath, payload)
 		if err != nil {
 			msg := fmt.Sprintf("Cisco IOS vendor pack error: %v", err)
 			s.recordStep(msg)
@@ -547,10 +654,15 @@ func (s *Server) executeVendor(creds vendorCreds, suggestions []string) {
 		updatedCopy = resCopy
 		haveUpdated = true
 	}
+	doneMsg := "Vendor checks complete"
+	if errors.Is(ctx.Err(), context.Canceled) {
+		doneMsg = "Vendor checks cancelled"
+	}
 	s.state.running = false
 	s.state.phase = "finished"
 	s.state.percent = 100
-	s.state.message = "Vendor checks complete"
+	s.state.message = doneMsg
+	s.state.cancel = nil
 	historyID = s.state.historyID
 	s.mu.Unlock()
 
@@ -560,9 +672,9 @@ func (s *Server) executeVendor(creds vendorCreds, suggestions []string) {
 		}
 	}
 
-	s.recordPhase("finished", "Vendor checks complete", false)
-	s.recordStep("Vendor checks complete.")
-	s.recordDone("finished", "Vendor checks complete")
+	s.recordPhase("finished", doneMsg, false)
+	s.recordStep(doneMsg + ".")
+	s.recordDone("finished", doneMsg)
 }
 
 func containsString(list []string, target string) bool {
@@ -7,6 +7,7 @@
         const statusMessage = document.getElementById('status-message');
         const resultsEl = document.getElementById('results');
         const startError = document.getElementById('start-error');
+        const cancelRunBtn = document.getElementById('cancel-run');
         const consoleEl = document.getElementById('console');
         const progressBar = document.getElementById('progress-bar');
         const lanCard = document.getElementById('lan-card');
@@ -19,6 +20,53 @@
         const wanAvg = document.getElementById('wan-avg');
         const wanP95 = document.getElementById('wan-p95');
         const wanJitter = document.getElementById('wan-jitter');
+        const ipv6Card = document.getElementById('ipv6-card');
+        const ipv6Gateway = document.getElementById('ipv6-gateway');
+        const ipv6Dest = document.getElementById('ipv6-dest');
+        const ipv6Avg = document.getElementById('ipv6-avg');
+        const ipv6P95 = document.getElementById('ipv6-p95');
+        const ipv6Jitter = document.getElementById('ipv6-jitter');
+        const ipv6Loss = document.getElementById('ipv6-loss');
+        const ipv6Mtu = document.getElementById('ipv6-mtu');
+        const wifiCard = document.getElementById('wifi-card');
+        const wifiSsid = document.getElementById('wifi-ssid');
+        const wifiChannel = document.getElementById('wifi-channel');
+        const wifiSignal = document.getElementById('wifi-signal');
+        const wifiBitrate = document.getElementById('wifi-bitrate');
+        const wifiRetries = document.getElementById('wifi-retries');
+        const wifiBusy = document.getElementById('wifi-busy');
+        const lldpCard = document.getElementById('lldp-card');
+        const lldpIface = document.getElementById('lldp-iface');
+        const lldpEmpty = document.getElementById('lldp-empty');
+        const lldpBody = document.getElementById('lldp-body');
+        const dhcpCard = document.getElementById('dhcp-card');
+        const dhcpIface = document.getElementById('dhcp-iface');
+        const dhcpEmpty = document.getElementById('dhcp-empty');
+        const dhcpBody = document.getElementById('dhcp-body');
+        const nicCard = document.getElementById('nic-card');
+        const nicBody = document.getElementById('nic-body');
+        const targetsCard = document.getElementById('targets-card');
+        const targetsBody = document.getElementById('targets-body');
+        const appsCard = document.getElementById('apps-card');
+        const appsBody = document.getElementById('apps-body');
+        const loadCard = document.getElementById('load-card');
+        const loadEndpoint = document.getElementById('load-endpoint');
+        const loadIdle = document.getElementById('load-idle');
+        const loadDownload = document.getElementById('load-download');
+        const loadUpload = document.getElementById('load-upload');
+        const loadGrade = document.getElementById('load-grade');
+        const voiceCard = document.getElementById('voice-card');
+        const voiceEndpoint = document.getElementById('voice-endpoint');
+        const voiceMos = document.getElementById('voice-mos');
+        const voiceLoss = document.getElementById('voice-loss');
+        const voiceJitter = document.getElementById('voice-jitter');
+        const voiceRtt = document.getElementById('voice-rtt');
+        const dnsCard = document.getElementById('dns-card');
+        const dnsBody = document.getElementById('dns-body');
+        const dnsMismatches = document.getElementById('dns-mismatches');
+        const dnsTamperCard = document.getElementById('dns-tamper-card');
+        const dnsTamperSummary = document.getElementById('dns-tamper-summary');
+        const dnsTamperList = document.getElementById('dns-tamper-list');
         const devicesCard = document.getElementById('devices-card');
         const devicesBody = document.getElementById('devices-body');
         const vendorCard = document.getElementById('vendor-card');
@@ -65,25 +113,22 @@
         const troubleshooterStatus = document.getElementById('troubleshooter-status');
         const troubleshooterError = document.getElementById('troubleshooter-error');
 
+        // Probe phases are filled in from /api/phases so new probes get a
+        // label without touching the UI.
         const PHASE_LABELS = {
                 idle: 'Idle',
                 starting: 'Starting',
-                netinfo: 'Network info',
-                'l2-scan': 'Layer-2 scan',
-                gateway: 'Gateway checks',
-                dns: 'DNS lookups',
-                wan: 'WAN ping',
-                traceroute: 'Traceroute',
-                mtu: 'MTU probe',
                 'python-packs': 'Vendor packs',
                 snmp: 'SNMP',
                 finalizing: 'Finalizing',
                 finished: 'Finished',
                 error: 'Error',
+                cancelled: 'Cancelled',
         };
+        const IDLE_PHASES = new Set(['idle', 'finished', 'error', 'cancelled']);
 
         const consoleCard = consoleEl ? consoleEl.closest('.card') : null;
-        const highlightableCards = [lanCard, wanCard, devicesCard, compareCard, consoleCard].filter(Boolean);
+        const highlightableCards = [lanCard, wifiCard, nicCard, wanCard, ipv6Card, targetsCard, appsCard, loadCard, voiceCard, dnsCard, dnsTamperCard, devicesCard, compareCard, consoleCard].filter(Boolean);
         const troubleshooterButtons = [troubleshooterLanBtn, troubleshooterWanBtn].filter(Boolean);
 
         const TROUBLESHOOTER_DEFAULT_STATUS = 'Pick a guided path above to run a focused check.';
@@ -142,6 +187,25 @@
                 };
         }
 
+        async function loadPhases() {
+                try {
+                        const resp = await fetch('/api/phases');
+                        if (!resp.ok) {
+                                throw new Error('Phases request failed');
+                        }
+                        const phases = await resp.json();
+                        if (Array.isArray(phases)) {
+                                phases.forEach((phase) => {
+                                        if (phase && phase.name) {
+                                                PHASE_LABELS[phase.name] = phase.label || phase.name;
+                                        }
+                                });
+                        }
+                } catch (err) {
+                        console.error(err);
+                }
+        }
+
         async function updateStatus() {
                 try {
                         const resp = await fetch('/api/status');
@@ -197,7 +261,18 @@
                         }
                 }
                 populatePerformanceCards(data);
-                populateDevicesTable(data && Array.isArray(data.discovered) ? data.discovered : null);
+                populateWifiCard(data ? data.wireless : null);
+                populateLLDPCard(data ? data.lldp : null);
+                populateDHCPCard(data ? data.dhcp : null);
+                populateNICTable(data && Array.isArray(data.nic_counters) ? data.nic_counters : null);
+                populateIPv6Card(data ? data.ipv6 : null);
+                populateTargetsTable(data && Array.isArray(data.targets) ? data.targets : null);
+                populateAppsTable(data && Array.isArray(data.apps) ? data.apps : null);
+                populateLoadCard(data ? data.bufferbloat : null);
+                populateVoiceCard(data ? data.voice : null);
+                populateResolversTable(data);
+                populateTamperCard(data ? data.dns_tamper : null);
+                populateDevicesTable(data && Array.isArray(data.discovered) ? data.discovered : null, data && Array.isArray(data.l2_changes) ? data.l2_changes : null);
                 populateVendorCard(data);
                 if (typeof allowBundle === 'boolean') {
                         setBundleAvailability(allowBundle);
@@ -269,7 +344,9 @@
                         if (entry.classification && entry.classification.trim() !== '') {
                                 const classificationSpan = document.createElement('span');
                                 classificationSpan.className = 'history-run-classification';
-                                classificationSpan.textContent = entry.classification.trim();
+                                classificationSpan.textContent = entry.partial
+                                        ? `${entry.classification.trim()} (partial)`
+                                        : entry.classification.trim();
                                 selectBtn.appendChild(classificationSpan);
                         }
 
@@ -553,6 +630,26 @@
                 return value;
         }
 
+        // formatMtu adds the likely encapsulation, a black-hole warning and the
+        // MSS to clamp to after a reduced path MTU.
+        function formatMtu(mtu) {
+                const value = extractMtuValue(mtu);
+                if (!Number.isFinite(value)) {
+                        return '—';
+                }
+                const notes = [];
+                if (mtu.encapsulation) {
+                        notes.push(mtu.encapsulation);
+                }
+                if (mtu.limit === 'blackhole') {
+                        notes.push('black hole');
+                }
+                if (value < 1500 && mtu.mss) {
+                        notes.push(`MSS ${mtu.mss}`);
+                }
+                return notes.length > 0 ? `${value} bytes (${notes.join(', ')})` : `${value} bytes`;
+        }
+
         function formatDelta(current, reference, formatValue, formatDiff) {
                 if (!Number.isFinite(current)) {
                         return '—';
@@ -647,9 +744,9 @@
                         return;
                 }
                 const targets = mode === 'lan'
-                        ? [lanCard, devicesCard, consoleCard]
+                        ? [lanCard, wifiCard, nicCard, devicesCard, consoleCard]
                         : mode === 'wan'
-                                ? [wanCard, compareCard, consoleCard]
+                                ? [wanCard, ipv6Card, targetsCard, appsCard, loadCard, voiceCard, dnsCard, dnsTamperCard, compareCard, consoleCard]
                                 : [];
                 for (const card of targets) {
                         if (card) {
@@ -678,6 +775,8 @@
                                 setTroubleshooterStatus(config.completeMessage || 'Focused diagnostics finished.');
                         } else if (status === 'error') {
                                 setTroubleshooterStatus('Focused diagnostics failed. Review the console for details.');
+                        } else if (status === 'cancelled') {
+                                setTroubleshooterStatus('Focused diagnostics cancelled. Partial results are shown below.');
                         } else {
                                 setTroubleshooterStatus(config.statusMessage || TROUBLESHOOTER_DEFAULT_STATUS);
                         }
@@ -831,6 +930,30 @@
         function applyPhase(phase) {
                 const label = PHASE_LABELS[phase] || phase || 'unknown';
                 statusPhase.textContent = label;
+                if (cancelRunBtn) {
+                        cancelRunBtn.hidden = IDLE_PHASES.has(phase);
+                }
+        }
+
+        async function cancelRun() {
+                if (!cancelRunBtn) {
+                        return;
+                }
+                cancelRunBtn.disabled = true;
+                try {
+                        const resp = await fetch('/api/cancel', { method: 'POST' });
+                        if (!resp.ok && resp.status !== 409) {
+                                throw new Error('Cancel request failed');
+                        }
+                } catch (err) {
+                        console.error(err);
+                } finally {
+                        cancelRunBtn.disabled = false;
+                }
+        }
+
+        if (cancelRunBtn) {
+                cancelRunBtn.addEventListener('click', cancelRun);
         }
 
         function setProgress(value) {
@@ -916,11 +1039,22 @@
                 if (data.message) {
                         statusMessage.textContent = data.message;
                 }
-                if (data.status === 'finished') {
+                if (data.status === 'finished' || data.status === 'cancelled') {
                         await loadResults();
                 } else if (data.status === 'error') {
                         resultsEl.textContent = '(Run failed)';
                         populatePerformanceCards(null);
+                        populateWifiCard(null);
+                        populateLLDPCard(null);
+                        populateDHCPCard(null);
+                        populateNICTable(null);
+                        populateIPv6Card(null);
+                        populateTargetsTable(null);
+                        populateAppsTable(null);
+                        populateLoadCard(null);
+                        populateVoiceCard(null);
+                        populateResolversTable(null);
+                        populateTamperCard(null);
                         populateDevicesTable(null);
                         setBundleAvailability(false);
                 }
@@ -1030,6 +1164,457 @@
                 }
         }
 
+        function populateWifiCard(wifi) {
+                if (!wifiCard) {
+                        return;
+                }
+                if (!wifi) {
+                        wifiCard.hidden = true;
+                        return;
+                }
+                if (wifiSsid) {
+                        wifiSsid.textContent = wifi.ssid ? `${wifi.ssid} (${wifi.iface})` : wifi.iface || '(unknown)';
+                }
+                if (wifiChannel) {
+                        wifiChannel.textContent = wifi.channel ? `${wifi.channel} (${wifi.band})` : '—';
+                }
+                if (wifiSignal) {
+                        wifiSignal.textContent = Number.isFinite(wifi.signal_dbm) && wifi.signal_dbm < 0 ? `${wifi.signal_dbm} dBm` : '—';
+                }
+                if (wifiBitrate) {
+                        wifiBitrate.textContent = Number.isFinite(wifi.tx_bitrate_mbps) && wifi.tx_bitrate_mbps > 0 ? `${wifi.tx_bitrate_mbps} Mbit/s` : '—';
+                }
+                if (wifiRetries) {
+                        wifiRetries.textContent = wifi.tx_packets > 0 ? formatPercentValue(wifi.retry_rate * 100) : '—';
+                }
+                if (wifiBusy) {
+                        wifiBusy.textContent = Number.isFinite(wifi.channel_busy) && wifi.channel_busy > 0 ? formatPercentValue(wifi.channel_busy * 100) : '—';
+                }
+                wifiCard.hidden = false;
+        }
+
+        function populateLLDPCard(lldp) {
+                if (!lldpCard || !lldpBody) {
+                        return;
+                }
+                lldpBody.innerHTML = '';
+                if (!lldp) {
+                        lldpCard.hidden = true;
+                        return;
+                }
+                const neighbors = Array.isArray(lldp.neighbors) ? lldp.neighbors.filter(Boolean) : [];
+                if (lldpIface) {
+                        lldpIface.textContent = lldp.iface || '—';
+                }
+                if (lldpEmpty) {
+                        lldpEmpty.hidden = neighbors.length > 0;
+                }
+                for (const n of neighbors) {
+                        let port = n.port_id || '';
+                        if (n.port_description && n.port_description !== port) {
+                                port = port ? `${port} (${n.port_description})` : n.port_description;
+                        }
+                        let vlan = n.vlan ? String(n.vlan) : '';
+                        if (n.voice_vlan) {
+                                vlan = `${vlan} (voice ${n.voice_vlan})`.trim();
+                        }
+                        const cells = [
+                                (n.protocol || '').toUpperCase() || '—',
+                                n.system_name || n.chassis_id || '—',
+                                port || '—',
+                                vlan || '—',
+                                Array.isArray(n.mgmt_addrs) && n.mgmt_addrs.length > 0 ? n.mgmt_addrs.join(', ') : '—',
+                                formatPoE(n.poe),
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 2 || index === 4) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        lldpBody.appendChild(row);
+                }
+                lldpCard.hidden = false;
+        }
+
+        function populateDHCPCard(dhcp) {
+                if (!dhcpCard || !dhcpBody) {
+                        return;
+                }
+                dhcpBody.innerHTML = '';
+                if (!dhcp) {
+                        dhcpCard.hidden = true;
+                        return;
+                }
+                const offers = Array.isArray(dhcp.offers) ? dhcp.offers.filter(Boolean) : [];
+                if (dhcpIface) {
+                        dhcpIface.textContent = dhcp.iface || '—';
+                }
+                if (dhcpEmpty) {
+                        dhcpEmpty.hidden = offers.length > 0;
+                }
+                for (const o of offers) {
+                        let server = o.server_id || o.from || '—';
+                        if (o.server_vendor) {
+                                server = `${server} (${o.server_vendor})`;
+                        }
+                        let router = Array.isArray(o.routers) && o.routers.length > 0 ? o.routers.join(', ') : '—';
+                        if (o.gateway_mismatch) {
+                                router = `${router} (not the current gateway)`;
+                        }
+                        let dns = Array.isArray(o.dns) && o.dns.length > 0 ? o.dns.join(', ') : '—';
+                        if (o.dns_mismatch) {
+                                dns = `${dns} (not the current DNS)`;
+                        }
+                        const cells = [
+                                server,
+                                o.subnet_mask ? `${o.offered_ip} / ${o.subnet_mask}` : o.offered_ip || '—',
+                                router,
+                                dns,
+                                o.lease_s > 0 ? `${o.lease_s} s` : '—',
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 1) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        dhcpBody.appendChild(row);
+                }
+                dhcpCard.hidden = false;
+        }
+
+        function formatPoE(poe) {
+                if (!poe) {
+                        return '—';
+                }
+                const parts = [];
+                if (!poe.supported) {
+                        parts.push('not supported');
+                } else if (!poe.enabled) {
+                        parts.push('disabled');
+                }
+                if (Number.isFinite(poe.class)) {
+                        parts.push(`class ${poe.class}`);
+                }
+                if (poe.allocated_w > 0) {
+                        parts.push(`${poe.allocated_w.toFixed(1)} W allocated`);
+                }
+                if (poe.requested_w > 0) {
+                        parts.push(`${poe.requested_w.toFixed(1)} W requested`);
+                }
+                return parts.length > 0 ? parts.join(', ') : 'enabled';
+        }
+
+        function populateNICTable(counters) {
+                if (!nicCard || !nicBody) {
+                        return;
+                }
+                nicBody.innerHTML = '';
+                const list = Array.isArray(counters) ? counters.filter(Boolean) : [];
+                if (list.length === 0) {
+                        nicCard.hidden = true;
+                        return;
+                }
+                for (const counter of list) {
+                        const delta = counter.delta || {};
+                        const cells = [
+                                counter.name || '—',
+                                String(counter.errors || 0),
+                                String(delta.rx_crc_errors || 0),
+                                String(delta.tx_carrier_errors || 0),
+                                String(delta.collisions || 0),
+                                String(counter.drops || 0),
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 0) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        nicBody.appendChild(row);
+                }
+                nicCard.hidden = false;
+        }
+
+        function populateIPv6Card(ipv6) {
+                if (!ipv6Card) {
+                        return;
+                }
+                const addrs = ipv6 && Array.isArray(ipv6.addrs) ? ipv6.addrs : [];
+                if (!ipv6 || (!ipv6.gateway && addrs.length === 0)) {
+                        ipv6Card.hidden = true;
+                        return;
+                }
+                const ping = ipv6.target && ipv6.ping ? ipv6.ping : {};
+                if (ipv6Gateway) {
+                        ipv6Gateway.textContent = ipv6.gateway || '(none)';
+                }
+                if (ipv6Dest) {
+                        ipv6Dest.textContent = ipv6.target || '(not checked)';
+                }
+                if (ipv6Avg) {
+                        ipv6Avg.textContent = formatMs(ping.avg_ms);
+                }
+                if (ipv6P95) {
+                        ipv6P95.textContent = formatMs(ping.p95_ms);
+                }
+                if (ipv6Jitter) {
+                        ipv6Jitter.textContent = formatMs(ping.jitter_ms);
+                }
+                if (ipv6Loss) {
+                        ipv6Loss.textContent = Number.isFinite(ping.loss) ? formatPercentValue(ping.loss * 100) : '—';
+                }
+                if (ipv6Mtu) {
+                        ipv6Mtu.textContent = formatMtu(ipv6.mtu);
+                }
+                ipv6Card.hidden = false;
+        }
+
+        function populateTargetsTable(targets) {
+                if (!targetsCard || !targetsBody) {
+                        return;
+                }
+                targetsBody.innerHTML = '';
+                const list = Array.isArray(targets) ? targets.filter(Boolean) : [];
+                if (list.length === 0) {
+                        targetsCard.hidden = true;
+                        return;
+                }
+                for (const target of list) {
+                        const ping = target.ping || {};
+                        const hops = target.trace && Array.isArray(target.trace.hops) ? target.trace.hops.length : 0;
+                        const cells = [
+                                target.name || target.host || '—',
+                                target.host || '—',
+                                formatMs(ping.avg_ms),
+                                formatMs(ping.p95_ms),
+                                Number.isFinite(ping.loss) ? formatPercentValue(ping.loss * 100) : '—',
+                                formatMs(ping.jitter_ms),
+                                formatMtu(target.mtu),
+                                hops > 0 ? String(hops) : '—',
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 1) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        targetsBody.appendChild(row);
+                }
+                targetsCard.hidden = false;
+        }
+
+        function populateAppsTable(apps) {
+                if (!appsCard || !appsBody) {
+                        return;
+                }
+                appsBody.innerHTML = '';
+                const list = Array.isArray(apps) ? apps.filter(Boolean) : [];
+                if (list.length === 0) {
+                        appsCard.hidden = true;
+                        return;
+                }
+                for (const app of list) {
+                        let result = 'connected';
+                        if (app.error) {
+                                result = app.error;
+                        } else if (app.status) {
+                                result = `HTTP ${app.status}`;
+                        }
+                        const cells = [
+                                app.target || '—',
+                                result,
+                                formatMs(app.dns_ms),
+                                formatMs(app.connect_ms),
+                                app.tls_version ? formatMs(app.tls_ms) : '—',
+                                app.status ? formatMs(app.ttfb_ms) : '—',
+                                formatMs(app.total_ms),
+                                app.cert_expiry ? String(app.cert_expiry).slice(0, 10) : '—',
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 0) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        appsBody.appendChild(row);
+                }
+                appsCard.hidden = false;
+        }
+
+        function formatLoadPhase(phase) {
+                if (!phase) {
+                        return '—';
+                }
+                if (phase.error) {
+                        return phase.error;
+                }
+                const mbps = Number.isFinite(phase.mbps) ? `${phase.mbps.toFixed(1)} Mbit/s` : '—';
+                if (!Number.isFinite(phase.increase_ms)) {
+                        return mbps;
+                }
+                return `${mbps} · +${formatMs(phase.increase_ms)}`;
+        }
+
+        function populateLoadCard(load) {
+                if (!loadCard) {
+                        return;
+                }
+                if (!load) {
+                        loadCard.hidden = true;
+                        return;
+                }
+                if (loadEndpoint) {
+                        loadEndpoint.textContent = load.mode ? `${load.endpoint} (${load.mode})` : load.endpoint || '—';
+                }
+                const idle = load.idle || {};
+                if (loadIdle) {
+                        loadIdle.textContent = load.error ? '—' : formatMs(idle.avg_ms);
+                }
+                if (loadDownload) {
+                        loadDownload.textContent = load.error ? '—' : formatLoadPhase(load.download);
+                }
+                if (loadUpload) {
+                        loadUpload.textContent = load.error ? '—' : formatLoadPhase(load.upload);
+                }
+                if (loadGrade) {
+                        loadGrade.textContent = load.error || load.grade || '—';
+                }
+                loadCard.hidden = false;
+        }
+
+        function populateVoiceCard(voice) {
+                if (!voiceCard) {
+                        return;
+                }
+                if (!voice) {
+                        voiceCard.hidden = true;
+                        return;
+                }
+                if (voiceEndpoint) {
+                        voiceEndpoint.textContent = voice.endpoint || '—';
+                }
+                const measured = !voice.error;
+                if (voiceMos) {
+                        voiceMos.textContent = measured && Number.isFinite(voice.mos)
+                                ? `${voice.mos.toFixed(2)}${voice.quality ? ` (${voice.quality})` : ''}`
+                                : voice.error || '—';
+                }
+                if (voiceLoss) {
+                        voiceLoss.textContent = measured && Number.isFinite(voice.loss) ? formatPercentValue(voice.loss * 100) : '—';
+                }
+                if (voiceJitter) {
+                        voiceJitter.textContent = measured ? formatMs(voice.jitter_ms) : '—';
+                }
+                if (voiceRtt) {
+                        voiceRtt.textContent = measured ? formatMs(voice.avg_ms) : '—';
+                }
+                voiceCard.hidden = false;
+        }
+
+        function populateResolversTable(data) {
+                if (!dnsCard || !dnsBody) {
+                        return;
+                }
+                dnsBody.innerHTML = '';
+                if (dnsMismatches) {
+                        dnsMismatches.innerHTML = '';
+                        dnsMismatches.hidden = true;
+                }
+                const list = data && Array.isArray(data.resolvers) ? data.resolvers.filter(Boolean) : [];
+                if (list.length === 0) {
+                        dnsCard.hidden = true;
+                        return;
+                }
+                for (const r of list) {
+                        const total = Array.isArray(r.queries) ? r.queries.length : 0;
+                        const answered = (r.failed || 0) < total;
+                        const cells = [
+                                r.system ? `${r.server} (system)` : (r.server || '—'),
+                                r.transport || '—',
+                                `${r.ok || 0}/${total}`,
+                                String(r.nxdomain || 0),
+                                `${r.servfail || 0} / ${r.refused || 0}`,
+                                String(r.failed || 0),
+                                answered ? formatMs(r.avg_ms) : '—',
+                        ];
+                        const row = document.createElement('tr');
+                        cells.forEach((text, index) => {
+                                const cell = document.createElement('td');
+                                cell.textContent = text;
+                                if (index === 0) {
+                                        cell.classList.add('mono');
+                                }
+                                row.appendChild(cell);
+                        });
+                        dnsBody.appendChild(row);
+                }
+                const mismatches = Array.isArray(data.dns_mismatches) ? data.dns_mismatches.filter(Boolean) : [];
+                if (dnsMismatches && mismatches.length > 0) {
+                        for (const m of mismatches) {
+                                const item = document.createElement('li');
+                                item.textContent = `${m.name} ${m.type}: ${m.detail}`;
+                                dnsMismatches.appendChild(item);
+                        }
+                        dnsMismatches.hidden = false;
+                }
+                dnsCard.hidden = false;
+        }
+
+        function populateTamperCard(tamper) {
+                if (!dnsTamperCard || !dnsTamperList) {
+                        return;
+                }
+                dnsTamperList.innerHTML = '';
+                dnsTamperList.hidden = true;
+                if (!tamper) {
+                        dnsTamperCard.hidden = true;
+                        return;
+                }
+                const items = [];
+                for (const r of Array.isArray(tamper.nx_redirects) ? tamper.nx_redirects : []) {
+                        items.push(`${r.server} answered the nonexistent name ${r.name} with ${(r.answers || []).join(', ')}`);
+                }
+                for (const r of Array.isArray(tamper.rewrites) ? tamper.rewrites : []) {
+                        items.push(`${r.server} answered ${r.name} with ${(r.answers || []).join(', ')}: ${r.reason}`);
+                }
+                for (const i of Array.isArray(tamper.interceptions) ? tamper.interceptions : []) {
+                        items.push(i.detail);
+                }
+                if (dnsTamperSummary) {
+                        if (items.length > 0) {
+                                dnsTamperSummary.textContent = `Compared with ${tamper.reference}:`;
+                        } else if (tamper.reference_ok) {
+                                dnsTamperSummary.textContent = `No signs of tampering; answers match ${tamper.reference}.`;
+                        } else {
+                                dnsTamperSummary.textContent = `${tamper.reference} did not answer, so answers were not compared.`;
+                        }
+                }
+                for (const text of items) {
+                        const item = document.createElement('li');
+                        item.textContent = text;
+                        dnsTamperList.appendChild(item);
+                }
+                dnsTamperList.hidden = items.length === 0;
+                dnsTamperCard.hidden = false;
+        }
+
         function clearDevicesTable() {
                 if (!devicesCard) {
                         return;
@@ -1040,12 +1625,36 @@
                 }
         }
 
-        function populateDevicesTable(hosts) {
+        function formatHostSource(host) {
+                switch (host.source) {
+                case 'arp':
+                        return Number.isFinite(host.rtt_ms) ? `ARP reply (${formatMs(host.rtt_ms)})` : 'ARP reply';
+                case 'arp-passive':
+                        return 'Overheard ARP';
+                case 'arp-cache':
+                        return 'ARP cache';
+                case 'ndp':
+                        return 'Neighbour cache';
+                default:
+                        return '—';
+                }
+        }
+
+        function formatHostLabel(host) {
+                const label = host.model || host.vendor || '';
+                if (!host.kind) {
+                        return label || '—';
+                }
+                return label ? `${label} (${host.kind})` : host.kind;
+        }
+
+        function populateDevicesTable(hosts, changes) {
                 if (!devicesCard || !devicesBody) {
                         return;
                 }
                 devicesBody.innerHTML = '';
                 const list = Array.isArray(hosts) ? hosts.filter(Boolean) : [];
+                const changeList = Array.isArray(changes) ? changes.filter(Boolean) : [];
                 if (list.length === 0) {
                         devicesCard.hidden = true;
                         return;
@@ -1067,19 +1676,47 @@
                         row.appendChild(ifaceCell);
 
                         const ipCell = document.createElement('td');
-                        ipCell.textContent = host.ip || '—';
+                        ipCell.textContent = host.ip ? `${host.ip}${host.router ? ' (router)' : ''}${host.gateway ? ' (gateway)' : ''}` : '—';
                         ipCell.classList.add('mono');
                         row.appendChild(ipCell);
 
+                        const hostnameCell = document.createElement('td');
+                        hostnameCell.textContent = host.hostname || '—';
+                        row.appendChild(hostnameCell);
+
                         const macCell = document.createElement('td');
                         const macText = typeof host.mac === 'string' ? host.mac.toUpperCase() : '—';
                         macCell.textContent = macText || '—';
                         macCell.classList.add('mono');
                         row.appendChild(macCell);
 
-                        const vendorCell = document.createElement('td');
-                        vendorCell.textContent = host.vendor || '—';
-                        row.appendChild(vendorCell);
+                        const deviceCell = document.createElement('td');
+                        deviceCell.textContent = formatHostLabel(host);
+                        row.appendChild(deviceCell);
+
+                        const sourceCell = document.createElement('td');
+                        sourceCell.textContent = formatHostSource(host);
+                        row.appendChild(sourceCell);
+
+                        const notes = [];
+                        if (Array.isArray(host.conflict_macs) && host.conflict_macs.length > 0) {
+                                notes.push(`also answered by ${host.conflict_macs.map((mac) => String(mac).toUpperCase()).join(', ')}`);
+                        }
+                        if (host.gratuitous) {
+                                notes.push('gratuitous ARP');
+                        }
+                        for (const change of changeList) {
+                                if (change.ip === host.ip) {
+                                        const vendor = change.before_vendor ? ` (${change.before_vendor})` : '';
+                                        notes.push(`was ${String(change.before_mac || '').toUpperCase()}${vendor} in run ${change.run || '—'}`);
+                                }
+                        }
+                        if (Array.isArray(host.services) && host.services.length > 0) {
+                                notes.push(`advertises ${host.services.join(', ')}`);
+                        }
+                        const notesCell = document.createElement('td');
+                        notesCell.textContent = notes.length > 0 ? notes.join('; ') : '—';
+                        row.appendChild(notesCell);
 
                         devicesBody.appendChild(row);
                 }
@@ -1157,6 +1794,12 @@
                         } else {
                                 li.textContent = message || '(no details)';
                         }
+                        if (typeof item.remediation === 'string' && item.remediation.trim() !== '') {
+                                const fix = document.createElement('div');
+                                fix.className = 'finding-fix';
+                                fix.textContent = item.remediation.trim();
+                                li.appendChild(fix);
+                        }
                         container.appendChild(li);
                 }
                 container.hidden = false;
@@ -1438,7 +2081,7 @@
         }
 
         ensureStream();
-        updateStatus();
+        loadPhases().then(updateStatus);
         loadResults();
         setBundleAvailability(false);
 })();